@@ -2,88 +2,140 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"database/sql"
-	"encoding/xml"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
-	"github.com/chromedp/chromedp"
 	"github.com/mattn/go-sqlite3"
-	_ "github.com/mattn/go-sqlite3"
-	"golang.org/x/net/context"
+	"golang.org/x/sync/errgroup"
 )
 
+// Defaults for the settings loadEnv reads from the environment.
 const (
-	folderPath  = "./product"
-	dbFileName  = "products.db"
-	datasetGUID = "guid"
-	authToken   = "token"
-	maxWorkers  = 5
-	maxRetries  = 5
+	defaultFolderPath  = "./product"
+	defaultDBFileName  = "products.db"
+	defaultDatasetGUID = "guid"
+	defaultBaseURL     = "https://b2b.my-buddy.ai"
 )
 
+const (
+	defaultWorkers = 5
+	maxRetries     = 5
+
+	specificationSelector = `.react-tabs__tab-panel`
+	categorySelector      = `.breadcrumb-item:last-child`
+)
+
+// RSS is a decoded product feed; parseFeed returns it.
 type RSS struct {
 	Channel Channel `xml:"channel"`
 }
 
+// Channel holds the feed's items in feed order. Malformed lists the items
+// skipped because they failed to parse or validate.
 type Channel struct {
-	Items []Item `xml:"item"`
+	Items     []Item      `xml:"item"`
+	Malformed []ItemError `xml:"-"`
 }
 
 type Item struct {
-	ID           string  `xml:"id"`
-	Title        string  `xml:"title"`
-	Description  string  `xml:"description"`
-	Price        float64 `xml:"price"`
-	Link         string  `xml:"link"`
-	ImageLink    string  `xml:"image_link"`
-	Brand        string  `xml:"brand"`
-	MPN          string  `xml:"mpn"`
-	GTIN         string  `xml:"gtin"`
-	Availability string  `xml:"availability"`
-	Condition    string  `xml:"condition"`
-	Inventory    int     `xml:"inventory"`
+	ID           string       `xml:"id"`
+	Title        string       `xml:"title"`
+	Description  string       `xml:"description"`
+	Price        Money        `xml:"price"`
+	Link         string       `xml:"link"`
+	ImageLink    string       `xml:"image_link"`
+	Brand        string       `xml:"brand"`
+	MPN          string       `xml:"mpn"`
+	GTIN         string       `xml:"gtin"`
+	Availability Availability `xml:"availability"`
+	Condition    string       `xml:"condition"`
+	Inventory    int          `xml:"inventory"`
+	ProductType  string       `xml:"product_type"`
+	ItemGroupID  string       `xml:"item_group_id"`
+	Size         string       `xml:"size"`
+	Color        string       `xml:"color"`
+
+	// Extra holds feed elements without a dedicated field, e.g. a custom group-by element.
+	Extra []xmlField `xml:",any"`
+
+	// Variants and PriceMax are set when several feed items are grouped into one product.
+	Variants []Variant `xml:"-"`
+	PriceMax Money     `xml:"-"`
+}
+
+// createDocumentResponse is the part of the create_by_file response we use.
+// Batch addresses the indexing-status endpoint.
+type createDocumentResponse struct {
+	Document struct {
+		ID string `json:"id"`
+	} `json:"document"`
+	Batch string `json:"batch"`
 }
 
 type Product struct {
 	UniqueCode string
-	Price      float64
+	Price      Money
 	MPN        string
 	Status     string
+	Scope      string
+	Source     string
+	FeedID     string
+	DocumentID string
 }
 
-var dbMutex sync.Mutex
-
-// fileExists checks if a file exists at the given path.
-func fileExists(filePath string) bool {
-	_, err := os.Stat(filePath)
-	if err == nil {
-		return true // File exists
+// uploadFile sends a POST request to upload a file to the run's dataset target
+// and returns the ID of the document it created.
+func uploadFile(ctx context.Context, cfg *Config, filePath string) (string, error) {
+	if cfg.DryRun {
+		infof("Dry run: would upload %s as a new document", filePath)
+		return "", nil
 	}
-	if os.IsNotExist(err) {
-		return false // File does not exist
+	url := fmt.Sprintf("%s/v1/datasets/%s/document/create_by_file", cfg.BaseURL, cfg.Target.DatasetGUID)
+	return sendDocumentFile(ctx, cfg, url, filePath)
+}
+
+// updateFile replaces the content of an existing document with a file and
+// returns the document's ID.
+func updateFile(ctx context.Context, cfg *Config, documentID, filePath string) (string, error) {
+	if cfg.DryRun {
+		infof("Dry run: would upload %s as a new version of document %s", filePath, documentID)
+		return "", nil
 	}
-	return false // Some other error occurred
+	url := fmt.Sprintf("%s/v1/datasets/%s/documents/%s/update_by_file", cfg.BaseURL, cfg.Target.DatasetGUID, documentID)
+	return sendDocumentFile(ctx, cfg, url, filePath)
 }
 
-// uploadFile sends a POST request to upload a file to a remote server.
-// uploadFile sends a POST request to upload a file to a remote server.
-func uploadFile(filePath string) error {
-	url := fmt.Sprintf("https://b2b.my-buddy.ai/v1/datasets/%s/document/create_by_file", datasetGUID)
-	payload := `{"indexing_technique":"high_quality","process_rule":{"rules":{"pre_processing_rules":[{"id":"remove_extra_spaces","enabled":true},{"id":"remove_urls_emails","enabled":false}],"segmentation":{"separator":"###","max_tokens":1000}},"mode":"custom"}}`
+// sendDocumentFile posts filePath with the target's upload payload to url, a
+// create or update endpoint, and returns the ID of the resulting document.
+func sendDocumentFile(ctx context.Context, cfg *Config, url, filePath string) (string, error) {
+	payload, err := cfg.Target.uploadPayload(cfg.Source)
+	if err != nil {
+		return "", err
+	}
 
 	file, err := os.Open(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to open file %s: %v", filePath, err)
+		return "", fmt.Errorf("failed to open file %s: %v", filePath, err)
 	}
 	defer file.Close()
 
@@ -91,383 +143,1389 @@ func uploadFile(filePath string) error {
 	writer := multipart.NewWriter(body)
 	part, err := writer.CreateFormFile("file", filepath.Base(file.Name()))
 	if err != nil {
-		return fmt.Errorf("failed to create form file: %v", err)
+		return "", fmt.Errorf("failed to create form file: %v", err)
 	}
 
 	_, err = io.Copy(part, file)
 	if err != nil {
-		return fmt.Errorf("failed to copy file content: %v", err)
+		return "", fmt.Errorf("failed to copy file content: %v", err)
 	}
 
 	err = writer.WriteField("data", payload)
 	if err != nil {
-		return fmt.Errorf("failed to write payload data: %v", err)
+		return "", fmt.Errorf("failed to write payload data: %v", err)
 	}
 
 	err = writer.Close()
 	if err != nil {
-		return fmt.Errorf("failed to close writer: %v", err)
+		return "", fmt.Errorf("failed to close writer: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", url, body)
-	if err != nil {
-		return fmt.Errorf("failed to create upload request: %v", err)
+	if err := uploadRateLimiter.Wait(ctx); err != nil {
+		return "", err
 	}
-
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", authToken))
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	start := time.Now()
+	resp, err := sendBody(ctx, cfg, "POST", url, body.Bytes(), writer.FormDataContentType())
+	metrics.ObserveDuration(metricUploadDuration, time.Since(start))
 	if err != nil {
-		return fmt.Errorf("failed to execute upload request: %v", err)
+		metrics.IncCounter(metricUploadFailures)
+		return "", fmt.Errorf("failed to execute upload request: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		metrics.IncCounter(metricUploadFailures)
 		bodyBytes, _ := ioutil.ReadAll(resp.Body)
-		return fmt.Errorf("failed to upload file: %d - %s", resp.StatusCode, string(bodyBytes))
+		return "", fmt.Errorf("failed to upload file: %d - %s", resp.StatusCode, string(bodyBytes))
 	}
 
-	fmt.Printf("File %s uploaded successfully\n", filePath)
-	return nil
-}
+	var created createDocumentResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("failed to decode upload response: %v", err)
+	}
 
-// markAllRecordsAsDeleted updates the status of all records to "deleted".
-func markAllRecordsAsDeleted(db *sql.DB) error {
-	updateQuery := `UPDATE products SET status = 'deleted'`
-	_, err := db.Exec(updateQuery)
-	return err
+	if cfg.WaitIndexing {
+		recordUploadBatch(created.Document.ID, created.Batch)
+	}
+	metrics.IncCounter(metricUploads)
+	slog.Debug("Uploaded document", "file", filePath, "document_id", created.Document.ID, "duration", time.Since(start))
+	return created.Document.ID, nil
 }
 
 // fetchSpecification uses Chrome to fetch additional details from a URL.
-func fetchSpecification(url string) (map[string]string, error) {
-	ctx, cancel := chromedp.NewContext(context.Background())
-	defer cancel()
+// productID names the debug screenshot taken when the scrape comes back empty.
+// The page is scraped on the shared scraper pool; cancelling ctx aborts it.
+func fetchSpecification(ctx context.Context, cfg *Config, productID, url string) (map[string]string, error) {
+	// A HEAD probe is far cheaper than a browser; skip the scrape when the
+	// page's ETag and Last-Modified match the cached scrape.
+	validators, err := fetchPageValidators(ctx, url)
+	if err != nil {
+		validators = pageValidators{}
+	}
+	if cached, ok := specCache.Lookup(cfg.FeedID, productID, url, validators); ok {
+		metrics.IncCounter(metricScrapeSkipped)
+		return cached, nil
+	}
 
-	// Set a higher timeout
-	ctx, cancel = context.WithTimeout(ctx, 20*time.Second)
-	defer cancel()
+	if cfg.PreferJSONLD {
+		data, ok, err := fetchJSONLDSpecification(ctx, url)
+		if err != nil {
+			warnf("JSON-LD extraction failed for %s, falling back to the browser: %v", url, err)
+		}
+		if ok {
+			metrics.IncCounter(metricScrapeJSONLD)
+			if err := specCache.Store(cfg.FeedID, productID, url, validators, data); err != nil {
+				warnf("Failed to cache specification for %s: %v", productID, err)
+			}
+			return data, nil
+		}
+	}
 
-	var specContent, category string
-	err := chromedp.Run(ctx,
-		chromedp.Navigate(url),
-		chromedp.Text(`.react-tabs__tab-panel`, &specContent),
-		chromedp.Text(`.breadcrumb-item:last-child`, &category),
-	)
+	start := time.Now()
+	data, err := fetchWithRetry(ctx, cfg, productID, url)
+	metrics.ObserveDuration(metricScrapeDuration, time.Since(start))
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch specification: %v", err)
+		metrics.IncCounter(metricScrapeFailures)
+		return nil, err
 	}
 
-	data := map[string]string{
-		"specification": specContent,
-		"category":      category,
+	if strings.TrimSpace(data["specification"]) != "" && strings.TrimSpace(data["category"]) != "" {
+		if err := specCache.Store(cfg.FeedID, productID, url, validators, data); err != nil {
+			warnf("Failed to cache specification for %s: %v", productID, err)
+		}
 	}
 
 	return data, nil
 }
 
-// initializeDB initializes the SQLite database with WAL mode and busy timeout.
-func initializeDB() (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL", dbFileName))
+// scrapeRetryDelay is the wait before the first scrape retry; each further
+// retry waits one more multiple of it.
+const scrapeRetryDelay = time.Second
+
+// fetchWithRetry scrapes url, navigating again in a new tab up to
+// cfg.ScrapeRetries times when the page failed to load or its selectors never
+// became visible. Timeouts and cancellation are not retried.
+func fetchWithRetry(ctx context.Context, cfg *Config, productID, url string) (map[string]string, error) {
+	for attempt := 0; ; attempt++ {
+		data, err := scrapers.Fetch(ctx, productID, url)
+		if err == nil || attempt >= cfg.ScrapeRetries || ctx.Err() != nil ||
+			!errors.Is(err, errNavigationFailed) && !errors.Is(err, errSelectorNotVisible) {
+			return data, err
+		}
+
+		wait := time.Duration(attempt+1) * scrapeRetryDelay
+		debugf("Scrape of %s failed: %v; retrying in %s", url, err, wait)
+		metrics.IncCounter(metricScrapeRetries)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// initializeDB initializes the SQLite database with WAL mode and busy timeout,
+// applying pragmas to every connection.
+func initializeDB(path string, pragmas map[string]string) (*sql.DB, error) {
+	dbPragmas = pragmaStatements(pragmas)
+	db, err := sql.Open(sqliteDriverName, fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL", path))
 	if err != nil {
 		return nil, err
 	}
+	if err := reportPragmas(db, pragmas); err != nil {
+		db.Close()
+		return nil, err
+	}
 	return db, nil
 }
 
-// executeWithRetry retries a database operation in case of SQLITE_BUSY or SQLITE_LOCKED errors.
-func executeWithRetry(db *sql.DB, query string, args ...interface{}) error {
-	var err error
-	for i := 0; i < maxRetries; i++ {
-		_, err = db.Exec(query, args...)
-		if err == nil {
-			return nil
-		}
+// execWithRetry executes a write statement, retrying in case of SQLITE_BUSY or
+// SQLITE_LOCKED errors. Writes normally reach it through the dbWriter.
+func execWithRetry(db *sql.DB, query string, args ...interface{}) (sql.Result, error) {
+	if dryRun {
+		debugf("Dry run: skipped %s statement", statementVerb(query))
+		return driver.ResultNoRows, nil
+	}
+	var result sql.Result
+	err := dbRetryPolicy.Do(func() (bool, error) {
+		var err error
+		result, err = db.Exec(query, args...)
 		if sqliteErr, ok := err.(sqlite3.Error); ok && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked) {
-			time.Sleep(time.Duration(i+1) * time.Millisecond * 100) // Exponential backoff
-			continue
+			return true, err
 		}
-		return err
-	}
-	return fmt.Errorf("query failed after %d retries: %w", maxRetries, err)
+		return false, err
+	})
+	return result, err
+}
+
+// storedProduct is the stored state of a product that worker compares the feed against.
+type storedProduct struct {
+	Price         Money
+	Status        string
+	FormatVersion int
+	DocumentID    string
+	ContentHash   string
 }
 
-// productExists checks if a product with the same unique code already exists in the database.
-func productExists(db *sql.DB, uniqueCode string) (bool, float64, error) {
-	var price float64
-	query := `SELECT price FROM products WHERE unique_code = ? LIMIT 1`
-	err := db.QueryRow(query, uniqueCode).Scan(&price)
+// productExists checks if a product of feed feedID with the same unique code
+// already exists in the database and returns its stored state.
+func productExists(db *sql.DB, feedID, uniqueCode string) (bool, storedProduct, error) {
+	var stored storedProduct
+	query := `SELECT price_cents, status, format_version, document_id, content_hash FROM products WHERE feed_id = ? AND unique_code = ? LIMIT 1`
+	err := db.QueryRow(query, feedID, uniqueCode).Scan(&stored.Price, &stored.Status, &stored.FormatVersion, &stored.DocumentID, &stored.ContentHash)
 	if err == sql.ErrNoRows {
-		return false, 0, nil
+		return false, stored, nil
 	}
 	if err != nil {
-		return false, 0, err
+		return false, stored, err
 	}
-	return true, price, nil
+	return true, stored, nil
 }
 
-// deleteFile sends a DELETE request to remove a document from a remote server
-func deleteFile(documentID string) error {
-	url := fmt.Sprintf("https://b2b.my-buddy.ai/v1/datasets/%s/documents/%s", datasetGUID, documentID)
+// deleteFile sends a DELETE request to remove a document from the run's dataset
+// target. A document that is already gone (404) counts as deleted; any other
+// non-2xx response is returned as an error, so callers keep their record of
+// the document and can try again.
+func deleteFile(ctx context.Context, cfg *Config, documentID string) error {
+	if cfg.DryRun {
+		infof("Dry run: would delete document ID %s", documentID)
+		return nil
+	}
+	url := fmt.Sprintf("%s/v1/datasets/%s/documents/%s", cfg.BaseURL, cfg.Target.DatasetGUID, documentID)
 
-	req, err := http.NewRequest("DELETE", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create delete request: %v", err)
 	}
+	if err := uploadRateLimiter.Wait(ctx); err != nil {
+		return err
+	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", authToken))
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	start := time.Now()
+	resp, err := apiDo(req)
+	metrics.ObserveDuration(metricDeleteDuration, time.Since(start))
 	if err != nil {
+		metrics.IncCounter(metricDeleteFailures)
 		return fmt.Errorf("failed to execute delete request: %v", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNoContent {
-		fmt.Printf("Deleted document ID %s\n", documentID)
-	} else {
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		metrics.IncCounter(metricDeletes)
+		slog.Debug("Deleted document", "document_id", documentID, "duration", time.Since(start))
+	case resp.StatusCode == http.StatusNotFound:
+		metrics.IncCounter(metricDeletes)
+		debugf("Document %s was already deleted", documentID)
+	default:
+		metrics.IncCounter(metricDeleteFailures)
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		bodyString := string(bodyBytes)
-		fmt.Printf("Failed to delete document ID %s: %d - %s\n", documentID, resp.StatusCode, bodyString)
+		return fmt.Errorf("failed to delete document %s: %d - %s", documentID, resp.StatusCode, string(bodyBytes))
 	}
-
 	return nil
 }
 
-// insertProduct inserts a product into the SQLite database with retry logic.
-func insertProduct(db *sql.DB, product Product) error {
-	dbMutex.Lock()
-	defer dbMutex.Unlock()
+// deleteProductDocument deletes the remote document recorded for a product.
+// Products uploaded before document IDs were stored have none; there is
+// nothing known to delete for them.
+func deleteProductDocument(ctx context.Context, uniqueCode, documentID string) error {
+	if documentID == "" {
+		infof("No remote document ID recorded for %s; skipping delete", uniqueCode)
+		return nil
+	}
+	return documentSink.Delete(ctx, documentID)
+}
 
-	query := `INSERT INTO products (unique_code, price, mpn, status) VALUES (?, ?, ?, ?)`
-	return executeWithRetry(db, query, product.UniqueCode, product.Price, product.MPN, product.Status)
+// insertProduct inserts a product into the SQLite database through its writer.
+// A product that is already stored is overwritten.
+func insertProduct(db *sql.DB, product Product) error {
+	if dryRun {
+		infof("Dry run: would insert product %s at %s", product.UniqueCode, product.Price)
+		return nil
+	}
+	return writerFor(db).Insert(product)
 }
 
-// updateProductStatus updates a product's status in the database with retry logic.
-func updateProductStatus(db *sql.DB, uniqueCode string, status string, price float64) error {
-	dbMutex.Lock()
-	defer dbMutex.Unlock()
+// updateProductStatus updates the status, price and scope of a product of feed feedID through its writer.
+func updateProductStatus(db *sql.DB, uniqueCode string, status string, price Money, scope Scope, feedID string) error {
+	if dryRun {
+		infof("Dry run: would mark product %s as %s at %s", uniqueCode, status, price)
+		return nil
+	}
+	return writerFor(db).UpdateStatus(uniqueCode, status, price, scope, feedID)
+}
 
-	query := `UPDATE products SET status = ?, price = ? WHERE unique_code = ?`
-	return executeWithRetry(db, query, status, price, uniqueCode)
+// renderedDocument is the formatted document of a feed item.
+type renderedDocument struct {
+	// Item is the feed item after the item processors ran.
+	Item     Item
+	Content  string
+	Category string
+	// Scraped is false when the product page could not be scraped, so the
+	// document lacks the scraped fields.
+	Scraped bool
 }
 
-// processItem processes a single XML item, extracts data, fetches specifications, and uploads the formatted file
-func processItem(item Item) error {
+// renderItem scrapes the product page of item, when scraping is enabled, and
+// formats its document. A non-empty reason means the document must not be
+// uploaded: it fails the scrape policy, its scrape timed out under
+// -on-scrape-timeout skip, an item processor rejected it, or it is too short.
+func renderItem(ctx context.Context, cfg *Config, stats *SyncStats, item Item) (doc renderedDocument, reason string) {
 	itemDict := make(map[string]string)
-	var title, outputFilePath string
-
 	itemDict["id"] = item.ID
-	itemDict["price"] = fmt.Sprintf("%.2f", item.Price)
+	itemDict["price"] = item.Price.String()
 	itemDict["mpn"] = item.MPN
+	if cfg.SourceLine && cfg.Source != "" {
+		itemDict["source"] = cfg.Source
+	}
 
-	title = item.ID
-	outputFilePath = filepath.Join(folderPath, fmt.Sprintf("Prod_%s.txt", title))
+	// Without a browser the scrape policy cannot be met, so it only applies
+	// when scraping is enabled.
+	scraped := false
+	if cfg.ScrapingEnabled {
+		specData, err := fetchSpecification(ctx, cfg, item.ID, item.Link)
+		scraped = err == nil
+		if err != nil {
+			stats.add(&stats.ScrapeFailures)
+			warnf("Failed to fetch specification for %s: %v", item.Link, err)
+			if cfg.OnScrapeTimeout.skips(err) {
+				return doc, err.Error()
+			}
+		} else {
+			for key, value := range specData {
+				itemDict[key] = value
+			}
+		}
 
-	if fileExists(outputFilePath) {
-		return nil
+		if reason, ok := cfg.ScrapePolicy.check(itemDict); !ok {
+			return doc, reason
+		}
 	}
 
-	specData, err := fetchSpecification(item.Link)
+	if err := runItemProcessors(ctx, &item); err != nil {
+		return doc, err.Error()
+	}
+
+	content, err := formatItem(item, itemDict)
 	if err != nil {
-		fmt.Printf("Failed to fetch specification for %s: %v\n", item.Link, err)
+		return doc, err.Error()
+	}
+	if length := utf8.RuneCountInString(strings.TrimSpace(content)); length < cfg.MinContentLength {
+		return doc, fmt.Sprintf("document is %d characters, below the %d minimum", length, cfg.MinContentLength)
+	}
+	return renderedDocument{Item: item, Content: content, Category: itemDict["category"], Scraped: scraped}, ""
+}
+
+// uploadedDocument is what processItem uploaded for a product.
+type uploadedDocument struct {
+	DocumentID  string
+	ContentHash string
+	// ImagePath is the local copy of the product image; see fetchProductImage.
+	ImagePath string
+}
+
+// processItem renders a single feed item and uploads the formatted file as a new document, or as a new
+// version of documentID when it is set. rendered, when not nil, is the item already rendered by
+// contentChanged, which is uploaded as it is. It returns the uploaded document, which is empty in a dry run.
+func processItem(ctx context.Context, cfg *Config, stats *SyncStats, item Item, rendered *renderedDocument, documentID string) (uploadedDocument, error) {
+	title := item.ID
+	outputFilePath := filepath.Join(cfg.FolderPath, documentFileName(title))
+
+	var doc renderedDocument
+	if rendered != nil {
+		doc = *rendered
 	} else {
-		for key, value := range specData {
-			itemDict[key] = value
+		var reason string
+		doc, reason = renderItem(ctx, cfg, stats, item)
+		if reason != "" {
+			return uploadedDocument{}, deferItem(cfg.FeedID, item, reason)
 		}
 	}
-
-	var formattedItem strings.Builder
-	formattedItem.WriteString("[TITLE] ")
-	formattedItem.WriteString(item.Title + "\n")
-	formattedItem.WriteString("[Price] " + itemDict["price"] + "\n")
-	if category, ok := itemDict["category"]; ok {
-		formattedItem.WriteString("[Category] " + category + "\n")
+	item, content := doc.Item, doc.Content
+	if cfg.ValidateChunks {
+		segmenter.validateChunks(item.ID, content)
 	}
-	formattedItem.WriteString("[BRAND] " + item.Brand + "\n")
-	formattedItem.WriteString("\n[CONTENT] \n")
-
-	formattedItem.WriteString("[DESCRIPTION] " + item.Description + "\n")
-	formattedItem.WriteString("[LINK] " + item.Link + "\n")
-	formattedItem.WriteString("[IMAGE LINK] " + item.ImageLink + "\n")
-	formattedItem.WriteString("[AVAILABILITY] " + item.Availability + "\n")
-	formattedItem.WriteString("[GTIN] " + item.GTIN + "\n")
-	formattedItem.WriteString("[ID] " + item.ID + "\n")
-	formattedItem.WriteString("[SKU] " + item.MPN + "\n")
 
-	for key, value := range itemDict {
-		if key != "id" && key != "price" && key != "mpn" && key != "category" {
-			formattedItem.WriteString(fmt.Sprintf("[%s] %s\n", strings.Title(key), value))
+	if cfg.DryRun {
+		debugf("Dry run: document for %s:\n%s", item.ID, content)
+	} else {
+		err := writeGeneratedFile(outputFilePath, []byte(content), cfg.FileMode)
+		if err != nil {
+			warnf("Failed to write product file %s: %v", outputFilePath, err)
+			return uploadedDocument{}, fmt.Errorf("Failed to write product file %s: %v\n", outputFilePath, err)
 		}
 	}
 
-	err = ioutil.WriteFile(outputFilePath, []byte(formattedItem.String()), 0644)
+	if !uploadCap.reserve() {
+		return uploadedDocument{}, errUploadCapReached
+	}
+	var err error
+	if documentID != "" {
+		documentID, err = documentSink.Update(ctx, documentID, outputFilePath)
+	} else {
+		documentID, err = documentSink.Upload(ctx, outputFilePath)
+	}
 	if err != nil {
-		fmt.Printf("Failed to write product file %s: %v\n", outputFilePath, err)
-		return fmt.Errorf("Failed to write product file %s: %v\n", outputFilePath, err)
+		stats.add(&stats.UploadFailures)
+		warnf("Failed to upload product file %s: %v", outputFilePath, err)
+		return uploadedDocument{}, fmt.Errorf("Failed to upload product file %s: %v\n", outputFilePath, err)
+	}
+	if cfg.DryRun {
+		return uploadedDocument{}, nil
 	}
 
-	err = uploadFile(outputFilePath)
+	hash := contentHash(content)
+	imagePath := fetchProductImage(ctx, cfg, item)
+	err = manifest.Write(manifestEntry{
+		ID:          item.ID,
+		Price:       item.Price,
+		Brand:       item.Brand,
+		Category:    doc.Category,
+		DocumentID:  documentID,
+		ContentHash: hash,
+		UploadedAt:  time.Now().UTC(),
+	})
 	if err != nil {
-		fmt.Printf("Failed to upload product file %s: %v\n", outputFilePath, err)
-		return fmt.Errorf("Failed to upload product file %s: %v\n", outputFilePath, err)
+		warnf("Failed to write manifest entry for %s: %v", item.ID, err)
 	}
 
-	fmt.Printf("Processed and uploaded item with ID %s\n", title)
-	return nil
+	if err := retireLocalFile(cfg, outputFilePath); err != nil {
+		warnf("Failed to clean up product file: %v", err)
+	}
+
+	deadLetters.Resolve(cfg.FeedID, item.ID)
+	slog.Debug("Processed item", "product_id", item.ID, "title", title, "document_id", documentID)
+	return uploadedDocument{DocumentID: documentID, ContentHash: hash, ImagePath: imagePath}, nil
 }
 
-// downloadXML downloads XML from a given URL with authentication and saves it to a file.
-func downloadXML(url, username, password, outputPath string) error {
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
+// documentFormatVersion identifies the built-in document layout. Bump it whenever
+// defaultDocumentTemplate changes so existing documents get re-uploaded.
+const documentFormatVersion = 1
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create HTTP request: %v", err)
+// documentFileName is the local file name, and therefore the remote document
+// name, used for the product with the given unique code.
+func documentFileName(uniqueCode string) string {
+	return documentName(documentNameTemplate, uniqueCode) + ".txt"
+}
+
+// formatItem renders the document text uploaded for item with
+// documentTemplate. itemDict carries the feed fields plus anything scraped
+// from the product page.
+func formatItem(item Item, itemDict map[string]string) (string, error) {
+	var formattedItem strings.Builder
+	if err := documentTemplate.Execute(&formattedItem, newDocumentData(item, itemDict)); err != nil {
+		return "", fmt.Errorf("failed to render document: %v", err)
 	}
+	return formattedItem.String(), nil
+}
 
-	req.SetBasicAuth(username, password)
+// contentHash returns the hex SHA-256 of a generated document.
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to download XML: %v", err)
+// contentChanged reports whether the document item renders to differs from
+// the one last uploaded for the stored product, and returns the changed
+// document so it is uploaded without scraping the page again. A product
+// uploaded before content hashes were recorded only gets its hash recorded,
+// so the first run after the upgrade does not re-upload everything. A
+// document that cannot be rendered, or whose page could not be scraped,
+// counts as unchanged rather than replacing a complete document with a
+// degraded one.
+func contentChanged(ctx context.Context, db *sql.DB, cfg *Config, stats *SyncStats, item Item, stored storedProduct) (*renderedDocument, bool) {
+	doc, reason := renderItem(ctx, cfg, stats, item)
+	if reason != "" || !doc.Scraped {
+		return nil, false
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad response: %s", resp.Status)
+	hash := contentHash(doc.Content)
+	if stored.ContentHash == "" {
+		if err := setContentHash(db, cfg.FeedID, item.ID, hash); err != nil {
+			warnf("Failed to record content hash for %s: %v", item.ID, err)
+		}
+		return nil, false
+	}
+	if hash == stored.ContentHash {
+		return nil, false
 	}
+	return &doc, true
+}
 
-	outFile, err := os.Create(outputPath)
+// downloadXML downloads XML from a given URL with auth and saves it to a file.
+// Non-zero validators make the request conditional; errFeedNotModified is returned when
+// the feed still matches them. It returns the validators of the downloaded feed.
+func downloadXML(ctx context.Context, url string, auth FeedAuth, outputPath string, since pageValidators) (pageValidators, error) {
+	resp, err := openFeedURL(ctx, url, auth, since)
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %v", err)
+		return pageValidators{}, err
 	}
-	defer outFile.Close()
+	defer resp.Body.Close()
 
-	_, err = io.Copy(outFile, resp.Body)
+	if err := checkDiskSpace(resp.ContentLength, tempDirOrDefault(), filepath.Dir(outputPath)); err != nil {
+		return pageValidators{}, err
+	}
+	// A gzipped feed is decompressed as it downloads, so it is never on disk
+	// twice. The compressed size is what Content-Length counts.
+	body, closeBody, err := decompressFeed(&lengthCheckedReader{r: resp.Body, want: resp.ContentLength})
 	if err != nil {
-		return fmt.Errorf("failed to save XML to file: %v", err)
+		return pageValidators{}, err
+	}
+	defer closeBody()
+	if err := writeViaTemp(outputPath, body); err != nil {
+		return pageValidators{}, fmt.Errorf("failed to save XML to file: %v", err)
 	}
 
-	log.Printf("XML file downloaded successfully and saved to %s", outputPath)
-	return nil
+	infof("XML file downloaded successfully and saved to %s", outputPath)
+	return pageValidators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}, nil
 }
 
-// Other unchanged methods...
-
-func worker(db *sql.DB, wg *sync.WaitGroup, item Item, mutex *sync.Mutex) {
-	defer wg.Done()
+// openFeedURL requests the feed at url with auth, conditionally on since
+// when it is not zero. The caller closes the response body.
+func openFeedURL(ctx context.Context, url string, auth FeedAuth, since pageValidators) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %v", err)
+	}
 
-	mutex.Lock()
-	defer mutex.Unlock()
+	auth.apply(req)
+	if since.ETag != "" {
+		req.Header.Set("If-None-Match", since.ETag)
+	}
+	if since.LastModified != "" {
+		req.Header.Set("If-Modified-Since", since.LastModified)
+	}
 
-	exists, price, err := productExists(db, item.ID)
+	resp, err := httpDoWithRetry(feedClient, req)
 	if err != nil {
-		log.Printf("Error checking product existence: %v", err)
-		return
+		return nil, fmt.Errorf("failed to download XML: %v", err)
+	}
+	if resp.StatusCode == http.StatusNotModified && !since.IsZero() {
+		resp.Body.Close()
+		return nil, errFeedNotModified
 	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("bad response: %s", resp.Status)
+	}
+	return resp, nil
+}
 
-	if exists {
-		if price == item.Price {
-			err = updateProductStatus(db, item.ID, "existing", item.Price)
+// worker syncs one feed item. It returns nil once the item is finished, an
+// error matching errDeferred or errUploadCapReached when it was put off, and
+// the failure otherwise. Workers run concurrently; their database writes are
+// serialized by the dbWriter.
+func worker(ctx context.Context, db *sql.DB, cfg *Config, stats *SyncStats, seen *idSet, item Item) error {
+	start := time.Now()
+	stats.add(&stats.Seen)
+	seen.Add(item.ID)
+
+	exists, stored, err := productExists(db, cfg.FeedID, item.ID)
+	if err != nil {
+		slog.Error("Error checking product existence", "product_id", item.ID, "error", err)
+		return fmt.Errorf("failed to look up %s: %v", item.ID, err)
+	}
+	price := stored.Price
+
+	var eventType, status string
+	if exists && stored.Status == "deleted" {
+		status = "restocked"
+		// Downstream, a product back in the feed is created again: it left
+		// the catalog when it was marked deleted.
+		eventType = eventProductCreated
+		// The product left the feed in an earlier run but its row and remote
+		// document were kept; bring the document back up to date in place.
+		stats.add(&stats.Restocked)
+		metrics.IncCounter(metricItemsProcessed, "status:restocked")
+		err = updateProductStatus(db, item.ID, "restocked", item.Price, cfg.Scope, cfg.FeedID)
+		if err == nil {
+			err = uploadItem(ctx, db, cfg, stats, item, nil, stored.DocumentID)
+		}
+	} else if exists && cfg.ForceReupload {
+		// Regenerated and replaced in place, as an update is: a failed upload
+		// leaves the old document, and document_id, intact.
+		status = "existing"
+		counter := &stats.Existing
+		if price != item.Price {
+			status = "updated"
+			counter = &stats.Updated
+			eventType = eventProductUpdated
+		}
+		stats.add(counter)
+		metrics.IncCounter(metricItemsProcessed, "status:"+status)
+		err = updateProductStatus(db, item.ID, status, item.Price, cfg.Scope, cfg.FeedID)
+		if err == nil {
+			err = uploadItem(ctx, db, cfg, stats, item, nil, stored.DocumentID)
+		}
+		if err == nil {
+			stats.add(&stats.Reuploaded)
+		}
+	} else if exists {
+		// Only an unchanged price needs the content compared; the document
+		// rendered for the comparison is the one uploaded.
+		var rendered *renderedDocument
+		changed := price != item.Price
+		if !changed {
+			rendered, changed = contentChanged(ctx, db, cfg, stats, item, stored)
+		}
+		if !changed {
+			status = "existing"
+			stats.add(&stats.Existing)
+			metrics.IncCounter(metricItemsProcessed, "status:existing")
+			err = updateProductStatus(db, item.ID, "existing", item.Price, cfg.Scope, cfg.FeedID)
+			if err == nil && deadLetters.Has(cfg.FeedID, item.ID) {
+				err = uploadItem(ctx, db, cfg, stats, item, nil, stored.DocumentID)
+			} else if err == nil && stored.FormatVersion < cfg.FormatVersion && formatMigrations.reserve() {
+				// The document was rendered by an older template; refresh it in place.
+				err = uploadItem(ctx, db, cfg, stats, item, nil, stored.DocumentID)
+				if err == nil {
+					stats.add(&stats.Migrated)
+				}
+			}
 		} else {
-			err = updateProductStatus(db, item.ID, "updated", item.Price)
-			err = deleteFile(item.ID)
+			status = "updated"
+			stats.add(&stats.Updated)
+			metrics.IncCounter(metricItemsProcessed, "status:updated")
+			eventType = eventProductUpdated
+			// The row already exists, so it is updated in place, and so is the
+			// document: a failed upload leaves the old version, and
+			// document_id, intact for the next run.
+			err = updateProductStatus(db, item.ID, "updated", item.Price, cfg.Scope, cfg.FeedID)
 			if err != nil {
-				log.Printf("Failed to delete document %s: %v", item.ID, err)
+				err = fmt.Errorf("failed to update %s: %v", item.ID, err)
 			}
-			product := Product{
-				UniqueCode: item.ID,
-				Price:      item.Price,
-				MPN:        item.MPN,
-				Status:     "new",
-			}
-			err = insertProduct(db, product)
 			if err == nil {
-				err = processItem(item)
+				err = uploadItem(ctx, db, cfg, stats, item, rendered, stored.DocumentID)
 			}
 		}
 	} else {
+		status = "new"
+		stats.add(&stats.New)
+		metrics.IncCounter(metricItemsProcessed, "status:new")
+		eventType = eventProductCreated
 		product := Product{
 			UniqueCode: item.ID,
 			Price:      item.Price,
 			MPN:        item.MPN,
 			Status:     "new",
+			Scope:      cfg.Scope.String(),
+			Source:     cfg.Source,
+			FeedID:     cfg.FeedID,
 		}
 		err = insertProduct(db, product)
 		if err == nil {
-			err = processItem(item)
+			err = uploadItem(ctx, db, cfg, stats, item, nil, "")
 		}
 	}
 
+	// Only a finished sync is recorded: a failed write, a deferred upload or
+	// a cancelled item leaves the product to be synced again.
+	if err == nil && !dryRun {
+		if exists && price != item.Price {
+			if err := recordPriceChange(db, cfg.FeedID, item.ID, price, item.Price); err != nil {
+				warnf("Failed to record price change for %s: %v", item.ID, err)
+			}
+		}
+		recordHistory(db, cfg.FeedID, item.ID, exists, stored, status, item.Price)
+	}
+
+	if errors.Is(err, errDeferred) {
+		stats.add(&stats.Deferred)
+		slog.Debug("Deferred product", "product_id", item.ID, "status", status, "duration", time.Since(start))
+		return err
+	}
+	if errors.Is(err, errUploadCapReached) {
+		stats.add(&stats.Capped)
+		return err
+	}
+	if err != nil && ctx.Err() != nil {
+		// Aborted by shutdown or -max-failures rather than failed; it is
+		// redone by the next run.
+		slog.Debug("Cancelled product", "product_id", item.ID, "status", status, "duration", time.Since(start), "error", err)
+		return err
+	}
 	if err != nil {
-		log.Printf("Failed to process item: %v", err)
+		stats.add(&stats.Failed)
+		metrics.IncCounter(metricItemFailures)
+		slog.Error("Failed to process item", "product_id", item.ID, "status", status, "duration", time.Since(start), "error", err)
+		return err
+	}
+	slog.Debug("Synced product", "product_id", item.ID, "status", status, "duration", time.Since(start))
+	if eventType != "" {
+		publishEvent(newProductEvent(eventType, item, cfg.Source))
 	}
+	return nil
 }
 
-func processXMLData(db *sql.DB, xmlPath string) error {
+// loadFeedItems parses the feed at xmlPath and applies the configured
+// transforms and variant grouping. Malformed items are skipped and returned
+// as ItemErrors.
+func loadFeedItems(cfg *Config, xmlPath string) ([]Item, []ItemError, error) {
 	xmlFile, err := os.Open(xmlPath)
 	if err != nil {
-		return fmt.Errorf("failed to open XML file: %v", err)
+		return nil, nil, fmt.Errorf("failed to open XML file: %v", err)
 	}
 	defer xmlFile.Close()
+	return parseFeedItems(cfg, xmlFile)
+}
 
-	byteValue, _ := ioutil.ReadAll(xmlFile)
-
-	var rss RSS
-	err = xml.Unmarshal(byteValue, &rss)
+// parseFeedItems parses a feed from r with parseFeed and applies the
+// configured transforms and variant grouping. Malformed items are skipped and
+// returned as ItemErrors. It does no file I/O and starts no workers, so any
+// reader, such as a strings.Reader holding a fixture, can be parsed; the
+// whole-file and streaming paths both go through decodeFeedItems.
+func parseFeedItems(cfg *Config, r io.Reader) ([]Item, []ItemError, error) {
+	feed, err := parseFeed(r)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal XML: %v", err)
+		return nil, nil, err
+	}
+	items, malformed := feed.Channel.Items, feed.Channel.Malformed
+
+	normalizeItems(items, cfg.Transforms)
+	seen := newIDSet()
+	kept := items[:0]
+	for _, item := range items {
+		if !duplicateItem(seen, item) && !skipOutOfStock(cfg, item) {
+			kept = append(kept, item)
+		}
+	}
+	items = kept
+	if cfg.GroupBy != "" {
+		items = groupVariants(items, cfg.GroupBy)
 	}
+	return items, malformed, nil
+}
 
-	var wg sync.WaitGroup
-	mutex := &sync.Mutex{}
-	sem := make(chan struct{}, maxWorkers)
+// processXMLData syncs every parsed feed item, starting at item startIndex
+// when resuming a checkpointed run of the feed identified by feedHash.
+// malformed lists the items skipped while parsing; it is returned in the
+// stats.
+func processXMLData(ctx context.Context, db *sql.DB, cfg *Config, items []Item, malformed []ItemError, feedHash string, startIndex int) (*SyncStats, error) {
+	started := time.Now()
+	var err error
+	if sampling(cfg) {
+		total := len(items)
+		items = sampleItems(items, cfg.SampleRate, cfg.SampleSeed)
+		infof("Sampled %d of %d feed items (rate %v, seed %d); reconcile is disabled", len(items), total, cfg.SampleRate, cfg.SampleSeed)
+	}
+	sortItems(items, cfg.SortBy)
 
-	for _, item := range rss.Channel.Items {
-		sem <- struct{}{}
-		wg.Add(1)
-		go func(item Item) {
-			defer func() { <-sem }()
-			worker(db, &wg, item, mutex)
-		}(item)
+	if cfg.BootstrapRemote {
+		if err := bootstrapFromRemote(ctx, db, cfg, items); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkPriceSwings(db, cfg, sliceFeed(items, nil)); err != nil {
+		return nil, err
 	}
 
-	wg.Wait()
+	if startIndex > len(items) {
+		startIndex = len(items)
+	}
+	if startIndex > 0 {
+		infof("Resuming at item %d of %d", startIndex, len(items))
+	}
 
-	return nil
+	// Deleting before or during the upload pass needs the stale set up front,
+	// so it is diffed against the parsed feed; otherwise it is diffed against
+	// the IDs the workers actually saw.
+	var stale []string
+	if cfg.ReconcileMode == ReconcileBefore || cfg.ReconcileMode == ReconcileInterleaved {
+		ids := feedIDs(cfg, items)
+		addMalformedIDs(ids, malformed)
+		stale, err = staleProducts(db, cfg, ids)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return dispatchFeed(ctx, db, cfg, sliceFeed(items, malformed), feedHash, startIndex, stale, started)
+}
+
+// sliceFeed returns an itemFeed yielding items, which reports malformed as
+// the items it skipped.
+func sliceFeed(items []Item, malformed []ItemError) itemFeed {
+	return func(yield func(Item) error) ([]ItemError, error) {
+		for _, item := range items {
+			if err := yield(item); err != nil {
+				return malformed, err
+			}
+		}
+		return malformed, nil
+	}
+}
+
+// dispatchFeed hands the items feed yields to the upload workers, starting at
+// item startIndex, then reconciles the products missing from the feed. stale
+// lists the products to delete before or during the pass; with
+// ReconcileAfter they are found once the feed has been read. feed blocks
+// while every worker is busy, so a streamed feed is read no faster than it is
+// uploaded. The stats' Duration is measured from started.
+func dispatchFeed(ctx context.Context, db *sql.DB, cfg *Config, feed itemFeed, feedHash string, startIndex int, stale []string, started time.Time) (*SyncStats, error) {
+	var err error
+	seen := newIDSet()
+	stats := &SyncStats{}
+	checkpoint := newCheckpointTracker(db, feedHash, startIndex, cfg.CheckpointEvery)
+	// The pool's context is cancelled when the run is interrupted or once
+	// -max-failures items have failed, which stops dispatching and aborts the
+	// items in flight.
+	pool, poolCtx := errgroup.WithContext(ctx)
+	pool.SetLimit(cfg.Workers)
+	failures := newFailureLimit(cfg.MaxFailures)
+	deletes := newDeletePool(cfg.DeleteConcurrency)
+	deleteStale := func(uniqueCode string) {
+		deletes.submit(func() { reconcileProduct(ctx, db, cfg, stats, uniqueCode) })
+	}
+
+	if cfg.ReconcileMode == ReconcileBefore {
+		for _, code := range stale {
+			deleteStale(code)
+		}
+		deletes.wait()
+	}
+
+	nextStale := 0
+	next, capped := 0, -1
+	malformed, feedErr := feed(func(item Item) error {
+		index := next
+		next++
+		switch {
+		case index < startIndex || capped >= 0:
+			// Items before a resume checkpoint were handled by the interrupted
+			// run, and those after the upload cap are still present; keep
+			// reconcile from treating either as removed.
+			if cfg.Scope.Matches(item) {
+				seen.Add(item.ID)
+			}
+			return nil
+		case !cfg.Scope.Matches(item):
+			checkpoint.complete(index)
+			return nil
+		case activeRun.completed(item.ID):
+			// Synced by the interrupted run being resumed.
+			stats.add(&stats.Resumed)
+			seen.Add(item.ID)
+			checkpoint.complete(index)
+			return nil
+		case feedWatermark.unmodified(item):
+			stats.add(&stats.NotModified)
+			seen.Add(item.ID)
+			checkpoint.complete(index)
+			return nil
+		case poolCtx.Err() != nil:
+			return poolCtx.Err()
+		case uploadCap.reached():
+			capped = index
+			seen.Add(item.ID)
+			return nil
+		}
+		pool.Go(func() error {
+			err := worker(poolCtx, db, cfg, stats, seen, item)
+			if err == nil {
+				activeRun.markDone(item.ID)
+			} else {
+				feedWatermark.failed(item)
+			}
+			// An item cut short by shutdown is redone on resume.
+			if poolCtx.Err() == nil {
+				checkpoint.complete(index)
+			}
+			// An item aborted by the pool's cancellation did not fail itself.
+			if err == nil || errors.Is(err, errDeferred) || errors.Is(err, errUploadCapReached) || poolCtx.Err() != nil {
+				return nil
+			}
+			stats.addFailure(ItemError{Index: index, ID: item.ID, Reason: err.Error()})
+			return failures.record()
+		})
+		if cfg.ReconcileMode == ReconcileInterleaved && nextStale < len(stale) {
+			deleteStale(stale[nextStale])
+			nextStale++
+		}
+		return nil
+	})
+	stats.Malformed = malformed
+	addMalformedIDs(seen, malformed)
+	if capped >= 0 {
+		infof("Upload cap of %d reached; stopped dispatching at item %d of %d", uploadCap.max, capped, next)
+	}
+	if cfg.ReconcileMode == ReconcileInterleaved && feedErr == nil {
+		for ; nextStale < len(stale); nextStale++ {
+			deleteStale(stale[nextStale])
+		}
+	}
+	poolErr := pool.Wait()
+	deletes.wait()
+	if err := ctx.Err(); err != nil {
+		// The feed pass is incomplete, so nothing may be treated as removed.
+		checkpoint.save()
+		return nil, fmt.Errorf("sync interrupted: %v", err)
+	}
+	if poolErr != nil {
+		// As above; the error lists the item failures that stopped the run.
+		checkpoint.save()
+		return nil, errors.Join(poolErr, stats.failureErrors())
+	}
+	if feedErr != nil {
+		// As above, a feed that could not be read to the end removes nothing.
+		checkpoint.save()
+		return nil, feedErr
+	}
+
+	if cfg.ReconcileMode == ReconcileAfter {
+		stale, err = staleProducts(db, cfg, seen)
+		if err != nil {
+			return nil, err
+		}
+		for _, code := range stale {
+			deleteStale(code)
+		}
+		deletes.wait()
+	}
+	if len(stale) > 0 {
+		elapsed := deletes.elapsed()
+		summaryf("Reconciled %d stale products (%d deleted, %d failed) in %s\n",
+			len(stale), stats.Deleted, stats.DeleteFailures, elapsed.Round(time.Millisecond))
+		if elapsed > 0 {
+			summaryf("Delete throughput: %.1f products/s\n", float64(len(stale))/elapsed.Seconds())
+		}
+	}
+
+	if !sampling(cfg) {
+		marked, err := markUnseenAsDeleted(db, cfg, seen)
+		if err != nil {
+			return nil, err
+		}
+		stats.MarkedDeleted = int64(marked)
+		if marked > 0 && !cfg.DryRun {
+			summaryf("Marked %d products missing from the feed as deleted\n", marked)
+		}
+
+		if err := clearCheckpoint(db); err != nil {
+			warnf("Failed to clear checkpoint: %v", err)
+		}
+		activeRun.finish()
+		// Items after the upload cap were not synced, so the watermark
+		// cannot move past them.
+		if capped < 0 {
+			feedWatermark.save(db)
+		}
+	}
+	metrics.SetGauge(metricLastRunItems, float64(next))
+	stats.Duration = time.Since(started)
+
+	return stats, nil
 }
 
 func main() {
-	url := "restapiurl"
-	username := "usenrmae"
-	password := "password"
-	outputPath := "./facebook_shop.xml"
+	// Deferred first so it runs last: an interrupted run still closes the
+	// database, browsers and output files before exiting non-zero.
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
+	cfg := parseFlags()
+	if err := applyCredentials(cfg); err != nil {
+		log.Fatalf("Failed to load credentials: %v\n", err)
+	}
+	if err := configureFeedAuth(cfg); err != nil {
+		log.Fatalf("Invalid feed authentication: %v\n", err)
+	}
+	err := loadConfigFile(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v\n", err)
+	}
+	if missing := missingRequiredFlags(cfg); len(missing) > 0 {
+		fmt.Fprintf(os.Stderr, "Missing required settings: %s\n\n", strings.Join(missing, ", "))
+		flag.Usage()
+		os.Exit(2)
+	}
+	if cfg.Workers < 1 {
+		log.Fatalf("-workers must be at least 1, got %d\n", cfg.Workers)
+	}
+	if cfg.MaxFailures < 0 {
+		log.Fatalf("-max-failures cannot be negative, got %d\n", cfg.MaxFailures)
+	}
+	if cfg.ScrapeConcurrency < 0 {
+		log.Fatalf("-scrape-concurrency cannot be negative, got %d\n", cfg.ScrapeConcurrency)
+	}
+	if cfg.ScrapeTimeout <= 0 {
+		log.Fatalf("-scrape-timeout must be positive, got %s\n", cfg.ScrapeTimeout)
+	}
+	if cfg.WaitIndexing && cfg.IndexingTimeout <= 0 {
+		log.Fatalf("-indexing-timeout must be positive, got %s\n", cfg.IndexingTimeout)
+	}
+	if cfg.Interval < 0 || (cfg.Interval > 0 && (cfg.RetryFailed || cfg.ReprocessStatus != "")) {
+		log.Fatalf("-interval must be positive and cannot be combined with -retry-failed or -reprocess-status\n")
+	}
+	if cfg.RetryFailed && cfg.ReprocessStatus != "" {
+		log.Fatalf("-retry-failed and -reprocess-status cannot be combined\n")
+	}
+	if cfg.Resume && cfg.NewRun {
+		log.Fatalf("-resume and -new-run cannot be combined\n")
+	}
+	// Checked before anything is started; -preview-chunks makes no API calls.
+	if cfg.PreviewChunks == "" {
+		apiTokens, err = newTokenProvider(cfg)
+		if err != nil {
+			log.Fatalf("Invalid API authentication: %v\n", err)
+		}
+	}
+	if err := setupLogging(cfg); err != nil {
+		log.Fatalf("Invalid logging configuration: %v\n", err)
+	}
+	cfg.Target, err = resolveTarget(cfg.Targets, cfg.TargetName, cfg.DatasetGUID)
+	if err != nil {
+		log.Fatalf("Invalid dataset target configuration: %v\n", err)
+	}
+	if len(cfg.Feeds) > 0 {
+		if cfg.Source != "" || cfg.FeedID != "" {
+			log.Fatalf("-source and -feed-id cannot be combined with feeds from the config file; each feed sets its own\n")
+		}
+		if _, err := feedRunConfigs(cfg); err != nil {
+			log.Fatalf("Invalid feed configuration: %v\n", err)
+		}
+	}
+	documentSink = MyBuddySink{cfg: cfg}
+	err = validateTransforms(cfg.Transforms)
+	if err != nil {
+		log.Fatalf("Invalid transform configuration: %v\n", err)
+	}
+	err = validateDocumentNameTemplate(cfg.DocNameTemplate)
+	if err != nil {
+		log.Fatalf("Invalid document name template: %v\n", err)
+	}
+	documentNameTemplate = cfg.DocNameTemplate
+	documentTemplate, err = loadDocumentTemplate(cfg.FormatTemplate)
+	if err != nil {
+		log.Fatalf("Invalid document format template: %v\n", err)
+	}
+	tempDir = cfg.TempDir
+	err = ensureGeneratedDir(cfg.FolderPath, cfg.FileMode)
+	if err != nil {
+		log.Fatalf("Failed to create product folder %s: %v\n", cfg.FolderPath, err)
+	}
+	if cfg.DownloadImages {
+		if cfg.ImageMaxBytes <= 0 {
+			log.Fatalf("-image-max-bytes must be positive, got %d\n", cfg.ImageMaxBytes)
+		}
+		imageMaxBytes = cfg.ImageMaxBytes
+		imagesDir := filepath.Join(cfg.FolderPath, imagesDirName)
+		if err := ensureGeneratedDir(imagesDir, cfg.FileMode); err != nil {
+			log.Fatalf("Failed to create image folder %s: %v\n", imagesDir, err)
+		}
+	}
+	uploadCap.max = int64(cfg.MaxUploads)
+	formatMigrations.max = int64(cfg.FormatMigrateMax)
+	err = enableItemProcessors(cfg.ItemProcessors)
+	if err != nil {
+		log.Fatalf("Invalid item processor configuration: %v\n", err)
+	}
+	err = validatePragmas(cfg.Pragmas)
+	if err != nil {
+		log.Fatalf("Invalid SQLite pragma configuration: %v\n", err)
+	}
+	scrapeSelectors, err = resolveSelectors(cfg.ScrapeRules, cfg.Selectors)
+	if err != nil {
+		log.Fatalf("Invalid selector configuration: %v\n", err)
+	}
+	err = configureSampling(cfg)
+	if err != nil {
+		log.Fatalf("Invalid sampling configuration: %v\n", err)
+	}
+	configureDryRun(cfg)
+	estimator, err := lookupTokenEstimator(cfg.TokenEstimator)
+	if err != nil {
+		log.Fatalf("Invalid chunking configuration: %v\n", err)
+	}
+	segmenter = newSegmenter(cfg.Target, estimator)
+	if cfg.PreviewChunks != "" {
+		err = previewChunks(segmenter, cfg.PreviewChunks)
+		if err != nil {
+			log.Fatalf("Failed to preview chunks: %v\n", err)
+		}
+		return
+	}
+
+	defer browsers.shutdown()
+	if !cfg.NoScrape {
+		if err := browsers.probe(); err != nil {
+			warnf("Scraping disabled: %v; documents will be built from feed data only", err)
+		} else {
+			cfg.ScrapingEnabled = true
+		}
+	}
+	scrapers = newScraperPool(cfg, scrapePoolSize(cfg))
+	defer scrapers.Close()
 
-	err := downloadXML(url, username, password, outputPath)
+	m, closeMetrics, err := newMetrics(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize metrics: %v\n", err)
+	}
+	defer closeMetrics()
+	metrics = m
+	configureHTTPClients(cfg)
+	err = configureRateLimit(cfg)
+	if err != nil {
+		log.Fatalf("Invalid rate limit: %v\n", err)
+	}
+	err = configureAPICapture(cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up API capture: %v\n", err)
+	}
+	apiBreaker = newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown)
+	apiConnectivity = newConnectivityMonitor(cfg.NetworkFailureThreshold, time.Second, cfg.ReconnectMaxBackoff, apiProbe(cfg.BaseURL))
+	apiSigner, err = newRequestSigner(cfg.SigningAlgorithm, cfg.SigningKey)
 	if err != nil {
-		log.Fatalf("Error: %v", err)
+		log.Fatalf("Invalid request signing configuration: %v\n", err)
 	}
+	events, err = newEventPublisher(cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up event publishing: %v\n", err)
+	}
+	defer events.Close()
 
-	db, err := initializeDB()
+	db, err := initializeDB(cfg.DBFileName, cfg.Pragmas)
 	if err != nil {
 		log.Fatalf("Failed to initialize the database: %v\n", err)
 	}
 	defer db.Close()
+	if err := ensureSchema(db); err != nil {
+		log.Fatalf("Failed to create the database schema: %v\n", err)
+	}
+	dbWrites = newDBWriter(db)
+	defer dbWrites.Close()
 
-	err = markAllRecordsAsDeleted(db)
+	deadLetters, err = openDeadLetterQueue(cfg.DeadLetterPath)
 	if err != nil {
-		log.Fatalf("Failed to mark records as deleted: %v\n", err)
+		log.Fatalf("Failed to open the dead-letter queue: %v\n", err)
 	}
+	defer func() {
+		if err := deadLetters.Close(); err != nil {
+			warnf("Failed to compact the dead-letter queue: %v", err)
+		}
+	}()
 
-	err = processXMLData(db, outputPath)
+	specCache, err = openSpecCache(db)
 	if err != nil {
-		log.Fatalf("Failed to process XML data: %v\n", err)
+		log.Fatalf("Failed to open the specification cache: %v\n", err)
 	}
 
-	fmt.Println("Database update complete.")
+	manifest, err = openManifest(cfg.ManifestPath)
+	if err != nil {
+		log.Fatalf("Failed to open the manifest: %v\n", err)
+	}
+	defer manifest.Close()
+
+	err = migrateDB(db)
+	if err != nil {
+		log.Fatalf("Failed to migrate the database: %v\n", err)
+	}
+
+	if cfg.ShowStats {
+		err = printUploadStats(db)
+		if err != nil {
+			log.Fatalf("Failed to read upload statistics: %v\n", err)
+		}
+		return
+	}
+
+	// SIGINT or SIGTERM cancels ctx, which stops dispatching work and aborts
+	// in-flight scrapes and requests; a second signal kills the process.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if cfg.Interval > 0 {
+		err = runDaemon(ctx, db, cfg)
+		if err != nil {
+			log.Fatalf("Scheduler failed: %v\n", err)
+		}
+		return
+	}
+	err = syncFeeds(ctx, db, cfg)
+	if err != nil && ctx.Err() != nil {
+		warnf("Shut down before the sync finished: %v", err)
+		exitCode = 130
+		return
+	}
+	if err != nil {
+		log.Fatalf("Sync failed: %v\n", err)
+	}
+}
+
+// runSync performs one sync of the feed into the dataset: an incremental run
+// from the changes feed when one is due, otherwise a full run followed by the
+// configured reporting and maintenance.
+func runSync(ctx context.Context, db *sql.DB, cfg *Config) error {
+	uploadCap.reset()
+	formatMigrations.reset()
+	resetScreenshots()
+
+	currentRunID = ""
+	// A dry run writes nothing, so it neither needs nor records a run marker.
+	if !cfg.DryRun {
+		lock, err := acquireRunLock(db, cfg.Target.DatasetGUID, cfg.RunStaleAfter)
+		if err != nil {
+			return fmt.Errorf("refusing to start: %v", err)
+		}
+		currentRunID = lock.marker.RunID
+		defer func() {
+			if err := lock.Release(); err != nil {
+				warnf("%v", err)
+			}
+		}()
+	}
+
+	if cfg.ReprocessStatus != "" {
+		err := reprocessProducts(ctx, db, cfg)
+		if err != nil {
+			return fmt.Errorf("failed to reprocess %s products: %v", cfg.ReprocessStatus, err)
+		}
+		return nil
+	}
+
+	outputPath := cfg.OutputPath
+
+	url := cfg.FeedURL
+	isFile := cfg.FeedFile != ""
+	if isFile {
+		url = cfg.FeedFile
+	}
+	feed, err := newFeedSource(url, isFile, cfg.FeedAuth)
+	if err != nil {
+		return fmt.Errorf("invalid feed source: %v", err)
+	}
+
+	incremental, err := useChangesFeed(db, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to read sync state: %v", err)
+	}
+	if incremental && !cfg.RetryFailed {
+		changesURL, err := changesFeedURL(db, cfg.ChangesFeedURL)
+		if err != nil {
+			return err
+		}
+		changes, err := newFeedSource(changesURL, false, cfg.FeedAuth)
+		if err != nil {
+			return fmt.Errorf("invalid changes feed source: %v", err)
+		}
+		fetchedAt := time.Now()
+		err = fetchFeed(ctx, changes, changesFeedPath)
+		if err != nil {
+			return err
+		}
+		_, err = processChangesFeed(ctx, db, cfg, changesFeedPath)
+		if err != nil {
+			return fmt.Errorf("failed to process the changes feed: %v", err)
+		}
+		err = markSynced(db, fetchedAt, false)
+		if err != nil {
+			warnf("Failed to record sync time: %v", err)
+		}
+		metrics.SetGauge(metricLastSuccess, float64(time.Now().Unix()))
+		summaryf("Database update complete.\n")
+		return nil
+	}
+
+	fetchedAt := time.Now()
+	var items []Item
+	var malformed []ItemError
+	var feedHash string
+	var validators pageValidators
+	// Without a feature that needs the whole feed, the saved feed is decoded
+	// while it is uploaded instead of being loaded first.
+	streamPath := ""
+	var streamSource FeedSource
+	if cfg.StreamFeed && !cfg.RetryFailed {
+		// Resuming needs the feed's hash, and the price guard a pass over the
+		// feed, before the first item, so those buffer the feed as the
+		// options wholeFeedReason names do.
+		if reason := wholeFeedReason(cfg); reason != "" || cfg.Resume || priceGuarded(cfg) {
+			items, malformed, feedHash, err = bufferFeedItems(ctx, cfg, feed)
+			if err != nil {
+				return err
+			}
+		} else {
+			streamSource = feed
+		}
+	} else if cfg.RetryFailed {
+		err = fetchFeed(ctx, feed, outputPath)
+		if err != nil {
+			return err
+		}
+		err = retryFailedUploads(ctx, db, cfg, outputPath)
+		if err != nil {
+			return fmt.Errorf("failed to retry failed uploads: %v", err)
+		}
+		return nil
+	} else {
+		validators, err = fetchFeedIfModified(ctx, db, cfg, feed, outputPath)
+		if errors.Is(err, errFeedNotModified) {
+			summaryf("Feed %s has not changed since the last run; nothing to sync.\n", feed)
+			metrics.SetGauge(metricLastSuccess, float64(time.Now().Unix()))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		feedHash, err = fileSHA256(outputPath)
+		if err != nil {
+			return fmt.Errorf("failed to hash the feed: %v", err)
+		}
+		if reason := wholeFeedReason(cfg); reason != "" {
+			debugf("Loading the whole feed before syncing: needed by %s", reason)
+			items, malformed, err = loadFeedItems(cfg, outputPath)
+			if err != nil {
+				return fmt.Errorf("failed to process XML data: %v", err)
+			}
+		} else {
+			streamPath = outputPath
+		}
+	}
+
+	feedWatermark, err = loadWatermark(db, cfg)
+	if err != nil {
+		return err
+	}
+	activeRun = nil
+	if !cfg.DryRun && !sampling(cfg) {
+		activeRun, err = startSyncRun(db, cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	startIndex := 0
+	if cfg.Resume {
+		startIndex, err = loadCheckpoint(db, feedHash)
+		if err != nil {
+			return fmt.Errorf("failed to load checkpoint: %v", err)
+		}
+	}
+
+	runStart := time.Now()
+	var stats *SyncStats
+	if streamSource != nil {
+		stats, err = processFeedStream(ctx, db, cfg, streamSource)
+	} else if streamPath != "" {
+		stats, err = processFeedFile(ctx, db, cfg, streamPath, feedHash, startIndex)
+	} else {
+		stats, err = processXMLData(ctx, db, cfg, items, malformed, feedHash, startIndex)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to process XML data: %v", err)
+	}
+	reportMalformedItems(stats.Malformed)
+	reportFailedItems(stats.Failures)
+	if cfg.DeleteRemoved {
+		err = reconcileDeletions(ctx, db, cfg, stats)
+		if err != nil {
+			return fmt.Errorf("failed to delete documents of removed products: %v", err)
+		}
+	}
+	if cfg.ChangesFeedURL != "" && !sampling(cfg) {
+		err = markSynced(db, fetchedAt, true)
+		if err != nil {
+			warnf("Failed to record sync time: %v", err)
+		}
+	}
+	if cfg.SuspiciousChangePct > 0 {
+		err = reportSuspiciousPriceChanges(db, cfg.FeedID, cfg.SuspiciousChangePct, runStart)
+		if err != nil {
+			warnf("Failed to report price changes: %v", err)
+		}
+	}
+	if cfg.DryRun {
+		printDryRunSummary(stats)
+	} else {
+		stats.printSummary()
+	}
+	if stats.Migrated > 0 {
+		summaryf("Re-uploaded %d products to document format version %d\n", stats.Migrated, cfg.FormatVersion)
+	}
+	if uploadCap.reached() {
+		summaryf("Upload cap of %d reached: %d products were left pending for the next run\n", uploadCap.max, stats.Capped)
+	}
+	if cfg.ForceReupload {
+		summaryf("Force re-uploaded %d of %d products in scope %q\n", stats.Reuploaded, stats.Seen, cfg.Scope.String())
+	}
+
+	if cfg.PruneRemote {
+		err = pruneRemoteDocuments(ctx, db, cfg)
+		if err != nil {
+			return fmt.Errorf("failed to prune remote documents: %v", err)
+		}
+	}
+
+	if shouldVacuum(cfg, stats) {
+		err = vacuumDB(db, cfg.DBFileName)
+		if err != nil {
+			warnf("Database maintenance failed: %v", err)
+		}
+	}
+
+	// Items that failed below -max-failures still fail the run, and keep the
+	// next one from skipping the feed before they are retried.
+	if len(stats.Failures) > 0 {
+		return fmt.Errorf("%d products failed to sync", len(stats.Failures))
+	}
+
+	// Only a completed run may let the next one skip an unchanged feed.
+	if !validators.IsZero() && !sampling(cfg) {
+		if err := saveFeedValidators(db, feed.String(), validators); err != nil {
+			warnf("Failed to save feed validators: %v", err)
+		}
+	}
+
+	metrics.SetGauge(metricLastSuccess, float64(time.Now().Unix()))
+	summaryf("Database update complete.\n")
+	return nil
 }
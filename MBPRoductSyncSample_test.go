@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDeleteFileReturnsAPIFailure(t *testing.T) {
+	cfg := newTestConfig(t)
+	api := newTestAPI(t, cfg)
+	api.setDeleteStatus(http.StatusInternalServerError)
+
+	err := deleteFile(context.Background(), cfg, "doc-1")
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("deleteFile() = %v, want an error naming the 500 response", err)
+	}
+}
+
+func TestDeleteFileTreatsNotFoundAsDeleted(t *testing.T) {
+	cfg := newTestConfig(t)
+	api := newTestAPI(t, cfg)
+	api.setDeleteStatus(http.StatusNotFound)
+
+	if err := deleteFile(context.Background(), cfg, "doc-1"); err != nil {
+		t.Fatalf("deleteFile() = %v, want nil for a document that is already gone", err)
+	}
+}
+
+func TestWorkerForceReuploadUpdatesInPlace(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	cfg.ForceReupload = true
+	sink := &FakeSink{}
+	useSink(t, sink)
+	item := Item{ID: "sku-1", Title: "Product", Price: 1000, Link: "https://shop.example/sku-1"}
+	if err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), item); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := loadProduct(t, db, "sku-1")
+
+	stats := &SyncStats{}
+	if err := worker(context.Background(), db, cfg, stats, newIDSet(), item); err != nil {
+		t.Fatal(err)
+	}
+	item.Price = 1200
+	if err := worker(context.Background(), db, cfg, stats, newIDSet(), item); err != nil {
+		t.Fatal(err)
+	}
+	calls := sink.Calls()
+	if len(calls) != 3 || calls[1].Method != "Update" || calls[2].Method != "Update" || calls[2].DocumentID != first.DocumentID {
+		t.Errorf("sink calls = %+v, want the upload then two updates of %s", calls, first.DocumentID)
+	}
+	if stats.Existing != 1 || stats.Updated != 1 || stats.Reuploaded != 2 {
+		t.Errorf("Existing, Updated, Reuploaded = %d, %d, %d; want 1, 1, 2", stats.Existing, stats.Updated, stats.Reuploaded)
+	}
+	if stored, _ := loadProduct(t, db, "sku-1"); stored.DocumentID != first.DocumentID || stored.Status != "updated" {
+		t.Errorf("stored = %+v, want %s kept and status updated", stored, first.DocumentID)
+	}
+}
+
+func TestWorkerForceReuploadFailureKeepsDocument(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	cfg.ForceReupload = true
+	useSink(t, errSink{err: errors.New("503 Service Unavailable")})
+	storeProduct(t, db, Product{UniqueCode: "sku-1", Price: 1000, Status: "existing", DocumentID: "doc-old"})
+
+	stats := &SyncStats{}
+	item := Item{ID: "sku-1", Title: "Product", Price: 1000, Link: "https://shop.example/sku-1"}
+	if err := worker(context.Background(), db, cfg, stats, newIDSet(), item); err == nil {
+		t.Fatal("worker() = nil, want the upload failure")
+	}
+	if stats.Failed != 1 || stats.Reuploaded != 0 {
+		t.Errorf("Failed, Reuploaded = %d, %d; want 1, 0", stats.Failed, stats.Reuploaded)
+	}
+	if stored, _ := loadProduct(t, db, "sku-1"); stored.DocumentID != "doc-old" {
+		t.Errorf("document_id = %q, want doc-old kept for the next run", stored.DocumentID)
+	}
+}
+
+func TestWorkerSurfacesUpdateStatusFailure(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	sink := &FakeSink{}
+	useSink(t, sink)
+	storeProduct(t, db, Product{UniqueCode: "sku-1", Price: 1000, Status: "existing", DocumentID: "doc-1"})
+	if _, err := db.Exec(`CREATE TRIGGER reject_updates BEFORE UPDATE ON products BEGIN SELECT RAISE(ABORT, 'disk I/O error'); END`); err != nil {
+		t.Fatal(err)
+	}
+
+	item := Item{ID: "sku-1", Title: "Product", Price: 1500, Link: "https://shop.example/sku-1"}
+	err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), item)
+	if err == nil || !strings.Contains(err.Error(), "failed to update sku-1") {
+		t.Fatalf("worker() = %v, want the failed status update", err)
+	}
+	if calls := sink.Calls(); len(calls) != 0 {
+		t.Errorf("sink calls = %v, want none after the status update failed", calls)
+	}
+}
+
+func TestWorkerCountsUploadFailure(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	useSink(t, errSink{err: errors.New("connection refused")})
+
+	stats := &SyncStats{}
+	err := worker(context.Background(), db, cfg, stats, newIDSet(), Item{ID: "sku-1", Title: "Product", Price: 100})
+	if err == nil {
+		t.Fatal("worker() = nil, want the upload failure")
+	}
+	if stats.New != 1 || stats.Failed != 1 || stats.UploadFailures != 1 {
+		t.Errorf("New, Failed, UploadFailures = %d, %d, %d; want 1, 1, 1", stats.New, stats.Failed, stats.UploadFailures)
+	}
+	var status string
+	if err := db.QueryRow(`SELECT upload_status FROM products WHERE unique_code = 'sku-1'`).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status != uploadFailed {
+		t.Errorf("upload_status = %q, want %q", status, uploadFailed)
+	}
+}
+
+// cachedPages serves product pages whose scrapes are all in the spec cache,
+// so renderItem gets scraped fields without a browser. It counts the HEAD
+// probes, one per render.
+type cachedPages struct {
+	*httptest.Server
+	mu     sync.Mutex
+	probes int
+}
+
+// newCachedPages enables scraping in cfg, backed by the spec cache in db.
+func newCachedPages(t testing.TB, db *sql.DB, cfg *Config) *cachedPages {
+	t.Helper()
+	pages := &cachedPages{}
+	pages.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pages.mu.Lock()
+		pages.probes++
+		pages.mu.Unlock()
+		w.Header().Set("ETag", `"v1"`)
+	}))
+	t.Cleanup(pages.Close)
+	cache, err := openSpecCache(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := specCache
+	specCache = cache
+	t.Cleanup(func() { specCache = previous })
+	cfg.ScrapingEnabled = true
+	cfg.ScrapePolicy = ScrapeRequireNone
+	return pages
+}
+
+// link returns the page URL of product id.
+func (p *cachedPages) link(id string) string {
+	return p.URL + "/" + id
+}
+
+// scraped caches specification as the scrape of product id.
+func (p *cachedPages) scraped(t testing.TB, id, specification string) {
+	t.Helper()
+	data := map[string]string{"specification": specification, "category": "Shoes"}
+	if err := specCache.Store("", id, p.link(id), pageValidators{ETag: `"v1"`}, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (p *cachedPages) probeCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.probes
+}
+
+func TestWorkerUploadsChangedContentRenderedOnce(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	sink := &FakeSink{}
+	useSink(t, sink)
+	pages := newCachedPages(t, db, cfg)
+	item := Item{ID: "sku-1", Title: "Product", Price: 1000, Link: pages.link("sku-1")}
+
+	pages.scraped(t, "sku-1", "Leather")
+	if err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), item); err != nil {
+		t.Fatal(err)
+	}
+	pages.scraped(t, "sku-1", "Suede")
+	before := pages.probeCount()
+	stats := &SyncStats{}
+	if err := worker(context.Background(), db, cfg, stats, newIDSet(), item); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := pages.probeCount() - before; n != 1 {
+		t.Errorf("rendered the changed product %d times, want 1", n)
+	}
+	if stats.Updated != 1 {
+		t.Errorf("Updated = %d, want 1", stats.Updated)
+	}
+	calls := sink.Calls()
+	if len(calls) != 2 || calls[1].Method != "Update" || calls[1].DocumentID != "fake-1" {
+		t.Fatalf("sink calls = %v, want an upload then an update of fake-1", calls)
+	}
+	if content := string(sink.Documents()["fake-1"]); !strings.Contains(content, "Suede") {
+		t.Errorf("document content = %q, want the new specification", content)
+	}
+}
+
+func TestWorkerUpdatesRepricedProductInPlace(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	api := newTestAPI(t, cfg)
+	storeProduct(t, db, Product{UniqueCode: "sku-1", Price: 1000, Status: "existing", DocumentID: "doc-7"})
+
+	item := Item{ID: "sku-1", Title: "Product", Price: 1200, Link: "https://shop.example/sku-1"}
+	if err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), item); err != nil {
+		t.Fatal(err)
+	}
+	if n := api.count("DELETE", "/documents/doc-7"); n != 0 {
+		t.Errorf("deleted the old document %d times, want it updated in place", n)
+	}
+	if n := api.count("POST", "/documents/doc-7/update_by_file"); n != 1 {
+		t.Errorf("updated doc-7 %d times, want 1", n)
+	}
+	if stored, _ := loadProduct(t, db, "sku-1"); stored.DocumentID != "doc-7" || stored.Price != 1200 {
+		t.Errorf("stored product = %+v, want doc-7 at 1200", stored)
+	}
+}
+
+func TestSyncRestocksProductDeletedEarlier(t *testing.T) {
+	// Without -delete-removed the document of a product that left the feed
+	// is kept and brought up to date; with it, the document is gone and the
+	// product is uploaded again.
+	for _, deleteRemoved := range []bool{false, true} {
+		t.Run(fmt.Sprintf("delete-removed=%v", deleteRemoved), func(t *testing.T) {
+			db := newTestDB(t)
+			cfg := newTestConfig(t)
+			cfg.OutputPath = filepath.Join(t.TempDir(), "feed.xml")
+			cfg.DeleteRemoved = deleteRemoved
+			sink := &FakeSink{}
+			useSink(t, sink)
+			sync := func(items ...string) *SyncStats {
+				t.Helper()
+				stats, err := processFeedFile(context.Background(), db, cfg, writeTestFeed(t, items...), "", 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if deleteRemoved {
+					if err := reconcileDeletions(context.Background(), db, cfg, stats); err != nil {
+						t.Fatal(err)
+					}
+				}
+				return stats
+			}
+			sync(feedItem("sku-1", "10.00"), feedItem("sku-2", "20.00"))
+			first, _ := loadProduct(t, db, "sku-2")
+			sync(feedItem("sku-1", "10.00"))
+			if gone, _ := loadProduct(t, db, "sku-2"); gone.Status != "deleted" {
+				t.Fatalf("sku-2 status = %q after leaving the feed, want deleted", gone.Status)
+			}
+
+			recorded := newRecordingMetrics()
+			useMetrics(t, recorded)
+			recorder := &recordingPublisher{}
+			usePublisher(t, recorder)
+			stats := sync(feedItem("sku-1", "10.00"), feedItem("sku-2", "20.00"))
+
+			if stats.Restocked != 1 || recorded.Counter(metricItemsProcessed, "status:restocked") != 1 {
+				t.Errorf("Restocked = %d, status:restocked = %d; want 1 each", stats.Restocked, recorded.Counter(metricItemsProcessed, "status:restocked"))
+			}
+			stored, _ := loadProduct(t, db, "sku-2")
+			if stored.Status != "restocked" || stored.DocumentID == "" {
+				t.Errorf("stored sku-2 = %+v, want restocked with a document", stored)
+			}
+			if _, ok := sink.Documents()[stored.DocumentID]; !ok {
+				t.Errorf("document %s of the restocked product is not stored", stored.DocumentID)
+			}
+			if kept := stored.DocumentID == first.DocumentID; kept == deleteRemoved {
+				t.Errorf("document = %s, first uploaded as %s; want it replaced only when it was deleted", stored.DocumentID, first.DocumentID)
+			}
+			if types := eventTypes(recorder.Events()); len(types) != 1 || types[0] != eventProductCreated+" sku-2" {
+				t.Errorf("events = %v, want sku-2 created again", types)
+			}
+		})
+	}
+}
+
+func TestWorkerKeepsDocumentWhenUpdateFails(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	useSink(t, errSink{err: errors.New("503 Service Unavailable")})
+	storeProduct(t, db, Product{UniqueCode: "sku-1", Price: 1000, Status: "existing", DocumentID: "doc-7"})
+
+	item := Item{ID: "sku-1", Title: "Product", Price: 1200, Link: "https://shop.example/sku-1"}
+	if err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), item); err == nil {
+		t.Fatal("worker() = nil, want the update failure")
+	}
+	if stored, _ := loadProduct(t, db, "sku-1"); stored.DocumentID != "doc-7" {
+		t.Errorf("document_id = %q, want doc-7 kept for the next run", stored.DocumentID)
+	}
+}
+
+func TestFormatItemAddsSourceLine(t *testing.T) {
+	item := Item{ID: "sku-1", Title: "Product"}
+	if doc, err := formatItem(item, map[string]string{"source": "warehouse"}); err != nil || !strings.Contains(doc, "[SOURCE] warehouse\n") {
+		t.Errorf("document lacks the [SOURCE] line (%v):\n%s", err, doc)
+	}
+	if doc, err := formatItem(item, map[string]string{}); err != nil || strings.Contains(doc, "[SOURCE]") {
+		t.Errorf("document without a source has a [SOURCE] line (%v):\n%s", err, doc)
+	}
+}
+
+func TestWorkerDefersDocumentBelowMinContentLength(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	sink := &FakeSink{}
+	useSink(t, sink)
+	item := Item{ID: "sku-1", Title: "Product", Price: 100}
+
+	cfg.MinContentLength = 100000
+	stats := &SyncStats{}
+	if err := worker(context.Background(), db, cfg, stats, newIDSet(), item); !errors.Is(err, errDeferred) {
+		t.Fatalf("worker() = %v, want errDeferred", err)
+	}
+	if calls := sink.Calls(); len(calls) != 0 {
+		t.Errorf("sink calls = %v, want the short document held back", calls)
+	}
+	if !deadLetters.Has(cfg.FeedID, item.ID) {
+		t.Error("short document was not deferred to the dead-letter queue")
+	}
+
+	cfg.MinContentLength = 10
+	if err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), item); err != nil {
+		t.Fatalf("worker() with a low minimum = %v", err)
+	}
+	if calls := sink.Calls(); len(calls) != 1 {
+		t.Errorf("sink calls = %v, want one upload", calls)
+	}
+}
+
+func TestInsertProductOverwritesStoredProduct(t *testing.T) {
+	db := newTestDB(t)
+	storeProduct(t, db, Product{UniqueCode: "sku-1", Price: 100, Status: "new", DocumentID: "doc-1"})
+	if err := insertProduct(db, Product{UniqueCode: "sku-1", Price: 200, Status: "updated", DocumentID: "doc-2"}); err != nil {
+		t.Fatalf("insertProduct() of a stored product = %v, want it overwritten", err)
+	}
+	stored, _ := loadProduct(t, db, "sku-1")
+	if stored.Price != 200 || stored.Status != "updated" || stored.DocumentID != "doc-2" {
+		t.Errorf("stored %+v, want the second insert", stored)
+	}
+}
+
+func TestWorkerStoresProductUnderFeedID(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	cfg.Source = "shop"
+	cfg.FeedID = "warehouse"
+	useSink(t, &FakeSink{})
+
+	if err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), Item{ID: "sku-1", Title: "Product", Price: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _, err := productExists(db, "warehouse", "sku-1"); err != nil || !exists {
+		t.Errorf("product under warehouse: exists = %v, err = %v", exists, err)
+	}
+	if _, ok := loadProduct(t, db, "sku-1"); ok {
+		t.Error("product was stored under the default feed too")
+	}
+	var source string
+	if err := db.QueryRow(`SELECT source FROM products WHERE feed_id = 'warehouse'`).Scan(&source); err != nil || source != "shop" {
+		t.Errorf("stored source = %q, %v; want shop", source, err)
+	}
+}
+
+// stallSink fails uploads of the product file of bad and holds every other
+// upload until its context is cancelled.
+type stallSink struct{ bad string }
+
+func (s stallSink) Upload(ctx context.Context, filePath string) (string, error) {
+	if strings.Contains(filepath.Base(filePath), s.bad) {
+		return "", errors.New("connection refused")
+	}
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+func (s stallSink) Update(ctx context.Context, _, filePath string) (string, error) {
+	return s.Upload(ctx, filePath)
+}
+func (s stallSink) Delete(context.Context, string) error { return nil }
+
+func TestDispatchFeedDoesNotCountCancelledItems(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	cfg.MaxFailures = 1
+	useSink(t, stallSink{bad: "sku-bad"})
+	feed := writeTestFeed(t, feedItem("sku-slow", "10.00"), feedItem("sku-bad", "20.00"))
+
+	_, err := processFeedFile(context.Background(), db, cfg, feed, "", 0)
+	if !errors.Is(err, errTooManyFailures) {
+		t.Fatalf("processFeedFile() = %v, want errTooManyFailures", err)
+	}
+	if !strings.Contains(err.Error(), "sku-bad") || strings.Contains(err.Error(), "sku-slow") {
+		t.Errorf("error = %v, want only sku-bad listed as failed", err)
+	}
+}
+
+func TestRunSyncFailsWhenItemsFail(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	cfg.FeedFile = writeTestFeed(t, feedItem("sku-1", "10.00"), feedItem("sku-2", "20.00"))
+	cfg.OutputPath = filepath.Join(t.TempDir(), "feed.xml")
+	useSink(t, chooseSink{ok: &FakeSink{}, bad: "sku-2"})
+
+	err := runSync(context.Background(), db, cfg)
+	if err == nil || !strings.Contains(err.Error(), "1 products failed") {
+		t.Fatalf("runSync() = %v, want an error for the failed product", err)
+	}
+	if stored, ok := loadProduct(t, db, "sku-1"); !ok || stored.DocumentID == "" {
+		t.Error("the product that uploaded was not recorded")
+	}
+}
+
+// chooseSink fails uploads of the product file of bad and passes the others
+// to ok.
+type chooseSink struct {
+	ok  *FakeSink
+	bad string
+}
+
+func (s chooseSink) Upload(ctx context.Context, filePath string) (string, error) {
+	if strings.Contains(filepath.Base(filePath), s.bad) {
+		return "", errors.New("connection refused")
+	}
+	return s.ok.Upload(ctx, filePath)
+}
+func (s chooseSink) Update(ctx context.Context, documentID, filePath string) (string, error) {
+	return s.ok.Update(ctx, documentID, filePath)
+}
+func (s chooseSink) Delete(ctx context.Context, documentID string) error {
+	return s.ok.Delete(ctx, documentID)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const listDocumentsPageSize = 100
+
+// apiClient is shared by every dataset API call.
+var apiClient = &http.Client{Transport: httpTransport, Timeout: defaultHTTPTimeout}
+
+// apiBreaker guards every dataset API call; main applies the configured limits.
+var apiBreaker = newCircuitBreaker(5, 30*time.Second)
+
+// apiDo sends a dataset API request. Uploads, deletes and listings all pass
+// through here, so the circuit breaker applies across operation types.
+// Network errors, 429 and 5xx responses count as failures. Once
+// apiConnectivity declares an outage, requests wait for the API to come back
+// and are sent again instead of failing.
+func apiDo(req *http.Request) (*http.Response, error) {
+	token, err := apiTokens.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	if err := signRequest(req); err != nil {
+		return nil, err
+	}
+	for {
+		if err := apiConnectivity.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+		if err := apiBreaker.Allow(); err != nil {
+			return nil, err
+		}
+		resp, err := httpDoWithRetry(apiClient, req)
+		if apiConnectivity.Record(req.Context(), err) {
+			// The network is down, not the API: keep the breaker closed and
+			// resend once the API is reachable, if the body can be replayed.
+			apiBreaker.Record(true)
+			if req.Body == nil || req.Body == http.NoBody {
+				continue
+			}
+			if req.GetBody != nil {
+				if body, bodyErr := req.GetBody(); bodyErr == nil {
+					req.Body = body
+					continue
+				}
+			}
+			return nil, err
+		}
+		apiBreaker.Record(err == nil && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500)
+		return resp, err
+	}
+}
+
+// remoteDocument is a document as listed by the dataset API.
+type remoteDocument struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// listDocumentsResponse is one page of the document list endpoint.
+type listDocumentsResponse struct {
+	Data    []remoteDocument `json:"data"`
+	HasMore bool             `json:"has_more"`
+}
+
+// listDocuments returns every document in the run's dataset target, following pagination.
+func listDocuments(ctx context.Context, cfg *Config) ([]remoteDocument, error) {
+	var documents []remoteDocument
+
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s/v1/datasets/%s/documents?page=%d&limit=%d", cfg.BaseURL, cfg.Target.DatasetGUID, page, listDocumentsPageSize)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create list request: %v", err)
+		}
+
+		resp, err := apiDo(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute list request: %v", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			bodyBytes, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to list documents: %d - %s", resp.StatusCode, string(bodyBytes))
+		}
+
+		var listed listDocumentsResponse
+		err = json.NewDecoder(resp.Body).Decode(&listed)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode document list: %v", err)
+		}
+
+		documents = append(documents, listed.Data...)
+		if !listed.HasMore || len(listed.Data) == 0 {
+			return documents, nil
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// redactedHeaders are replaced in recordings so they can be shared.
+var redactedHeaders = []string{"Authorization", signatureHeader}
+
+// apiInteraction is one recorded request and its response.
+type apiInteraction struct {
+	Method         string      `json:"method"`
+	URL            string      `json:"url"`
+	RequestHeader  http.Header `json:"request_header"`
+	RequestBody    []byte      `json:"request_body,omitempty"`
+	Status         int         `json:"status"`
+	ResponseHeader http.Header `json:"response_header"`
+	ResponseBody   []byte      `json:"response_body,omitempty"`
+}
+
+// configureAPICapture switches apiClient to recording into cfg.RecordDir or
+// replaying from cfg.ReplayDir. It must run before the connectivity monitor
+// is configured.
+func configureAPICapture(cfg *Config) error {
+	switch {
+	case cfg.RecordDir != "" && cfg.ReplayDir != "":
+		return fmt.Errorf("-record-dir and -replay-dir cannot be combined")
+	case cfg.RecordDir != "":
+		recorder, err := newAPIRecorder(cfg.RecordDir, apiClient.Transport)
+		if err != nil {
+			return err
+		}
+		apiClient.Transport = recorder
+		infof("Recording API interactions to %s", cfg.RecordDir)
+	case cfg.ReplayDir != "":
+		replayer, err := newAPIReplayer(cfg.ReplayDir)
+		if err != nil {
+			return err
+		}
+		apiClient.Transport = replayer
+		// A missing recording is not an outage worth waiting for.
+		cfg.NetworkFailureThreshold = 0
+		infof("Replaying %d API interactions from %s", replayer.remaining(), cfg.ReplayDir)
+	}
+	return nil
+}
+
+// apiRecorder is an http.RoundTripper that saves every interaction as a
+// numbered JSON file in dir.
+type apiRecorder struct {
+	dir  string
+	next http.RoundTripper
+	seq  atomic.Int64
+}
+
+func newAPIRecorder(dir string, next http.RoundTripper) (*apiRecorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create record directory %s: %v", dir, err)
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &apiRecorder{dir: dir, next: next}, nil
+}
+
+func (r *apiRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := apiInteraction{
+		Method:         req.Method,
+		URL:            req.URL.String(),
+		RequestHeader:  redactHeader(req.Header),
+		RequestBody:    reqBody,
+		Status:         resp.StatusCode,
+		ResponseHeader: resp.Header,
+		ResponseBody:   respBody,
+	}
+	data, err := json.MarshalIndent(interaction, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(r.dir, fmt.Sprintf("%06d.json", r.seq.Add(1)))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		warnf("Failed to record API interaction %s %s: %v", req.Method, req.URL, err)
+	}
+	return resp, nil
+}
+
+// redactHeader copies h with credentials replaced.
+func redactHeader(h http.Header) http.Header {
+	redacted := h.Clone()
+	for _, name := range redactedHeaders {
+		if redacted.Get(name) != "" {
+			redacted.Set(name, "REDACTED")
+		}
+	}
+	return redacted
+}
+
+// apiReplayer is an http.RoundTripper that answers requests from a recording.
+// Requests are matched on method and URL, in recording order per pair, so
+// concurrent workers replay correctly even if they run in a different order.
+type apiReplayer struct {
+	mu           sync.Mutex
+	interactions map[string][]apiInteraction
+}
+
+func newAPIReplayer(dir string) (*apiReplayer, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recorded API interactions in %s", dir)
+	}
+	sort.Strings(files)
+
+	replayer := &apiReplayer{interactions: make(map[string][]apiInteraction)}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recording %s: %v", file, err)
+		}
+		var interaction apiInteraction
+		if err := json.Unmarshal(data, &interaction); err != nil {
+			return nil, fmt.Errorf("failed to parse recording %s: %v", file, err)
+		}
+		key := interaction.Method + " " + interaction.URL
+		replayer.interactions[key] = append(replayer.interactions[key], interaction)
+	}
+	return replayer, nil
+}
+
+func (r *apiReplayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	key := req.Method + " " + req.URL.String()
+
+	r.mu.Lock()
+	queue := r.interactions[key]
+	if len(queue) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("no recorded response left for %s", key)
+	}
+	interaction := queue[0]
+	r.interactions[key] = queue[1:]
+	r.mu.Unlock()
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status)),
+		StatusCode:    interaction.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        interaction.ResponseHeader,
+		Body:          io.NopCloser(bytes.NewReader(interaction.ResponseBody)),
+		ContentLength: int64(len(interaction.ResponseBody)),
+		Request:       req,
+	}, nil
+}
+
+// remaining is the number of recorded interactions not yet replayed.
+func (r *apiReplayer) remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, queue := range r.interactions {
+		n += len(queue)
+	}
+	return n
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useAPICapture applies -record-dir or -replay-dir from cfg for the rest of
+// the test.
+func useAPICapture(t *testing.T, cfg *Config) {
+	t.Helper()
+	saved := apiClient.Transport
+	t.Cleanup(func() { apiClient.Transport = saved })
+	if err := configureAPICapture(cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordAndReplayAPIInteractions(t *testing.T) {
+	recordDir := t.TempDir()
+	savedTokens := apiTokens
+	t.Cleanup(func() { apiTokens = savedTokens })
+	apiTokens = staticToken("secret-token")
+	item := Item{ID: "sku-1", Title: "Product", Price: 100}
+
+	// Record an upload against the mock API.
+	cfg := newTestConfig(t)
+	api := newTestAPI(t, cfg)
+	cfg.RecordDir = recordDir
+	useAPICapture(t, cfg)
+	if err := worker(context.Background(), newTestDB(t), cfg, &SyncStats{}, newIDSet(), item); err != nil {
+		t.Fatal(err)
+	}
+	api.Close()
+
+	files, _ := filepath.Glob(filepath.Join(recordDir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("recorded %d interactions, want 1", len(files))
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-token") {
+		t.Error("the recording contains the API token")
+	}
+	var interaction apiInteraction
+	if err := json.Unmarshal(data, &interaction); err != nil {
+		t.Fatal(err)
+	}
+	if interaction.RequestHeader.Get("Authorization") != "REDACTED" || interaction.Status != 200 {
+		t.Errorf("interaction = %s %d with Authorization %q", interaction.URL, interaction.Status, interaction.RequestHeader.Get("Authorization"))
+	}
+
+	// Replay it with the API gone.
+	replay := newTestConfig(t)
+	replay.BaseURL = cfg.BaseURL
+	replay.ReplayDir = recordDir
+	useSink(t, MyBuddySink{cfg: replay})
+	useAPICapture(t, replay)
+	db := newTestDB(t)
+	if err := worker(context.Background(), db, replay, &SyncStats{}, newIDSet(), item); err != nil {
+		t.Fatalf("replayed worker() = %v", err)
+	}
+	if stored, _ := loadProduct(t, db, "sku-1"); stored.DocumentID != "doc-1" {
+		t.Errorf("replayed document ID = %q, want the recorded doc-1", stored.DocumentID)
+	}
+	if err := worker(context.Background(), newTestDB(t), replay, &SyncStats{}, newIDSet(), item); err == nil {
+		t.Error("a request without a recording left succeeded")
+	}
+}
+
+func TestConfigureAPICaptureRejectsBoth(t *testing.T) {
+	if err := configureAPICapture(&Config{RecordDir: "a", ReplayDir: "b"}); err == nil {
+		t.Error("configureAPICapture accepted -record-dir with -replay-dir")
+	}
+	if err := configureAPICapture(&Config{ReplayDir: t.TempDir()}); err == nil {
+		t.Error("configureAPICapture accepted an empty recording")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// Availability is a feed item's stock status. Known spellings are normalized
+// to one of the canonical values below, so "in stock", "in_stock", "InStock"
+// and "available" render the same document text; anything else is kept as
+// written.
+type Availability string
+
+const (
+	AvailabilityInStock    Availability = "in_stock"
+	AvailabilityOutOfStock Availability = "out_of_stock"
+	AvailabilityPreorder   Availability = "preorder"
+	AvailabilityBackorder  Availability = "backorder"
+)
+
+// availabilitySpellings maps spellings, lowercased and with spaces,
+// underscores and hyphens removed, to the canonical value.
+var availabilitySpellings = map[string]Availability{
+	"instock":    AvailabilityInStock,
+	"available":  AvailabilityInStock,
+	"outofstock": AvailabilityOutOfStock,
+	"soldout":    AvailabilityOutOfStock,
+	"preorder":   AvailabilityPreorder,
+	"backorder":  AvailabilityBackorder,
+}
+
+// normalizeAvailability returns the canonical value for raw, ignoring case,
+// separators and a schema.org URL prefix, or raw trimmed when it is not a
+// known spelling.
+func normalizeAvailability(raw string) Availability {
+	value := strings.TrimSpace(raw)
+	key := strings.ToLower(value)
+	for _, prefix := range []string{"https://schema.org/", "http://schema.org/"} {
+		key = strings.TrimPrefix(key, prefix)
+	}
+	key = strings.NewReplacer(" ", "", "_", "", "-", "").Replace(key)
+	if canonical, ok := availabilitySpellings[key]; ok {
+		return canonical
+	}
+	return Availability(value)
+}
+
+// UnmarshalXML normalizes the element text with normalizeAvailability.
+func (a *Availability) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var s string
+	if err := d.DecodeElement(&s, &start); err != nil {
+		return err
+	}
+	*a = normalizeAvailability(s)
+	return nil
+}
+
+// skipOutOfStock reports whether item is left out of the feed because it is
+// out of stock and -skip-out-of-stock is set. It is then handled like a
+// product that left the feed.
+func skipOutOfStock(cfg *Config, item Item) bool {
+	if !cfg.SkipOutOfStock || item.Availability != AvailabilityOutOfStock {
+		return false
+	}
+	debugf("Skipping out-of-stock item %s", item.ID)
+	return true
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"testing"
+)
+
+func TestNormalizeAvailability(t *testing.T) {
+	tests := map[string]Availability{
+		"in stock":                      AvailabilityInStock,
+		" In_Stock ":                    AvailabilityInStock,
+		"InStock":                       AvailabilityInStock,
+		"available":                     AvailabilityInStock,
+		"https://schema.org/OutOfStock": AvailabilityOutOfStock,
+		"sold-out":                      AvailabilityOutOfStock,
+		"pre-order":                     AvailabilityPreorder,
+		"BackOrder":                     AvailabilityBackorder,
+		" limited ":                     "limited",
+		"":                              "",
+	}
+	for raw, want := range tests {
+		if got := normalizeAvailability(raw); got != want {
+			t.Errorf("normalizeAvailability(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestAvailabilityUnmarshalXML(t *testing.T) {
+	var item Item
+	if err := xml.Unmarshal([]byte(`<item><id>sku-1</id><availability>Out of Stock</availability></item>`), &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Availability != AvailabilityOutOfStock {
+		t.Errorf("Availability = %q, want %q", item.Availability, AvailabilityOutOfStock)
+	}
+}
+
+func TestProcessFeedFileSkipsOutOfStockItems(t *testing.T) {
+	for _, skip := range []bool{false, true} {
+		db := newTestDB(t)
+		cfg := newTestConfig(t)
+		cfg.SkipOutOfStock = skip
+		sink := &FakeSink{}
+		useSink(t, sink)
+		feed := writeTestFeed(t, feedItem("sku-1", "10.00"),
+			`<item><id>sku-2</id><title>Sold out</title><price>5.00</price><availability>out of stock</availability></item>`)
+
+		if _, err := processFeedFile(context.Background(), db, cfg, feed, "", 0); err != nil {
+			t.Fatal(err)
+		}
+		want := 2
+		if skip {
+			want = 1
+		}
+		if calls := sink.Calls(); len(calls) != want {
+			t.Errorf("-skip-out-of-stock %v: %d uploads, want %d", skip, len(calls), want)
+		}
+		if _, ok := loadProduct(t, db, "sku-2"); ok == skip {
+			t.Errorf("-skip-out-of-stock %v: out-of-stock product stored %v", skip, ok)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// bootstrapFromRemote seeds an empty products table from the documents that
+// already exist in the dataset, so a run on a fresh machine only uploads items
+// that are genuinely missing. A feed item is taken as uploaded when a remote
+// document carries its name under the -doc-name scheme; it is stored with its
+// feed price and the remote document's ID, so later price changes are
+// detected and applied as usual.
+func bootstrapFromRemote(ctx context.Context, db *sql.DB, cfg *Config, items []Item) error {
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM products`).Scan(&count); err != nil {
+		return fmt.Errorf("failed to count products: %v", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	documents, err := listDocuments(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	remote := make(map[string]string, len(documents))
+	for _, doc := range documents {
+		remote[strings.TrimSuffix(doc.Name, ".txt")] = doc.ID
+	}
+
+	seeded := 0
+	for _, item := range items {
+		documentID, ok := remote[documentName(documentNameTemplate, item.ID)]
+		if !cfg.Scope.Matches(item) || !ok {
+			continue
+		}
+		product := Product{
+			UniqueCode: item.ID,
+			Price:      item.Price,
+			MPN:        item.MPN,
+			Status:     "existing",
+			Scope:      cfg.Scope.String(),
+			Source:     cfg.Source,
+			FeedID:     cfg.FeedID,
+			DocumentID: documentID,
+		}
+		if err := insertProduct(db, product); err != nil {
+			return fmt.Errorf("failed to seed product %s: %v", item.ID, err)
+		}
+		if err := setUploadStatus(db, cfg.FeedID, item.ID, uploadUploaded); err != nil {
+			return fmt.Errorf("failed to seed product %s: %v", item.ID, err)
+		}
+		seeded++
+	}
+	summaryf("Bootstrapped %d products from %d remote documents\n", seeded, len(documents))
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// newListingAPI serves documents from the document list endpoint and counts
+// the listings.
+func newListingAPI(t *testing.T, cfg *Config, documents ...remoteDocument) *int32 {
+	t.Helper()
+	var listings int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&listings, 1)
+		json.NewEncoder(w).Encode(listDocumentsResponse{Data: documents})
+	}))
+	t.Cleanup(server.Close)
+	cfg.BaseURL = server.URL
+	return &listings
+}
+
+func TestBootstrapFromRemoteSeedsMatchingItems(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	newListingAPI(t, cfg, remoteDocument{ID: "doc-1", Name: "Prod_sku-1.txt"}, remoteDocument{ID: "doc-9", Name: "Prod_sku-9.txt"})
+	items := []Item{{ID: "sku-1", Price: 1000}, {ID: "sku-2", Price: 2000}}
+
+	if err := bootstrapFromRemote(context.Background(), db, cfg, items); err != nil {
+		t.Fatal(err)
+	}
+	stored, ok := loadProduct(t, db, "sku-1")
+	if !ok || stored.DocumentID != "doc-1" || stored.Price != 1000 || stored.Status != "existing" {
+		t.Errorf("sku-1 = %+v, %v; want it seeded with doc-1 at the feed price", stored, ok)
+	}
+	if status := storedUploadStatus(t, db, "sku-1"); status != uploadUploaded {
+		t.Errorf("upload_status = %q, want %q", status, uploadUploaded)
+	}
+	for _, code := range []string{"sku-2", "sku-9"} {
+		if _, ok := loadProduct(t, db, code); ok {
+			t.Errorf("%s was seeded without both a feed item and a document", code)
+		}
+	}
+}
+
+func TestBootstrapFromRemoteSkipsPopulatedDB(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	listings := newListingAPI(t, cfg, remoteDocument{ID: "doc-1", Name: "Prod_sku-1.txt"})
+	storeProduct(t, db, Product{UniqueCode: "sku-0", Status: "existing"})
+
+	if err := bootstrapFromRemote(context.Background(), db, cfg, []Item{{ID: "sku-1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(listings); n != 0 {
+		t.Errorf("listed remote documents %d times for a populated database", n)
+	}
+	if _, ok := loadProduct(t, db, "sku-1"); ok {
+		t.Error("seeded a populated database")
+	}
+}
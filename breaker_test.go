@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	breaker := newCircuitBreaker(2, 10*time.Millisecond)
+	breaker.Record(false)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("Allow() after one failure = %v", err)
+	}
+	breaker.Record(false)
+	if err := breaker.Allow(); err != errCircuitOpen {
+		t.Fatalf("Allow() after the threshold = %v, want errCircuitOpen", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("trial call after the cooldown was refused: %v", err)
+	}
+	if err := breaker.Allow(); err != errCircuitOpen {
+		t.Errorf("second call during the trial = %v, want errCircuitOpen", err)
+	}
+	breaker.Record(true)
+	if err := breaker.Allow(); err != nil {
+		t.Errorf("Allow() after a successful trial = %v", err)
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	breaker := newCircuitBreaker(0, time.Hour)
+	for i := 0; i < 5; i++ {
+		breaker.Record(false)
+	}
+	if err := breaker.Allow(); err != nil {
+		t.Errorf("disabled breaker refused a call: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/chromedp/chromedp"
+)
+
+// browserTracker keeps every Chrome allocator started for scraping so main can
+// cancel whatever is still open on exit and report processes that survived.
+type browserTracker struct {
+	mu      sync.Mutex
+	nextID  int
+	active  map[int]context.CancelFunc
+	pids    map[int]int
+	started int
+	closed  int
+}
+
+// browsers is the process-wide tracker the scraper pool starts browsers with.
+var browsers = &browserTracker{
+	active: make(map[int]context.CancelFunc),
+	pids:   make(map[int]int),
+}
+
+// newBrowserContext starts a Chrome instance with its own allocator and
+// returns a tab context on it. The returned cancel closes the tab, waits for
+// the browser process to exit and untracks it; it is safe to call twice.
+func (t *browserTracker) newBrowserContext() (context.Context, context.CancelFunc, error) {
+	allocCtx, allocCancel := chromedp.NewExecAllocator(context.Background(), chromedp.DefaultExecAllocatorOptions[:]...)
+	tabCtx, tabCancel := chromedp.NewContext(allocCtx)
+
+	t.mu.Lock()
+	id := t.nextID
+	t.nextID++
+	t.started++
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			tabCancel()
+			allocCancel()
+			t.mu.Lock()
+			delete(t.active, id)
+			t.closed++
+			t.mu.Unlock()
+		})
+	}
+	t.active[id] = cancel
+	t.mu.Unlock()
+
+	// Run with no actions launches the browser so its process can be tracked.
+	if err := chromedp.Run(tabCtx); err != nil {
+		cancel()
+		return nil, nil, fmt.Errorf("failed to start browser: %v", err)
+	}
+	if c := chromedp.FromContext(tabCtx); c != nil && c.Browser != nil {
+		if process := c.Browser.Process(); process != nil {
+			t.mu.Lock()
+			t.pids[id] = process.Pid
+			t.mu.Unlock()
+		}
+	}
+	return tabCtx, cancel, nil
+}
+
+// probe launches and closes one browser to check that scraping can work.
+func (t *browserTracker) probe() error {
+	_, cancel, err := t.newBrowserContext()
+	if err != nil {
+		return err
+	}
+	cancel()
+	return nil
+}
+
+// shutdown cancels every browser that is still open and logs any browser
+// process that is still alive afterwards.
+func (t *browserTracker) shutdown() {
+	t.mu.Lock()
+	pending := make([]context.CancelFunc, 0, len(t.active))
+	for _, cancel := range t.active {
+		pending = append(pending, cancel)
+	}
+	t.mu.Unlock()
+
+	if len(pending) > 0 {
+		infof("Closing %d browsers that were still open", len(pending))
+	}
+	for _, cancel := range pending {
+		cancel()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	leaked := 0
+	for _, pid := range t.pids {
+		if processAlive(pid) {
+			leaked++
+			warnf("Chrome process %d is still running after shutdown", pid)
+		}
+	}
+	if leaked > 0 || t.started != t.closed {
+		warnf("Browser cleanup: %d started, %d closed, %d processes may have leaked", t.started, t.closed, leaked)
+	}
+}
+
+// processAlive reports whether a process with pid exists.
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
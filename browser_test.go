@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestProcessAlive(t *testing.T) {
+	if !processAlive(os.Getpid()) {
+		t.Error("processAlive() = false for the test process")
+	}
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("cannot run a child process: %v", err)
+	}
+	if processAlive(cmd.Process.Pid) {
+		t.Error("processAlive() = true for a reaped child")
+	}
+}
+
+func TestBrowserTrackerShutdownClosesOpenBrowsers(t *testing.T) {
+	tracker := &browserTracker{active: make(map[int]context.CancelFunc), pids: make(map[int]int)}
+	cancelled := 0
+	for id := 0; id < 2; id++ {
+		id := id
+		tracker.started++
+		tracker.active[id] = func() {
+			cancelled++
+			tracker.mu.Lock()
+			delete(tracker.active, id)
+			tracker.closed++
+			tracker.mu.Unlock()
+		}
+	}
+
+	tracker.shutdown()
+	if cancelled != 2 || len(tracker.active) != 0 || tracker.closed != 2 {
+		t.Errorf("cancelled %d, %d still active, %d closed; want every browser closed", cancelled, len(tracker.active), tracker.closed)
+	}
+}
+
+func TestBrowserContextCancelIsIdempotent(t *testing.T) {
+	tracker := &browserTracker{active: make(map[int]context.CancelFunc), pids: make(map[int]int)}
+	if err := tracker.probe(); err != nil {
+		t.Skipf("Chrome is not available: %v", err)
+	}
+	_, cancel, err := tracker.newBrowserContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	cancel()
+	if tracker.started != 2 || tracker.closed != 2 {
+		t.Errorf("started %d, closed %d; want 2 and 2", tracker.started, tracker.closed)
+	}
+	for id, pid := range tracker.pids {
+		if processAlive(pid) {
+			t.Errorf("browser %d (pid %d) is still running after cancel", id, pid)
+		}
+	}
+}
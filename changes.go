@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	changesSinceMetaKey = "changes_since"
+	lastFullSyncMetaKey = "last_full_sync"
+	changesFeedPath     = "./changes_feed.xml"
+)
+
+// useChangesFeed reports whether this run should apply the changes-only feed
+// instead of the full feed: a changes feed is configured and the last full
+// sync is more recent than cfg.FullSyncEvery.
+func useChangesFeed(db *sql.DB, cfg *Config) (bool, error) {
+	if cfg.ChangesFeedURL == "" {
+		return false, nil
+	}
+	value, ok, err := getMeta(db, feedMetaKey(lastFullSyncMetaKey))
+	if err != nil || !ok {
+		return false, err
+	}
+	lastFull, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return false, nil
+	}
+	return time.Since(lastFull) < cfg.FullSyncEvery, nil
+}
+
+// changesFeedURL appends the stored changes timestamp as the since parameter.
+func changesFeedURL(db *sql.DB, base string) (string, error) {
+	since, ok, err := getMeta(db, feedMetaKey(changesSinceMetaKey))
+	if err != nil || !ok {
+		return base, err
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid changes feed URL: %v", err)
+	}
+	query := u.Query()
+	query.Set("since", since)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// markSynced records that the catalog is current as of at, after a full run
+// (full is true) or a changes-only run.
+func markSynced(db *sql.DB, at time.Time, full bool) error {
+	stamp := at.UTC().Format(time.RFC3339)
+	if full {
+		if err := setMeta(db, feedMetaKey(lastFullSyncMetaKey), stamp); err != nil {
+			return err
+		}
+	}
+	return setMeta(db, feedMetaKey(changesSinceMetaKey), stamp)
+}
+
+// isDeleteChange reports whether a changes-feed item describes a removal. The
+// supplier marks those with a change_type element of "delete" or "deleted".
+func isDeleteChange(item Item) bool {
+	switch strings.ToLower(strings.TrimSpace(itemField(item, "change_type"))) {
+	case "delete", "deleted":
+		return true
+	}
+	return false
+}
+
+// processChangesFeed applies the changes-only feed at xmlPath: removals are
+// reconciled like stale products and everything else goes through worker as
+// an add or update. Products the feed does not mention are left alone.
+func processChangesFeed(ctx context.Context, db *sql.DB, cfg *Config, xmlPath string) (*SyncStats, error) {
+	items, malformed, err := loadFeedItems(cfg, xmlPath)
+	if err != nil {
+		return nil, err
+	}
+	reportMalformedItems(malformed)
+	sortItems(items, cfg.SortBy)
+
+	stats := &SyncStats{Malformed: malformed}
+	seen := newIDSet()
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, cfg.Workers)
+	deletes := newDeletePool(cfg.DeleteConcurrency)
+
+	removed := 0
+	for _, item := range items {
+		item := item
+		if ctx.Err() != nil {
+			break
+		}
+		if !cfg.Scope.Matches(item) {
+			continue
+		}
+		if isDeleteChange(item) {
+			removed++
+			deletes.submit(func() { reconcileProduct(ctx, db, cfg, stats, item.ID) })
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			worker(ctx, db, cfg, stats, seen, item)
+		}()
+	}
+	wg.Wait()
+	deletes.wait()
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("changes feed interrupted: %v", err)
+	}
+
+	summaryf("Applied %d changes: %d upserted, %d removed (%d deleted, %d failed)\n",
+		len(items), seen.Len(), removed, stats.Deleted, stats.DeleteFailures)
+	return stats, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUseChangesFeedBetweenFullSyncs(t *testing.T) {
+	db := newTestDB(t)
+	cfg := &Config{ChangesFeedURL: "https://shop.example/changes.xml", FullSyncEvery: 24 * time.Hour}
+	if use, err := useChangesFeed(db, cfg); err != nil || use {
+		t.Errorf("useChangesFeed() before any full sync = %v, %v; want a full sync", use, err)
+	}
+
+	if err := markSynced(db, time.Now().Add(-time.Hour), true); err != nil {
+		t.Fatal(err)
+	}
+	if use, err := useChangesFeed(db, cfg); err != nil || !use {
+		t.Errorf("useChangesFeed() an hour after a full sync = %v, %v; want the changes feed", use, err)
+	}
+	if use, _ := useChangesFeed(db, &Config{FullSyncEvery: 24 * time.Hour}); use {
+		t.Error("useChangesFeed() without -changes-feed-url = true")
+	}
+
+	if err := markSynced(db, time.Now().Add(-25*time.Hour), true); err != nil {
+		t.Fatal(err)
+	}
+	if use, _ := useChangesFeed(db, cfg); use {
+		t.Error("useChangesFeed() = true once a full sync is due")
+	}
+}
+
+func TestChangesFeedURLAddsSince(t *testing.T) {
+	db := newTestDB(t)
+	base := "https://shop.example/changes.xml?format=rss"
+	if got, err := changesFeedURL(db, base); err != nil || got != base {
+		t.Errorf("changesFeedURL() before any sync = %q, %v; want the base URL", got, err)
+	}
+
+	// A changes-only run moves since forward without counting as a full sync.
+	at := time.Date(2026, 10, 14, 8, 0, 0, 0, time.UTC)
+	if err := markSynced(db, at, false); err != nil {
+		t.Fatal(err)
+	}
+	got, err := changesFeedURL(db, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "format=rss") || !strings.Contains(got, "since=2026-10-14T08%3A00%3A00Z") {
+		t.Errorf("changesFeedURL() = %q, want the format kept and since added", got)
+	}
+	if _, ok, _ := getMeta(db, feedMetaKey(lastFullSyncMetaKey)); ok {
+		t.Error("a changes-only run recorded a full sync")
+	}
+}
+
+func TestProcessChangesFeedAppliesOnlyChanges(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	sink := &FakeSink{}
+	useSink(t, sink)
+	for _, code := range []string{"sku-1", "sku-gone", "sku-quiet"} {
+		item := Item{ID: code, Title: "Product", Price: 1000, Link: "https://shop.example/" + code}
+		if err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gone, _ := loadProduct(t, db, "sku-gone")
+	quiet, _ := loadProduct(t, db, "sku-quiet")
+	uploads := len(sink.Calls())
+	removal := `<item><id>sku-gone</id><title>Product</title><price>10.00</price><change_type>Deleted</change_type></item>`
+	feed := writeTestFeed(t, feedItem("sku-1", "12.00"), feedItem("sku-2", "5.00"), removal)
+
+	stats, err := processChangesFeed(context.Background(), db, cfg, feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Updated != 1 || stats.New != 1 || stats.Deleted != 1 || stats.Failed != 0 {
+		t.Errorf("Updated, New, Deleted, Failed = %d, %d, %d, %d; want 1, 1, 1, 0", stats.Updated, stats.New, stats.Deleted, stats.Failed)
+	}
+	if _, ok := loadProduct(t, db, "sku-gone"); ok {
+		t.Error("removed product is still stored")
+	}
+	if stored, ok := loadProduct(t, db, "sku-quiet"); !ok || stored != quiet {
+		t.Errorf("sku-quiet = %+v, %v; want a product the changes feed leaves out untouched", stored, ok)
+	}
+	documents := sink.Documents()
+	if _, ok := documents[gone.DocumentID]; ok || len(documents) != 3 {
+		t.Errorf("documents = %d, with %s; want sku-gone's deleted and sku-2's added", len(documents), gone.DocumentID)
+	}
+	for _, call := range sink.Calls()[uploads:] {
+		if call.DocumentID == quiet.DocumentID {
+			t.Errorf("changes feed touched sku-quiet's document: %+v", call)
+		}
+	}
+}
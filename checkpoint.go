@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const checkpointMetaKey = "checkpoint"
+
+// feedCheckpoint records how far a run got through a specific feed. Every
+// item before Index has been fully processed.
+type feedCheckpoint struct {
+	FeedHash string    `json:"feed_hash"`
+	Index    int       `json:"index"`
+	SavedAt  time.Time `json:"saved_at"`
+}
+
+// fileSHA256 returns the hex SHA-256 of the file at path.
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// loadCheckpoint returns the item index to resume from for feedHash, or 0
+// when there is no checkpoint or it belongs to a different feed.
+func loadCheckpoint(db *sql.DB, feedHash string) (int, error) {
+	value, ok, err := getMeta(db, feedMetaKey(checkpointMetaKey))
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	var cp feedCheckpoint
+	if err := json.Unmarshal([]byte(value), &cp); err != nil {
+		return 0, fmt.Errorf("failed to decode checkpoint: %v", err)
+	}
+	if cp.FeedHash != feedHash {
+		infof("Ignoring checkpoint from %s: feed has changed", cp.SavedAt.Format(time.RFC3339))
+		return 0, nil
+	}
+	return cp.Index, nil
+}
+
+// saveCheckpoint persists cp to the meta table.
+func saveCheckpoint(db *sql.DB, cp feedCheckpoint) error {
+	value, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return setMeta(db, feedMetaKey(checkpointMetaKey), string(value))
+}
+
+// clearCheckpoint removes the checkpoint after a run completes cleanly.
+func clearCheckpoint(db *sql.DB) error {
+	return deleteMeta(db, feedMetaKey(checkpointMetaKey))
+}
+
+// checkpointTracker follows item completions, which arrive out of order from
+// the worker pool, and periodically saves the lowest index below which every
+// item is done.
+type checkpointTracker struct {
+	mu        sync.Mutex
+	db        *sql.DB
+	feedHash  string
+	every     int
+	next      int
+	done      map[int]bool
+	sinceSave int
+}
+
+func newCheckpointTracker(db *sql.DB, feedHash string, start, every int) *checkpointTracker {
+	return &checkpointTracker{db: db, feedHash: feedHash, every: every, next: start, done: make(map[int]bool)}
+}
+
+// complete marks item index as processed and saves a checkpoint every t.every completions.
+func (t *checkpointTracker) complete(index int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done[index] = true
+	for t.done[t.next] {
+		delete(t.done, t.next)
+		t.next++
+	}
+
+	t.sinceSave++
+	if t.every <= 0 || t.sinceSave < t.every {
+		return
+	}
+	t.sinceSave = 0
+	err := saveCheckpoint(t.db, feedCheckpoint{FeedHash: t.feedHash, Index: t.next, SavedAt: time.Now().UTC()})
+	if err != nil {
+		warnf("Failed to save checkpoint at item %d: %v", t.next, err)
+	}
+}
+
+// save records the current checkpoint immediately, e.g. when the run is
+// interrupted between periodic saves.
+func (t *checkpointTracker) save() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.every <= 0 {
+		return
+	}
+	err := saveCheckpoint(t.db, feedCheckpoint{FeedHash: t.feedHash, Index: t.next, SavedAt: time.Now().UTC()})
+	if err != nil {
+		warnf("Failed to save checkpoint at item %d: %v", t.next, err)
+	}
+}
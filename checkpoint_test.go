@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCheckpointTrackerSavesContiguousPrefix(t *testing.T) {
+	db := newTestDB(t)
+	tracker := newCheckpointTracker(db, "hash", 0, 2)
+
+	// Item 0 is still in flight, so nothing is known to be done yet.
+	tracker.complete(2)
+	tracker.complete(1)
+	if index, err := loadCheckpoint(db, "hash"); err != nil || index != 0 {
+		t.Fatalf("checkpoint = %d, %v; want 0 while item 0 is pending", index, err)
+	}
+	tracker.complete(0)
+	tracker.complete(4)
+	if index, err := loadCheckpoint(db, "hash"); err != nil || index != 3 {
+		t.Fatalf("checkpoint = %d, %v; want 3", index, err)
+	}
+}
+
+func TestLoadCheckpointIgnoresOtherFeed(t *testing.T) {
+	db := newTestDB(t)
+	if err := saveCheckpoint(db, feedCheckpoint{FeedHash: "old", Index: 5, SavedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if index, err := loadCheckpoint(db, "new"); err != nil || index != 0 {
+		t.Errorf("loadCheckpoint(new) = %d, %v; want 0", index, err)
+	}
+	if index, err := loadCheckpoint(db, "old"); err != nil || index != 5 {
+		t.Errorf("loadCheckpoint(old) = %d, %v; want 5", index, err)
+	}
+	if err := clearCheckpoint(db); err != nil {
+		t.Fatal(err)
+	}
+	if index, err := loadCheckpoint(db, "old"); err != nil || index != 0 {
+		t.Errorf("loadCheckpoint after clear = %d, %v; want 0", index, err)
+	}
+}
+
+func TestProcessFeedFileResumesAtCheckpoint(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	sink := &FakeSink{}
+	useSink(t, sink)
+	feed := writeTestFeed(t, feedItem("sku-1", "10.00"), feedItem("sku-2", "20.00"), feedItem("sku-3", "30.00"))
+
+	stats, err := processFeedFile(context.Background(), db, cfg, feed, "hash", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.New != 1 {
+		t.Errorf("New = %d, want only the item after the checkpoint", stats.New)
+	}
+	if _, ok := loadProduct(t, db, "sku-3"); !ok {
+		t.Error("item after the checkpoint was not stored")
+	}
+	if _, ok := loadProduct(t, db, "sku-1"); ok {
+		t.Error("item before the checkpoint was synced again")
+	}
+}
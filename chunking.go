@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Segmentation used by the API in automatic process_rule mode.
+const (
+	automaticSeparator = "\n"
+	automaticMaxTokens = 500
+)
+
+// TokenEstimator approximates how many tokens the API counts in a text.
+type TokenEstimator interface {
+	Estimate(text string) int
+}
+
+// TokenEstimatorFunc adapts a function to TokenEstimator.
+type TokenEstimatorFunc func(text string) int
+
+// Estimate implements TokenEstimator.
+func (f TokenEstimatorFunc) Estimate(text string) int { return f(text) }
+
+// tokenEstimators are the estimators -token-estimator can select.
+var tokenEstimators = map[string]TokenEstimator{
+	// words counts whitespace-separated words.
+	"words": TokenEstimatorFunc(func(text string) int { return len(strings.Fields(text)) }),
+	// chars assumes four characters per token, the usual rule of thumb for
+	// BPE tokenizers on English text.
+	"chars": TokenEstimatorFunc(func(text string) int { return (utf8.RuneCountInString(text) + 3) / 4 }),
+}
+
+// lookupTokenEstimator returns the estimator registered as name.
+func lookupTokenEstimator(name string) (TokenEstimator, error) {
+	estimator, ok := tokenEstimators[name]
+	if !ok {
+		names := make([]string, 0, len(tokenEstimators))
+		for known := range tokenEstimators {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown token estimator %q: expected one of %s", name, strings.Join(names, ", "))
+	}
+	return estimator, nil
+}
+
+// segmenter chunks documents for -preview-chunks and -validate-chunks; main
+// builds it from the run's dataset target.
+var segmenter Segmenter
+
+// Chunk is one segment of a document as the API would index it.
+type Chunk struct {
+	Text   string
+	Tokens int
+	// Oversized marks a separator-delimited segment above MaxTokens that the
+	// API splits at an arbitrary word boundary.
+	Oversized bool
+}
+
+// Segmenter mirrors the API's separator/max_tokens segmentation so documents
+// can be checked locally before upload.
+type Segmenter struct {
+	Separator string
+	MaxTokens int
+	Estimator TokenEstimator
+}
+
+// newSegmenter builds the Segmenter for a target's process rule.
+func newSegmenter(target *DatasetTarget, estimator TokenEstimator) Segmenter {
+	rule := target.indexing().ProcessRule
+	if rule.Mode != "custom" {
+		return Segmenter{Separator: automaticSeparator, MaxTokens: automaticMaxTokens, Estimator: estimator}
+	}
+	segmentation := rule.Rules.Segmentation
+	return Segmenter{Separator: segmentation.Separator, MaxTokens: segmentation.MaxTokens, Estimator: estimator}
+}
+
+// Segment splits doc on the separator, drops empty segments and splits any
+// segment above MaxTokens into word runs that fit.
+func (s Segmenter) Segment(doc string) []Chunk {
+	var chunks []Chunk
+	for _, segment := range strings.Split(doc, s.Separator) {
+		segment = strings.TrimSpace(segment)
+		if segment == "" {
+			continue
+		}
+		tokens := s.Estimator.Estimate(segment)
+		if s.MaxTokens <= 0 || tokens <= s.MaxTokens {
+			chunks = append(chunks, Chunk{Text: segment, Tokens: tokens})
+			continue
+		}
+		chunks = append(chunks, s.split(segment)...)
+	}
+	return chunks
+}
+
+// split packs the words of an oversized segment into chunks of at most
+// MaxTokens. A single word above the limit becomes a chunk of its own.
+func (s Segmenter) split(segment string) []Chunk {
+	var chunks []Chunk
+	var current []string
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		text := strings.Join(current, " ")
+		chunks = append(chunks, Chunk{Text: text, Tokens: s.Estimator.Estimate(text), Oversized: true})
+		current = nil
+	}
+	for _, word := range strings.Fields(segment) {
+		current = append(current, word)
+		if len(current) > 1 && s.Estimator.Estimate(strings.Join(current, " ")) > s.MaxTokens {
+			current = current[:len(current)-1]
+			flush()
+			current = []string{word}
+		}
+	}
+	flush()
+	return chunks
+}
+
+// validateChunks warns about every segment of doc the API would have to split
+// because it exceeds MaxTokens, and reports whether there were any.
+func (s Segmenter) validateChunks(name, doc string) bool {
+	ok := true
+	for i, segment := range strings.Split(doc, s.Separator) {
+		segment = strings.TrimSpace(segment)
+		if tokens := s.Estimator.Estimate(segment); s.MaxTokens > 0 && tokens > s.MaxTokens {
+			warnf("Document %s: segment %d is about %d tokens, above max_tokens %d", name, i+1, tokens, s.MaxTokens)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// previewChunks prints the chunks of path, a document file or a folder of
+// them, without uploading anything.
+func previewChunks(s Segmenter, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	files := []string{path}
+	if info.IsDir() {
+		files, err = filepath.Glob(filepath.Join(path, "*.txt"))
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Segmentation: separator %q, max_tokens %d\n", s.Separator, s.MaxTokens)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", file, err)
+		}
+		chunks := s.Segment(string(data))
+		fmt.Printf("\n%s: %d chunks\n", file, len(chunks))
+		for i, chunk := range chunks {
+			marker := ""
+			if chunk.Oversized {
+				marker = " (split: segment above max_tokens)"
+			}
+			fmt.Printf("--- chunk %d, ~%d tokens%s\n%s\n", i+1, chunk.Tokens, marker, chunk.Text)
+		}
+	}
+	return nil
+}
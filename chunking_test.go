@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSegmenterSegment(t *testing.T) {
+	words, err := lookupTokenEstimator("words")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := Segmenter{Separator: "###", MaxTokens: 3, Estimator: words}
+
+	got := s.Segment("Title here###  ###one two three four five###Price: 10")
+	want := []Chunk{
+		{Text: "Title here", Tokens: 2},
+		{Text: "one two three", Tokens: 3, Oversized: true},
+		{Text: "four five", Tokens: 2, Oversized: true},
+		{Text: "Price: 10", Tokens: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Segment() = %+v, want %+v", got, want)
+	}
+
+	if s.validateChunks("sku-1", "short###one two three four") {
+		t.Error("validateChunks() accepted an oversized segment")
+	}
+	if !s.validateChunks("sku-1", "short###one two three") {
+		t.Error("validateChunks() rejected segments within max_tokens")
+	}
+}
+
+func TestTokenEstimators(t *testing.T) {
+	chars, err := lookupTokenEstimator("chars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chars.Estimate("abcdefghi"); got != 3 {
+		t.Errorf("chars estimate of 9 characters = %d, want 3", got)
+	}
+	if _, err := lookupTokenEstimator("tiktoken"); err == nil || !strings.Contains(err.Error(), "chars, words") {
+		t.Errorf("lookupTokenEstimator(tiktoken) = %v, want an error listing the estimators", err)
+	}
+}
+
+func TestNewSegmenterFollowsTarget(t *testing.T) {
+	custom := defaultTarget("g")
+	if s := newSegmenter(&custom, nil); s.Separator != "###" || s.MaxTokens != 1000 {
+		t.Errorf("custom target segmenter = %q/%d, want ###/1000", s.Separator, s.MaxTokens)
+	}
+	automatic := DatasetTarget{Name: "a", DatasetGUID: "g", Indexing: &IndexingConfig{IndexingTechnique: IndexingEconomy, ProcessRule: ProcessRule{Mode: "automatic"}}}
+	if s := newSegmenter(&automatic, nil); s.Separator != automaticSeparator || s.MaxTokens != automaticMaxTokens {
+		t.Errorf("automatic target segmenter = %q/%d, want the API's automatic rule", s.Separator, s.MaxTokens)
+	}
+}
+
+func TestPreviewChunks(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Prod_sku-1.txt"), []byte("Title###one two three four"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := Segmenter{Separator: "###", MaxTokens: 3, Estimator: tokenEstimators["words"]}
+
+	var err error
+	out := captureOutput(t, &os.Stdout, func() { err = previewChunks(s, dir) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Prod_sku-1.txt: 3 chunks", "--- chunk 2, ~3 tokens (split: segment above max_tokens)\none two three"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("preview %q is missing %q", out, want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// gzipRejected is set once the API has refused a gzip-encoded body, so the
+// rest of the run sends uncompressed bodies without a wasted round trip.
+var gzipRejected atomic.Bool
+
+// gzipBytes compresses data with the default compression level.
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress request body: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress request body: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// sendBody sends body to url through apiDo. Bodies of at least cfg.GzipMinBytes
+// are gzip-encoded when cfg.Gzip is set; if the server answers 415 to an
+// encoded body, the request is repeated uncompressed. Any other error, a 400
+// included, is about the request itself and is returned as it is.
+func sendBody(ctx context.Context, cfg *Config, method, url string, body []byte, contentType string) (*http.Response, error) {
+	if cfg.Gzip && len(body) >= cfg.GzipMinBytes && !gzipRejected.Load() {
+		compressed, err := gzipBytes(body)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(compressed))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Content-Encoding", "gzip")
+
+		resp, err := apiDo(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnsupportedMediaType {
+			return resp, nil
+		}
+		resp.Body.Close()
+		gzipRejected.Store(true)
+		warnf("Server rejected a gzip-encoded body (%s); sending uncompressed", resp.Status)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	return apiDo(req)
+}
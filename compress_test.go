@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// gzipServer records the Content-Encoding and decoded body of each request,
+// answering gzip-encoded ones with reject when it is not zero.
+type gzipServer struct {
+	*httptest.Server
+	reject int
+
+	mu        sync.Mutex
+	encodings []string
+	bodies    []string
+}
+
+func newGzipServer(t *testing.T, reject int) *gzipServer {
+	t.Helper()
+	s := &gzipServer{reject: reject}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := r.Header.Get("Content-Encoding")
+		var body io.Reader = r.Body
+		if encoding == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("body is not gzip: %v", err)
+				return
+			}
+			body = zr
+		}
+		data, _ := io.ReadAll(body)
+		s.mu.Lock()
+		s.encodings = append(s.encodings, encoding)
+		s.bodies = append(s.bodies, string(data))
+		s.mu.Unlock()
+		if encoding == "gzip" && s.reject != 0 {
+			w.WriteHeader(s.reject)
+		}
+	}))
+	t.Cleanup(s.Close)
+	saved := gzipRejected.Load()
+	gzipRejected.Store(false)
+	t.Cleanup(func() { gzipRejected.Store(saved) })
+	return s
+}
+
+func (s *gzipServer) requests() ([]string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.encodings...), append([]string(nil), s.bodies...)
+}
+
+func TestSendBodyCompressesLargeBodies(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Gzip, cfg.GzipMinBytes = true, 64
+	server := newGzipServer(t, 0)
+	small, large := `{"name":"sku-1"}`, strings.Repeat("x", 64)
+
+	for _, body := range []string{large, small} {
+		resp, err := sendBody(context.Background(), cfg, http.MethodPost, server.URL, []byte(body), "application/json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	encodings, bodies := server.requests()
+	if strings.Join(encodings, ",") != "gzip," {
+		t.Errorf("Content-Encoding = %q, want gzip for the large body only", encodings)
+	}
+	if len(bodies) != 2 || bodies[0] != large || bodies[1] != small {
+		t.Errorf("server received %q", bodies)
+	}
+}
+
+func TestSendBodyFallsBackOnlyOn415(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 64)
+	for _, tt := range []struct {
+		status    int
+		encodings string
+	}{
+		{http.StatusUnsupportedMediaType, "gzip,,"},
+		{http.StatusBadRequest, "gzip,gzip"},
+	} {
+		cfg := newTestConfig(t)
+		cfg.Gzip, cfg.GzipMinBytes = true, 64
+		server := newGzipServer(t, tt.status)
+		var codes []int
+		for i := 0; i < 2; i++ {
+			resp, err := sendBody(context.Background(), cfg, http.MethodPost, server.URL, body, "text/plain")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			codes = append(codes, resp.StatusCode)
+		}
+		// A 415 is retried plain and turns compression off for the run; a 400
+		// is the caller's to handle.
+		if encodings, _ := server.requests(); strings.Join(encodings, ",") != tt.encodings {
+			t.Errorf("%d: Content-Encoding = %q, want %s", tt.status, encodings, tt.encodings)
+		}
+		if tt.status == http.StatusBadRequest && codes[0] != http.StatusBadRequest {
+			t.Errorf("400: sendBody returned %d, want the 400", codes[0])
+		}
+		if tt.status == http.StatusUnsupportedMediaType && (codes[0] != http.StatusOK || !gzipRejected.Load()) {
+			t.Errorf("415: sendBody returned %d (rejected %v), want the plain retry's 200", codes[0], gzipRejected.Load())
+		}
+	}
+}
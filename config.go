@@ -0,0 +1,570 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config holds the runtime options for a sync run.
+type Config struct {
+	// DatasetGUID, AuthToken and BaseURL locate and authorize the dataset API;
+	// FolderPath holds generated documents and DBFileName is the SQLite
+	// database. They come from the environment; see loadEnv.
+	DatasetGUID string
+	AuthToken   string
+	BaseURL     string
+	FolderPath  string
+	DBFileName  string
+
+	// FeedUser and FeedPassword authenticate HTTP feed downloads; OutputPath
+	// is where the full feed is saved. Workers bounds concurrent uploads, and
+	// MaxFailures aborts the run once that many items failed (0 never does).
+	FeedUser     string
+	FeedPassword string
+	OutputPath   string
+	Workers      int
+	MaxFailures  int
+
+	// FeedAuthMode, FeedToken and FeedHeader select other feed
+	// authentication; main combines them with FeedUser and FeedPassword into
+	// FeedAuth.
+	FeedAuthMode FeedAuthMode
+	FeedToken    string
+	FeedHeader   string
+	FeedAuth     FeedAuth
+
+	// MetricsBackend selects the metrics implementation: none, statsd or prometheus.
+	// When empty, statsd is used if StatsDAddr is set and prometheus if
+	// MetricsAddr is; setting both then needs MetricsBackend to choose.
+	MetricsBackend string
+	StatsDAddr     string
+	MetricsAddr    string
+
+	// Scope limits the run to one feed partition; see Scope.
+	Scope Scope
+
+	// ScrapePolicy gates uploads on how much of the scrape succeeded.
+	// Items that fail it are deferred to DeadLetterPath.
+	ScrapePolicy   ScrapePolicy
+	DeadLetterPath string
+
+	// ManifestPath is the JSON-lines file with one line per uploaded document.
+	// Empty disables the manifest.
+	ManifestPath string
+
+	// PageLoad is how fetchSpecification waits for product pages, bounded by PageLoadTimeout.
+	PageLoad        PageLoadStrategy
+	PageLoadTimeout time.Duration
+
+	// ScrapeTimeout bounds one whole product page scrape; OnScrapeTimeout
+	// decides what happens to a product whose scrape runs out of time.
+	ScrapeTimeout   time.Duration
+	OnScrapeTimeout ScrapeTimeoutAction
+	// ScrapeConcurrency caps how many product pages are scraped at once,
+	// which is also the number of browsers kept running; 0 means Workers.
+	// Workers waiting for a browser still overlap uploads and database work.
+	ScrapeConcurrency int
+	// ScrapeRetries is how many more times a scrape whose page did not load
+	// or never showed the panel is retried, in a fresh tab.
+	ScrapeRetries int
+
+	// SinceField names the feed element holding each item's update time;
+	// when set, items not updated since the stored watermark are skipped.
+	// Full syncs every item anyway, and downloads the feed even when its
+	// cache validators say it is unchanged.
+	SinceField string
+	Full       bool
+
+	// SkipOutOfStock leaves out-of-stock items out of the feed, so they are
+	// not uploaded and are reconciled like removed products.
+	SkipOutOfStock bool
+
+	// NoScrape skips product page scraping. ScrapingEnabled is set by main:
+	// it is false with NoScrape or when no browser can be launched, and then
+	// documents are built from feed data only.
+	NoScrape        bool
+	ScrapingEnabled bool
+
+	// PruneRemote deletes remote documents the local database does not track.
+	// It asks for confirmation unless AssumeYes is set, and only reports in
+	// DryRun, which also makes the sync report its uploads, deletes and
+	// database writes instead of performing them; see configureDryRun.
+	PruneRemote bool
+	AssumeYes   bool
+	DryRun      bool
+
+	// GroupBy names the feed element (usually item_group_id) whose value folds
+	// variant items into one product document. Empty disables grouping.
+	GroupBy string
+
+	// ForceReupload regenerates and re-uploads every product in Scope, even
+	// when nothing about it changed, e.g. after a document template change.
+	ForceReupload bool
+
+	// KeepLocalFiles moves uploaded documents into an archive subfolder of
+	// FolderPath instead of deleting them.
+	KeepLocalFiles bool
+
+	// DownloadImages saves each uploaded product's image under the images
+	// subfolder and records its path; ImageMaxBytes bounds one image.
+	DownloadImages bool
+	ImageMaxBytes  int64
+
+	// ShowStats prints product counts by status and upload status, then exits
+	// without downloading the feed.
+	ShowStats bool
+
+	// RetryFailed re-uploads only the products whose last upload failed, plus
+	// the items waiting in the dead-letter queue, and leaves the rest alone.
+	RetryFailed bool
+
+	// ReprocessStatus re-uploads only the products with this status, or upload
+	// status for pending, uploaded and failed, from the last saved feed.
+	ReprocessStatus string
+
+	// Vacuum runs VACUUM and a WAL truncate at the end of the run. It also runs
+	// automatically once a run deletes VacuumThreshold products (0 disables).
+	Vacuum          bool
+	VacuumThreshold int
+
+	// Gzip compresses upload bodies of at least GzipMinBytes with
+	// Content-Encoding: gzip, falling back to plain bodies if the API refuses.
+	Gzip         bool
+	GzipMinBytes int
+
+	// DocNameTemplate names uploaded documents; see documentName.
+	DocNameTemplate string
+
+	// FormatTemplate is a text/template file replacing the built-in document
+	// layout; see documentData for the fields it can use.
+	FormatTemplate string
+
+	// MaxUploads stops the run from dispatching further work once it has
+	// performed this many uploads. 0 means unlimited.
+	MaxUploads int
+
+	// SuspiciousChangePct flags price changes larger than this percentage in
+	// the run report. 0 disables the report.
+	SuspiciousChangePct float64
+
+	// PriceGuardChangePct and PriceGuardFraction abort a run in which more than
+	// that fraction of stored products would change price by more than that
+	// percentage. Force applies such a feed anyway.
+	PriceGuardChangePct float64
+	PriceGuardFraction  float64
+	Force               bool
+
+	// BootstrapRemote seeds an empty database from the dataset's existing
+	// documents before the first run on a new machine.
+	BootstrapRemote bool
+
+	// ItemProcessors is a comma-separated list of ItemProcessor names run on
+	// every item before formatting.
+	ItemProcessors string
+
+	// DeleteConcurrency is the number of workers deleting stale products
+	// during reconcile, independent of the upload pool.
+	DeleteConcurrency int
+
+	// ChangesFeedURL is a changes-only feed applied instead of the full feed
+	// while the last full sync is younger than FullSyncEvery.
+	ChangesFeedURL string
+	FullSyncEvery  time.Duration
+
+	// EventsAMQPURL enables publishing product.created/updated/deleted events
+	// to EventsExchange on an AMQP broker.
+	EventsAMQPURL  string
+	EventsExchange string
+
+	// FormatVersion is stamped on every uploaded product. Unchanged products
+	// with an older stamp are re-uploaded, at most FormatMigrateMax per run.
+	FormatVersion    int
+	FormatMigrateMax int
+
+	// FeedURL is where the full feed is fetched from: an HTTP(S) URL,
+	// s3://bucket/key or gs://bucket/key. FeedFile reads a local file instead.
+	// Gzip-compressed feeds are decompressed transparently.
+	FeedURL  string
+	FeedFile string
+
+	// Feeds, from the config file, replace the command-line feed with several
+	// feeds synced one after another; see FeedConfig.
+	Feeds []FeedConfig
+
+	// PreferJSONLD reads schema.org Product JSON-LD from product pages over
+	// plain HTTP and only drives Chrome when a page has none.
+	PreferJSONLD bool
+
+	// Quiet hides progress logging and keeps warnings and errors; Silent also
+	// drops the run summary; Verbose adds debug messages. LogLevel, when set,
+	// replaces the level those imply. LogFormat is text or json; LogJSON is
+	// shorthand for json.
+	Quiet     bool
+	Silent    bool
+	LogLevel  string
+	LogFormat string
+	LogJSON   bool
+	Verbose   bool
+
+	// FileMode is the octal permission mode of generated files; the product
+	// folder gets the matching directory mode.
+	FileMode FileMode
+
+	// TempDir holds intermediate files such as in-progress feed downloads;
+	// empty uses TMPDIR or the system default.
+	TempDir string
+
+	// PreviewChunks prints how documents at this path would be chunked and
+	// exits; ValidateChunks warns about oversized segments during a sync.
+	// TokenEstimator names the token counting used by both.
+	PreviewChunks  string
+	ValidateChunks bool
+	TokenEstimator string
+
+	// RunStaleAfter is how long a run-in-progress marker without a heartbeat
+	// blocks other runs against the same database and dataset.
+	RunStaleAfter time.Duration
+
+	// SampleRate processes only this random fraction of the feed, chosen with
+	// SampleSeed, without reconciling anything; 0 processes the whole feed.
+	SampleRate float64
+	SampleSeed int64
+
+	// RecordDir captures every dataset API interaction; ReplayDir answers API
+	// requests from such a capture instead of the network.
+	RecordDir string
+	ReplayDir string
+
+	// SortBy orders feed items before dispatch; the zero value keeps feed order.
+	SortBy SortOrder
+
+	// StreamFeed uploads feed items as they download instead of saving the
+	// feed to disk first. Options that need the whole feed, and -resume, hold
+	// it in memory instead; -retry-failed still saves it.
+	StreamFeed bool
+
+	// Interval keeps the process running and starts a full sync this often;
+	// 0 runs once. HealthAddr serves the scheduler's health check.
+	Interval   time.Duration
+	HealthAddr string
+
+	// CredentialsPath is a JSON or YAML file with the feed and dataset
+	// credentials, kept out of the command line; see LoadConfig.
+	CredentialsPath string
+
+	// DeleteRemoved deletes the remote documents of products marked deleted
+	// after the feed pass and clears their document IDs; see reconcileDeletions.
+	DeleteRemoved bool
+
+	// HTTPTimeout bounds each dataset API request and the wait for the feed
+	// download's response headers; HTTPRetries is how often either is retried
+	// after a transient failure.
+	HTTPTimeout time.Duration
+	HTTPRetries int
+
+	// WaitIndexing polls each uploaded document's indexing status for up to
+	// IndexingTimeout and counts a document the API failed to index as a
+	// failed upload.
+	WaitIndexing    bool
+	IndexingTimeout time.Duration
+
+	// RateLimit caps uploads and deletes per second across all workers; 0
+	// disables the limit.
+	RateLimit float64
+
+	// ScrapeDebugDir receives a full-page screenshot, named by product ID, whenever
+	// a scrape leaves specification or category empty; at most ScrapeDebugMax per run.
+	ScrapeDebugDir string
+	ScrapeDebugMax int
+
+	// ConfigPath is an optional JSON file with settings that do not fit on the
+	// command line, such as the dataset targets.
+	ConfigPath string
+
+	// Targets lists the datasets this tool can upload to; TargetName picks the
+	// one used by this run and Target is the resolved, validated choice.
+	Targets    []DatasetTarget
+	TargetName string
+	Target     *DatasetTarget
+
+	// CheckpointEvery is how many completed items pass between checkpoint
+	// saves; Resume continues from the saved checkpoint when the feed is
+	// unchanged and resumes an interrupted run without asking. NewRun
+	// discards an interrupted run instead.
+	CheckpointEvery int
+	Resume          bool
+	NewRun          bool
+
+	// MinContentLength is the shortest formatted document, in characters, that
+	// is uploaded; shorter ones are deferred so a later scrape can fill them in.
+	MinContentLength int
+
+	// Source identifies the feed in upload metadata and is stored with each
+	// product; SourceLine also adds a [SOURCE] line.
+	Source     string
+	SourceLine bool
+
+	// FeedID partitions the database between feeds: products, cached scrapes,
+	// history and dead letters are keyed by feed ID and unique code, and
+	// reconcile and mark-deleted only touch the run's feed ID. The default is
+	// the empty feed ID, which rows stored before feed IDs existed belong to.
+	FeedID string
+
+	// ReconcileMode schedules deletion of products missing from the feed
+	// before, after or interleaved with the uploads; off keeps them.
+	ReconcileMode ReconcileMode
+
+	// BreakerThreshold consecutive API failures open the circuit breaker for BreakerCooldown.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// NetworkFailureThreshold consecutive network-level API failures pause
+	// API calls until a probe, backed off up to ReconnectMaxBackoff, succeeds.
+	NetworkFailureThreshold int
+	ReconnectMaxBackoff     time.Duration
+
+	// SigningKey enables signing of every API request with SigningAlgorithm.
+	SigningKey       string
+	SigningAlgorithm string
+
+	// OAuthTokenURL switches API authentication from the static token to the
+	// OAuth2 client-credentials flow.
+	OAuthTokenURL     string
+	OAuthClientID     string
+	OAuthClientSecret string
+	OAuthScopes       string
+
+	// Transforms are field rewrites applied to every feed item before formatting.
+	Transforms []TransformRule
+
+	// Pragmas are SQLite PRAGMA settings applied to every database connection;
+	// see knownPragmas for the supported names.
+	Pragmas map[string]string
+
+	// ScrapeRules sets the page selectors of this feed's storefront, and
+	// Selectors lists fallback CSS selectors per scraped field, tried in order.
+	ScrapeRules ScrapeRules
+	Selectors   map[string][]string
+}
+
+// fileConfig is the layout of the -config JSON file.
+type fileConfig struct {
+	Targets        []DatasetTarget     `json:"targets"`
+	Target         string              `json:"target"`
+	Transforms     []TransformRule     `json:"transforms"`
+	Pragmas        map[string]string   `json:"pragmas"`
+	FileMode       string              `json:"file_mode"`
+	Selectors      map[string][]string `json:"selectors"`
+	Rules          ScrapeRules         `json:"scrape_rules"`
+	FormatTemplate string              `json:"format_template"`
+	Feeds          []FeedConfig        `json:"feeds"`
+}
+
+// loadConfigFile merges the JSON file at cfg.ConfigPath into cfg. Values given
+// on the command line take precedence over the file.
+func loadConfigFile(cfg *Config) error {
+	if cfg.ConfigPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(cfg.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %v", cfg.ConfigPath, err)
+	}
+
+	var file fileConfig
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", cfg.ConfigPath, err)
+	}
+
+	cfg.Targets = file.Targets
+	cfg.Transforms = file.Transforms
+	cfg.Pragmas = file.Pragmas
+	cfg.Selectors = file.Selectors
+	cfg.ScrapeRules = file.Rules
+	cfg.Feeds = file.Feeds
+	if cfg.FileMode == 0 && file.FileMode != "" {
+		if err := cfg.FileMode.Set(file.FileMode); err != nil {
+			return fmt.Errorf("invalid file_mode in %s: %v", cfg.ConfigPath, err)
+		}
+	}
+	if cfg.TargetName == "" {
+		cfg.TargetName = file.Target
+	}
+	if cfg.FormatTemplate == "" {
+		cfg.FormatTemplate = file.FormatTemplate
+	}
+	return nil
+}
+
+// Environment variables read by loadEnv.
+const (
+	envDatasetGUID = "MBSYNC_DATASET_GUID"
+	envAuthToken   = "MBSYNC_AUTH_TOKEN"
+	envBaseURL     = "MBSYNC_BASE_URL"
+	envFolderPath  = "MBSYNC_FOLDER_PATH"
+	envDBFileName  = "MBSYNC_DB_FILE"
+)
+
+// loadEnv fills the deployment settings from the environment, falling back
+// to the built-in defaults. There is no default API token.
+func loadEnv(cfg *Config) {
+	cfg.DatasetGUID = envOr(envDatasetGUID, defaultDatasetGUID)
+	cfg.AuthToken = os.Getenv(envAuthToken)
+	cfg.BaseURL = strings.TrimRight(envOr(envBaseURL, defaultBaseURL), "/")
+	cfg.FolderPath = envOr(envFolderPath, defaultFolderPath)
+	cfg.DBFileName = envOr(envDBFileName, defaultDBFileName)
+}
+
+// envOr returns the environment variable key, or fallback when it is unset or empty.
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// missingRequiredFlags lists the required settings cfg still lacks once the
+// command line, the environment and the credentials and config files are
+// merged. A run that only reports or previews needs none; otherwise a feed
+// location is needed unless the config file lists feeds, and an API token
+// unless OAuth2 is configured.
+func missingRequiredFlags(cfg *Config) []string {
+	if cfg.ShowStats || cfg.PreviewChunks != "" {
+		return nil
+	}
+	var missing []string
+	if cfg.FeedURL == "" && cfg.FeedFile == "" && len(cfg.Feeds) == 0 {
+		missing = append(missing, "-feed-url, -feed-file or feed_url")
+	}
+	if cfg.AuthToken == "" && cfg.OAuthTokenURL == "" {
+		missing = append(missing, envAuthToken+", -oauth-token-url or auth_token")
+	}
+	return missing
+}
+
+// parseFlags builds a Config from the environment and the command line;
+// flags override the environment.
+func parseFlags() *Config {
+	cfg := &Config{
+		ScrapePolicy:    ScrapeRequireNone,
+		PageLoad:        PageLoadWaitForSelector,
+		ReconcileMode:   ReconcileOff,
+		OnScrapeTimeout: ScrapeTimeoutUpload,
+	}
+	loadEnv(cfg)
+	flag.StringVar(&cfg.FeedUser, "user", "", "username for HTTP basic auth on the feed download")
+	flag.StringVar(&cfg.FeedPassword, "pass", "", "password for HTTP basic auth on the feed download")
+	flag.Var(&cfg.FeedAuthMode, "feed-auth", "feed download auth: none, basic, bearer or header (default basic when -user or -pass is set, else none)")
+	flag.StringVar(&cfg.FeedToken, "feed-token", "", "bearer token for -feed-auth bearer")
+	flag.StringVar(&cfg.FeedHeader, "feed-header", "", "\"Name: value\" header for -feed-auth header, e.g. an API key")
+	flag.StringVar(&cfg.OutputPath, "out", "./facebook_shop.xml", "where the downloaded feed is saved")
+	flag.StringVar(&cfg.DBFileName, "db", cfg.DBFileName, "SQLite database file (default from "+envDBFileName+")")
+	flag.IntVar(&cfg.Workers, "workers", defaultWorkers, "number of items processed concurrently")
+	flag.IntVar(&cfg.MaxFailures, "max-failures", 0, "abort the run once this many items failed to sync (0 never aborts)")
+	flag.StringVar(&cfg.MetricsBackend, "metrics-backend", "", "metrics backend: none, statsd or prometheus")
+	flag.StringVar(&cfg.StatsDAddr, "statsd-addr", "", "StatsD agent address (host:port); metrics are disabled when empty")
+	flag.StringVar(&cfg.MetricsAddr, "metrics-addr", "", "listen address for a Prometheus /metrics endpoint, e.g. :9090 (disabled when empty)")
+	flag.Var(&cfg.Scope, "scope", "only sync and reconcile products in this partition: brand:<name>, category:<product_type> or prefix:<id prefix>")
+	flag.Var(&cfg.ScrapePolicy, "scrape-policy", "upload gate for partial scrapes: require-both, require-any or require-none")
+	flag.StringVar(&cfg.DeadLetterPath, "dead-letter", "./dead_letter.jsonl", "JSON-lines file of deferred items retried on the next run")
+	flag.StringVar(&cfg.ManifestPath, "manifest", "./manifest.jsonl", "JSON-lines manifest of uploaded documents (empty to disable)")
+	flag.Var(&cfg.PageLoad, "page-load", "product page wait strategy: domcontentloaded, load, networkidle or wait-for-selector")
+	flag.DurationVar(&cfg.PageLoadTimeout, "page-load-timeout", 15*time.Second, "maximum time to wait for a product page to load")
+	flag.DurationVar(&cfg.ScrapeTimeout, "scrape-timeout", 20*time.Second, "maximum time for one product page scrape")
+	flag.StringVar(&cfg.SinceField, "since", "", "feed element with each item's update time; only items updated after the last run are synced")
+	flag.BoolVar(&cfg.Full, "full", false, "sync every item, ignoring the -since watermark and an unchanged feed's cache validators")
+	flag.BoolVar(&cfg.SkipOutOfStock, "skip-out-of-stock", false, "treat out-of-stock items as missing from the feed instead of uploading them")
+	flag.BoolVar(&cfg.NoScrape, "no-scrape", false, "do not scrape product pages; upload documents built from feed data only")
+	flag.IntVar(&cfg.ScrapeConcurrency, "scrape-concurrency", 0, "maximum concurrent product page scrapes and browsers (0 uses -workers)")
+	flag.IntVar(&cfg.ScrapeRetries, "scrape-retries", 2, "retries of a product page scrape whose navigation failed or whose selectors never appeared")
+	flag.Var(&cfg.OnScrapeTimeout, "on-scrape-timeout", "what to do with a product whose scrape times out: upload (without the scraped fields) or skip")
+	flag.BoolVar(&cfg.PruneRemote, "prune-remote", false, "delete remote documents that are not tracked in the local database")
+	flag.BoolVar(&cfg.AssumeYes, "yes", false, "do not ask for confirmation before destructive steps")
+	flag.BoolVar(&cfg.DryRun, "dry-run", false, "report uploads, deletes and database writes without performing them")
+	flag.StringVar(&cfg.GroupBy, "group-by", "", "feed element grouping variants into one product, e.g. item_group_id")
+	flag.BoolVar(&cfg.ForceReupload, "force-reupload", false, "regenerate and re-upload every product in -scope even if unchanged")
+	flag.BoolVar(&cfg.ShowStats, "stats", false, "print product counts by status and upload status, then exit")
+	flag.BoolVar(&cfg.RetryFailed, "retry-failed", false, "re-upload only failed-upload products and dead-letter items, then exit")
+	flag.StringVar(&cfg.ReprocessStatus, "reprocess-status", "", "re-upload only products with this status (e.g. updated) or upload status (e.g. failed) from the last saved feed, then exit")
+	flag.BoolVar(&cfg.Vacuum, "vacuum", false, "compact the database file and truncate the WAL at the end of the run")
+	flag.IntVar(&cfg.VacuumThreshold, "vacuum-threshold", 1000, "run -vacuum automatically when a run deletes at least this many products (0 disables)")
+	flag.BoolVar(&cfg.Gzip, "gzip", false, "gzip-compress upload request bodies")
+	flag.IntVar(&cfg.GzipMinBytes, "gzip-min-bytes", 8192, "only compress upload bodies of at least this many bytes")
+	flag.StringVar(&cfg.DocNameTemplate, "doc-name", defaultDocumentNameTemplate, "document name template; {id} is the product's unique code")
+	flag.StringVar(&cfg.FormatTemplate, "format-template", "", "text/template file for the document text (built-in layout when empty); bump -format-version after changing it")
+	flag.IntVar(&cfg.MaxUploads, "max-uploads", 0, "stop after this many uploads in one run (0 for no limit)")
+	flag.Float64Var(&cfg.SuspiciousChangePct, "suspicious-change-pct", 50, "report price changes larger than this percentage (0 disables)")
+	flag.Float64Var(&cfg.PriceGuardChangePct, "price-guard-change", 80, "percent price change that counts as a swing for the bad-feed guard (0 disables)")
+	flag.Float64Var(&cfg.PriceGuardFraction, "price-guard-fraction", 0.5, "abort when more than this fraction of stored products swing in price (0 disables)")
+	flag.BoolVar(&cfg.Force, "force", false, "apply the feed even if the bad-feed guard rejects it")
+	flag.BoolVar(&cfg.BootstrapRemote, "bootstrap-remote", false, "when the database is empty, seed it from the documents already in the dataset")
+	flag.StringVar(&cfg.ItemProcessors, "item-processors", "", "comma-separated item processors to run before formatting, e.g. collapse-whitespace")
+	flag.IntVar(&cfg.DeleteConcurrency, "delete-concurrency", 10, "number of concurrent deletes during -reconcile-mode")
+	flag.StringVar(&cfg.ChangesFeedURL, "changes-feed-url", "", "changes-only feed used for incremental runs between full syncs")
+	flag.DurationVar(&cfg.FullSyncEvery, "full-sync-every", 24*time.Hour, "run a full feed sync and reconcile at least this often when -changes-feed-url is set")
+	flag.StringVar(&cfg.EventsAMQPURL, "events-amqp-url", "", "AMQP broker URL for product change events (disabled when empty)")
+	flag.StringVar(&cfg.EventsExchange, "events-exchange", "mbsync.products", "AMQP topic exchange product events are published to")
+	flag.IntVar(&cfg.FormatVersion, "format-version", documentFormatVersion, "document format version; older documents are re-uploaded")
+	flag.IntVar(&cfg.FormatMigrateMax, "format-migrate-max", 100, "maximum outdated documents to re-upload per run (0 for no limit)")
+	flag.StringVar(&cfg.FeedURL, "feed-url", "", "feed location: http(s) URL, s3://bucket/key or gs://bucket/key")
+	flag.StringVar(&cfg.FeedFile, "feed-file", "", "read the feed from this local file instead of downloading it")
+	flag.BoolVar(&cfg.PreferJSONLD, "jsonld", false, "extract product data from schema.org JSON-LD when present, falling back to Chrome selectors")
+	flag.BoolVar(&cfg.Quiet, "quiet", false, "only log warnings and errors; the run summary is still printed")
+	flag.BoolVar(&cfg.Silent, "silent", false, "like -quiet, and also suppress the run summary")
+	flag.StringVar(&cfg.LogFormat, "log-format", "text", "log output format: text or json")
+	flag.BoolVar(&cfg.LogJSON, "log-json", false, "log as JSON; shorthand for -log-format json")
+	flag.StringVar(&cfg.LogLevel, "log-level", "", "minimum log level: debug, info, warn or error (overrides -verbose and -quiet)")
+	flag.Var(&cfg.FileMode, "file-mode", "octal permission mode of generated files, e.g. 0640 or 0664 (default 0644)")
+	flag.StringVar(&cfg.TempDir, "temp-dir", "", "directory for intermediate files such as feed downloads (default $TMPDIR)")
+	flag.StringVar(&cfg.PreviewChunks, "preview-chunks", "", "print the chunks the API would make of this document file or folder, then exit")
+	flag.BoolVar(&cfg.ValidateChunks, "validate-chunks", false, "warn about document segments longer than the target's max_tokens")
+	flag.StringVar(&cfg.TokenEstimator, "token-estimator", "words", "token estimate used for chunking: words or chars")
+	flag.DurationVar(&cfg.RunStaleAfter, "run-stale-after", 10*time.Minute, "treat another run's marker as left over from a crash after this long without a heartbeat")
+	flag.Float64Var(&cfg.SampleRate, "sample-rate", 0, "process only this random fraction (0-1] of the feed, without reconcile or deletes (0 disables)")
+	flag.Int64Var(&cfg.SampleSeed, "sample-seed", 0, "random seed for -sample-rate (default: time-based, logged)")
+	flag.StringVar(&cfg.RecordDir, "record-dir", "", "record every dataset API request and response into this directory, with credentials redacted")
+	flag.StringVar(&cfg.ReplayDir, "replay-dir", "", "answer dataset API requests from a -record-dir capture instead of the network")
+	flag.Var(&cfg.SortBy, "sort-by", "process items in this order: price, inventory, brand or id, optionally with :asc or :desc (default feed order)")
+	flag.BoolVar(&cfg.StreamFeed, "stream-feed", false, "parse the feed while downloading it instead of saving it to disk first")
+	flag.BoolVar(&cfg.Verbose, "verbose", false, "also log debug messages, such as which selector matched")
+	flag.DurationVar(&cfg.Interval, "interval", 0, "keep running and start a sync this often, skipping a tick while a run is in progress (0 runs once)")
+	flag.StringVar(&cfg.HealthAddr, "health-addr", "", "address for the /healthz endpoint in -interval mode, e.g. :8081 (disabled when empty)")
+	flag.StringVar(&cfg.CredentialsPath, "credentials", "", "JSON or YAML file with feed_url, feed_user, feed_password, feed_token, dataset_guid, auth_token, workers and folder_path")
+	flag.BoolVar(&cfg.DeleteRemoved, "delete-removed", false, "after the sync, delete the remote documents of products that are marked deleted")
+	flag.DurationVar(&cfg.HTTPTimeout, "http-timeout", defaultHTTPTimeout, "timeout of each dataset API request, including the body, and of waiting for the feed download to start")
+	flag.BoolVar(&cfg.WaitIndexing, "wait-indexing", false, "after each upload, wait for the dataset to finish indexing the document")
+	flag.DurationVar(&cfg.IndexingTimeout, "indexing-timeout", 2*time.Minute, "how long -wait-indexing waits for one document")
+	flag.IntVar(&cfg.HTTPRetries, "http-retries", 3, "retries of API requests and feed downloads after 429, 5xx or connection errors, with exponential backoff (0 disables)")
+	flag.Float64Var(&cfg.RateLimit, "rate-limit", 0, "maximum uploads and deletes per second across all workers (0 for no limit)")
+	flag.BoolVar(&cfg.KeepLocalFiles, "keep-local-files", false, "move uploaded documents into an archive subfolder of the product folder instead of deleting them")
+	flag.BoolVar(&cfg.DownloadImages, "download-images", false, "download each uploaded product's image into the images subfolder of the product folder")
+	flag.Int64Var(&cfg.ImageMaxBytes, "image-max-bytes", 10<<20, "largest product image -download-images saves, in bytes")
+	flag.StringVar(&cfg.ScrapeDebugDir, "scrape-debug-dir", "", "save a screenshot of product pages whose scrape came back empty into this directory")
+	flag.IntVar(&cfg.ScrapeDebugMax, "scrape-debug-max", 50, "maximum number of debug screenshots per run")
+	flag.StringVar(&cfg.ConfigPath, "config", "", "JSON config file with dataset targets, transform rules, SQLite pragmas, scrape rules and selectors")
+	flag.StringVar(&cfg.TargetName, "target", "", "name of the dataset target to upload to (default: first configured)")
+	flag.IntVar(&cfg.CheckpointEvery, "checkpoint-every", 100, "save a resume checkpoint after this many processed items (0 disables)")
+	flag.BoolVar(&cfg.Resume, "resume", false, "resume an interrupted run, skipping products it already synced")
+	flag.BoolVar(&cfg.NewRun, "new-run", false, "start a new run even if an interrupted run could be resumed")
+	flag.IntVar(&cfg.MinContentLength, "min-content-length", 0, "defer documents shorter than this many characters instead of uploading them")
+	flag.StringVar(&cfg.Source, "source", "", "identifier of this feed, sent as document metadata and stored with each product")
+	flag.StringVar(&cfg.FeedID, "feed-id", "", "ID of this feed's products in the database; feeds sharing a database need distinct IDs")
+	flag.BoolVar(&cfg.SourceLine, "source-line", false, "also write a [SOURCE] line into each document")
+	flag.Var(&cfg.ReconcileMode, "reconcile-mode", "when to delete products missing from the feed: off, before, after or interleaved")
+	flag.IntVar(&cfg.BreakerThreshold, "breaker-threshold", 5, "consecutive API failures that open the circuit breaker (0 disables)")
+	flag.DurationVar(&cfg.BreakerCooldown, "breaker-cooldown", 30*time.Second, "how long the circuit breaker stays open")
+	flag.IntVar(&cfg.NetworkFailureThreshold, "network-failure-threshold", 3, "consecutive network failures that pause API calls until the API is reachable (0 disables)")
+	flag.DurationVar(&cfg.ReconnectMaxBackoff, "reconnect-max-backoff", time.Minute, "longest wait between API reachability probes during a network outage")
+	flag.StringVar(&cfg.SigningKey, "signing-key", "", "key used to sign API requests (signing is disabled when empty)")
+	flag.StringVar(&cfg.SigningAlgorithm, "signing-alg", "hmac-sha256", "API request signing algorithm")
+	flag.StringVar(&cfg.OAuthTokenURL, "oauth-token-url", "", "OAuth2 token endpoint for client-credentials API authentication")
+	flag.StringVar(&cfg.OAuthClientID, "oauth-client-id", "", "OAuth2 client ID")
+	flag.StringVar(&cfg.OAuthClientSecret, "oauth-client-secret", "", "OAuth2 client secret")
+	flag.StringVar(&cfg.OAuthScopes, "oauth-scopes", "", "comma-separated OAuth2 scopes")
+	flag.Parse()
+	return cfg
+}
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestLoadEnv(t *testing.T) {
+	t.Setenv(envDatasetGUID, "env-dataset")
+	t.Setenv(envAuthToken, "env-token")
+	t.Setenv(envBaseURL, "https://api.example/")
+	t.Setenv(envFolderPath, "/srv/docs")
+	t.Setenv(envDBFileName, "")
+
+	var cfg Config
+	loadEnv(&cfg)
+	want := Config{
+		DatasetGUID: "env-dataset",
+		AuthToken:   "env-token",
+		BaseURL:     "https://api.example",
+		FolderPath:  "/srv/docs",
+		DBFileName:  defaultDBFileName,
+	}
+	if cfg.DatasetGUID != want.DatasetGUID || cfg.AuthToken != want.AuthToken || cfg.BaseURL != want.BaseURL ||
+		cfg.FolderPath != want.FolderPath || cfg.DBFileName != want.DBFileName {
+		t.Errorf("loadEnv() = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestLoadEnvDefaults(t *testing.T) {
+	for _, key := range []string{envDatasetGUID, envAuthToken, envBaseURL, envFolderPath, envDBFileName} {
+		t.Setenv(key, "")
+	}
+	var cfg Config
+	loadEnv(&cfg)
+	if cfg.DatasetGUID != defaultDatasetGUID || cfg.BaseURL != defaultBaseURL || cfg.FolderPath != defaultFolderPath {
+		t.Errorf("loadEnv() without the environment = %+v, want the defaults", cfg)
+	}
+	if cfg.AuthToken != "" {
+		t.Errorf("AuthToken = %q, want no default token", cfg.AuthToken)
+	}
+	if _, err := newTokenProvider(&cfg); err == nil {
+		t.Error("newTokenProvider accepted a config without a token")
+	}
+}
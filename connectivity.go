@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// apiConnectivity pauses dataset API calls during a network outage; main
+// applies the configured limits.
+var apiConnectivity = newConnectivityMonitor(3, time.Second, time.Minute, apiProbe(defaultBaseURL))
+
+// connectivityMonitor tracks network-level failures of API calls. After
+// threshold consecutive failures it declares the API offline: callers block
+// in Wait while a single goroutine probes the API with exponential backoff,
+// and all of them resume once a probe succeeds. HTTP error responses are not
+// network failures and are left to the circuit breaker.
+type connectivityMonitor struct {
+	mu         sync.Mutex
+	threshold  int
+	failures   int
+	online     chan struct{} // closed when the outage ends; nil while online
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	probe      func(ctx context.Context) error
+}
+
+func newConnectivityMonitor(threshold int, minBackoff, maxBackoff time.Duration, probe func(ctx context.Context) error) *connectivityMonitor {
+	return &connectivityMonitor{threshold: threshold, minBackoff: minBackoff, maxBackoff: maxBackoff, probe: probe}
+}
+
+// Wait blocks while the API is offline, or until ctx is done.
+func (m *connectivityMonitor) Wait(ctx context.Context) error {
+	m.mu.Lock()
+	online := m.online
+	m.mu.Unlock()
+	if online == nil {
+		return nil
+	}
+	select {
+	case <-online:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Record feeds the outcome of a call into the monitor. It reports whether err
+// was a network failure seen while the API is, or has just been declared,
+// offline, in which case the caller should Wait and send the request again.
+func (m *connectivityMonitor) Record(ctx context.Context, err error) bool {
+	if m.threshold <= 0 || !isNetworkFailure(ctx, err) {
+		if err == nil {
+			m.mu.Lock()
+			m.failures = 0
+			m.mu.Unlock()
+		}
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures++
+	if m.online != nil {
+		return true
+	}
+	if m.failures < m.threshold {
+		return false
+	}
+	m.online = make(chan struct{})
+	go m.reconnect(m.online)
+	return true
+}
+
+// reconnect probes the API until it answers, then ends the outage.
+func (m *connectivityMonitor) reconnect(online chan struct{}) {
+	start := time.Now()
+	warnf("Dataset API unreachable after %d network failures; pausing API calls", m.threshold)
+	metrics.IncCounter(metricAPIOutages)
+	metrics.SetGauge(metricAPIOffline, 1)
+
+	backoff := m.minBackoff
+	for attempt := 1; ; attempt++ {
+		time.Sleep(backoff)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := m.probe(ctx)
+		cancel()
+		if err == nil {
+			break
+		}
+		backoff *= 2
+		if backoff > m.maxBackoff {
+			backoff = m.maxBackoff
+		}
+		infof("Dataset API still unreachable (probe %d): %v; next probe in %v", attempt, err, backoff)
+	}
+
+	outage := time.Since(start)
+	m.mu.Lock()
+	m.failures = 0
+	m.online = nil
+	m.mu.Unlock()
+	close(online)
+	warnf("Dataset API reachable again after %v; resuming API calls", outage.Round(time.Second))
+	metrics.SetGauge(metricAPIOffline, 0)
+	metrics.ObserveDuration(metricAPIOutageDuration, outage)
+}
+
+// isNetworkFailure reports whether err is a transport-level failure, as
+// opposed to a cancellation by the caller.
+func isNetworkFailure(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, errCircuitOpen)
+}
+
+// apiProbe returns a probe that sends an unauthenticated HEAD request to the
+// API root at baseURL. Any HTTP response, whatever its status, means the
+// network is back.
+func apiProbe(baseURL string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, baseURL+"/", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := apiClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConnectivityMonitorPausesUntilProbeSucceeds(t *testing.T) {
+	var reachable atomic.Bool
+	var probes int32
+	monitor := newConnectivityMonitor(2, time.Millisecond, 5*time.Millisecond, func(context.Context) error {
+		atomic.AddInt32(&probes, 1)
+		if reachable.Load() {
+			return nil
+		}
+		return errors.New("connection refused")
+	})
+	ctx := context.Background()
+	networkErr := errors.New("dial tcp: connection refused")
+
+	if monitor.Record(ctx, networkErr) {
+		t.Fatal("one failure declared an outage")
+	}
+	if !monitor.Record(ctx, networkErr) {
+		t.Fatal("reaching the threshold did not declare an outage")
+	}
+
+	cancelled, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := monitor.Wait(cancelled); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait() during the outage = %v, want the context's error", err)
+	}
+	reachable.Store(true)
+	waited, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := monitor.Wait(waited); err != nil {
+		t.Fatalf("Wait() after the API came back = %v", err)
+	}
+	if n := atomic.LoadInt32(&probes); n < 2 {
+		t.Errorf("probed %d times, want a failed probe before the successful one", n)
+	}
+	if monitor.Record(ctx, nil) || monitor.Wait(ctx) != nil {
+		t.Error("monitor did not return to online")
+	}
+}
+
+func TestConnectivityMonitorIgnoresCancellation(t *testing.T) {
+	monitor := newConnectivityMonitor(1, time.Millisecond, time.Millisecond, func(context.Context) error { return nil })
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if monitor.Record(ctx, context.Canceled) {
+		t.Error("a cancelled call declared an outage")
+	}
+	if monitor.Record(context.Background(), errCircuitOpen) {
+		t.Error("an open circuit breaker declared an outage")
+	}
+}
+
+// flakyTransport fails the first failures requests with a network error and
+// passes the rest to http.DefaultTransport.
+type flakyTransport struct {
+	mu       sync.Mutex
+	failures int
+}
+
+func (f *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	fail := f.failures > 0
+	if fail {
+		f.failures--
+	}
+	f.mu.Unlock()
+	if fail {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, errors.New("dial tcp: connection refused")
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestAPIDoResendsAfterOutage(t *testing.T) {
+	newTestConfig(t)
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	savedClient, savedMonitor := apiClient, apiConnectivity
+	t.Cleanup(func() { apiClient, apiConnectivity = savedClient, savedMonitor })
+	apiClient = &http.Client{Transport: &flakyTransport{failures: 2}}
+	apiConnectivity = newConnectivityMonitor(1, time.Millisecond, time.Millisecond, func(context.Context) error { return nil })
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/datasets/d/document/create_by_file", bytes.NewReader([]byte("payload")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := apiDo(req)
+	if err != nil {
+		t.Fatalf("apiDo() = %v, want the request resent once the API is back", err)
+	}
+	resp.Body.Close()
+	if string(body) != "payload" {
+		t.Errorf("server received %q, want the replayed body", body)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables the credentials file falls back to, alongside those
+// read by loadEnv.
+const (
+	envFeedURL      = "MBSYNC_FEED_URL"
+	envFeedUser     = "MBSYNC_FEED_USER"
+	envFeedPassword = "MBSYNC_FEED_PASSWORD"
+	envFeedToken    = "MBSYNC_FEED_TOKEN"
+	envWorkers      = "MBSYNC_WORKERS"
+)
+
+// credentialsFile is the layout of the -credentials JSON or YAML file.
+type credentialsFile struct {
+	FeedURL      string `json:"feed_url" yaml:"feed_url"`
+	FeedUser     string `json:"feed_user" yaml:"feed_user"`
+	FeedPassword string `json:"feed_password" yaml:"feed_password"`
+	FeedToken    string `json:"feed_token" yaml:"feed_token"`
+	DatasetGUID  string `json:"dataset_guid" yaml:"dataset_guid"`
+	AuthToken    string `json:"auth_token" yaml:"auth_token"`
+	Workers      int    `json:"workers" yaml:"workers"`
+	FolderPath   string `json:"folder_path" yaml:"folder_path"`
+}
+
+// LoadConfig reads the feed and dataset credentials from the file at path,
+// parsed as YAML for .yaml and .yml files and as JSON otherwise. Keys the file
+// leaves out come from the environment; an empty path reads the environment
+// only. It fails naming every required setting that is still missing.
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{Workers: defaultWorkers}
+	loadEnv(cfg)
+	if err := mergeCredentialSources(cfg, path, nil); err != nil {
+		return nil, err
+	}
+	if missing := missingRequiredFlags(cfg); len(missing) > 0 {
+		return nil, fmt.Errorf("missing required settings: %s", strings.Join(missing, ", "))
+	}
+	if cfg.Workers < 1 {
+		return nil, fmt.Errorf("workers must be at least 1, got %d", cfg.Workers)
+	}
+	return cfg, nil
+}
+
+// mergeCredentialSources merges the credential environment variables and then
+// the credentials file at path, if any, into cfg. Settings whose flag is in
+// set were given on the command line and are left alone.
+func mergeCredentialSources(cfg *Config, path string, set map[string]bool) error {
+	env := &credentialsFile{
+		FeedURL:      os.Getenv(envFeedURL),
+		FeedUser:     os.Getenv(envFeedUser),
+		FeedPassword: os.Getenv(envFeedPassword),
+		FeedToken:    os.Getenv(envFeedToken),
+	}
+	if value := os.Getenv(envWorkers); value != "" {
+		workers, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %v", envWorkers, value, err)
+		}
+		env.Workers = workers
+	}
+	mergeCredentials(cfg, env, set)
+
+	if path != "" {
+		file, err := readCredentialsFile(path)
+		if err != nil {
+			return err
+		}
+		mergeCredentials(cfg, file, set)
+	}
+	return nil
+}
+
+// readCredentialsFile parses the credentials file at path.
+func readCredentialsFile(path string) (*credentialsFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file %s: %v", path, err)
+	}
+
+	var file credentialsFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &file)
+	default:
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse credentials file %s: %v", path, err)
+	}
+	return &file, nil
+}
+
+// mergeCredentials copies the keys present in file into cfg, except those
+// whose flag is in set.
+func mergeCredentials(cfg *Config, file *credentialsFile, set map[string]bool) {
+	if file.FeedURL != "" && !set["feed-url"] && !set["feed-file"] {
+		cfg.FeedURL = file.FeedURL
+	}
+	if file.FeedUser != "" && !set["user"] {
+		cfg.FeedUser = file.FeedUser
+	}
+	if file.FeedPassword != "" && !set["pass"] {
+		cfg.FeedPassword = file.FeedPassword
+	}
+	if file.FeedToken != "" && !set["feed-token"] {
+		cfg.FeedToken = file.FeedToken
+	}
+	if file.DatasetGUID != "" {
+		cfg.DatasetGUID = file.DatasetGUID
+	}
+	if file.AuthToken != "" {
+		cfg.AuthToken = file.AuthToken
+	}
+	if file.Workers != 0 && !set["workers"] {
+		cfg.Workers = file.Workers
+	}
+	if file.FolderPath != "" {
+		cfg.FolderPath = file.FolderPath
+	}
+}
+
+// applyCredentials merges cfg.CredentialsPath into cfg, which parseFlags has
+// already filled from the environment and the command line. Flags given on the
+// command line take precedence; required settings are checked by the caller
+// once every source is merged.
+func applyCredentials(cfg *Config) error {
+	if cfg.CredentialsPath == "" {
+		return nil
+	}
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if err := mergeCredentialSources(cfg, cfg.CredentialsPath, set); err != nil {
+		return fmt.Errorf("%s: %v", cfg.CredentialsPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// clearCredentialEnv unsets every variable LoadConfig reads for the rest of the test.
+func clearCredentialEnv(t *testing.T) {
+	t.Helper()
+	for _, key := range []string{envDatasetGUID, envAuthToken, envBaseURL, envFolderPath, envDBFileName,
+		envFeedURL, envFeedUser, envFeedPassword, envFeedToken, envWorkers} {
+		t.Setenv(key, "")
+	}
+}
+
+// writeCredentials writes content to a credentials file called name.
+func writeCredentials(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFormats(t *testing.T) {
+	files := map[string]string{
+		"credentials.json": `{"feed_url":"https://shop.example/feed.xml","feed_user":"shop","auth_token":"secret","workers":4}`,
+		"credentials.yaml": "feed_url: https://shop.example/feed.xml\nfeed_user: shop\nauth_token: secret\nworkers: 4\n",
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			clearCredentialEnv(t)
+			cfg, err := LoadConfig(writeCredentials(t, name, content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.FeedURL != "https://shop.example/feed.xml" || cfg.FeedUser != "shop" || cfg.AuthToken != "secret" || cfg.Workers != 4 {
+				t.Errorf("LoadConfig() = %+v", cfg)
+			}
+			if cfg.DatasetGUID != defaultDatasetGUID {
+				t.Errorf("DatasetGUID = %q, want the default for a key the file leaves out", cfg.DatasetGUID)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFallsBackToEnvironment(t *testing.T) {
+	clearCredentialEnv(t)
+	t.Setenv(envFeedURL, "https://env.example/feed.xml")
+	t.Setenv(envAuthToken, "env-secret")
+	t.Setenv(envWorkers, "3")
+
+	cfg, err := LoadConfig(writeCredentials(t, "credentials.json", `{"auth_token":"file-secret"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.FeedURL != "https://env.example/feed.xml" || cfg.AuthToken != "file-secret" || cfg.Workers != 3 {
+		t.Errorf("LoadConfig() = %+v, want the file over the environment", cfg)
+	}
+}
+
+func TestLoadConfigReportsMissingKeys(t *testing.T) {
+	clearCredentialEnv(t)
+	_, err := LoadConfig("")
+	if err == nil || !strings.Contains(err.Error(), "feed_url") || !strings.Contains(err.Error(), "auth_token") {
+		t.Errorf("LoadConfig() = %v, want both missing keys named", err)
+	}
+
+	t.Setenv(envAuthToken, "env-secret")
+	t.Setenv(envWorkers, "2")
+	if _, err := LoadConfig(""); err == nil || !strings.Contains(err.Error(), "feed_url") || strings.Contains(err.Error(), "auth_token") {
+		t.Errorf("LoadConfig() = %v, want only the feed location missing once the token is in the environment", err)
+	}
+
+	t.Setenv(envWorkers, "many")
+	if _, err := LoadConfig(""); err == nil {
+		t.Error("LoadConfig accepted a non-numeric worker count")
+	}
+	t.Setenv(envWorkers, "")
+	if _, err := LoadConfig(writeCredentials(t, "credentials.yml", "feed_url: [")); err == nil {
+		t.Error("LoadConfig accepted malformed YAML")
+	}
+}
+
+func TestApplyCredentialsLeavesOtherSourcesInPlace(t *testing.T) {
+	clearCredentialEnv(t)
+	t.Setenv(envAuthToken, "env-secret")
+	cfg := &Config{Workers: defaultWorkers}
+	loadEnv(cfg)
+	cfg.FeedFile = "feed.xml"
+	cfg.CredentialsPath = writeCredentials(t, "credentials.yaml", "feed_user: shop\n")
+
+	if err := applyCredentials(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.FeedUser != "shop" || cfg.AuthToken != "env-secret" || cfg.FeedFile != "feed.xml" {
+		t.Errorf("applyCredentials() = %+v, want the file merged over the environment and -feed-file", cfg)
+	}
+	if missing := missingRequiredFlags(cfg); len(missing) != 0 {
+		t.Errorf("missingRequiredFlags() = %v, want none with -feed-file and an environment token", missing)
+	}
+}
+
+func TestMergeCredentialSourcesKeepsFlags(t *testing.T) {
+	clearCredentialEnv(t)
+	t.Setenv(envWorkers, "3")
+	cfg := &Config{FeedURL: "https://flag.example/feed.xml", Workers: 8}
+	path := writeCredentials(t, "credentials.json", `{"feed_url":"https://file.example/feed.xml","auth_token":"file-secret","workers":4}`)
+
+	if err := mergeCredentialSources(cfg, path, map[string]bool{"feed-url": true, "workers": true}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.FeedURL != "https://flag.example/feed.xml" || cfg.Workers != 8 || cfg.AuthToken != "file-secret" {
+		t.Errorf("merged config = %+v, want the flags kept and the token from the file", cfg)
+	}
+}
+
+func TestMissingRequiredFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want int
+	}{
+		{"feed URL and token", Config{FeedURL: "https://shop.example/feed.xml", AuthToken: "secret"}, 0},
+		{"feeds and OAuth2", Config{Feeds: []FeedConfig{{Name: "shop"}}, OAuthTokenURL: "https://auth.example/token"}, 0},
+		{"stats only", Config{ShowStats: true}, 0},
+		{"no token", Config{FeedFile: "feed.xml"}, 1},
+		{"nothing", Config{}, 2},
+	}
+	for _, tt := range tests {
+		if missing := missingRequiredFlags(&tt.cfg); len(missing) != tt.want {
+			t.Errorf("%s: missingRequiredFlags() = %v, want %d missing", tt.name, missing, tt.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// scheduler runs a sync every interval in -interval mode. A tick that arrives
+// while the previous run is still going is skipped rather than queued. The
+// browser tracker, API client and database handle are process-wide, so every
+// run reuses them.
+type scheduler struct {
+	db       *sql.DB
+	cfg      *Config
+	interval time.Duration
+	run      func(ctx context.Context, db *sql.DB, cfg *Config) error
+	// now and newTicker are the scheduler's clock; newTicker returns the tick
+	// channel and a func stopping it.
+	now       func() time.Time
+	newTicker func(d time.Duration) (<-chan time.Time, func())
+
+	mu        sync.Mutex
+	running   bool
+	runs      int
+	skipped   int
+	lastStart time.Time
+	lastEnd   time.Time
+	lastErr   error
+	wg        sync.WaitGroup
+}
+
+// healthStatus is the JSON body of /healthz.
+type healthStatus struct {
+	Status    string     `json:"status"`
+	Running   bool       `json:"running"`
+	Runs      int        `json:"runs"`
+	Skipped   int        `json:"skipped"`
+	LastStart *time.Time `json:"last_start,omitempty"`
+	LastEnd   *time.Time `json:"last_end,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// runDaemon syncs immediately and then every cfg.Interval until ctx is
+// cancelled, after which it waits for the interrupted run to stop.
+func runDaemon(ctx context.Context, db *sql.DB, cfg *Config) error {
+	s := newScheduler(db, cfg, syncFeeds)
+	if cfg.HealthAddr != "" {
+		server, err := s.serveHealth(cfg.HealthAddr)
+		if err != nil {
+			return err
+		}
+		defer server.Close()
+	}
+
+	infof("Syncing every %s", cfg.Interval)
+	s.loop(ctx)
+	infof("Shutting down: waiting for the run in progress to stop")
+	s.wg.Wait()
+	return nil
+}
+
+// newScheduler returns a scheduler calling run every cfg.Interval on the
+// wall clock.
+func newScheduler(db *sql.DB, cfg *Config, run func(ctx context.Context, db *sql.DB, cfg *Config) error) *scheduler {
+	return &scheduler{db: db, cfg: cfg, interval: cfg.Interval, run: run, now: time.Now, newTicker: newWallTicker}
+}
+
+// newWallTicker is the newTicker of a scheduler on the wall clock.
+func newWallTicker(d time.Duration) (<-chan time.Time, func()) {
+	ticker := time.NewTicker(d)
+	return ticker.C, ticker.Stop
+}
+
+// loop starts a run now and on every tick until ctx is done.
+func (s *scheduler) loop(ctx context.Context) {
+	ticks, stop := s.newTicker(s.interval)
+	defer stop()
+	s.tick(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+			s.tick(ctx)
+		}
+	}
+}
+
+// tick starts a run in the background unless one is already in progress.
+func (s *scheduler) tick(ctx context.Context) bool {
+	s.mu.Lock()
+	if s.running {
+		s.skipped++
+		started := s.lastStart
+		s.mu.Unlock()
+		warnf("Previous sync started at %s is still running; skipping this one", started.Format(time.RFC3339))
+		return false
+	}
+	s.running = true
+	s.lastStart = s.now()
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		err := s.run(ctx, s.db, s.cfg)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Sync failed", "error", err)
+		}
+		s.mu.Lock()
+		s.running = false
+		s.runs++
+		s.lastEnd = s.now()
+		s.lastErr = err
+		s.mu.Unlock()
+	}()
+	return true
+}
+
+// health reports the scheduler state; it is unhealthy after a failed run.
+func (s *scheduler) health() healthStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := healthStatus{Status: "ok", Running: s.running, Runs: s.runs, Skipped: s.skipped}
+	if !s.lastStart.IsZero() {
+		start := s.lastStart
+		status.LastStart = &start
+	}
+	if !s.lastEnd.IsZero() {
+		end := s.lastEnd
+		status.LastEnd = &end
+	}
+	if s.lastErr != nil {
+		status.Status = "failing"
+		status.LastError = s.lastErr.Error()
+	}
+	return status
+}
+
+// serveHealth exposes /healthz on addr in the background.
+func (s *scheduler) serveHealth(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for health checks on %s: %v", addr, err)
+	}
+
+	server := &http.Server{Handler: s.healthHandler()}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			warnf("Health server stopped: %v", err)
+		}
+	}()
+	return server, nil
+}
+
+// healthHandler serves /healthz: the scheduler state as JSON, with a 503 after
+// a failed run.
+func (s *scheduler) healthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		status := s.health()
+		w.Header().Set("Content-Type", "application/json")
+		if status.LastError != "" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	})
+	return mux
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestScheduler returns a scheduler calling run on a fixed clock and
+// ticking whenever a test sends on the returned channel.
+func newTestScheduler(run func(ctx context.Context, db *sql.DB, cfg *Config) error) (*scheduler, chan time.Time, time.Time) {
+	now := time.Date(2026, 10, 14, 8, 0, 0, 0, time.UTC)
+	ticks := make(chan time.Time)
+	s := newScheduler(nil, &Config{Interval: time.Minute}, run)
+	s.now = func() time.Time { return now }
+	s.newTicker = func(time.Duration) (<-chan time.Time, func()) { return ticks, func() {} }
+	return s, ticks, now
+}
+
+func TestSchedulerSkipsTickWhileRunning(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	s, _, _ := newTestScheduler(func(context.Context, *sql.DB, *Config) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+
+	if !s.tick(context.Background()) {
+		t.Fatal("first tick did not start a run")
+	}
+	<-started
+	if s.tick(context.Background()) {
+		t.Error("tick started a second run while the first was in flight")
+	}
+	close(release)
+	s.wg.Wait()
+
+	go func() { <-started }()
+	if !s.tick(context.Background()) {
+		t.Error("tick after the run finished did not start one")
+	}
+	s.wg.Wait()
+	if status := s.health(); status.Runs != 2 || status.Skipped != 1 || status.Running {
+		t.Errorf("health = %+v, want 2 runs and 1 skipped", status)
+	}
+}
+
+func TestSchedulerLoopRunsOnEveryTick(t *testing.T) {
+	runs := make(chan struct{})
+	s, ticks, now := newTestScheduler(func(context.Context, *sql.DB, *Config) error {
+		runs <- struct{}{}
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.loop(ctx)
+		close(done)
+	}()
+
+	<-runs // the run loop starts immediately
+	for i := 0; i < 2; i++ {
+		// Let the previous run finish, so the tick is not skipped.
+		for s.health().Running {
+			time.Sleep(time.Millisecond)
+		}
+		ticks <- now
+		<-runs
+	}
+	cancel()
+	<-done
+	s.wg.Wait()
+	if status := s.health(); status.Runs != 3 || status.Skipped != 0 {
+		t.Errorf("health = %+v, want 3 runs and none skipped", status)
+	}
+}
+
+func TestHealthzReportsLastRun(t *testing.T) {
+	result := errors.New("feed unreachable")
+	s, _, now := newTestScheduler(func(context.Context, *sql.DB, *Config) error { return result })
+	server := httptest.NewServer(s.healthHandler())
+	defer server.Close()
+	check := func(wantCode int, wantStatus, wantError string) {
+		t.Helper()
+		s.tick(context.Background())
+		s.wg.Wait()
+		resp, err := http.Get(server.URL + "/healthz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var status healthStatus
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != wantCode || status.Status != wantStatus || status.LastError != wantError {
+			t.Errorf("/healthz = %d %+v, want %d %s %q", resp.StatusCode, status, wantCode, wantStatus, wantError)
+		}
+		if status.LastEnd == nil || !status.LastEnd.Equal(now) {
+			t.Errorf("last_end = %v, want %s", status.LastEnd, now)
+		}
+	}
+
+	check(http.StatusServiceUnavailable, "failing", "feed unreachable")
+	result = nil
+	check(http.StatusOK, "ok", "")
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ensureSchema creates the products table in a new database with every
+// current column. migrateDB adds the columns an older table lacks, with the
+// same definitions, and creates the indexes, so new and upgraded databases
+// end up with the same schema.
+func ensureSchema(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS products (
+		unique_code TEXT NOT NULL,
+		price REAL,
+		mpn TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'new',
+		scope TEXT NOT NULL DEFAULT '',
+		source TEXT NOT NULL DEFAULT '',
+		feed_id TEXT NOT NULL DEFAULT '',
+		upload_status TEXT NOT NULL DEFAULT 'pending',
+		format_version INTEGER NOT NULL DEFAULT 1,
+		document_id TEXT NOT NULL DEFAULT '',
+		content_hash TEXT NOT NULL DEFAULT '',
+		image_path TEXT NOT NULL DEFAULT '',
+		indexing_status TEXT NOT NULL DEFAULT '',
+		price_cents INTEGER
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create products: %v", err)
+	}
+	return nil
+}
+
+// migrateDB brings an existing products table up to the current column set
+// and creates the auxiliary tables.
+func migrateDB(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS sync_meta (key TEXT PRIMARY KEY, value TEXT NOT NULL)`)
+	if err != nil {
+		return fmt.Errorf("failed to create sync_meta: %v", err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS price_history (
+		feed_id TEXT NOT NULL DEFAULT '',
+		unique_code TEXT NOT NULL,
+		old_price REAL NOT NULL,
+		new_price REAL NOT NULL,
+		pct_change REAL,
+		changed_at TEXT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create price_history: %v", err)
+	}
+	// Changes recorded before feed IDs existed belong to the default feed.
+	if err := addColumnIfMissing(db, "price_history", "feed_id", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS price_history_feed_id_changed_at ON price_history (feed_id, changed_at)`)
+	if err != nil {
+		return fmt.Errorf("failed to index price_history: %v", err)
+	}
+	if err := migrateSyncRuns(db); err != nil {
+		return err
+	}
+	if err := migrateProductHistory(db); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "products", "scope", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "products", "source", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := migrateFeedID(db); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "products", "upload_status", "TEXT NOT NULL DEFAULT 'pending'"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "products", "format_version", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "products", "document_id", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "products", "content_hash", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "products", "image_path", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "products", "indexing_status", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	// price_cents is the exact price; the REAL price column is still written
+	// for other readers of the table. Rows from before the column existed are
+	// converted once.
+	if err := addColumnIfMissing(db, "products", "price_cents", "INTEGER"); err != nil {
+		return err
+	}
+	_, err = db.Exec(`UPDATE products SET price_cents = CAST(ROUND(price * 100) AS INTEGER) WHERE price_cents IS NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to convert prices to cents: %v", err)
+	}
+	return createProductIndexes(db)
+}
+
+// migrateFeedID adds the feed_id column products are keyed by. Rows stored
+// before it existed were keyed by source, so they take their source as feed
+// ID; rows without a source get the default, empty feed ID.
+func migrateFeedID(db *sql.DB) error {
+	exists, err := hasColumn(db, "products", "feed_id")
+	if err != nil || exists {
+		return err
+	}
+	if err := addColumnIfMissing(db, "products", "feed_id", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	_, err = db.Exec(`UPDATE products SET feed_id = source`)
+	if err != nil {
+		return fmt.Errorf("failed to set the feed ID of stored products: %v", err)
+	}
+	return nil
+}
+
+// dedupeProductsMeta is the sync_meta key recording that duplicate product
+// rows have been collapsed.
+const dedupeProductsMeta = "migration:dedupe_products"
+
+// dedupeProducts collapses the product rows older versions could insert twice
+// to the most recently inserted row. It runs once per database, through the
+// writer; afterwards the unique index keeps duplicates out. A dry run only
+// reports the duplicates and returns false, as it leaves them in place.
+func dedupeProducts(db *sql.DB) (bool, error) {
+	_, done, err := getMeta(db, dedupeProductsMeta)
+	if err != nil || done {
+		return done, err
+	}
+	const duplicates = `FROM products WHERE rowid NOT IN (SELECT MAX(rowid) FROM products GROUP BY feed_id, unique_code)`
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) ` + duplicates).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to count duplicate products: %v", err)
+	}
+	if dryRun {
+		if count > 0 {
+			infof("Dry run: would remove %d duplicate product rows", count)
+		}
+		return count == 0, nil
+	}
+	if count > 0 {
+		if err := writeDB(db, `DELETE `+duplicates); err != nil {
+			return false, fmt.Errorf("failed to remove duplicate products: %v", err)
+		}
+		warnf("Removed %d duplicate product rows, keeping the newest row of each product", count)
+	}
+	if err := setMeta(db, dedupeProductsMeta, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return false, fmt.Errorf("failed to record the product dedupe: %v", err)
+	}
+	return true, nil
+}
+
+// createProductIndexes indexes products by feed_id and unique_code, which
+// every feed item is looked up by, and by document_id, which reconcile and
+// prune look up. The unique index stands in for a primary key, which SQLite
+// cannot add to an existing table, so a second row for a product of the same
+// feed is rejected. It is only created once dedupeProducts has run.
+func createProductIndexes(db *sql.DB) error {
+	deduped, err := dedupeProducts(db)
+	if err != nil {
+		return err
+	}
+	// products_unique_code made unique codes unique across feeds, and
+	// products_source_unique_code keyed them by source before feed_id existed.
+	for _, index := range []string{"products_unique_code", "products_source_unique_code"} {
+		_, err = db.Exec(`DROP INDEX IF EXISTS ` + index)
+		if err != nil {
+			return fmt.Errorf("failed to drop the index %s: %v", index, err)
+		}
+	}
+	if deduped {
+		_, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS products_feed_id_unique_code ON products (feed_id, unique_code)`)
+		if err != nil {
+			return fmt.Errorf("failed to index products by feed_id and unique_code: %v", err)
+		}
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS products_document_id ON products (document_id)`)
+	if err != nil {
+		return fmt.Errorf("failed to index products by document_id: %v", err)
+	}
+	return nil
+}
+
+// getMeta reads key from sync_meta; ok is false when the key is not set.
+func getMeta(db *sql.DB, key string) (value string, ok bool, err error) {
+	err = db.QueryRow(`SELECT value FROM sync_meta WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// setMeta stores value under key in sync_meta.
+func setMeta(db *sql.DB, key, value string) error {
+	query := `INSERT INTO sync_meta (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value`
+	return writeDB(db, query, key, value)
+}
+
+// deleteMeta removes key from sync_meta.
+func deleteMeta(db *sql.DB, key string) error {
+	return writeDB(db, `DELETE FROM sync_meta WHERE key = ?`, key)
+}
+
+// hasColumn reports whether PRAGMA table_info lists column for table. A table
+// that does not exist has no columns.
+func hasColumn(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect table %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, fmt.Errorf("failed to read columns of %s: %v", table, err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("failed to read columns of %s: %v", table, err)
+	}
+	return false, nil
+}
+
+// addColumnIfMissing adds column to table unless PRAGMA table_info already lists it.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	exists, err := hasColumn(db, table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %v", table, column, err)
+	}
+	return nil
+}
+
+// partitionFilter returns a WHERE clause fragment and its arguments limiting
+// products to scope and feed feedID. An empty scope does not filter; feedID
+// always does, since it is part of a product's key.
+func partitionFilter(scope Scope, feedID string) (string, []interface{}) {
+	clause := "feed_id = ?"
+	args := []interface{}{feedID}
+	if !scope.IsZero() {
+		clause += " AND scope = ?"
+		args = append(args, scope.String())
+	}
+	return clause, args
+}
+
+// setDocumentID records the remote document ID of a product of feed feedID.
+func setDocumentID(db *sql.DB, feedID, uniqueCode, documentID string) error {
+	return writeDB(db, `UPDATE products SET document_id = ? WHERE feed_id = ? AND unique_code = ?`, documentID, feedID, uniqueCode)
+}
+
+// storedDocumentID returns the remote document ID recorded for a product of
+// feed feedID, or "" when there is none.
+func storedDocumentID(db *sql.DB, feedID, uniqueCode string) (string, error) {
+	var documentID string
+	err := db.QueryRow(`SELECT document_id FROM products WHERE feed_id = ? AND unique_code = ?`, feedID, uniqueCode).Scan(&documentID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return documentID, err
+}
+
+// deleteProduct removes the row of a product of feed feedID.
+func deleteProduct(db *sql.DB, feedID, uniqueCode string) error {
+	return writeDB(db, `DELETE FROM products WHERE feed_id = ? AND unique_code = ?`, feedID, uniqueCode)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+)
+
+// openLegacyDB returns an in-memory database holding the original products
+// table with a product inserted twice, as older versions could.
+func openLegacyDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open(sqliteDriverName, "file::memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	for _, stmt := range []string{
+		`CREATE TABLE products (unique_code TEXT NOT NULL, price REAL, mpn TEXT NOT NULL DEFAULT '', status TEXT NOT NULL DEFAULT 'new')`,
+		`INSERT INTO products (unique_code, price) VALUES ('p1', 1.50), ('p1', 2.50), ('p2', 3)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestEnsureSchemaCreatesCurrentColumns(t *testing.T) {
+	db, err := sql.Open(sqliteDriverName, "file::memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	if err := ensureSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`SELECT scope, source, feed_id, upload_status, format_version, document_id, content_hash, image_path, indexing_status, price_cents FROM products`); err != nil {
+		t.Fatalf("fresh schema is missing columns: %v", err)
+	}
+}
+
+func TestMigrateDBDedupesProductsOnce(t *testing.T) {
+	db := openLegacyDB(t)
+	if err := migrateDB(db); err != nil {
+		t.Fatal(err)
+	}
+	if n := countProducts(t, db); n != 2 {
+		t.Fatalf("got %d products after the migration, want 2", n)
+	}
+	var price float64
+	if err := db.QueryRow(`SELECT price FROM products WHERE unique_code = 'p1'`).Scan(&price); err != nil {
+		t.Fatal(err)
+	}
+	if price != 2.50 {
+		t.Errorf("kept price %v, want the newest row's 2.50", price)
+	}
+	if _, ok, err := getMeta(db, dedupeProductsMeta); err != nil || !ok {
+		t.Fatalf("dedupe not recorded: ok=%v err=%v", ok, err)
+	}
+	if _, err := db.Exec(`INSERT INTO products (unique_code) VALUES ('p2')`); err == nil {
+		t.Error("duplicate product inserted after the migration")
+	}
+	if err := migrateDB(db); err != nil {
+		t.Fatalf("second migration: %v", err)
+	}
+}
+
+func TestMigrateDBDryRunKeepsDuplicates(t *testing.T) {
+	defer func(saved bool) { dryRun = saved }(dryRun)
+	dryRun = true
+	db := openLegacyDB(t)
+	if err := migrateDB(db); err != nil {
+		t.Fatal(err)
+	}
+	if n := countProducts(t, db); n != 3 {
+		t.Fatalf("dry run left %d products, want all 3", n)
+	}
+	if _, ok, _ := getMeta(db, dedupeProductsMeta); ok {
+		t.Error("dry run recorded the dedupe")
+	}
+}
+
+// BenchmarkProductLookup compares productExists on a 100k-row table with and
+// without the indexes createProductIndexes adds.
+func BenchmarkProductLookup(b *testing.B) {
+	const rows = 100000
+	for _, indexed := range []bool{true, false} {
+		name := "indexed"
+		if !indexed {
+			name = "unindexed"
+		}
+		b.Run(name, func(b *testing.B) {
+			db := newTestDB(b)
+			_, err := db.Exec(`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < ?)
+				INSERT INTO products (unique_code, price, price_cents, document_id) SELECT 'sku-' || i, i, i * 100, 'doc-' || i FROM n`, rows)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if !indexed {
+				for _, index := range []string{"products_feed_id_unique_code", "products_document_id"} {
+					if _, err := db.Exec(`DROP INDEX ` + index); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Spread over the table, since a scan stops at the first match.
+				code := fmt.Sprintf("sku-%d", i*7919%rows+1)
+				if exists, _, err := productExists(db, "", code); err != nil || !exists {
+					b.Fatalf("productExists(%s) = %v, %v", code, exists, err)
+				}
+			}
+		})
+	}
+}
+
+func TestProductsAreKeyedByFeedID(t *testing.T) {
+	db := newTestDB(t)
+	storeProduct(t, db, Product{UniqueCode: "sku-1", Price: 100, Status: "new", DocumentID: "doc-a"})
+	storeProduct(t, db, Product{UniqueCode: "sku-1", Price: 200, Status: "new", FeedID: "outlet", DocumentID: "doc-b"})
+	// The source only tags the row; it does not make a third product.
+	storeProduct(t, db, Product{UniqueCode: "sku-1", Price: 300, Status: "new", Source: "shop", FeedID: "outlet", DocumentID: "doc-b"})
+	if n := countProducts(t, db); n != 2 {
+		t.Fatalf("got %d products, want sku-1 once per feed ID", n)
+	}
+
+	if err := setDocumentID(db, "outlet", "sku-1", "doc-c"); err != nil {
+		t.Fatal(err)
+	}
+	for feedID, want := range map[string]string{"": "doc-a", "outlet": "doc-c", "other": ""} {
+		if id, err := storedDocumentID(db, feedID, "sku-1"); err != nil || id != want {
+			t.Errorf("storedDocumentID(%q) = %q, %v; want %q", feedID, id, err, want)
+		}
+	}
+
+	if err := deleteProduct(db, "outlet", "sku-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loadProduct(t, db, "sku-1"); !ok || countProducts(t, db) != 1 {
+		t.Error("deleting the outlet product removed the default feed's")
+	}
+}
+
+func TestMigrateDBReplacesUniqueCodeIndex(t *testing.T) {
+	db := openLegacyDB(t)
+	if _, err := db.Exec(`DELETE FROM products WHERE rowid = 1`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE UNIQUE INDEX products_unique_code ON products (unique_code)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := ensureSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateDB(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO products (unique_code, feed_id) VALUES ('p1', 'outlet')`); err != nil {
+		t.Errorf("a second feed could not store p1: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO products (unique_code, feed_id) VALUES ('p1', 'outlet')`); err == nil {
+		t.Error("p1 stored twice for the same feed")
+	}
+}
+
+func TestMigrateDBGivesSourceKeyedRowsTheirSourceAsFeedID(t *testing.T) {
+	db := openLegacyDB(t)
+	for _, stmt := range []string{
+		`DELETE FROM products WHERE rowid = 1`,
+		`ALTER TABLE products ADD COLUMN source TEXT NOT NULL DEFAULT ''`,
+		`INSERT INTO products (unique_code, price, source) VALUES ('p1', 4, 'outlet')`,
+		`CREATE UNIQUE INDEX products_source_unique_code ON products (source, unique_code)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := migrateDB(db); err != nil {
+		t.Fatal(err)
+	}
+	for feedID, want := range map[string]float64{"": 2.50, "outlet": 4} {
+		var price float64
+		if err := db.QueryRow(`SELECT price FROM products WHERE feed_id = ? AND unique_code = 'p1'`, feedID).Scan(&price); err != nil || price != want {
+			t.Errorf("p1 of feed %q: price %v, %v; want %v", feedID, price, err, want)
+		}
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'products_source_unique_code'`).Scan(&n); err != nil || n != 0 {
+		t.Errorf("source index still present: %d, %v", n, err)
+	}
+}
+
+func TestPartitionFilter(t *testing.T) {
+	clause, args := partitionFilter(Scope{}, "")
+	if clause != "feed_id = ?" || len(args) != 1 || args[0] != "" {
+		t.Errorf("unscoped filter = %q %v, want the default feed", clause, args)
+	}
+	clause, args = partitionFilter(Scope{Kind: "brand", Value: "Acme"}, "outlet")
+	if clause != "feed_id = ? AND scope = ?" || len(args) != 2 || args[0] != "outlet" {
+		t.Errorf("scoped filter = %q %v", clause, args)
+	}
+}
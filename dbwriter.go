@@ -0,0 +1,104 @@
+package main
+
+import "database/sql"
+
+// dbWriter serializes writes to the database. A started writer owns one
+// goroutine that executes write requests in arrival order, so upload workers
+// scrape and format concurrently and only queue for their own statements,
+// and writes never contend with each other for the SQLite write lock.
+type dbWriter struct {
+	db   *sql.DB
+	ops  chan dbWrite
+	done chan struct{}
+}
+
+// dbWrite is one queued statement; its outcome is sent on reply.
+type dbWrite struct {
+	query string
+	args  []interface{}
+	reply chan dbWriteResult
+}
+
+type dbWriteResult struct {
+	result sql.Result
+	err    error
+}
+
+// dbWrites is the writer for the run's database; main starts it once the
+// database is open.
+var dbWrites *dbWriter
+
+// newDBWriter starts a writer goroutine for db.
+func newDBWriter(db *sql.DB) *dbWriter {
+	w := &dbWriter{db: db, ops: make(chan dbWrite), done: make(chan struct{})}
+	go w.run()
+	return w
+}
+
+func (w *dbWriter) run() {
+	for op := range w.ops {
+		result, err := execWithRetry(w.db, op.query, op.args...)
+		op.reply <- dbWriteResult{result: result, err: err}
+	}
+	close(w.done)
+}
+
+// writerFor returns the started writer when it owns db. Any other handle gets
+// an unstarted writer, which executes statements on the caller's goroutine.
+func writerFor(db *sql.DB) *dbWriter {
+	if dbWrites != nil && dbWrites.db == db {
+		return dbWrites
+	}
+	return &dbWriter{db: db}
+}
+
+// Exec queues a write statement and waits for its result. It must not be
+// called after Close.
+func (w *dbWriter) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if w.ops == nil {
+		return execWithRetry(w.db, query, args...)
+	}
+	reply := make(chan dbWriteResult, 1)
+	w.ops <- dbWrite{query: query, args: args, reply: reply}
+	r := <-reply
+	return r.result, r.err
+}
+
+// Insert adds a product row, or replaces the stored row of the same product.
+func (w *dbWriter) Insert(product Product) error {
+	_, err := w.Exec(`INSERT INTO products (unique_code, price, price_cents, mpn, status, scope, source, feed_id, document_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(feed_id, unique_code) DO UPDATE SET price = excluded.price, price_cents = excluded.price_cents, mpn = excluded.mpn,
+			status = excluded.status, scope = excluded.scope, source = excluded.source, document_id = excluded.document_id`,
+		product.UniqueCode, product.Price.Float64(), product.Price, product.MPN, product.Status, product.Scope, product.Source, product.FeedID, product.DocumentID)
+	return err
+}
+
+// UpdateStatus sets the status, price and scope of the product uniqueCode of
+// feed feedID.
+func (w *dbWriter) UpdateStatus(uniqueCode, status string, price Money, scope Scope, feedID string) error {
+	_, err := w.Exec(`UPDATE products SET status = ?, price = ?, price_cents = ?, scope = ? WHERE feed_id = ? AND unique_code = ?`,
+		status, price.Float64(), price, scope.String(), feedID, uniqueCode)
+	return err
+}
+
+// MarkDeleted sets the status of the product uniqueCode of feed feedID to
+// deleted.
+func (w *dbWriter) MarkDeleted(uniqueCode, feedID string) error {
+	_, err := w.Exec(`UPDATE products SET status = 'deleted' WHERE feed_id = ? AND unique_code = ?`, feedID, uniqueCode)
+	return err
+}
+
+// Close stops accepting writes and waits for the queued ones to finish.
+func (w *dbWriter) Close() {
+	if w.ops == nil {
+		return
+	}
+	close(w.ops)
+	<-w.done
+}
+
+// writeDB executes a write statement through the writer for db.
+func writeDB(db *sql.DB, query string, args ...interface{}) error {
+	_, err := writerFor(db).Exec(query, args...)
+	return err
+}
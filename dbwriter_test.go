@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestDBWriterSerializesConcurrentWrites(t *testing.T) {
+	db := newTestDB(t)
+	w := newDBWriter(db)
+	defer func(saved *dbWriter) { dbWrites = saved }(dbWrites)
+	dbWrites = w
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- writerFor(db).Insert(Product{UniqueCode: fmt.Sprintf("p%d", i), Price: Money(i * 100), Status: "new"})
+		}()
+	}
+	wg.Wait()
+	w.Close()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := countProducts(t, db); n != 50 {
+		t.Errorf("got %d products, want 50", n)
+	}
+}
+
+func TestDBWriterInsertReplacesProduct(t *testing.T) {
+	db := newTestDB(t)
+	w := writerFor(db)
+	if err := w.Insert(Product{UniqueCode: "p1", Price: 150, Status: "new", DocumentID: "doc-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Insert(Product{UniqueCode: "p1", Price: 250, Status: "new", DocumentID: "doc-2"}); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := loadProduct(t, db, "p1")
+	if !ok || got.Price != 250 || got.DocumentID != "doc-2" {
+		t.Errorf("stored %+v, want the second insert", got)
+	}
+	if n := countProducts(t, db); n != 1 {
+		t.Errorf("got %d products, want 1", n)
+	}
+
+	if err := w.MarkDeleted("p1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := loadProduct(t, db, "p1"); got.Status != "deleted" {
+		t.Errorf("status = %q, want deleted", got.Status)
+	}
+}
+
+func TestWriterForOtherHandleRunsInline(t *testing.T) {
+	db := newTestDB(t)
+	defer func(saved *dbWriter) { dbWrites = saved }(dbWrites)
+	dbWrites = newDBWriter(newTestDB(t))
+	defer dbWrites.Close()
+
+	if w := writerFor(db); w == dbWrites || w.ops != nil {
+		t.Fatal("writerFor returned the started writer for another database")
+	}
+	if err := writeDB(db, `INSERT INTO products (unique_code) VALUES ('p1')`); err != nil {
+		t.Fatal(err)
+	}
+	if n := countProducts(t, db); n != 1 {
+		t.Errorf("got %d products, want 1", n)
+	}
+}
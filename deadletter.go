@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// deadLetterEntry is one deferred item. The full Item is kept so a later run
+// can retry it without the original feed.
+type deadLetterEntry struct {
+	FeedID     string    `json:"feed_id,omitempty"`
+	ID         string    `json:"id"`
+	Reason     string    `json:"reason"`
+	Item       Item      `json:"item"`
+	DeferredAt time.Time `json:"deferred_at"`
+}
+
+// deadLetterKey identifies an entry the way products are identified: by the
+// ID of its feed and its unique code.
+type deadLetterKey struct {
+	FeedID, ID string
+}
+
+// deadLetterQueue is an append-only JSON-lines file of items whose upload was
+// deferred. Entries from earlier runs are loaded on open so workers can retry
+// them; Close rewrites the file with whatever is still unresolved. Feeds
+// sharing the file keep separate entries.
+type deadLetterQueue struct {
+	mu      sync.Mutex
+	path    string
+	entries map[deadLetterKey]deadLetterEntry
+	file    *os.File
+}
+
+// deadLetters is the process-wide dead-letter queue, opened in main.
+// The default keeps entries in memory only.
+var deadLetters = &deadLetterQueue{entries: make(map[deadLetterKey]deadLetterEntry)}
+
+// openDeadLetterQueue loads the entries already in path and opens it for appending.
+func openDeadLetterQueue(path string) (*deadLetterQueue, error) {
+	q := &deadLetterQueue{path: path, entries: make(map[deadLetterKey]deadLetterEntry)}
+
+	existing, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to open dead-letter file %s: %v", path, err)
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(existing)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var entry deadLetterEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.ID == "" {
+				continue // skip torn or foreign lines
+			}
+			q.entries[deadLetterKey{entry.FeedID, entry.ID}] = entry
+		}
+		existing.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read dead-letter file %s: %v", path, err)
+		}
+	}
+
+	q.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead-letter file %s: %v", path, err)
+	}
+	return q, nil
+}
+
+// Add records item of feed feedID as deferred for reason, replacing any
+// earlier entry for the same product.
+func (q *deadLetterQueue) Add(feedID string, item Item, reason string) error {
+	entry := deadLetterEntry{FeedID: feedID, ID: item.ID, Reason: reason, Item: item, DeferredAt: time.Now().UTC()}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.entries[deadLetterKey{feedID, item.ID}] = entry
+	if q.file == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode dead-letter entry for %s: %v", item.ID, err)
+	}
+	_, err = q.file.Write(append(line, '\n'))
+	return err
+}
+
+// Has reports whether product id of feed feedID is waiting for a retry.
+func (q *deadLetterQueue) Has(feedID, id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, ok := q.entries[deadLetterKey{feedID, id}]
+	return ok
+}
+
+// Resolve drops product id of feed feedID from the queue after a successful
+// retry.
+func (q *deadLetterQueue) Resolve(feedID, id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.entries, deadLetterKey{feedID, id})
+}
+
+// Items returns the items of the unresolved entries of feed feedID.
+func (q *deadLetterQueue) Items(feedID string) []Item {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var items []Item
+	for key, entry := range q.entries {
+		if key.FeedID == feedID {
+			items = append(items, entry.Item)
+		}
+	}
+	return items
+}
+
+// Len returns the number of unresolved entries.
+func (q *deadLetterQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// Close compacts the file down to the unresolved entries.
+func (q *deadLetterQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.file == nil {
+		return nil
+	}
+	if err := q.file.Close(); err != nil {
+		return err
+	}
+	q.file = nil
+
+	tmpPath := q.path + ".tmp"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to compact dead-letter file: %v", err)
+	}
+	encoder := json.NewEncoder(out)
+	for _, entry := range q.entries {
+		if err := encoder.Encode(entry); err != nil {
+			out.Close()
+			return fmt.Errorf("failed to compact dead-letter file: %v", err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to compact dead-letter file: %v", err)
+	}
+	return os.Rename(tmpPath, q.path)
+}
+
+// errDeferred is returned by processItem when an item was parked in the
+// dead-letter queue instead of being uploaded. It is not a failure.
+var errDeferred = errors.New("item deferred to dead-letter queue")
+
+// deferItem parks item of feed feedID in the dead-letter queue so a later run
+// retries it.
+func deferItem(feedID string, item Item, reason string) error {
+	infof("Deferring item %s to the dead-letter queue: %s", item.ID, reason)
+	if err := deadLetters.Add(feedID, item, reason); err != nil {
+		warnf("Failed to record dead-letter entry for %s: %v", item.ID, err)
+	}
+	return errDeferred
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDeadLetterQueueKeepsFeedsApart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead-letters.jsonl")
+	q, err := openDeadLetterQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Add("shop-a", Item{ID: "sku-1", Title: "A"}, "scrape timed out"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Add("shop-b", Item{ID: "sku-1", Title: "B"}, "image failed"); err != nil {
+		t.Fatal(err)
+	}
+	q.Resolve("shop-a", "sku-1")
+	if q.Has("shop-a", "sku-1") {
+		t.Error("resolved entry of shop-a still queued")
+	}
+	if !q.Has("shop-b", "sku-1") {
+		t.Error("resolving shop-a dropped the entry of shop-b")
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := openDeadLetterQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if items := reopened.Items("shop-a"); len(items) != 0 {
+		t.Errorf("shop-a items = %v, want none", items)
+	}
+	items := reopened.Items("shop-b")
+	if len(items) != 1 || items[0].Title != "B" {
+		t.Errorf("shop-b items = %v, want the entry of shop-b", items)
+	}
+}
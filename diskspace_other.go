@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package main
+
+// availableDiskSpace cannot be determined on this platform.
+func availableDiskSpace(dir string) (bytes uint64, ok bool) {
+	return 0, false
+}
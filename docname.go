@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultDocumentNameTemplate = "Prod_{id}"
+	documentIDPlaceholder       = "{id}"
+
+	// maxDocumentNameLength keeps names, including the ".txt" extension,
+	// within the 255 characters the dataset API and most file systems accept.
+	maxDocumentNameLength = 251
+)
+
+// documentNameTemplate is the template documentFileName expands; main sets it
+// from -doc-name.
+var documentNameTemplate = defaultDocumentNameTemplate
+
+// validateDocumentNameTemplate requires the {id} placeholder so every product
+// gets a distinct, stable name.
+func validateDocumentNameTemplate(template string) error {
+	if !strings.Contains(template, documentIDPlaceholder) {
+		return fmt.Errorf("template %q must contain %s", template, documentIDPlaceholder)
+	}
+	return nil
+}
+
+// documentName expands template for uniqueCode. Characters outside
+// [A-Za-z0-9._-] are replaced with "_" and the result is truncated to
+// maxDocumentNameLength, so the same product always maps to the same name.
+func documentName(template, uniqueCode string) string {
+	name := strings.ReplaceAll(template, documentIDPlaceholder, uniqueCode)
+	name = unsafeFileChars.ReplaceAllString(name, "_")
+	if len(name) > maxDocumentNameLength {
+		name = name[:maxDocumentNameLength]
+	}
+	return name
+}
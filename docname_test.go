@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDocumentName(t *testing.T) {
+	tests := []struct {
+		template, code, want string
+	}{
+		{defaultDocumentNameTemplate, "sku-1", "Prod_sku-1"},
+		{"{id}", "a/b c?", "a_b_c_"},
+		{"Shop {id} v2", "X.1", "Shop_X.1_v2"},
+	}
+	for _, tt := range tests {
+		if got := documentName(tt.template, tt.code); got != tt.want {
+			t.Errorf("documentName(%q, %q) = %q, want %q", tt.template, tt.code, got, tt.want)
+		}
+	}
+	long := documentName("{id}", strings.Repeat("x", 300))
+	if len(long) != maxDocumentNameLength {
+		t.Errorf("long name has %d characters, want %d", len(long), maxDocumentNameLength)
+	}
+}
+
+func TestValidateDocumentNameTemplate(t *testing.T) {
+	if err := validateDocumentNameTemplate("Item_{id}"); err != nil {
+		t.Errorf("valid template rejected: %v", err)
+	}
+	if err := validateDocumentNameTemplate("Item"); err == nil {
+		t.Error("template without {id} accepted")
+	}
+}
+
+func TestPruneKeepsDocumentsNamedByTemplate(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	cfg.AssumeYes = true
+	defer func(saved string) { documentNameTemplate = saved }(documentNameTemplate)
+	documentNameTemplate = "Shop_{id}"
+	storeProduct(t, db, Product{UniqueCode: "sku-1", Status: "existing"})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(listDocumentsResponse{Data: []remoteDocument{
+			{ID: "doc-1", Name: "Shop_sku-1.txt"},
+			{ID: "doc-2", Name: "Shop_sku-2.txt"},
+		}})
+	}))
+	defer server.Close()
+	cfg.BaseURL = server.URL
+	sink := &FakeSink{}
+	useSink(t, sink)
+
+	if err := pruneRemoteDocuments(context.Background(), db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := []SinkCall{{Method: "Delete", DocumentID: "doc-2"}}
+	if calls := sink.Calls(); !reflect.DeepEqual(calls, want) {
+		t.Errorf("sink calls = %+v, want only the orphan deleted", calls)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// defaultDocumentTemplate is the built-in document layout.
+const defaultDocumentTemplate = "[TITLE] {{.Title}}\n" +
+	"[Price] {{.Price}}\n" +
+	"{{with .Category}}[Category] {{.}}\n{{end}}" +
+	"[BRAND] {{.Brand}}\n" +
+	"\n[CONTENT] \n" +
+	"[DESCRIPTION] {{.Description}}\n" +
+	"[LINK] {{.Link}}\n" +
+	"[IMAGE LINK] {{.ImageLink}}\n" +
+	"[AVAILABILITY] {{.Availability}}\n" +
+	"[GTIN] {{.GTIN}}\n" +
+	"[ID] {{.ID}}\n" +
+	"[SKU] {{.MPN}}\n" +
+	"{{with .Source}}[SOURCE] {{.}}\n{{end}}" +
+	"{{if .Variants}}[PRICE RANGE] {{.Price}} - {{.PriceMax}}\n" +
+	"[VARIANTS]\n" +
+	"{{range .Variants}}- {{.ID}}: {{if .Size}}size {{.Size}}, {{end}}{{if .Color}}color {{.Color}}, {{end}}{{.Price}}{{with .Availability}}, {{.}}{{end}}\n{{end}}" +
+	"{{end}}" +
+	"{{range $key, $value := .Specification}}[{{title $key}}] {{$value}}\n{{end}}"
+
+// documentTemplate renders uploaded documents; main sets it from
+// -format-template.
+var documentTemplate = template.Must(parseDocumentTemplate("document", defaultDocumentTemplate))
+
+// documentData is what a document template is executed with: every Item
+// field, plus the category, source line and remaining scraped
+// specification fields. Templates range over Specification in key order.
+type documentData struct {
+	Item
+	Category      string
+	Source        string
+	Specification map[string]string
+}
+
+// documentTemplateFuncs are the helpers available to document templates.
+var documentTemplateFuncs = template.FuncMap{
+	"title": strings.Title,
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// parseDocumentTemplate parses text as a document template. Missing map keys
+// render as empty strings.
+func parseDocumentTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(documentTemplateFuncs).Option("missingkey=zero").Parse(text)
+}
+
+// loadDocumentTemplate reads the template at path, or returns the built-in
+// one when path is empty. The template is executed once against a sample
+// item so a reference to an unknown field fails at startup rather than on
+// every product.
+func loadDocumentTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return documentTemplate, nil
+	}
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	tmpl, err := parseDocumentTemplate(path, string(text))
+	if err != nil {
+		return nil, err
+	}
+	sample := documentData{
+		Item: Item{
+			ID:       "sample",
+			Title:    "Sample product",
+			Variants: []Variant{{ID: "sample-1", Size: "M", Color: "blue", Availability: AvailabilityInStock}},
+		},
+		Category:      "Sample category",
+		Specification: map[string]string{"specification": "sample"},
+	}
+	if err := tmpl.Execute(io.Discard, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// newDocumentData splits itemDict into the template fields for item.
+func newDocumentData(item Item, itemDict map[string]string) documentData {
+	data := documentData{
+		Item:          item,
+		Category:      itemDict["category"],
+		Source:        itemDict["source"],
+		Specification: make(map[string]string, len(itemDict)),
+	}
+	for key, value := range itemDict {
+		if key != "id" && key != "price" && key != "mpn" && key != "category" && key != "source" {
+			data.Specification[key] = value
+		}
+	}
+	return data
+}
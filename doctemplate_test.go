@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+// useDocumentTemplate makes tmpl the document template for the rest of the test.
+func useDocumentTemplate(t *testing.T, tmpl *template.Template) {
+	t.Helper()
+	saved := documentTemplate
+	t.Cleanup(func() { documentTemplate = saved })
+	documentTemplate = tmpl
+}
+
+func TestFormatItemDefaultLayout(t *testing.T) {
+	item := Item{ID: "sku-1", Title: "Kettle", Price: 1999, Brand: "Acme", MPN: "K-1", Availability: AvailabilityInStock}
+	doc, err := formatItem(item, map[string]string{"id": "sku-1", "category": "Kitchen", "capacity": "1.7 l"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[TITLE] Kettle\n[Price] 19.99\n[Category] Kitchen\n[BRAND] Acme\n\n[CONTENT] \n[DESCRIPTION] \n[LINK] \n" +
+		"[IMAGE LINK] \n[AVAILABILITY] in_stock\n[GTIN] \n[ID] sku-1\n[SKU] K-1\n[Capacity] 1.7 l\n"
+	if doc != want {
+		t.Errorf("formatItem() =\n%s\nwant\n%s", doc, want)
+	}
+}
+
+// writeTemplate writes text to a template file.
+func writeTemplate(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "document.tmpl")
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDocumentTemplate(t *testing.T) {
+	if tmpl, err := loadDocumentTemplate(""); err != nil || tmpl != documentTemplate {
+		t.Errorf("loadDocumentTemplate(\"\") = %v, %v; want the built-in template", tmpl, err)
+	}
+
+	tmpl, err := loadDocumentTemplate(writeTemplate(t, `{{upper .Title}} | {{.Specification.warranty}}{{.Specification.missing}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	useDocumentTemplate(t, tmpl)
+	doc, err := formatItem(Item{ID: "sku-1", Title: "Kettle"}, map[string]string{"warranty": "2 years"})
+	if err != nil || doc != "KETTLE | 2 years" {
+		t.Errorf("formatItem() = %q, %v", doc, err)
+	}
+
+	for _, text := range []string{`{{.Title`, `{{.Colour}}`} {
+		if _, err := loadDocumentTemplate(writeTemplate(t, text)); err == nil {
+			t.Errorf("template %q accepted", text)
+		}
+	}
+	if _, err := loadDocumentTemplate(filepath.Join(t.TempDir(), "missing.tmpl")); err == nil || !strings.Contains(err.Error(), "failed to read") {
+		t.Errorf("missing template = %v", err)
+	}
+}
+
+func TestNewDocumentDataSplitsItemDict(t *testing.T) {
+	data := newDocumentData(Item{ID: "sku-1"}, map[string]string{
+		"id": "sku-1", "price": "1.00", "mpn": "K-1", "category": "Kitchen", "source": "shop", "warranty": "2 years",
+	})
+	if data.Category != "Kitchen" || data.Source != "shop" {
+		t.Errorf("Category, Source = %q, %q", data.Category, data.Source)
+	}
+	if len(data.Specification) != 1 || data.Specification["warranty"] != "2 years" {
+		t.Errorf("Specification = %v, want only the scraped warranty", data.Specification)
+	}
+}
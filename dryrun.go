@@ -0,0 +1,40 @@
+package main
+
+import "strings"
+
+// dryRun mirrors cfg.DryRun for the database helpers, which are not handed
+// the config; configureDryRun sets it.
+var dryRun bool
+
+// configureDryRun makes a -dry-run sync report what it would do without
+// changing the remote dataset or the database. Documents are still rendered,
+// in memory only. Checkpoints, vacuuming and event publishing are turned off
+// since they would record or announce changes that were never made.
+func configureDryRun(cfg *Config) {
+	dryRun = cfg.DryRun
+	if !cfg.DryRun {
+		return
+	}
+	cfg.CheckpointEvery = 0
+	cfg.Resume = false
+	cfg.NewRun = false
+	cfg.Vacuum = false
+	cfg.VacuumThreshold = 0
+	cfg.EventsAMQPURL = ""
+	infof("Dry run: no uploads, deletes or database writes will be made")
+}
+
+// printDryRunSummary reports what a dry run would have changed.
+func printDryRunSummary(stats *SyncStats) {
+	summaryf("Dry run: would sync %d products: %d new, %d updated, %d existing, %d restocked, %d deleted, %d marked deleted\n",
+		stats.Seen, stats.New, stats.Updated, stats.Existing, stats.Restocked, stats.Deleted, stats.MarkedDeleted)
+}
+
+// statementVerb is the first word of a SQL statement, for dry-run logging.
+func statementVerb(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
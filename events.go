@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Catalog event types, also used as AMQP routing keys.
+const (
+	eventProductCreated = "product.created"
+	eventProductUpdated = "product.updated"
+	eventProductDeleted = "product.deleted"
+
+	eventPublishTimeout = 5 * time.Second
+)
+
+// productEvent describes one catalog change for downstream consumers.
+// Deleted events only carry the ID.
+type productEvent struct {
+	Type       string    `json:"type"`
+	ID         string    `json:"id"`
+	Title      string    `json:"title,omitempty"`
+	Price      Money     `json:"price,omitempty"`
+	Brand      string    `json:"brand,omitempty"`
+	MPN        string    `json:"mpn,omitempty"`
+	Link       string    `json:"link,omitempty"`
+	Source     string    `json:"source,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// newProductEvent builds an event of eventType for item.
+func newProductEvent(eventType string, item Item, source string) productEvent {
+	return productEvent{
+		Type:       eventType,
+		ID:         item.ID,
+		Title:      item.Title,
+		Price:      item.Price,
+		Brand:      item.Brand,
+		MPN:        item.MPN,
+		Link:       item.Link,
+		Source:     source,
+		OccurredAt: time.Now().UTC(),
+	}
+}
+
+// EventPublisher delivers catalog events to a message queue.
+type EventPublisher interface {
+	Publish(ctx context.Context, event productEvent) error
+	Close() error
+}
+
+// events is the process-wide publisher; it is a no-op unless main configures one.
+var events EventPublisher = noopPublisher{}
+
+// publishEvent sends event and logs, rather than returns, a failure so that a
+// queue outage never fails the sync itself.
+func publishEvent(event productEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), eventPublishTimeout)
+	defer cancel()
+	if err := events.Publish(ctx, event); err != nil {
+		warnf("Failed to publish %s for %s: %v", event.Type, event.ID, err)
+	}
+}
+
+// newEventPublisher builds the publisher selected by cfg.
+func newEventPublisher(cfg *Config) (EventPublisher, error) {
+	if cfg.EventsAMQPURL == "" {
+		return noopPublisher{}, nil
+	}
+	return newAMQPPublisher(cfg.EventsAMQPURL, cfg.EventsExchange)
+}
+
+// noopPublisher discards every event.
+type noopPublisher struct{}
+
+func (noopPublisher) Publish(context.Context, productEvent) error { return nil }
+func (noopPublisher) Close() error                                { return nil }
+
+// amqpPublisher publishes JSON events to an AMQP topic exchange, routed by
+// event type.
+type amqpPublisher struct {
+	mu       sync.Mutex
+	conn     *amqp.Connection
+	channel  *amqp.Channel
+	exchange string
+}
+
+// newAMQPPublisher connects to the broker at url and declares exchange.
+func newAMQPPublisher(url, exchange string) (*amqpPublisher, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to AMQP broker: %v", err)
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open AMQP channel: %v", err)
+	}
+	err = channel.ExchangeDeclare(exchange, "topic", true, false, false, false, nil)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to declare exchange %s: %v", exchange, err)
+	}
+	return &amqpPublisher{conn: conn, channel: channel, exchange: exchange}, nil
+}
+
+// Publish implements EventPublisher. AMQP channels are not safe for concurrent
+// use, so publishes are serialized.
+func (p *amqpPublisher) Publish(ctx context.Context, event productEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %v", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.channel.PublishWithContext(ctx, p.exchange, event.Type, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    event.OccurredAt,
+		Body:         body,
+	})
+}
+
+// Close closes the channel and the connection.
+func (p *amqpPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.channel.Close()
+	return p.conn.Close()
+}
+
+// recordingPublisher keeps published events in memory so tests can assert on
+// what the pipeline emitted.
+type recordingPublisher struct {
+	mu     sync.Mutex
+	events []productEvent
+}
+
+func (r *recordingPublisher) Publish(_ context.Context, event productEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *recordingPublisher) Close() error { return nil }
+
+// Events returns a copy of everything published so far.
+func (r *recordingPublisher) Events() []productEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]productEvent(nil), r.events...)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// usePublisher makes publisher the run's event publisher for the rest of the test.
+func usePublisher(t *testing.T, publisher EventPublisher) {
+	t.Helper()
+	saved := events
+	t.Cleanup(func() { events = saved })
+	events = publisher
+}
+
+// eventTypes returns the type and ID of each event, in order.
+func eventTypes(published []productEvent) []string {
+	var types []string
+	for _, event := range published {
+		types = append(types, event.Type+" "+event.ID)
+	}
+	return types
+}
+
+func TestSyncPublishesProductEvents(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	cfg.Source = "warehouse"
+	cfg.ReconcileMode = ReconcileAfter
+	newTestAPI(t, cfg)
+	recorder := &recordingPublisher{}
+	usePublisher(t, recorder)
+	for _, product := range []Product{
+		{UniqueCode: "sku-1", Price: 1000, Status: "existing", Source: "warehouse"},
+		{UniqueCode: "sku-gone", Price: 1000, Status: "existing", Source: "warehouse", DocumentID: "doc-gone"},
+	} {
+		storeProduct(t, db, product)
+	}
+	items := []Item{{ID: "sku-1", Title: "Product", Price: 1200}, {ID: "sku-2", Title: "Product", Price: 500}}
+
+	if _, err := processXMLData(context.Background(), db, cfg, items, nil, "", 0); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]productEvent{}
+	for _, event := range recorder.Events() {
+		got[event.Type+" "+event.ID] = event
+	}
+	for _, want := range []string{eventProductUpdated + " sku-1", eventProductCreated + " sku-2", eventProductDeleted + " sku-gone"} {
+		event, ok := got[want]
+		if !ok {
+			t.Errorf("no %s event among %v", want, eventTypes(recorder.Events()))
+			continue
+		}
+		if event.Source != "warehouse" || event.OccurredAt.IsZero() {
+			t.Errorf("%s: source %q, occurred at %v; want warehouse and a timestamp", want, event.Source, event.OccurredAt)
+		}
+	}
+	if event := got[eventProductUpdated+" sku-1"]; event.Price != 1200 {
+		t.Errorf("updated event price = %v, want the new 12.00", event.Price)
+	}
+	if len(got) != 3 {
+		t.Errorf("events = %v, want exactly 3", eventTypes(recorder.Events()))
+	}
+}
+
+// failingPublisher rejects every event.
+type failingPublisher struct{ noopPublisher }
+
+func (failingPublisher) Publish(context.Context, productEvent) error {
+	return errors.New("broker unreachable")
+}
+
+func TestPublishFailureDoesNotFailSync(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	useSink(t, &FakeSink{})
+	usePublisher(t, failingPublisher{})
+
+	if err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), Item{ID: "sku-1", Title: "Product", Price: 100}); err != nil {
+		t.Errorf("worker() = %v, want the publish failure only logged", err)
+	}
+}
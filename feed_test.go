@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFeed(t *testing.T) {
+	tests := []struct {
+		name          string
+		feed          string
+		wantItems     []Item
+		wantMalformed []ItemError
+		wantErr       string
+	}{
+		{
+			name: "valid feed",
+			feed: `<?xml version="1.0"?><rss><channel><title>Shop</title>
+				<item><id>sku-1</id><title>Kettle</title><description>Steel kettle</description><price>19.99 USD</price>
+				<link>https://shop.example/sku-1</link><image_link>https://shop.example/sku-1.jpg</image_link><brand>Acme</brand>
+				<mpn>K-1</mpn><gtin>0123456789012</gtin><availability>in stock</availability><condition>new</condition>
+				<inventory>7</inventory><product_type>Kitchen</product_type><item_group_id>kettles</item_group_id><size>1l</size><color>red</color></item>
+				<item><id>sku-2</id><title>Mug</title><price>5</price></item>
+			</channel></rss>`,
+			wantItems: []Item{
+				{ID: "sku-1", Title: "Kettle", Description: "Steel kettle", Price: 1999, Link: "https://shop.example/sku-1",
+					ImageLink: "https://shop.example/sku-1.jpg", Brand: "Acme", MPN: "K-1", GTIN: "0123456789012",
+					Availability: AvailabilityInStock, Condition: "new", Inventory: 7, ProductType: "Kitchen",
+					ItemGroupID: "kettles", Size: "1l", Color: "red"},
+				{ID: "sku-2", Title: "Mug", Price: 500},
+			},
+		},
+		{
+			name: "empty channel",
+			feed: `<rss><channel></channel></rss>`,
+		},
+		{
+			name: "missing fields",
+			feed: `<rss><channel>
+				<item><id>sku-1</id></item>
+				<item><title>No id</title><price>1</price></item>
+				<item><id>sku-3</id><price>abc</price></item>
+			</channel></rss>`,
+			wantItems: []Item{{ID: "sku-1"}},
+			wantMalformed: []ItemError{
+				{Index: 1, Reason: "missing id"},
+				{Index: 2, ID: "sku-3", Reason: `invalid price "abc"`},
+			},
+		},
+		{
+			name: "unknown elements",
+			feed: `<rss version="2.0"><channel><generator>shop</generator>
+				<item><id>sku-1</id><title>Kettle</title><season>winter</season></item>
+			</channel><footer/></rss>`,
+			wantItems: []Item{{ID: "sku-1", Title: "Kettle", Extra: []xmlField{{XMLName: xml.Name{Local: "season"}, Value: "winter"}}}},
+		},
+		{
+			name:    "malformed XML",
+			feed:    `<rss><channel><item><id>sku-1</id></channel></rss>`,
+			wantErr: "failed to unmarshal XML",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed, err := parseFeed(strings.NewReader(tt.feed))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseFeed() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFeed() error = %v", err)
+			}
+			if !reflect.DeepEqual(feed.Channel.Items, tt.wantItems) {
+				t.Errorf("items = %+v\nwant %+v", feed.Channel.Items, tt.wantItems)
+			}
+			if !reflect.DeepEqual(feed.Channel.Malformed, tt.wantMalformed) {
+				t.Errorf("malformed = %+v\nwant %+v", feed.Channel.Malformed, tt.wantMalformed)
+			}
+		})
+	}
+}
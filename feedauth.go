@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// FeedAuthMode selects how HTTP feed downloads authenticate.
+type FeedAuthMode string
+
+const (
+	FeedAuthNone   FeedAuthMode = "none"
+	FeedAuthBasic  FeedAuthMode = "basic"  // -user and -pass
+	FeedAuthBearer FeedAuthMode = "bearer" // -feed-token
+	FeedAuthHeader FeedAuthMode = "header" // -feed-header
+)
+
+// String implements flag.Value.
+func (m *FeedAuthMode) String() string {
+	return string(*m)
+}
+
+// Set implements flag.Value.
+func (m *FeedAuthMode) Set(value string) error {
+	switch FeedAuthMode(value) {
+	case FeedAuthNone, FeedAuthBasic, FeedAuthBearer, FeedAuthHeader:
+		*m = FeedAuthMode(value)
+		return nil
+	}
+	return fmt.Errorf("invalid feed auth mode %q: expected %s, %s, %s or %s", value, FeedAuthNone, FeedAuthBasic, FeedAuthBearer, FeedAuthHeader)
+}
+
+// FeedAuth is the authentication applied to HTTP feed requests. Empty
+// credentials send no auth header in any mode.
+type FeedAuth struct {
+	Mode               FeedAuthMode
+	Username, Password string
+	Token              string
+	Header, Value      string
+}
+
+// configureFeedAuth sets cfg.FeedAuth from the feed auth flags. Without
+// -feed-auth, basic auth is used when -user or -pass is set and none
+// otherwise.
+func configureFeedAuth(cfg *Config) error {
+	auth := FeedAuth{Mode: cfg.FeedAuthMode, Username: cfg.FeedUser, Password: cfg.FeedPassword, Token: cfg.FeedToken}
+	if auth.Mode == "" {
+		auth.Mode = FeedAuthNone
+		if cfg.FeedUser != "" || cfg.FeedPassword != "" {
+			auth.Mode = FeedAuthBasic
+		}
+	}
+	if auth.Mode == FeedAuthHeader && cfg.FeedHeader != "" {
+		name, value, ok := strings.Cut(cfg.FeedHeader, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("-feed-header must be \"Name: value\", got %q", cfg.FeedHeader)
+		}
+		auth.Header, auth.Value = http.CanonicalHeaderKey(strings.TrimSpace(name)), strings.TrimSpace(value)
+	}
+	cfg.FeedAuth = auth
+	return nil
+}
+
+// apply sets the auth header of req.
+func (a FeedAuth) apply(req *http.Request) {
+	switch a.Mode {
+	case FeedAuthBasic:
+		if a.Username != "" || a.Password != "" {
+			req.SetBasicAuth(a.Username, a.Password)
+		}
+	case FeedAuthBearer:
+		if a.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+a.Token)
+		}
+	case FeedAuthHeader:
+		if a.Header != "" && a.Value != "" {
+			req.Header.Set(a.Header, a.Value)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigureFeedAuth(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want FeedAuth
+	}{
+		{"default none", Config{}, FeedAuth{Mode: FeedAuthNone}},
+		{"default basic", Config{FeedUser: "shop", FeedPassword: "secret"},
+			FeedAuth{Mode: FeedAuthBasic, Username: "shop", Password: "secret"}},
+		{"bearer", Config{FeedAuthMode: FeedAuthBearer, FeedToken: "t0k3n"},
+			FeedAuth{Mode: FeedAuthBearer, Token: "t0k3n"}},
+		{"header", Config{FeedAuthMode: FeedAuthHeader, FeedHeader: " x-api-key : abc123 "},
+			FeedAuth{Mode: FeedAuthHeader, Header: "X-Api-Key", Value: "abc123"}},
+	}
+	for _, tt := range tests {
+		cfg := tt.cfg
+		if err := configureFeedAuth(&cfg); err != nil {
+			t.Errorf("%s: configureFeedAuth() = %v", tt.name, err)
+			continue
+		}
+		if cfg.FeedAuth != tt.want {
+			t.Errorf("%s: FeedAuth = %+v, want %+v", tt.name, cfg.FeedAuth, tt.want)
+		}
+	}
+
+	for _, header := range []string{"no colon", ": value"} {
+		cfg := Config{FeedAuthMode: FeedAuthHeader, FeedHeader: header}
+		if err := configureFeedAuth(&cfg); err == nil {
+			t.Errorf("-feed-header %q accepted", header)
+		}
+	}
+}
+
+func TestFeedAuthModeSet(t *testing.T) {
+	var m FeedAuthMode
+	if err := m.Set("bearer"); err != nil || m != FeedAuthBearer {
+		t.Errorf("Set(bearer) = %v, mode %q", err, m)
+	}
+	if err := m.Set("digest"); err == nil {
+		t.Error("Set(digest) accepted an unknown mode")
+	}
+}
+
+func TestDownloadXMLSendsFeedAuth(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Write([]byte(`<rss/>`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		auth   FeedAuth
+		header string
+		want   string
+	}{
+		{FeedAuth{Mode: FeedAuthBasic, Username: "shop", Password: "secret"}, "Authorization", "Basic c2hvcDpzZWNyZXQ="},
+		{FeedAuth{Mode: FeedAuthBearer, Token: "t0k3n"}, "Authorization", "Bearer t0k3n"},
+		{FeedAuth{Mode: FeedAuthHeader, Header: "X-Api-Key", Value: "abc123"}, "X-Api-Key", "abc123"},
+		{FeedAuth{Mode: FeedAuthBearer}, "Authorization", ""},
+		{FeedAuth{Mode: FeedAuthNone, Username: "shop", Token: "t0k3n"}, "Authorization", ""},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "feed.xml")
+		if _, err := downloadXML(context.Background(), server.URL, tt.auth, path, pageValidators{}); err != nil {
+			t.Fatal(err)
+		}
+		if value := got.Get(tt.header); value != tt.want {
+			t.Errorf("%+v: %s = %q, want %q", tt.auth, tt.header, value, tt.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const feedValidatorsMetaKey = "feed_validators"
+
+// errFeedNotModified is returned by a conditional feed fetch when the server
+// answers 304 Not Modified.
+var errFeedNotModified = errors.New("feed not modified")
+
+// storedFeedValidators are the cache validators of the feed the last
+// completed run synced, and the feed URL they belong to.
+type storedFeedValidators struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// conditionalFeedSource is a FeedSource that can skip a download when the
+// feed has not changed since the validators in since were recorded.
+type conditionalFeedSource interface {
+	FeedSource
+	FetchIfModified(ctx context.Context, outputPath string, since pageValidators) (pageValidators, error)
+}
+
+// loadFeedValidators returns the validators saved for the feed at url, or
+// zero validators when none were saved or they belong to another feed.
+func loadFeedValidators(db *sql.DB, url string) (pageValidators, error) {
+	value, ok, err := getMeta(db, feedMetaKey(feedValidatorsMetaKey))
+	if err != nil || !ok {
+		return pageValidators{}, err
+	}
+	var stored storedFeedValidators
+	if err := json.Unmarshal([]byte(value), &stored); err != nil {
+		return pageValidators{}, fmt.Errorf("failed to decode feed validators: %v", err)
+	}
+	if stored.URL != url {
+		return pageValidators{}, nil
+	}
+	return pageValidators{ETag: stored.ETag, LastModified: stored.LastModified}, nil
+}
+
+// saveFeedValidators records v for the feed at url once a run has synced it.
+func saveFeedValidators(db *sql.DB, url string, v pageValidators) error {
+	value, err := json.Marshal(storedFeedValidators{URL: url, ETag: v.ETag, LastModified: v.LastModified})
+	if err != nil {
+		return err
+	}
+	return setMeta(db, feedMetaKey(feedValidatorsMetaKey), string(value))
+}
+
+// fetchFeedIfModified fetches source into outputPath like fetchFeed, but asks
+// the server to skip the download when the feed still matches the validators
+// saved by the last completed run; errFeedNotModified reports that it did.
+// -full and -force-reupload always download. The returned validators are for
+// runSync to save once the run completes, so an interrupted run is not
+// skipped next time.
+func fetchFeedIfModified(ctx context.Context, db *sql.DB, cfg *Config, source FeedSource, outputPath string) (pageValidators, error) {
+	conditional, ok := source.(conditionalFeedSource)
+	if !ok {
+		return pageValidators{}, fetchFeed(ctx, source, outputPath)
+	}
+
+	var since pageValidators
+	if !cfg.Full && !cfg.ForceReupload {
+		var err error
+		since, err = loadFeedValidators(db, source.String())
+		if err != nil {
+			return pageValidators{}, err
+		}
+	}
+	validators, err := conditional.FetchIfModified(ctx, outputPath, since)
+	if err != nil {
+		return pageValidators{}, err
+	}
+	return validators, gunzipInPlace(outputPath)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// newConditionalFeedServer serves a feed with a fixed ETag and answers 304 to
+// requests that send it, recording the If-None-Match of the last request.
+func newConditionalFeedServer(t *testing.T, etag string) (*httptest.Server, *string) {
+	t.Helper()
+	var lastIfNoneMatch string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastIfNoneMatch = r.Header.Get("If-None-Match")
+		if lastIfNoneMatch == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", "Mon, 02 Mar 2026 10:00:00 GMT")
+		w.Write([]byte(`<rss><channel>` + feedItem("sku-1", "1.00") + `</channel></rss>`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &lastIfNoneMatch
+}
+
+func TestFeedValidatorsRoundTrip(t *testing.T) {
+	db := newTestDB(t)
+	v := pageValidators{ETag: `"v1"`, LastModified: "Mon, 02 Mar 2026 10:00:00 GMT"}
+	if err := saveFeedValidators(db, "https://shop.example/feed.xml", v); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := loadFeedValidators(db, "https://shop.example/feed.xml"); err != nil || got != v {
+		t.Errorf("loadFeedValidators() = %+v, %v; want %+v", got, err, v)
+	}
+	if got, err := loadFeedValidators(db, "https://other.example/feed.xml"); err != nil || !got.IsZero() {
+		t.Errorf("validators of another feed = %+v, %v; want none", got, err)
+	}
+}
+
+func TestFetchFeedIfModified(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	server, lastIfNoneMatch := newConditionalFeedServer(t, `"v1"`)
+	source, err := newFeedSource(server.URL, false, FeedAuth{Mode: FeedAuthNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "feed.xml")
+
+	validators, err := fetchFeedIfModified(context.Background(), db, cfg, source, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if validators.ETag != `"v1"` || *lastIfNoneMatch != "" {
+		t.Fatalf("first fetch: validators %+v, If-None-Match %q", validators, *lastIfNoneMatch)
+	}
+	if err := saveFeedValidators(db, source.String(), validators); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fetchFeedIfModified(context.Background(), db, cfg, source, path); !errors.Is(err, errFeedNotModified) {
+		t.Errorf("second fetch = %v, want errFeedNotModified", err)
+	}
+
+	cfg.Full = true
+	if _, err := fetchFeedIfModified(context.Background(), db, cfg, source, path); err != nil {
+		t.Errorf("-full fetch = %v, want a download", err)
+	}
+	if *lastIfNoneMatch != "" {
+		t.Errorf("-full sent If-None-Match %q", *lastIfNoneMatch)
+	}
+}
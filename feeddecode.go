@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxReportedItemErrors bounds how many skipped items are logged one by one.
+const maxReportedItemErrors = 20
+
+// ItemError describes a feed item that was skipped because it is malformed.
+type ItemError struct {
+	// Index is the position of the item among the feed's <item> elements.
+	Index int
+	// ID is the item's ID when it could be read.
+	ID     string
+	Reason string
+}
+
+func (e *ItemError) Error() string {
+	if e.ID != "" {
+		return fmt.Sprintf("item %d (%s): %s", e.Index, e.ID, e.Reason)
+	}
+	return fmt.Sprintf("item %d: %s", e.Index, e.Reason)
+}
+
+// validateItem rejects an item without an ID. An unrecognized availability is
+// kept as written; see Availability.
+func validateItem(item Item) error {
+	if strings.TrimSpace(item.ID) == "" {
+		return errors.New("missing id")
+	}
+	return nil
+}
+
+// duplicateItem reports whether item repeats the ID of an item already in
+// seen, and otherwise adds it. Only the first item with a given ID is synced;
+// later ones are skipped with a warning, so two workers never race to insert
+// the same product.
+func duplicateItem(seen *idSet, item Item) bool {
+	if seen.Has(item.ID) {
+		warnf("Skipping feed item %s: an earlier item has the same id", item.ID)
+		return true
+	}
+	seen.Add(item.ID)
+	return false
+}
+
+// itemFeed calls yield with each well-formed feed item in order and returns
+// the malformed ones it skipped. It stops at the first error yield returns,
+// which it passes back.
+type itemFeed func(yield func(Item) error) ([]ItemError, error)
+
+// decodeFeedItems decodes the <item> elements of the feed in r one at a time
+// and passes each to fn, so only the item being decoded is held in memory.
+// Items whose fields do not parse or that fail validateItem are skipped and
+// returned; XML that is not well-formed stops decoding. The first error from
+// fn stops decoding and is returned as is.
+func decodeFeedItems(r io.Reader, fn func(Item) error) ([]ItemError, error) {
+	decoder := xml.NewDecoder(r)
+	var malformed []ItemError
+	index := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return malformed, nil
+		}
+		if err != nil {
+			return malformed, fmt.Errorf("failed to unmarshal XML: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "item" {
+			continue
+		}
+		var item Item
+		err = decoder.DecodeElement(&item, &start)
+		if err == nil {
+			err = validateItem(item)
+			if err != nil {
+				err = &ItemError{ID: strings.TrimSpace(item.ID), Reason: err.Error()}
+			}
+		}
+		var itemErr *ItemError
+		if errors.As(err, &itemErr) {
+			itemErr.Index = index
+			malformed = append(malformed, *itemErr)
+			index++
+			continue
+		}
+		if err != nil {
+			return malformed, fmt.Errorf("failed to unmarshal XML: %v", err)
+		}
+		index++
+		if err := fn(item); err != nil {
+			return malformed, err
+		}
+	}
+}
+
+// parseFeed decodes the feed in r as it is. Items that do not parse or
+// validate are left out of the channel's items and listed in its Malformed;
+// XML that is not well-formed is an error. Transforms, deduplication and
+// grouping are left to the caller.
+func parseFeed(r io.Reader) (RSS, error) {
+	var feed RSS
+	malformed, err := decodeFeedItems(r, func(item Item) error {
+		feed.Channel.Items = append(feed.Channel.Items, item)
+		return nil
+	})
+	if err != nil {
+		return RSS{}, err
+	}
+	feed.Channel.Malformed = malformed
+	return feed, nil
+}
+
+// reportMalformedItems logs how many feed items were skipped and why.
+func reportMalformedItems(malformed []ItemError) {
+	reportItemErrors("Skipped %d malformed feed items", malformed)
+}
+
+// reportFailedItems logs how many feed items failed to sync and why.
+func reportFailedItems(failures []ItemError) {
+	reportItemErrors("Failed to sync %d feed items", failures)
+}
+
+// reportItemErrors logs heading with the number of itemErrs, then the first
+// maxReportedItemErrors of them.
+func reportItemErrors(heading string, itemErrs []ItemError) {
+	if len(itemErrs) == 0 {
+		return
+	}
+	warnf(heading, len(itemErrs))
+	for i, itemErr := range itemErrs {
+		if i == maxReportedItemErrors {
+			warnf("  ... and %d more", len(itemErrs)-i)
+			break
+		}
+		warnf("  %v", &itemErr)
+	}
+}
+
+// wholeFeedReason names the option that needs every feed item in memory
+// before the first upload, or returns "" when the feed can be streamed to the
+// workers.
+func wholeFeedReason(cfg *Config) string {
+	switch {
+	case sampling(cfg):
+		return "-sample-rate"
+	case cfg.SortBy.Key != "":
+		return "-sort-by"
+	case cfg.GroupBy != "":
+		return "-group-by"
+	case cfg.BootstrapRemote:
+		return "-bootstrap-remote"
+	case cfg.ReconcileMode == ReconcileBefore || cfg.ReconcileMode == ReconcileInterleaved:
+		return "-reconcile-mode " + string(cfg.ReconcileMode)
+	}
+	return ""
+}
+
+// processFeedFile syncs the feed at xmlPath while decoding it, so memory use
+// depends on the worker count rather than the feed size. The price guard
+// decodes the file once more before the first upload. Products are only
+// reconciled once the whole feed has been read.
+func processFeedFile(ctx context.Context, db *sql.DB, cfg *Config, xmlPath, feedHash string, startIndex int) (*SyncStats, error) {
+	started := time.Now()
+	open := func() (io.ReadCloser, error) {
+		xmlFile, err := os.Open(xmlPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open XML file: %v", err)
+		}
+		return xmlFile, nil
+	}
+	err := checkPriceSwings(db, cfg, func(yield func(Item) error) ([]ItemError, error) {
+		xmlFile, err := open()
+		if err != nil {
+			return nil, err
+		}
+		defer xmlFile.Close()
+		return decodeFeedItems(xmlFile, func(item Item) error {
+			normalizeItem(&item, cfg.Transforms)
+			return yield(item)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if startIndex > 0 {
+		infof("Resuming at item %d", startIndex)
+	}
+	feed := decodedFeed(cfg, open)
+	return dispatchFeed(ctx, db, cfg, feed, feedHash, startIndex, nil, started)
+}
+
+// processFeedStream syncs the feed straight from source while it downloads,
+// so the feed is neither saved nor held in memory. Its hash is only known
+// once it has been read, so the run's checkpoints match no feed and cannot
+// be resumed, and the price guard, which must read the feed before the first
+// upload, cannot check it.
+func processFeedStream(ctx context.Context, db *sql.DB, cfg *Config, source FeedSource) (*SyncStats, error) {
+	started := time.Now()
+	feed := decodedFeed(cfg, func() (io.ReadCloser, error) {
+		return openFeedStream(ctx, source)
+	})
+	return dispatchFeed(ctx, db, cfg, feed, "", 0, nil, started)
+}
+
+// decodedFeed returns an itemFeed decoding the feed open returns one item at a
+// time, normalized and with duplicates and skipped out-of-stock items left
+// out as parseFeedItems does.
+func decodedFeed(cfg *Config, open func() (io.ReadCloser, error)) itemFeed {
+	return func(yield func(Item) error) ([]ItemError, error) {
+		r, err := open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		seen := newIDSet()
+		return decodeFeedItems(r, func(item Item) error {
+			normalizeItem(&item, cfg.Transforms)
+			if duplicateItem(seen, item) || skipOutOfStock(cfg, item) {
+				return nil
+			}
+			return yield(item)
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pipeFeedSource serves a feed written to an io.Pipe, so a test controls when
+// each part of it arrives.
+type pipeFeedSource struct{ r *io.PipeReader }
+
+func (s pipeFeedSource) Fetch(context.Context, string) error { return errors.New("not persisted") }
+func (s pipeFeedSource) Open(context.Context) (io.ReadCloser, error) {
+	return s.r, nil
+}
+func (s pipeFeedSource) String() string { return "pipe" }
+
+func TestProcessFeedStreamUploadsItemsAsTheyArrive(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	sink := &FakeSink{}
+	useSink(t, sink)
+
+	r, w := io.Pipe()
+	go func() {
+		io.WriteString(w, `<?xml version="1.0"?><rss><channel>`+feedItem("sku-1", "10.00"))
+		// The rest of the feed only arrives once the first item is uploaded.
+		deadline := time.Now().Add(5 * time.Second)
+		for len(sink.Calls()) == 0 {
+			if time.Now().After(deadline) {
+				w.CloseWithError(errors.New("first item was not uploaded before the feed ended"))
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		io.WriteString(w, feedItem("sku-2", "20.00")+`</channel></rss>`)
+		w.Close()
+	}()
+
+	stats, err := processFeedStream(context.Background(), db, cfg, pipeFeedSource{r: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.New != 2 {
+		t.Errorf("New = %d, want 2", stats.New)
+	}
+	if _, ok := loadProduct(t, db, "sku-2"); !ok {
+		t.Error("product after the first upload was not stored")
+	}
+}
+
+func TestProcessFeedFileSkipsDuplicatesAndMalformedItems(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	sink := &FakeSink{}
+	useSink(t, sink)
+	feed := writeTestFeed(t, feedItem("sku-1", "10.00"), feedItem("sku-1", "11.00"), feedItem("sku-2", "not a price"))
+
+	stats, err := processFeedFile(context.Background(), db, cfg, feed, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.New != 1 || len(stats.Malformed) != 1 {
+		t.Errorf("New, Malformed = %d, %v; want 1 new and 1 malformed", stats.New, stats.Malformed)
+	}
+	if calls := sink.Calls(); len(calls) != 1 {
+		t.Errorf("sink calls = %v, want one upload", calls)
+	}
+}
+
+func TestMalformedItemKeepsItsProductAndDocument(t *testing.T) {
+	for _, mode := range []ReconcileMode{ReconcileOff, ReconcileBefore, ReconcileAfter} {
+		t.Run(string(mode), func(t *testing.T) {
+			db := newTestDB(t)
+			cfg := newTestConfig(t)
+			cfg.OutputPath = filepath.Join(t.TempDir(), "feed.xml")
+			sink := &FakeSink{}
+			useSink(t, sink)
+			cfg.FeedFile = writeTestFeed(t, feedItem("sku-1", "10.00"), feedItem("sku-2", "20.00"))
+			if err := runSync(context.Background(), db, cfg); err != nil {
+				t.Fatal(err)
+			}
+			before, _ := loadProduct(t, db, "sku-2")
+
+			cfg.ReconcileMode = mode
+			cfg.DeleteRemoved = true
+			cfg.FeedFile = writeTestFeed(t, feedItem("sku-1", "10.00"), feedItem("sku-2", "not a price"))
+			if err := runSync(context.Background(), db, cfg); err != nil {
+				t.Fatal(err)
+			}
+			after, ok := loadProduct(t, db, "sku-2")
+			if !ok || after.Status == "deleted" || after.DocumentID != before.DocumentID {
+				t.Errorf("stored sku-2 = %+v (found %v), want it kept with document %s", after, ok, before.DocumentID)
+			}
+			if _, ok := sink.Documents()[before.DocumentID]; !ok {
+				t.Errorf("document %s of the malformed item was deleted", before.DocumentID)
+			}
+		})
+	}
+}
+
+func TestDecodeFeedItemsSkipsInvalidItems(t *testing.T) {
+	feed := `<rss><channel>
+		<item><id>sku-1</id><availability>in stock</availability></item>
+		<item><id>sku-2</id><price>twelve</price></item>
+		<item><id> </id></item>
+		<item><id>sku-4</id><availability>out_of_stock</availability></item>
+	</channel></rss>`
+	var ids []string
+	malformed, err := decodeFeedItems(strings.NewReader(feed), func(item Item) error {
+		ids = append(ids, item.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, ",") != "sku-1,sku-4" {
+		t.Errorf("decoded %v, want sku-1 and sku-4", ids)
+	}
+	if len(malformed) != 2 || malformed[0].Index != 1 || malformed[0].ID != "sku-2" || malformed[1].Index != 2 {
+		t.Errorf("malformed = %+v, want items 1 and 2", malformed)
+	}
+}
+
+func TestDecodeFeedItemsStopsOnCallbackError(t *testing.T) {
+	stop := errors.New("stop")
+	calls := 0
+	_, err := decodeFeedItems(strings.NewReader(`<rss><channel>`+feedItem("sku-1", "1")+feedItem("sku-2", "2")+`</channel></rss>`), func(Item) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("err, calls = %v, %d; want the callback's error after one item", err, calls)
+	}
+}
+
+func TestReportMalformedItemsCapsLog(t *testing.T) {
+	restoreLogging(t)
+	malformed := make([]ItemError, maxReportedItemErrors+5)
+	for i := range malformed {
+		malformed[i] = ItemError{Index: i, ID: fmt.Sprintf("sku-%d", i), Reason: "missing price"}
+	}
+	out := captureOutput(t, &os.Stderr, func() {
+		if err := setupLogging(&Config{}); err != nil {
+			t.Fatal(err)
+		}
+		reportMalformedItems(malformed)
+	})
+	if !strings.Contains(out, "Skipped 25 malformed feed items") || !strings.Contains(out, "and 5 more") {
+		t.Errorf("log = %q", out)
+	}
+	if strings.Contains(out, fmt.Sprintf("sku-%d", maxReportedItemErrors)) {
+		t.Errorf("logged more than %d items: %q", maxReportedItemErrors, out)
+	}
+}
+
+func TestDuplicateItem(t *testing.T) {
+	seen := newIDSet()
+	if duplicateItem(seen, Item{ID: "sku-1"}) {
+		t.Error("first sku-1 reported as a duplicate")
+	}
+	if !duplicateItem(seen, Item{ID: "sku-1"}) {
+		t.Error("second sku-1 not reported as a duplicate")
+	}
+	if duplicateItem(seen, Item{ID: "sku-2"}) {
+		t.Error("sku-2 reported as a duplicate")
+	}
+}
+
+func TestParseFeedItemsKeepsFirstOfRepeatedIDs(t *testing.T) {
+	feed := `<rss><channel>` + feedItem("sku-1", "10.00") + feedItem("sku-2", "5.00") + feedItem("sku-1", "11.00") + `</channel></rss>`
+	items, _, err := parseFeedItems(newTestConfig(t), strings.NewReader(feed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].ID != "sku-1" || items[0].Price != 1000 || items[1].ID != "sku-2" {
+		t.Errorf("items = %+v, want the first sku-1 and sku-2", items)
+	}
+}
+
+// generatedFeed produces a feed of n items on the fly, so the feed itself is
+// never held in memory.
+type generatedFeed struct {
+	n, next int
+	buf     []byte
+}
+
+func (g *generatedFeed) Read(p []byte) (int, error) {
+	for len(g.buf) == 0 {
+		switch {
+		case g.next == 0:
+			g.buf = []byte(`<?xml version="1.0"?><rss><channel>`)
+		case g.next > g.n+1:
+			return 0, io.EOF
+		case g.next == g.n+1:
+			g.buf = []byte(`</channel></rss>`)
+		default:
+			id := fmt.Sprintf("sku-%d", g.next)
+			g.buf = []byte(fmt.Sprintf(`<item><id>%s</id><title>Product %s</title><description>%s</description><price>%d.99</price><link>https://shop.example/%s</link></item>`,
+				id, id, strings.Repeat("x", 1024), g.next%500, id))
+		}
+		g.next++
+	}
+	n := copy(p, g.buf)
+	g.buf = g.buf[n:]
+	return n, nil
+}
+
+func (g *generatedFeed) Close() error { return nil }
+
+func TestDecodedFeedMemoryStaysFlat(t *testing.T) {
+	const items = 50000 // about 55 MB of feed
+	cfg := newTestConfig(t)
+	feed := decodedFeed(cfg, func() (io.ReadCloser, error) { return &generatedFeed{n: items}, nil })
+
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	baseline, peak := stats.HeapAlloc, stats.HeapAlloc
+	count := 0
+	malformed, err := feed(func(Item) error {
+		count++
+		if count%5000 == 0 {
+			runtime.GC()
+			runtime.ReadMemStats(&stats)
+			if stats.HeapAlloc > peak {
+				peak = stats.HeapAlloc
+			}
+		}
+		return nil
+	})
+	if err != nil || len(malformed) != 0 {
+		t.Fatalf("feed() = %v, %v", malformed, err)
+	}
+	if count != items {
+		t.Fatalf("decoded %d items, want %d", count, items)
+	}
+	// Only the seen IDs grow with the feed; the items themselves must not be
+	// retained.
+	if grown := peak - baseline; grown > 16<<20 {
+		t.Errorf("live heap grew by %d bytes while decoding %d items, want under 16 MiB", grown, items)
+	}
+}
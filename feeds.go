@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// FeedConfig is one entry of the config file's "feeds" list. Each feed is
+// synced into its own dataset target, and its products are stored under its
+// feed ID, so reconcile only ever marks that feed's products deleted. Feeds may reuse unique codes when their targets are
+// different datasets; within one dataset the document names would collide.
+type FeedConfig struct {
+	Name string `json:"name"`
+	// ID is the feed's -feed-id; it defaults to the name, which is also the
+	// feed's source.
+	ID string `json:"id"`
+	// URL or File is the feed location, as with -feed-url and -feed-file.
+	URL  string `json:"url"`
+	File string `json:"file"`
+	// Auth, User, Password, Token and Header authenticate the download like
+	// the matching -feed-auth flags.
+	Auth     FeedAuthMode `json:"auth"`
+	User     string       `json:"user"`
+	Password string       `json:"password"`
+	Token    string       `json:"token"`
+	Header   string       `json:"header"`
+	// Target names a dataset target from "targets"; DatasetGUID is used
+	// instead when no targets are configured.
+	Target      string `json:"target"`
+	DatasetGUID string `json:"dataset_guid"`
+	// Out is where the feed is saved; it defaults to -out with the feed name
+	// added before the extension.
+	Out string `json:"out"`
+}
+
+// currentFeedName is the name of the configured feed being synced; syncFeeds
+// sets it, and it is empty for the feed given on the command line.
+var currentFeedName string
+
+// feedMetaKey returns the sync_meta key for per-feed state such as the
+// checkpoint, so feeds sharing a database do not overwrite each other's.
+func feedMetaKey(key string) string {
+	if currentFeedName == "" {
+		return key
+	}
+	return "feed:" + currentFeedName + ":" + key
+}
+
+// feedRunConfigs returns a copy of cfg for each configured feed, with its
+// location, credentials, target, source, feed ID and output path filled in. The
+// changes feed only applies to the command-line feed and is cleared.
+func feedRunConfigs(cfg *Config) ([]*Config, error) {
+	seen := make(map[string]bool, len(cfg.Feeds))
+	usedIDs := make(map[string]bool, len(cfg.Feeds))
+	runs := make([]*Config, 0, len(cfg.Feeds))
+	for _, feed := range cfg.Feeds {
+		if feed.Name == "" {
+			return nil, fmt.Errorf("every feed needs a name")
+		}
+		if seen[feed.Name] {
+			return nil, fmt.Errorf("feed %s is defined twice", feed.Name)
+		}
+		seen[feed.Name] = true
+		if (feed.URL == "") == (feed.File == "") {
+			return nil, fmt.Errorf("feed %s needs exactly one of url and file", feed.Name)
+		}
+		feedID := feed.ID
+		if feedID == "" {
+			feedID = feed.Name
+		}
+		if usedIDs[feedID] {
+			return nil, fmt.Errorf("feed %s reuses feed ID %s", feed.Name, feedID)
+		}
+		usedIDs[feedID] = true
+
+		run := *cfg
+		run.FeedURL, run.FeedFile = feed.URL, feed.File
+		run.FeedAuthMode, run.FeedUser, run.FeedPassword = feed.Auth, feed.User, feed.Password
+		run.FeedToken, run.FeedHeader = feed.Token, feed.Header
+		if err := configureFeedAuth(&run); err != nil {
+			return nil, fmt.Errorf("feed %s: %v", feed.Name, err)
+		}
+		if feed.Target != "" || feed.DatasetGUID != "" {
+			target, err := resolveTarget(cfg.Targets, feed.Target, feed.DatasetGUID)
+			if err != nil {
+				return nil, fmt.Errorf("feed %s: %v", feed.Name, err)
+			}
+			run.Target = target
+		}
+		run.Source, run.FeedID = feed.Name, feedID
+		run.OutputPath = feed.Out
+		if run.OutputPath == "" {
+			ext := filepath.Ext(cfg.OutputPath)
+			run.OutputPath = strings.TrimSuffix(cfg.OutputPath, ext) + "." + feed.Name + ext
+		}
+		run.ChangesFeedURL = ""
+		runs = append(runs, &run)
+	}
+	return runs, nil
+}
+
+// syncFeeds runs runSync for the command-line feed, or for each configured
+// feed in turn. Feeds are synced one at a time because a run's state, such
+// as the document sink and the upload cap, is process-wide. A failed feed
+// does not stop the others.
+func syncFeeds(ctx context.Context, db *sql.DB, cfg *Config) error {
+	if len(cfg.Feeds) == 0 {
+		return runSync(ctx, db, cfg)
+	}
+	runs, err := feedRunConfigs(cfg)
+	if err != nil {
+		return err
+	}
+	sink, chunker := documentSink, segmenter
+	defer func() {
+		currentFeedName = ""
+		documentSink, segmenter = sink, chunker
+	}()
+
+	var failed []string
+	for _, run := range runs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		infof("Syncing feed %s into dataset %s", run.Source, run.Target.DatasetGUID)
+		currentFeedName = run.Source
+		if _, ok := sink.(MyBuddySink); ok {
+			documentSink = MyBuddySink{cfg: run}
+		}
+		segmenter = newSegmenter(run.Target, chunker.Estimator)
+		if err := runSync(ctx, db, run); err != nil {
+			warnf("Feed %s failed: %v", run.Source, err)
+			failed = append(failed, run.Source)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d feeds failed: %s", len(failed), len(runs), strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestFeedRunConfigsDefaultFeedIDToName(t *testing.T) {
+	cfg := &Config{OutputPath: "feed.xml", Feeds: []FeedConfig{
+		{Name: "shop-a", File: "a.xml"},
+		{Name: "shop-b", ID: "tenant-b", File: "b.xml"},
+	}}
+	runs, err := feedRunConfigs(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs[0].FeedID != "shop-a" || runs[1].FeedID != "tenant-b" || runs[1].Source != "shop-b" {
+		t.Errorf("feed IDs = %q, %q (source %q); want shop-a and tenant-b", runs[0].FeedID, runs[1].FeedID, runs[1].Source)
+	}
+	if runs[1].OutputPath != "feed.shop-b.xml" {
+		t.Errorf("output path = %q, want feed.shop-b.xml", runs[1].OutputPath)
+	}
+
+	cfg.Feeds[1].ID = "shop-a"
+	if _, err := feedRunConfigs(cfg); err == nil {
+		t.Error("feedRunConfigs() accepted two feeds with the same feed ID")
+	}
+}
+
+func TestSyncFeedsKeepsFeedsApart(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	cfg.OutputPath = filepath.Join(t.TempDir(), "feed.xml")
+	cfg.ReconcileMode = ReconcileAfter
+	sink := &FakeSink{}
+	useSink(t, sink)
+	sync := func(feedA, feedB string) {
+		t.Helper()
+		cfg.Feeds = []FeedConfig{{Name: "shop-a", File: feedA}, {Name: "shop-b", File: feedB}}
+		if err := syncFeeds(context.Background(), db, cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Both feeds carry sku-1; each keeps its own row, price and document.
+	feedB := writeTestFeed(t, feedItem("sku-1", "99.00"), feedItem("sku-3", "30.00"))
+	sync(writeTestFeed(t, feedItem("sku-1", "10.00"), feedItem("sku-2", "20.00")), feedB)
+	sync(writeTestFeed(t, feedItem("sku-1", "12.00")), feedB)
+
+	for _, want := range []struct {
+		feedID, code, status string
+		price                Money
+	}{
+		{"shop-a", "sku-1", "updated", 1200},
+		{"shop-b", "sku-1", "existing", 9900},
+		{"shop-b", "sku-3", "existing", 3000},
+	} {
+		exists, stored, err := productExists(db, want.feedID, want.code)
+		if err != nil || !exists || stored.Status != want.status || stored.Price != want.price {
+			t.Errorf("%s %s = %+v (exists %v, %v), want %s at %s", want.feedID, want.code, stored, exists, err, want.status, want.price)
+		}
+	}
+	if exists, _, _ := productExists(db, "shop-a", "sku-2"); exists {
+		t.Error("sku-2, dropped from shop-a, was not reconciled")
+	}
+	documents := sink.Documents()
+	if len(documents) != 3 {
+		t.Errorf("%d remote documents, want sku-1 of each feed and sku-3", len(documents))
+	}
+
+	for feedID, want := range map[string][]Money{"shop-a": {1000, 1200}, "shop-b": {9900, 9900}} {
+		history, err := QueryHistory(db, feedID, "sku-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != len(want) {
+			t.Errorf("history of %s sku-1 = %+v, want %d entries", feedID, history, len(want))
+			continue
+		}
+		for i, entry := range history {
+			if entry.NewPrice != want[i] {
+				t.Errorf("history of %s sku-1 entry %d = %+v, want price %s", feedID, i, entry, want[i])
+			}
+		}
+	}
+}
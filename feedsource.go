@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// FeedSource fetches a product feed into a local file, or opens it for
+// streaming without touching the disk.
+type FeedSource interface {
+	Fetch(ctx context.Context, outputPath string) error
+	Open(ctx context.Context) (io.ReadCloser, error)
+	String() string
+}
+
+// newFeedSource picks the source for location: s3://bucket/key and
+// gs://bucket/key read from object storage using the SDKs' default credential
+// chains, file:// or a path marked by isFile reads a local file, and anything
+// else is downloaded over HTTP with auth.
+func newFeedSource(location string, isFile bool, auth FeedAuth) (FeedSource, error) {
+	if isFile {
+		return fileFeedSource{path: location}, nil
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid feed location %q: %v", location, err)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	switch u.Scheme {
+	case "s3":
+		return &objectFeedSource{store: newS3ObjectStore, scheme: u.Scheme, bucket: u.Host, key: key}, nil
+	case "gs":
+		return &objectFeedSource{store: newGCSObjectStore, scheme: u.Scheme, bucket: u.Host, key: key}, nil
+	case "file":
+		return fileFeedSource{path: u.Path}, nil
+	default:
+		return httpFeedSource{url: location, auth: auth}, nil
+	}
+}
+
+// fetchFeed fetches source into outputPath and transparently decompresses a
+// gzip-compressed feed.
+func fetchFeed(ctx context.Context, source FeedSource, outputPath string) error {
+	if err := source.Fetch(ctx, outputPath); err != nil {
+		return err
+	}
+	return gunzipInPlace(outputPath)
+}
+
+// feedStream is an open feed body read through its decompressor.
+type feedStream struct {
+	io.Reader
+	body       io.Closer
+	decompress func() error
+}
+
+// Close releases the decompressor and closes the body.
+func (s feedStream) Close() error {
+	s.decompress()
+	return s.body.Close()
+}
+
+// openFeedStream opens source for reading, decompressing it if needed.
+func openFeedStream(ctx context.Context, source FeedSource) (io.ReadCloser, error) {
+	body, err := source.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	feed, closeFeed, err := decompressFeed(body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	return feedStream{Reader: feed, body: body, decompress: closeFeed}, nil
+}
+
+// bufferFeedItems parses the whole feed straight from source into memory, so
+// the feed never has to fit on disk; runSync uses it instead of
+// processFeedStream when the run needs every item or the feed's hash up
+// front. It also returns the SHA-256 of the decompressed feed, which matches
+// fileSHA256 of a persisted copy.
+func bufferFeedItems(ctx context.Context, cfg *Config, source FeedSource) ([]Item, []ItemError, string, error) {
+	feed, err := openFeedStream(ctx, source)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer feed.Close()
+
+	hash := sha256.New()
+	items, malformed, err := parseFeedItems(cfg, io.TeeReader(feed, hash))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	// Hash whatever follows the closing element too.
+	if _, err := io.Copy(hash, feed); err != nil {
+		return nil, nil, "", fmt.Errorf("failed to read feed from %s: %v", source, err)
+	}
+	infof("Streamed %d items from %s", len(items), source)
+	return items, malformed, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// checkDiskSpace fails when size bytes, e.g. a Content-Length, do not fit on
+// the filesystem of any of dirs. Unknown sizes (negative) and filesystems
+// whose free space cannot be read are not checked.
+func checkDiskSpace(size int64, dirs ...string) error {
+	if size < 0 {
+		return nil
+	}
+	for _, dir := range dirs {
+		available, ok := availableDiskSpace(dir)
+		if ok && uint64(size) > available {
+			return fmt.Errorf("feed is %d bytes but only %d bytes are free in %s; free up space, set -temp-dir or use -stream-feed", size, available, dir)
+		}
+	}
+	return nil
+}
+
+// httpFeedSource downloads the feed with downloadXML.
+type httpFeedSource struct {
+	url  string
+	auth FeedAuth
+}
+
+func (s httpFeedSource) Fetch(ctx context.Context, outputPath string) error {
+	_, err := downloadXML(ctx, s.url, s.auth, outputPath, pageValidators{})
+	return err
+}
+
+func (s httpFeedSource) FetchIfModified(ctx context.Context, outputPath string, since pageValidators) (pageValidators, error) {
+	return downloadXML(ctx, s.url, s.auth, outputPath, since)
+}
+
+func (s httpFeedSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	resp, err := openFeedURL(ctx, s.url, s.auth, pageValidators{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s httpFeedSource) String() string { return s.url }
+
+// fileFeedSource copies a local feed file.
+type fileFeedSource struct {
+	path string
+}
+
+func (s fileFeedSource) Fetch(_ context.Context, outputPath string) error {
+	if s.path == outputPath {
+		return nil
+	}
+	in, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to open feed file: %v", err)
+	}
+	defer in.Close()
+	if info, err := in.Stat(); err == nil {
+		if err := checkDiskSpace(info.Size(), tempDirOrDefault(), filepath.Dir(outputPath)); err != nil {
+			return err
+		}
+	}
+	return writeFeed(outputPath, in)
+}
+
+func (s fileFeedSource) Open(context.Context) (io.ReadCloser, error) {
+	in, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open feed file: %v", err)
+	}
+	return in, nil
+}
+
+func (s fileFeedSource) String() string { return s.path }
+
+// objectStore reads objects from a bucket. It is implemented for S3, GCS and,
+// for tests, in memory.
+type objectStore interface {
+	Open(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+}
+
+// objectFeedSource reads the feed from an object store created on first use.
+type objectFeedSource struct {
+	store               func(ctx context.Context) (objectStore, error)
+	scheme, bucket, key string
+}
+
+func (s *objectFeedSource) Fetch(ctx context.Context, outputPath string) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := store.Open(ctx, s.bucket, s.key)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", s, err)
+	}
+	defer body.Close()
+	if err := writeFeed(outputPath, body); err != nil {
+		return err
+	}
+	infof("Feed %s downloaded successfully and saved to %s", s, outputPath)
+	return nil
+}
+
+func (s *objectFeedSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	store, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	body, err := store.Open(ctx, s.bucket, s.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", s, err)
+	}
+	return body, nil
+}
+
+func (s *objectFeedSource) String() string {
+	return fmt.Sprintf("%s://%s/%s", s.scheme, s.bucket, s.key)
+}
+
+// s3ObjectStore reads from S3 using the default AWS credential chain
+// (environment, shared config, instance role).
+type s3ObjectStore struct {
+	client *s3.Client
+}
+
+func newS3ObjectStore(ctx context.Context) (objectStore, error) {
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %v", err)
+	}
+	return s3ObjectStore{client: s3.NewFromConfig(awsCfg)}, nil
+}
+
+func (s s3ObjectStore) Open(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// gcsObjectStore reads from Google Cloud Storage using Application Default
+// Credentials.
+type gcsObjectStore struct {
+	client *storage.Client
+}
+
+func newGCSObjectStore(ctx context.Context) (objectStore, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %v", err)
+	}
+	return gcsObjectStore{client: client}, nil
+}
+
+func (s gcsObjectStore) Open(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	return s.client.Bucket(bucket).Object(key).NewReader(ctx)
+}
+
+// memoryObjectStore serves objects from memory so tests can exercise
+// objectFeedSource without a cloud account.
+type memoryObjectStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newMemoryObjectStore() *memoryObjectStore {
+	return &memoryObjectStore{objects: make(map[string][]byte)}
+}
+
+// Put stores data under bucket/key.
+func (m *memoryObjectStore) Put(bucket, key string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[bucket+"/"+key] = data
+}
+
+func (m *memoryObjectStore) Open(_ context.Context, bucket, key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[bucket+"/"+key]
+	if !ok {
+		return nil, fmt.Errorf("object %s/%s not found", bucket, key)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// writeFeed saves r to outputPath through a temporary file in tempDir.
+func writeFeed(outputPath string, r io.Reader) error {
+	if err := writeViaTemp(outputPath, r); err != nil {
+		return fmt.Errorf("failed to save feed to file: %v", err)
+	}
+	return nil
+}
+
+// gunzipInPlace replaces path with its decompressed content when it starts
+// with the gzip magic number, and leaves it alone otherwise.
+func gunzipInPlace(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	reader := bufio.NewReader(in)
+	if !isGzipped(reader) {
+		return nil
+	}
+
+	zr, err := gzip.NewReader(reader)
+	if err != nil {
+		return fmt.Errorf("failed to decompress feed: %v", err)
+	}
+	defer zr.Close()
+
+	if err := writeViaTemp(path, zr); err != nil {
+		return fmt.Errorf("failed to decompress feed: %v", err)
+	}
+	return nil
+}
+
+// decompressFeed returns a reader of r's decompressed content when r starts
+// with the gzip magic number, as .xml.gz files and bodies sent with
+// Content-Encoding: gzip do, and of r unchanged otherwise. The returned close
+// releases the decompressor; it does not close r.
+func decompressFeed(r io.Reader) (io.Reader, func() error, error) {
+	reader := bufio.NewReader(r)
+	if !isGzipped(reader) {
+		return reader, func() error { return nil }, nil
+	}
+	zr, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decompress feed: %v", err)
+	}
+	return zr, zr.Close, nil
+}
+
+// isGzipped reports whether reader's next bytes are the gzip magic number.
+func isGzipped(reader *bufio.Reader) bool {
+	magic, err := reader.Peek(2)
+	return err == nil && magic[0] == 0x1f && magic[1] == 0x8b
+}
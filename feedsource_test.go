@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// gzipped returns data compressed with gzip.
+func gzipped(t *testing.T, data string) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return compressed.Bytes()
+}
+
+func TestOpenFeedStreamDecompressesGzip(t *testing.T) {
+	feed := `<?xml version="1.0"?><rss><channel>` + feedItem("sku-1", "10.00") + `</channel></rss>`
+	path := filepath.Join(t.TempDir(), "feed.xml.gz")
+	if err := os.WriteFile(path, gzipped(t, feed), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	items, malformed, hash, err := bufferFeedItems(context.Background(), newTestConfig(t), fileFeedSource{path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].ID != "sku-1" || len(malformed) != 0 {
+		t.Errorf("items, malformed = %v, %v; want sku-1 only", items, malformed)
+	}
+	plain := filepath.Join(t.TempDir(), "feed.xml")
+	if err := os.WriteFile(plain, []byte(feed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := fileSHA256(plain); hash != want {
+		t.Errorf("hash = %s, want the hash of the decompressed feed %s", hash, want)
+	}
+}
+
+func TestNewFeedSource(t *testing.T) {
+	tests := []struct {
+		location string
+		isFile   bool
+		want     string
+	}{
+		{"s3://feeds/catalog/feed.xml.gz", false, "s3://feeds/catalog/feed.xml.gz"},
+		{"gs://feeds/feed.xml", false, "gs://feeds/feed.xml"},
+		{"file:///var/feeds/feed.xml", false, "/var/feeds/feed.xml"},
+		{"feeds/feed.xml", true, "feeds/feed.xml"},
+		{"https://shop.example/feed.xml", false, "https://shop.example/feed.xml"},
+	}
+	for _, tt := range tests {
+		source, err := newFeedSource(tt.location, tt.isFile, FeedAuth{})
+		if err != nil {
+			t.Errorf("newFeedSource(%q) = %v", tt.location, err)
+			continue
+		}
+		if got := source.String(); got != tt.want {
+			t.Errorf("newFeedSource(%q) = %s, want %s", tt.location, got, tt.want)
+		}
+	}
+}
+
+func TestFetchFeedFromObjectStoreGunzips(t *testing.T) {
+	feed := `<?xml version="1.0"?><rss><channel>` + feedItem("sku-1", "10.00") + `</channel></rss>`
+	store := newMemoryObjectStore()
+	store.Put("feeds", "catalog/feed.xml.gz", gzipped(t, feed))
+	source := &objectFeedSource{
+		store:  func(context.Context) (objectStore, error) { return store, nil },
+		scheme: "s3", bucket: "feeds", key: "catalog/feed.xml.gz",
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "feed.xml")
+	if err := fetchFeed(context.Background(), source, outputPath); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(outputPath); string(got) != feed {
+		t.Errorf("fetched feed = %q, want the decompressed feed", got)
+	}
+
+	missing := &objectFeedSource{store: source.store, scheme: "s3", bucket: "feeds", key: "missing.xml"}
+	if err := fetchFeed(context.Background(), missing, outputPath); err == nil {
+		t.Error("fetchFeed of a missing object succeeded")
+	}
+}
+
+func TestFileFeedSourceFetchCopiesFeed(t *testing.T) {
+	feed := writeTestFeed(t, feedItem("sku-1", "10.00"))
+	outputPath := filepath.Join(t.TempDir(), "copy.xml")
+	if err := fetchFeed(context.Background(), fileFeedSource{path: feed}, outputPath); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := os.ReadFile(feed)
+	if got, _ := os.ReadFile(outputPath); !bytes.Equal(got, want) {
+		t.Errorf("copied feed = %q, want %q", got, want)
+	}
+}
+
+func TestDownloadXMLDecompressesGzip(t *testing.T) {
+	feed := `<?xml version="1.0"?><rss><channel>` + feedItem("sku-1", "10.00") + `</channel></rss>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(gzipped(t, feed))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "feed.xml")
+	if _, err := downloadXML(context.Background(), server.URL, FeedAuth{Mode: FeedAuthNone}, path, pageValidators{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != feed {
+		t.Errorf("saved %q, %v; want the decompressed feed", got, err)
+	}
+}
+
+func TestDecompressFeedPassesPlainFeedThrough(t *testing.T) {
+	for _, data := range [][]byte{[]byte("<rss/>"), []byte("<"), nil} {
+		r, closeFeed, err := decompressFeed(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("read %q, %v; want %q unchanged", got, err, data)
+		}
+		closeFeed()
+	}
+	if _, _, err := decompressFeed(bytes.NewReader([]byte{0x1f, 0x8b, 0})); err == nil {
+		t.Error("a truncated gzip header was accepted")
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+)
+
+// googleBaseNS is the namespace of Google Merchant and Facebook catalog feed
+// elements, which feeds usually write with the g: prefix.
+const googleBaseNS = "http://base.google.com/ns/1.0"
+
+// xmlField captures feed elements that have no dedicated Item field.
+type xmlField struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+// itemField returns the value of the feed element named name for item,
+// falling back to elements captured in Item.Extra.
+func itemField(item Item, name string) string {
+	switch name {
+	case "id":
+		return item.ID
+	case "title":
+		return item.Title
+	case "description":
+		return item.Description
+	case "link":
+		return item.Link
+	case "image_link":
+		return item.ImageLink
+	case "brand":
+		return item.Brand
+	case "mpn":
+		return item.MPN
+	case "gtin":
+		return item.GTIN
+	case "item_group_id":
+		return item.ItemGroupID
+	case "product_type":
+		return item.ProductType
+	case "size":
+		return item.Size
+	case "color":
+		return item.Color
+	case "availability":
+		return string(item.Availability)
+	case "condition":
+		return item.Condition
+	}
+	for _, field := range item.Extra {
+		if field.XMLName.Local == name {
+			return strings.TrimSpace(field.Value)
+		}
+	}
+	return ""
+}
+
+// setItemField sets the feed element named name on item. The ID cannot be
+// changed this way; unknown names update or add an entry in Item.Extra.
+func setItemField(item *Item, name, value string) {
+	switch name {
+	case "title":
+		item.Title = value
+	case "description":
+		item.Description = value
+	case "link":
+		item.Link = value
+	case "image_link":
+		item.ImageLink = value
+	case "brand":
+		item.Brand = value
+	case "mpn":
+		item.MPN = value
+	case "gtin":
+		item.GTIN = value
+	case "item_group_id":
+		item.ItemGroupID = value
+	case "product_type":
+		item.ProductType = value
+	case "size":
+		item.Size = value
+	case "color":
+		item.Color = value
+	case "availability":
+		item.Availability = normalizeAvailability(value)
+	case "condition":
+		item.Condition = value
+	default:
+		for i := range item.Extra {
+			if item.Extra[i].XMLName.Local == name {
+				item.Extra[i].Value = value
+				return
+			}
+		}
+		item.Extra = append(item.Extra, xmlField{XMLName: xml.Name{Local: name}, Value: value})
+	}
+}
+
+// rawFeedElement is one child element of a feed item, kept undecoded.
+type rawFeedElement struct {
+	XMLName xml.Name
+	Inner   []byte `xml:",innerxml"`
+}
+
+// UnmarshalXML decodes a feed item whose elements may be bare (<price>) or in
+// the Google namespace (<g:price>). Item's tags carry no namespace, so either
+// form fills a field. When an item has both forms of an element, as feeds
+// that keep the RSS <title> and <link> next to g:title and g:link do, the g:
+// element wins regardless of order.
+func (item *Item) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var raw struct {
+		Elements []rawFeedElement `xml:",any"`
+	}
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+
+	namespaced := make(map[string]bool)
+	for _, element := range raw.Elements {
+		if isGoogleElement(element.XMLName) {
+			namespaced[element.XMLName.Local] = true
+		}
+	}
+	var buf bytes.Buffer
+	buf.WriteString("<item>")
+	for _, element := range raw.Elements {
+		name := element.XMLName.Local
+		if namespaced[name] && !isGoogleElement(element.XMLName) {
+			continue
+		}
+		buf.WriteString("<" + name + ">")
+		buf.Write(element.Inner)
+		buf.WriteString("</" + name + ">")
+	}
+	buf.WriteString("</item>")
+
+	// plainItem has Item's fields without this method, so decoding it does
+	// not recurse.
+	type plainItem Item
+	var decoded plainItem
+	if err := xml.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		// The whole element has been read, so the feed can go on without it.
+		itemErr := &ItemError{Reason: err.Error()}
+		for _, element := range raw.Elements {
+			if element.XMLName.Local == "id" {
+				itemErr.ID = strings.TrimSpace(string(element.Inner))
+			}
+		}
+		return itemErr
+	}
+	*item = Item(decoded)
+	return nil
+}
+
+// isGoogleElement reports whether name is in the Google namespace. A g:
+// prefix the feed forgot to declare counts too.
+func isGoogleElement(name xml.Name) bool {
+	return name.Space == googleBaseNS || name.Space == "g"
+}
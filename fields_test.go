@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+// decodeItem decodes one <item> element of a feed declaring the g: namespace.
+func decodeItem(t *testing.T, inner string) Item {
+	t.Helper()
+	var item Item
+	data := `<item xmlns:g="` + googleBaseNS + `">` + inner + `</item>`
+	if err := xml.Unmarshal([]byte(data), &item); err != nil {
+		t.Fatalf("failed to decode %s: %v", data, err)
+	}
+	return item
+}
+
+func TestItemPrefersGoogleElements(t *testing.T) {
+	for _, inner := range []string{
+		`<title>RSS title</title><g:title>Kettle</g:title><g:id>sku-1</g:id><link>https://blog.example/</link><g:link>https://shop.example/sku-1</g:link>`,
+		`<g:title>Kettle</g:title><title>RSS title</title><g:id>sku-1</g:id><g:link>https://shop.example/sku-1</g:link><link>https://blog.example/</link>`,
+	} {
+		item := decodeItem(t, inner)
+		if item.ID != "sku-1" || item.Title != "Kettle" || item.Link != "https://shop.example/sku-1" {
+			t.Errorf("decoded %+v from %s, want the g: elements", item, inner)
+		}
+	}
+}
+
+func TestItemDecodesBareAndUndeclaredPrefix(t *testing.T) {
+	item := decodeItem(t, `<id>sku-1</id><g:price>2.50</g:price><title>Mug</title>`)
+	if item.ID != "sku-1" || item.Title != "Mug" || item.Price != 250 {
+		t.Errorf("decoded %+v", item)
+	}
+
+	var undeclared Item
+	if err := xml.Unmarshal([]byte(`<item><title>Bare</title><g:title>Prefixed</g:title></item>`), &undeclared); err != nil {
+		t.Fatal(err)
+	}
+	if undeclared.Title != "Prefixed" {
+		t.Errorf("Title = %q, want the undeclared g: element", undeclared.Title)
+	}
+}
+
+func TestItemUnparsableFieldIsItemError(t *testing.T) {
+	var item Item
+	err := xml.Unmarshal([]byte(`<item><id> sku-9 </id><price>abc</price></item>`), &item)
+	itemErr, ok := err.(*ItemError)
+	if !ok {
+		t.Fatalf("err = %v, want an *ItemError", err)
+	}
+	if itemErr.ID != "sku-9" || !strings.Contains(itemErr.Reason, "abc") {
+		t.Errorf("ItemError = %+v", itemErr)
+	}
+}
+
+func TestItemFieldRoundTrip(t *testing.T) {
+	item := decodeItem(t, `<id>sku-1</id><g:season> winter </g:season>`)
+	if got := itemField(item, "season"); got != "winter" {
+		t.Errorf("itemField(season) = %q, want the trimmed extra element", got)
+	}
+	setItemField(&item, "season", "summer")
+	setItemField(&item, "material", "steel")
+	setItemField(&item, "brand", "Acme")
+	for name, want := range map[string]string{"season": "summer", "material": "steel", "brand": "Acme", "id": "sku-1", "missing": ""} {
+		if got := itemField(item, name); got != want {
+			t.Errorf("itemField(%s) = %q, want %q", name, got, want)
+		}
+	}
+	if len(item.Extra) != 2 {
+		t.Errorf("Extra = %+v, want season updated in place and material added", item.Extra)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// defaultFileMode is used for generated files when -file-mode is not set.
+const defaultFileMode FileMode = 0644
+
+// FileMode is the permission mode of generated product documents and debug
+// screenshots, given in octal. The zero value means defaultFileMode.
+type FileMode os.FileMode
+
+// String implements flag.Value.
+func (m *FileMode) String() string {
+	return fmt.Sprintf("%#o", uint32(m.file()))
+}
+
+// Set implements flag.Value.
+func (m *FileMode) Set(value string) error {
+	mode, err := parseFileMode(value)
+	if err != nil {
+		return err
+	}
+	*m = mode
+	return nil
+}
+
+// parseFileMode parses an octal permission mode such as 0640 or 664. Modes
+// with bits outside 0777 or without owner read permission are rejected.
+func parseFileMode(value string) (FileMode, error) {
+	n, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid file mode %q: expected an octal value such as 0644", value)
+	}
+	if n&^0777 != 0 {
+		return 0, fmt.Errorf("invalid file mode %q: only permission bits (0777) are allowed", value)
+	}
+	if n&0400 == 0 {
+		return 0, fmt.Errorf("invalid file mode %q: the owner must be able to read generated files", value)
+	}
+	return FileMode(n), nil
+}
+
+// file is the mode for generated files.
+func (m FileMode) file() os.FileMode {
+	if m == 0 {
+		return os.FileMode(defaultFileMode)
+	}
+	return os.FileMode(m)
+}
+
+// dir is the matching mode for directories: every class that may read the
+// files may also list and traverse the directory.
+func (m FileMode) dir() os.FileMode {
+	mode := m.file()
+	return mode | (mode&0444)>>2
+}
+
+// writeGeneratedFile writes data to path with mode. The mode is applied again
+// after writing, because the process umask masks it on creation and WriteFile
+// leaves the mode of an existing file unchanged.
+func writeGeneratedFile(path string, data []byte, mode FileMode) error {
+	if err := os.WriteFile(path, data, mode.file()); err != nil {
+		return err
+	}
+	return os.Chmod(path, mode.file())
+}
+
+// ensureGeneratedDir creates dir with the directory mode matching mode. An
+// existing directory is left as it is.
+func ensureGeneratedDir(dir string, mode FileMode) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, mode.dir()); err != nil {
+		return err
+	}
+	return os.Chmod(dir, mode.dir())
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseFileMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    FileMode
+		wantErr bool
+	}{
+		{in: "0640", want: 0640},
+		{in: "664", want: 0664},
+		{in: "0400", want: 0400},
+		{in: "rw-r--r--", wantErr: true},
+		{in: "1777", wantErr: true},
+		{in: "0044", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseFileMode(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseFileMode(%q) = %#o, %v; want %#o, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestFileModeDir(t *testing.T) {
+	tests := []struct {
+		mode FileMode
+		want os.FileMode
+	}{
+		{0, 0755},
+		{0640, 0750},
+		{0600, 0700},
+		{0604, 0705},
+	}
+	for _, tt := range tests {
+		if got := tt.mode.dir(); got != tt.want {
+			t.Errorf("FileMode(%#o).dir() = %#o, want %#o", uint32(tt.mode), got, tt.want)
+		}
+	}
+}
+
+func TestWriteGeneratedFileAppliesMode(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "docs", "nested")
+	if err := ensureGeneratedDir(dir, 0640); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "Prod_sku-1.txt")
+	// An existing file keeps its mode through WriteFile, so the mode must be reapplied.
+	if err := os.WriteFile(path, []byte("old"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeGeneratedFile(path, []byte("new"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, check := range []struct {
+		path string
+		want os.FileMode
+	}{{dir, 0750}, {path, 0640}} {
+		info, err := os.Stat(check.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != check.want {
+			t.Errorf("%s has mode %#o, want %#o", check.path, got, check.want)
+		}
+	}
+}
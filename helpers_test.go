@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newTestDB opens an in-memory database with the full schema. It is served by
+// a single connection, since every connection to :memory: is a database of
+// its own.
+func newTestDB(t testing.TB) *sql.DB {
+	t.Helper()
+	db, err := sql.Open(sqliteDriverName, "file::memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if err := ensureSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateDB(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newTestConfig returns a config for a run against dataset test-dataset that
+// writes its documents to a temporary folder, and resets the process-wide run
+// state the pipeline shares when the test ends.
+func newTestConfig(t testing.TB) *Config {
+	t.Helper()
+	target, err := resolveTarget(nil, "", "test-dataset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink, letters := documentSink, deadLetters
+	retries, breaker := httpRetryPolicy, apiBreaker
+	t.Cleanup(func() {
+		documentSink, deadLetters = sink, letters
+		httpRetryPolicy, apiBreaker = retries, breaker
+		uploadCap.max, formatMigrations.max = 0, 0
+		uploadCap.reset()
+		formatMigrations.reset()
+		// Set by runSync for the run it syncs.
+		feedWatermark, activeRun, currentRunID = nil, nil, ""
+	})
+	deadLetters = &deadLetterQueue{entries: make(map[deadLetterKey]deadLetterEntry)}
+	httpRetryPolicy.MaxRetries = 0
+	apiBreaker = newCircuitBreaker(0, 0)
+	return &Config{
+		BaseURL:           "http://dataset.invalid",
+		FolderPath:        t.TempDir(),
+		Workers:           2,
+		DeleteConcurrency: 2,
+		FormatVersion:     documentFormatVersion,
+		ScrapePolicy:      ScrapeRequireNone,
+		ReconcileMode:     ReconcileOff,
+		Target:            target,
+	}
+}
+
+// useSink makes sink the run's document sink for the rest of the test.
+func useSink(t testing.TB, sink DocumentSink) {
+	t.Helper()
+	documentSink = sink
+}
+
+// storeProduct inserts a product row of the default feed.
+func storeProduct(t testing.TB, db *sql.DB, product Product) {
+	t.Helper()
+	if err := insertProduct(db, product); err != nil {
+		t.Fatalf("failed to store %s: %v", product.UniqueCode, err)
+	}
+}
+
+// loadProduct returns the stored row of uniqueCode in the default feed.
+func loadProduct(t testing.TB, db *sql.DB, uniqueCode string) (storedProduct, bool) {
+	t.Helper()
+	exists, stored, err := productExists(db, "", uniqueCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored, exists
+}
+
+// countProducts returns the number of stored product rows.
+func countProducts(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM products`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// apiRequest is a request received by testAPI.
+type apiRequest struct {
+	Method string
+	Path   string
+}
+
+// testAPI is a mock dataset API. Uploads and updates succeed and return
+// sequential document IDs; deletes answer deleteStatus.
+type testAPI struct {
+	*httptest.Server
+	mu           sync.Mutex
+	requests     []apiRequest
+	deleteStatus int
+	nextID       int
+}
+
+// newTestAPI starts a mock dataset API and points cfg and the document sink
+// at it.
+func newTestAPI(t testing.TB, cfg *Config) *testAPI {
+	t.Helper()
+	api := &testAPI{deleteStatus: http.StatusNoContent}
+	api.Server = httptest.NewServer(http.HandlerFunc(api.serve))
+	t.Cleanup(api.Close)
+	cfg.BaseURL = api.URL
+	useSink(t, MyBuddySink{cfg: cfg})
+	return api
+}
+
+func (a *testAPI) serve(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	a.requests = append(a.requests, apiRequest{Method: r.Method, Path: r.URL.Path})
+	deleteStatus := a.deleteStatus
+	a.mu.Unlock()
+
+	switch {
+	case r.Method == "DELETE":
+		w.WriteHeader(deleteStatus)
+		if deleteStatus >= 300 {
+			fmt.Fprint(w, `{"message":"delete failed"}`)
+		}
+	case strings.HasSuffix(r.URL.Path, "/document/create_by_file"):
+		a.mu.Lock()
+		a.nextID++
+		id := fmt.Sprintf("doc-%d", a.nextID)
+		a.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"document": map[string]string{"id": id}})
+	case strings.HasSuffix(r.URL.Path, "/update_by_file"):
+		parts := strings.Split(r.URL.Path, "/")
+		json.NewEncoder(w).Encode(map[string]interface{}{"document": map[string]string{"id": parts[len(parts)-2]}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// setDeleteStatus changes the status deletes answer with.
+func (a *testAPI) setDeleteStatus(status int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.deleteStatus = status
+}
+
+// count returns how many requests with method had a path ending in suffix.
+func (a *testAPI) count(method, suffix string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := 0
+	for _, req := range a.requests {
+		if req.Method == method && strings.HasSuffix(req.Path, suffix) {
+			n++
+		}
+	}
+	return n
+}
+
+// writeTestFeed writes a feed with items to a temporary file and returns its path.
+func writeTestFeed(t testing.TB, items ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "feed.xml")
+	feed := `<?xml version="1.0"?><rss><channel>` + strings.Join(items, "") + `</channel></rss>`
+	if err := os.WriteFile(path, []byte(feed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// errSink fails every call with err.
+type errSink struct{ err error }
+
+func (s errSink) Upload(context.Context, string) (string, error)         { return "", s.err }
+func (s errSink) Update(context.Context, string, string) (string, error) { return "", s.err }
+func (s errSink) Delete(context.Context, string) error                   { return s.err }
+
+// captureOutput returns what fn writes to *file, which is swapped for a pipe
+// while fn runs.
+func captureOutput(t *testing.T, file **os.File, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := *file
+	*file = w
+	defer func() { *file = saved }()
+	done := make(chan string)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- string(out)
+	}()
+	fn()
+	w.Close()
+	return <-done
+}
+
+// feedItem renders a minimal feed <item>.
+func feedItem(id, price string) string {
+	return fmt.Sprintf(`<item><id>%s</id><title>Product %s</title><price>%s</price><link>https://shop.example/%s</link></item>`, id, id, price, id)
+}
+
+// storedUploadStatus returns the upload_status of uniqueCode in the default feed.
+func storedUploadStatus(t *testing.T, db *sql.DB, uniqueCode string) string {
+	t.Helper()
+	var status string
+	if err := db.QueryRow(`SELECT upload_status FROM products WHERE feed_id = '' AND unique_code = ?`, uniqueCode).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+// restoreLogging puts back the loggers and -silent setupLogging replaces.
+func restoreLogging(t *testing.T) {
+	t.Helper()
+	logger, writer, flags, wasSilent := slog.Default(), log.Writer(), log.Flags(), silent
+	t.Cleanup(func() {
+		slog.SetDefault(logger)
+		log.SetOutput(writer)
+		log.SetFlags(flags)
+		silent = wasSilent
+	})
+}
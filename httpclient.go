@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// httpTransport is shared by the API, product page and image clients, so
+// connections to the dataset API and product pages are pooled and reused
+// across workers instead of being set up per request.
+var httpTransport = newHTTPTransport()
+
+// feedTransport carries feed downloads. Only the wait for the response
+// headers is bounded, since a large feed can take much longer than any API
+// request to arrive; the download itself ends with the run's context.
+var feedTransport = newFeedTransport()
+
+// feedClient downloads feeds. It is separate from apiClient so feed downloads
+// are never recorded by -record-dir.
+var feedClient = &http.Client{Transport: feedTransport}
+
+// defaultHTTPTimeout bounds an API request, including reading the body, and
+// the wait for a feed's response headers; -http-timeout overrides it.
+const defaultHTTPTimeout = time.Minute
+
+func newHTTPTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 16
+	transport.IdleConnTimeout = 90 * time.Second
+	return transport
+}
+
+func newFeedTransport() *http.Transport {
+	transport := newHTTPTransport()
+	transport.ResponseHeaderTimeout = defaultHTTPTimeout
+	return transport
+}
+
+// configureHTTPClients applies -http-timeout and -http-retries and keeps
+// enough idle connections per host for every upload and delete worker.
+func configureHTTPClients(cfg *Config) {
+	httpRetryPolicy.MaxRetries = cfg.HTTPRetries
+	apiClient.Timeout = cfg.HTTPTimeout
+	feedTransport.ResponseHeaderTimeout = cfg.HTTPTimeout
+	if idle := cfg.Workers + cfg.DeleteConcurrency; idle > httpTransport.MaxIdleConnsPerHost {
+		httpTransport.MaxIdleConnsPerHost = idle
+	}
+}
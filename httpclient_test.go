@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useHTTPClients restores the shared client settings configureHTTPClients
+// changes when the test ends.
+func useHTTPClients(t *testing.T) {
+	t.Helper()
+	timeout, header, idle := apiClient.Timeout, feedTransport.ResponseHeaderTimeout, httpTransport.MaxIdleConnsPerHost
+	t.Cleanup(func() {
+		apiClient.Timeout, feedTransport.ResponseHeaderTimeout, httpTransport.MaxIdleConnsPerHost = timeout, header, idle
+	})
+}
+
+func TestConfigureHTTPClients(t *testing.T) {
+	cfg := newTestConfig(t)
+	useHTTPClients(t)
+	cfg.HTTPTimeout, cfg.HTTPRetries = 5*time.Second, 2
+	cfg.Workers, cfg.DeleteConcurrency = 20, 10
+
+	configureHTTPClients(cfg)
+	if apiClient.Timeout != 5*time.Second || feedTransport.ResponseHeaderTimeout != 5*time.Second {
+		t.Errorf("timeouts = %s, %s, want 5s", apiClient.Timeout, feedTransport.ResponseHeaderTimeout)
+	}
+	if httpRetryPolicy.MaxRetries != 2 {
+		t.Errorf("MaxRetries = %d, want 2", httpRetryPolicy.MaxRetries)
+	}
+	if httpTransport.MaxIdleConnsPerHost != 30 {
+		t.Errorf("MaxIdleConnsPerHost = %d, want one per worker", httpTransport.MaxIdleConnsPerHost)
+	}
+
+	cfg.Workers, cfg.DeleteConcurrency = 1, 1
+	configureHTTPClients(cfg)
+	if httpTransport.MaxIdleConnsPerHost != 30 {
+		t.Errorf("MaxIdleConnsPerHost shrank to %d", httpTransport.MaxIdleConnsPerHost)
+	}
+}
+
+func TestSharedTransportReusesConnections(t *testing.T) {
+	var conns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := &http.Client{Transport: newHTTPTransport()}
+	for i := 0; i < 5; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("opened %d connections for 5 sequential requests, want 1", n)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTPRetryPolicy bounds retries of transient HTTP failures. The wait before
+// retry n (0-based) is BaseDelay doubled n times, capped at MaxDelay, with
+// random jitter of up to half of it; a Retry-After header replaces the
+// computed wait, still capped at MaxDelay.
+type HTTPRetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// httpRetryPolicy applies to the dataset API and feed downloads; main sets
+// MaxRetries from -http-retries.
+var httpRetryPolicy = HTTPRetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  500 * time.Millisecond,
+	MaxDelay:   30 * time.Second,
+}
+
+// retryableStatus reports whether a response status is worth retrying.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// httpDoWithRetry sends req with client, retrying connection errors and
+// retryable statuses under httpRetryPolicy. A request whose body cannot be
+// replayed is sent once. Waiting stops early when the request's context is
+// cancelled. The last response or error is returned when retries run out.
+func httpDoWithRetry(client *http.Client, req *http.Request) (*http.Response, error) {
+	policy := httpRetryPolicy
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Do(req)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if attempt >= policy.MaxRetries || req.Context().Err() != nil || !rewindBody(req) {
+			return resp, err
+		}
+
+		wait := policy.delay(attempt)
+		if err == nil {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				wait = after
+				if policy.MaxDelay > 0 && wait > policy.MaxDelay {
+					wait = policy.MaxDelay
+				}
+			}
+			resp.Body.Close()
+			warnf("%s %s returned %s; retrying in %s", req.Method, req.URL.Redacted(), resp.Status, wait.Round(time.Millisecond))
+		} else {
+			warnf("%s %s failed: %v; retrying in %s", req.Method, req.URL.Redacted(), err, wait.Round(time.Millisecond))
+		}
+		metrics.IncCounter(metricHTTPRetries)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// delay returns the jittered wait before retry attempt n.
+func (p HTTPRetryPolicy) delay(n int) time.Duration {
+	d := p.BaseDelay
+	for i := 0; i < n && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// rewindBody prepares req to be sent again, reporting false when its body
+// cannot be replayed.
+func rewindBody(req *http.Request) bool {
+	if req.Body == nil || req.Body == http.NoBody {
+		return true
+	}
+	if req.GetBody == nil {
+		return false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return false
+	}
+	req.Body = body
+	return true
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingServer answers the first failures requests with status and the rest
+// with 200, counting every request.
+func failingServer(t *testing.T, failures int32, status int, header http.Header) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			for key, values := range header {
+				w.Header()[key] = values
+			}
+			w.WriteHeader(status)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// useRetryPolicy makes policy the HTTP retry policy for the rest of the test.
+func useRetryPolicy(t *testing.T, policy HTTPRetryPolicy) {
+	t.Helper()
+	saved := httpRetryPolicy
+	t.Cleanup(func() { httpRetryPolicy = saved })
+	httpRetryPolicy = policy
+}
+
+func TestHTTPDoWithRetryRetriesTransientStatuses(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		useRetryPolicy(t, HTTPRetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+		server, requests := failingServer(t, 2, status, nil)
+		req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("payload"))
+		resp, err := httpDoWithRetry(server.Client(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || *requests != 3 {
+			t.Errorf("status %d: got %d after %d requests, want 200 after 3", status, resp.StatusCode, *requests)
+		}
+	}
+}
+
+func TestHTTPDoWithRetryGivesUp(t *testing.T) {
+	useRetryPolicy(t, HTTPRetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	server, requests := failingServer(t, 10, http.StatusBadGateway, nil)
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := httpDoWithRetry(server.Client(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || *requests != 3 {
+		t.Errorf("got %d after %d requests, want the last 502 after 3", resp.StatusCode, *requests)
+	}
+
+	server, requests = failingServer(t, 10, http.StatusBadRequest, nil)
+	req, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+	if resp, err = httpDoWithRetry(server.Client(), req); err == nil {
+		resp.Body.Close()
+	}
+	if *requests != 1 {
+		t.Errorf("a 400 was sent %d times, want once", *requests)
+	}
+}
+
+func TestHTTPDoWithRetryHonoursRetryAfter(t *testing.T) {
+	useRetryPolicy(t, HTTPRetryPolicy{MaxRetries: 1, BaseDelay: time.Hour, MaxDelay: 50 * time.Millisecond})
+	server, _ := failingServer(t, 1, http.StatusTooManyRequests, http.Header{"Retry-After": {"3600"}})
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	start := time.Now()
+	resp, err := httpDoWithRetry(server.Client(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("waited %s, want Retry-After capped at MaxDelay", elapsed)
+	}
+}
+
+func TestHTTPDoWithRetryStopsOnCancel(t *testing.T) {
+	useRetryPolicy(t, HTTPRetryPolicy{MaxRetries: 3, BaseDelay: time.Hour, MaxDelay: time.Hour})
+	server, requests := failingServer(t, 10, http.StatusServiceUnavailable, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if _, err := httpDoWithRetry(server.Client(), req); err != context.DeadlineExceeded {
+		t.Errorf("err = %v, want the context's error", err)
+	}
+	if *requests != 1 {
+		t.Errorf("sent %d requests, want 1", *requests)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"7", 7 * time.Second, true},
+		{"soon", 0, false},
+		{"-1", 0, false},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+	} {
+		if got, ok := retryAfter(tc.value); got != tc.want || ok != tc.ok {
+			t.Errorf("retryAfter(%q) = %s, %v, want %s, %v", tc.value, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestHTTPRetryPolicyDelay(t *testing.T) {
+	policy := HTTPRetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for n, max := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		if d := policy.delay(n); d < max/2 || d > max {
+			t.Errorf("delay(%d) = %s, want within [%s, %s]", n, d, max/2, max)
+		}
+	}
+}
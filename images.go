@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+const (
+	imageFetchTimeout = 30 * time.Second
+	imagesDirName     = "images"
+)
+
+// imageClient downloads product images for -download-images.
+var imageClient = &http.Client{Transport: httpTransport, Timeout: imageFetchTimeout}
+
+// imageMaxBytes bounds a downloaded image; main sets it from -image-max-bytes.
+var imageMaxBytes int64 = 10 << 20
+
+// errImageNotFound is returned by downloadImage when the image link answers
+// 404 or 410, which is common for products whose images were removed.
+var errImageNotFound = errors.New("image not found")
+
+// imageExtensions maps the accepted image types to the extension of the saved
+// file.
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// downloadImage saves the image at url to dest plus the extension of its
+// type and returns the path it wrote. Both the Content-Type header and the
+// sniffed content must be an accepted image type, and the body may not exceed
+// imageMaxBytes.
+func downloadImage(ctx context.Context, url, dest string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create HTTP request: %v", err)
+	}
+	resp, err := imageClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download image: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return "", errImageNotFound
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("failed to download image: %s", resp.Status)
+	case resp.ContentLength > imageMaxBytes:
+		return "", fmt.Errorf("image is %d bytes, above the %d limit", resp.ContentLength, imageMaxBytes)
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || imageExtensions[mediaType] == "" {
+		return "", fmt.Errorf("unsupported image content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, imageMaxBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %v", err)
+	}
+	if int64(len(data)) > imageMaxBytes {
+		return "", fmt.Errorf("image is larger than the %d byte limit", imageMaxBytes)
+	}
+	sniffed := http.DetectContentType(data)
+	ext := imageExtensions[sniffed]
+	if ext == "" {
+		return "", fmt.Errorf("image content is %s, not the %s it was served as", sniffed, mediaType)
+	}
+
+	path := dest + ext
+	if err := writeViaTemp(path, bytes.NewReader(data)); err != nil {
+		return "", fmt.Errorf("failed to save image: %v", err)
+	}
+	return path, nil
+}
+
+// fetchProductImage downloads the image of item into the images subfolder
+// when -download-images is set. A missing or unusable image is logged and ""
+// returned, so the product is still uploaded with its text only.
+func fetchProductImage(ctx context.Context, cfg *Config, item Item) string {
+	if !cfg.DownloadImages || cfg.DryRun || item.ImageLink == "" {
+		return ""
+	}
+	dest := filepath.Join(cfg.FolderPath, imagesDirName, documentName(documentNameTemplate, item.ID))
+	path, err := downloadImage(ctx, item.ImageLink, dest)
+	if errors.Is(err, errImageNotFound) {
+		debugf("Image of %s not found at %s; uploading text only", item.ID, item.ImageLink)
+		return ""
+	}
+	if err != nil {
+		warnf("Failed to download image of %s from %s: %v", item.ID, item.ImageLink, err)
+		return ""
+	}
+	return path
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pngData is the start of a PNG file, enough for content sniffing.
+const pngData = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+// newImageServer serves pngData as /product.png, HTML as /page.png served as
+// a PNG, and 404 for anything else.
+func newImageServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/product.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(pngData))
+		case "/page.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("<html><body>Not an image</body></html>"))
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(pngData))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownloadImage(t *testing.T) {
+	server := newImageServer(t)
+	dest := filepath.Join(t.TempDir(), "Prod_sku-1")
+
+	path, err := downloadImage(context.Background(), server.URL+"/product.png", dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); path != dest+".png" || string(got) != pngData {
+		t.Errorf("saved %q to %s, want the image at %s.png", got, path, dest)
+	}
+
+	if _, err := downloadImage(context.Background(), server.URL+"/missing.png", dest); !errors.Is(err, errImageNotFound) {
+		t.Errorf("missing image = %v, want errImageNotFound", err)
+	}
+	for _, name := range []string{"/page.png", "/page.html"} {
+		if _, err := downloadImage(context.Background(), server.URL+name, dest); err == nil {
+			t.Errorf("%s was saved as an image", name)
+		}
+	}
+}
+
+func TestDownloadImageEnforcesMaxBytes(t *testing.T) {
+	server := newImageServer(t)
+	defer func(saved int64) { imageMaxBytes = saved }(imageMaxBytes)
+	imageMaxBytes = 8
+
+	_, err := downloadImage(context.Background(), server.URL+"/product.png", filepath.Join(t.TempDir(), "Prod_sku-1"))
+	if err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("downloadImage() = %v, want the size limit error", err)
+	}
+}
+
+func TestWorkerRecordsImagePath(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	useSink(t, &FakeSink{})
+	server := newImageServer(t)
+	cfg.DownloadImages = true
+	// main creates the image folder at startup.
+	if err := ensureGeneratedDir(filepath.Join(cfg.FolderPath, imagesDirName), cfg.FileMode); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, item := range []Item{
+		{ID: "sku-1", Title: "Product", Price: 100, ImageLink: server.URL + "/product.png"},
+		{ID: "sku-2", Title: "Product", Price: 100, ImageLink: server.URL + "/missing.png"},
+	} {
+		if err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), item); err != nil {
+			t.Fatalf("%s: %v", item.ID, err)
+		}
+	}
+	for code, want := range map[string]string{
+		"sku-1": filepath.Join(cfg.FolderPath, imagesDirName, documentName(documentNameTemplate, "sku-1")+".png"),
+		"sku-2": "",
+	} {
+		var path string
+		if err := db.QueryRow(`SELECT image_path FROM products WHERE unique_code = ?`, code).Scan(&path); err != nil {
+			t.Fatal(err)
+		}
+		if path != want {
+			t.Errorf("%s: image_path = %q, want %q", code, path, want)
+		}
+	}
+}
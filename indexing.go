@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Indexing states reported by the indexing-status endpoint that end polling.
+// The API reports several intermediate states (waiting, parsing, splitting,
+// indexing); they are recorded as they are.
+const (
+	indexingCompleted = "completed"
+	indexingError     = "error"
+)
+
+const (
+	indexingPollStart = time.Second
+	indexingPollMax   = 10 * time.Second
+)
+
+// errIndexingFailed is returned by uploadItem when the API could not index an
+// uploaded document; the product is then marked failed for -retry-failed.
+var errIndexingFailed = errors.New("document indexing failed")
+
+// uploadBatches maps a document ID to the indexing batch of its last upload,
+// which the indexing-status endpoint is addressed by.
+var uploadBatches = struct {
+	sync.Mutex
+	batch map[string]string
+}{batch: make(map[string]string)}
+
+// indexingSink is a DocumentSink that can report whether an uploaded document
+// has been indexed.
+type indexingSink interface {
+	WaitIndexed(ctx context.Context, documentID string) (string, error)
+}
+
+// indexingStatusResponse is the part of the indexing-status response we use.
+type indexingStatusResponse struct {
+	Data []struct {
+		ID             string `json:"id"`
+		IndexingStatus string `json:"indexing_status"`
+		Error          string `json:"error"`
+	} `json:"data"`
+}
+
+// recordUploadBatch remembers batch for documentID after an upload.
+func recordUploadBatch(documentID, batch string) {
+	if batch == "" {
+		return
+	}
+	uploadBatches.Lock()
+	uploadBatches.batch[documentID] = batch
+	uploadBatches.Unlock()
+}
+
+// takeUploadBatch returns and forgets the batch recorded for documentID.
+func takeUploadBatch(documentID string) string {
+	uploadBatches.Lock()
+	defer uploadBatches.Unlock()
+	batch := uploadBatches.batch[documentID]
+	delete(uploadBatches.batch, documentID)
+	return batch
+}
+
+// WaitIndexed implements indexingSink. It polls the document's batch with
+// backoff until indexing completes or fails, and returns the last state seen
+// when cfg.IndexingTimeout passes first. A document uploaded without a batch
+// returns "".
+func (s MyBuddySink) WaitIndexed(ctx context.Context, documentID string) (string, error) {
+	batch := takeUploadBatch(documentID)
+	if batch == "" {
+		return "", nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.IndexingTimeout)
+	defer cancel()
+
+	status := ""
+	delay := indexingPollStart
+	for {
+		current, err := fetchIndexingStatus(ctx, s.cfg, batch, documentID)
+		if err != nil && ctx.Err() == nil {
+			return status, err
+		}
+		if current != "" {
+			status = current
+		}
+		if status == indexingCompleted || status == indexingError || ctx.Err() != nil {
+			return status, nil
+		}
+		select {
+		case <-ctx.Done():
+			return status, nil
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > indexingPollMax {
+			delay = indexingPollMax
+		}
+	}
+}
+
+// fetchIndexingStatus returns the indexing state of documentID in batch.
+func fetchIndexingStatus(ctx context.Context, cfg *Config, batch, documentID string) (string, error) {
+	url := fmt.Sprintf("%s/v1/datasets/%s/documents/%s/indexing-status", cfg.BaseURL, cfg.Target.DatasetGUID, batch)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create indexing status request: %v", err)
+	}
+	resp, err := apiDo(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute indexing status request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("failed to get indexing status: %d - %s", resp.StatusCode, string(bodyBytes))
+	}
+	var statuses indexingStatusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&statuses); err != nil {
+		return "", fmt.Errorf("failed to decode indexing status: %v", err)
+	}
+	for _, document := range statuses.Data {
+		if document.ID == documentID {
+			if document.IndexingStatus == indexingError && document.Error != "" {
+				warnf("Indexing of document %s failed: %s", documentID, document.Error)
+			}
+			return document.IndexingStatus, nil
+		}
+	}
+	return "", nil
+}
+
+// waitForIndexing waits, with -wait-indexing, for the document uploaded for
+// uniqueCode to be indexed and records the final state in indexing_status. It
+// returns errIndexingFailed when indexing failed. A timeout or a failed
+// status check is logged and leaves the upload marked successful.
+func waitForIndexing(ctx context.Context, db *sql.DB, cfg *Config, uniqueCode, documentID string) error {
+	sink, ok := documentSink.(indexingSink)
+	if !cfg.WaitIndexing || !ok || documentID == "" {
+		return nil
+	}
+	status, err := sink.WaitIndexed(ctx, documentID)
+	if err != nil {
+		warnf("Failed to check indexing of %s: %v", uniqueCode, err)
+	}
+	if status == "" {
+		return nil
+	}
+	if status != indexingCompleted && status != indexingError {
+		warnf("Document %s of %s still %s after %s", documentID, uniqueCode, status, cfg.IndexingTimeout)
+	}
+	if err := setIndexingStatus(db, cfg.FeedID, uniqueCode, status); err != nil {
+		warnf("Failed to record indexing status for %s: %v", uniqueCode, err)
+	}
+	if status == indexingError {
+		return fmt.Errorf("%w for document %s", errIndexingFailed, documentID)
+	}
+	return nil
+}
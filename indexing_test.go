@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// indexingAPI is a mock dataset API whose uploads return doc-1 in batch-1
+// and whose indexing-status endpoint reports states in turn, repeating the
+// last one.
+type indexingAPI struct {
+	*httptest.Server
+	mu     sync.Mutex
+	states []string
+	polls  int
+}
+
+// newIndexingAPI starts an indexingAPI, points cfg and the document sink at
+// it and enables -wait-indexing.
+func newIndexingAPI(t *testing.T, cfg *Config, states ...string) *indexingAPI {
+	t.Helper()
+	api := &indexingAPI{states: states}
+	api.Server = httptest.NewServer(http.HandlerFunc(api.serve))
+	t.Cleanup(api.Close)
+	cfg.BaseURL = api.URL
+	cfg.WaitIndexing, cfg.IndexingTimeout = true, 10*time.Second
+	useSink(t, MyBuddySink{cfg: cfg})
+	return api
+}
+
+func (a *indexingAPI) serve(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/document/create_by_file"):
+		json.NewEncoder(w).Encode(map[string]interface{}{"document": map[string]string{"id": "doc-1"}, "batch": "batch-1"})
+	case strings.HasSuffix(r.URL.Path, "/documents/batch-1/indexing-status"):
+		a.mu.Lock()
+		state := a.states[len(a.states)-1]
+		if a.polls < len(a.states) {
+			state = a.states[a.polls]
+		}
+		a.polls++
+		a.mu.Unlock()
+		document := map[string]string{"id": "doc-1", "indexing_status": state}
+		if state == indexingError {
+			document["error"] = "unsupported encoding"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": []map[string]string{{"id": "doc-0", "indexing_status": "waiting"}, document}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *indexingAPI) pollCount() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.polls
+}
+
+// storedIndexingStatus returns the indexing_status of a product of the
+// default feed.
+func storedIndexingStatus(t *testing.T, db *sql.DB, uniqueCode string) string {
+	t.Helper()
+	var status string
+	if err := db.QueryRow(`SELECT indexing_status FROM products WHERE feed_id = '' AND unique_code = ?`, uniqueCode).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestWorkerWaitsUntilDocumentIsIndexed(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	api := newIndexingAPI(t, cfg, "indexing", indexingCompleted)
+
+	if err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), Item{ID: "sku-1", Title: "Product", Price: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if n := api.pollCount(); n != 2 {
+		t.Errorf("polled %d times, want until completed on the second poll", n)
+	}
+	if status := storedIndexingStatus(t, db, "sku-1"); status != indexingCompleted {
+		t.Errorf("indexing_status = %q, want %q", status, indexingCompleted)
+	}
+	if status := storedUploadStatus(t, db, "sku-1"); status != uploadUploaded {
+		t.Errorf("upload_status = %q, want %q", status, uploadUploaded)
+	}
+}
+
+func TestWorkerFailsDocumentThatDoesNotIndex(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	newIndexingAPI(t, cfg, indexingError)
+
+	err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), Item{ID: "sku-1", Title: "Product", Price: 100})
+	if !errors.Is(err, errIndexingFailed) {
+		t.Fatalf("worker() = %v, want errIndexingFailed", err)
+	}
+	if status := storedIndexingStatus(t, db, "sku-1"); status != indexingError {
+		t.Errorf("indexing_status = %q, want %q", status, indexingError)
+	}
+	if status := storedUploadStatus(t, db, "sku-1"); status != uploadFailed {
+		t.Errorf("upload_status = %q, want %q", status, uploadFailed)
+	}
+	if id, _ := storedDocumentID(db, "", "sku-1"); id != "doc-1" {
+		t.Errorf("document_id = %q, want the unindexed document kept", id)
+	}
+}
+
+func TestWaitIndexedReturnsLastStateOnTimeout(t *testing.T) {
+	cfg := newTestConfig(t)
+	newIndexingAPI(t, cfg, "parsing")
+	cfg.IndexingTimeout = 100 * time.Millisecond
+	recordUploadBatch("doc-1", "batch-1")
+
+	status, err := MyBuddySink{cfg: cfg}.WaitIndexed(context.Background(), "doc-1")
+	if err != nil || status != "parsing" {
+		t.Errorf("WaitIndexed() = %q, %v; want the last state seen", status, err)
+	}
+	if status, err := (MyBuddySink{cfg: cfg}).WaitIndexed(context.Background(), "doc-1"); err != nil || status != "" {
+		t.Errorf("WaitIndexed() without a batch = %q, %v; want nothing to wait for", status, err)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	jsonLDFetchTimeout = 15 * time.Second
+	jsonLDMaxPageBytes = 8 << 20
+)
+
+var jsonLDScript = regexp.MustCompile(`(?is)<script[^>]*type\s*=\s*["']application/ld\+json["'][^>]*>(.*?)</script>`)
+
+// pageClient fetches product pages for JSON-LD extraction.
+var pageClient = &http.Client{Transport: httpTransport, Timeout: jsonLDFetchTimeout}
+
+// fetchJSONLDSpecification downloads url without a browser and extracts the
+// schema.org Product it describes. ok is false when the page has no Product.
+// Cancelling ctx aborts the download.
+func fetchJSONLDSpecification(ctx context.Context, url string) (map[string]string, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create page request: %v", err)
+	}
+	resp, err := pageClient.Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to fetch page: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("failed to fetch page: %s", resp.Status)
+	}
+	page, err := io.ReadAll(io.LimitReader(resp.Body, jsonLDMaxPageBytes))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read page: %v", err)
+	}
+	data, ok := extractJSONLDProduct(string(page))
+	return data, ok, nil
+}
+
+// extractJSONLDProduct finds the first schema.org Product in the page's
+// JSON-LD blocks and maps it to the "specification" and "category" keys that
+// the selector scrape produces.
+func extractJSONLDProduct(page string) (map[string]string, bool) {
+	for _, match := range jsonLDScript.FindAllStringSubmatch(page, -1) {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(match[1])), &doc); err != nil {
+			continue
+		}
+		if product := findJSONLDType(doc, "Product"); product != nil {
+			return jsonLDProductSpec(product), true
+		}
+	}
+	return nil, false
+}
+
+// findJSONLDType walks arrays and @graph containers for a node of type t.
+func findJSONLDType(node interface{}, t string) map[string]interface{} {
+	switch v := node.(type) {
+	case []interface{}:
+		for _, child := range v {
+			if found := findJSONLDType(child, t); found != nil {
+				return found
+			}
+		}
+	case map[string]interface{}:
+		if hasJSONLDType(v, t) {
+			return v
+		}
+		if graph, ok := v["@graph"]; ok {
+			return findJSONLDType(graph, t)
+		}
+	}
+	return nil
+}
+
+func hasJSONLDType(node map[string]interface{}, t string) bool {
+	switch types := node["@type"].(type) {
+	case string:
+		return types == t
+	case []interface{}:
+		for _, candidate := range types {
+			if candidate == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonLDProductSpec renders a Product node as specification lines.
+func jsonLDProductSpec(product map[string]interface{}) map[string]string {
+	var spec []string
+	add := func(label string, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			spec = append(spec, label+": "+value)
+		}
+	}
+
+	add("Description", jsonLDString(product["description"]))
+	add("Brand", jsonLDString(product["brand"]))
+	add("SKU", jsonLDString(product["sku"]))
+	add("GTIN", jsonLDString(product["gtin13"]))
+	add("Color", jsonLDString(product["color"]))
+	add("Material", jsonLDString(product["material"]))
+
+	offer := findJSONLDType(product["offers"], "Offer")
+	if untyped, ok := product["offers"].(map[string]interface{}); ok && offer == nil {
+		offer = untyped
+	}
+	if offer != nil {
+		price := jsonLDString(offer["price"])
+		if currency := jsonLDString(offer["priceCurrency"]); price != "" && currency != "" {
+			price += " " + currency
+		}
+		add("Price", price)
+		add("Availability", string(normalizeAvailability(jsonLDString(offer["availability"]))))
+	}
+
+	var properties []string
+	if list, ok := product["additionalProperty"].([]interface{}); ok {
+		for _, entry := range list {
+			if prop, ok := entry.(map[string]interface{}); ok {
+				name, value := jsonLDString(prop["name"]), jsonLDString(prop["value"])
+				if name != "" && value != "" {
+					properties = append(properties, name+": "+value)
+				}
+			}
+		}
+	}
+	sort.Strings(properties)
+	spec = append(spec, properties...)
+
+	return map[string]string{
+		"specification": strings.Join(spec, "\n"),
+		"category":      jsonLDString(product["category"]),
+	}
+}
+
+// jsonLDString flattens a JSON-LD value into text. Nested nodes use their name.
+func jsonLDString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%g", v)
+	case map[string]interface{}:
+		return jsonLDString(v["name"])
+	case []interface{}:
+		if len(v) > 0 {
+			return jsonLDString(v[0])
+		}
+	}
+	return ""
+}
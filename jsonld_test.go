@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const jsonLDProductPage = `<html><head>
+<script type="application/ld+json">{"@context":"https://schema.org","@type":"BreadcrumbList"}</script>
+<script type='application/ld+json'>
+{"@context":"https://schema.org","@graph":[
+  {"@type":"WebPage","name":"Shop"},
+  {"@type":["Product","IndividualProduct"],"name":"Tote","description":" Roomy tote ",
+   "brand":{"@type":"Brand","name":"Acme"},"sku":"T-1","category":"Bags",
+   "offers":[{"@type":"Offer","price":49.5,"priceCurrency":"EUR","availability":"https://schema.org/InStock"}],
+   "additionalProperty":[{"name":"Width","value":"40 cm"},{"name":"Depth","value":"12 cm"}]}
+]}
+</script></head><body></body></html>`
+
+func TestExtractJSONLDProduct(t *testing.T) {
+	data, ok := extractJSONLDProduct(jsonLDProductPage)
+	if !ok {
+		t.Fatal("no Product found")
+	}
+	want := "Description: Roomy tote\nBrand: Acme\nSKU: T-1\nPrice: 49.5 EUR\nAvailability: in_stock\nDepth: 12 cm\nWidth: 40 cm"
+	if data["specification"] != want {
+		t.Errorf("specification = %q, want %q", data["specification"], want)
+	}
+	if data["category"] != "Bags" {
+		t.Errorf("category = %q, want Bags", data["category"])
+	}
+
+	for _, page := range []string{
+		`<p>no structured data</p>`,
+		`<script type="application/ld+json">{"@type":"Organization"}</script>`,
+		`<script type="application/ld+json">{not json</script>`,
+	} {
+		if _, ok := extractJSONLDProduct(page); ok {
+			t.Errorf("extractJSONLDProduct(%q) found a Product", page)
+		}
+	}
+}
+
+func TestFetchSpecificationPrefersJSONLD(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	cfg.PreferJSONLD = true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, jsonLDProductPage)
+	}))
+	defer server.Close()
+	cache, err := openSpecCache(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(saved *specCacheStore) { specCache = saved }(specCache)
+	specCache = cache
+
+	data, err := fetchSpecification(context.Background(), cfg, "sku-1", server.URL+"/sku-1")
+	if err != nil {
+		t.Fatalf("fetchSpecification() = %v; the JSON-LD page should not need a browser", err)
+	}
+	if data["category"] != "Bags" {
+		t.Errorf("category = %q, want the JSON-LD category", data["category"])
+	}
+	if _, ok := cache.Lookup("", "sku-1", server.URL+"/sku-1", pageValidators{ETag: `"v1"`}); !ok {
+		t.Error("the JSON-LD extraction was not cached")
+	}
+}
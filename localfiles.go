@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// archiveDirName is the subfolder of the product folder that uploaded
+// documents are moved into with -keep-local-files.
+const archiveDirName = "archive"
+
+// retireLocalFile removes the local copy of an uploaded document, or with
+// cfg.KeepLocalFiles moves it into the archive subfolder, replacing an older
+// archived copy. Only successful uploads are retired, so the file of a failed
+// one stays in place for the retry.
+func retireLocalFile(cfg *Config, path string) error {
+	if !cfg.KeepLocalFiles {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %v", path, err)
+		}
+		return nil
+	}
+
+	dir := filepath.Join(filepath.Dir(path), archiveDirName)
+	if err := ensureGeneratedDir(dir, cfg.FileMode); err != nil {
+		return fmt.Errorf("failed to create archive folder %s: %v", dir, err)
+	}
+	if err := os.Rename(path, filepath.Join(dir, filepath.Base(path))); err != nil {
+		return fmt.Errorf("failed to archive %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// productFiles lists the files in dir, without subfolders.
+func productFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+func TestRetireLocalFile(t *testing.T) {
+	cfg := newTestConfig(t)
+	path := filepath.Join(cfg.FolderPath, "sku-1.txt")
+	for _, content := range []string{"old", "new"} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg.KeepLocalFiles = true
+		if err := retireLocalFile(cfg, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("archived file is still in place: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(cfg.FolderPath, archiveDirName, "sku-1.txt")); err != nil || string(got) != "new" {
+		t.Errorf("archived copy = %q, %v; want the newest", got, err)
+	}
+
+	cfg.KeepLocalFiles = false
+	if err := os.WriteFile(path, []byte("doc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := retireLocalFile(cfg, path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file was not removed: %v", err)
+	}
+	if err := retireLocalFile(cfg, path); err != nil {
+		t.Errorf("removing a missing file = %v, want nil", err)
+	}
+}
+
+func TestWorkerRetiresOnlyUploadedFiles(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	useSink(t, &FakeSink{})
+	item := Item{ID: "sku-1", Title: "Product", Price: 100}
+	if err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), item); err != nil {
+		t.Fatal(err)
+	}
+	if files := productFiles(t, cfg.FolderPath); len(files) != 0 {
+		t.Errorf("product folder still holds %v after the upload", files)
+	}
+
+	cfg = newTestConfig(t)
+	cfg.KeepLocalFiles = true
+	if err := worker(context.Background(), newTestDB(t), cfg, &SyncStats{}, newIDSet(), item); err != nil {
+		t.Fatal(err)
+	}
+	if files := productFiles(t, filepath.Join(cfg.FolderPath, archiveDirName)); len(files) != 1 {
+		t.Errorf("archive holds %v, want the uploaded document", files)
+	}
+
+	cfg = newTestConfig(t)
+	useSink(t, errSink{err: errors.New("connection refused")})
+	if err := worker(context.Background(), newTestDB(t), cfg, &SyncStats{}, newIDSet(), item); err == nil {
+		t.Fatal("worker() = nil, want the upload failure")
+	}
+	if files := productFiles(t, cfg.FolderPath); len(files) != 1 {
+		t.Errorf("product folder holds %v, want the failed document kept for the retry", files)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+)
+
+// silent suppresses the run summary on stdout; set by setupLogging from -silent.
+var silent bool
+
+// setupLogging installs the process-wide slog logger: text or JSON on stderr,
+// at info level, debug level with -verbose, warn level with -quiet or
+// -silent, or the level named by -log-level. Output from the log package,
+// such as the startup errors main reports with log.Fatalf, is routed through
+// the same handler at error level.
+func setupLogging(cfg *Config) error {
+	level := slog.LevelInfo
+	if cfg.Verbose {
+		level = slog.LevelDebug
+	}
+	if cfg.Quiet || cfg.Silent {
+		level = slog.LevelWarn
+	}
+	if cfg.LogLevel != "" {
+		if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+			return fmt.Errorf("unknown log level %q: expected debug, info, warn or error", cfg.LogLevel)
+		}
+	}
+	silent = cfg.Silent
+
+	format := cfg.LogFormat
+	if cfg.LogJSON {
+		format = "json"
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch format {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("unknown log format %q: expected text or json", cfg.LogFormat)
+	}
+
+	logger := slog.New(handler)
+	slog.SetDefault(logger)
+	log.SetFlags(0)
+	log.SetOutput(slogWriter{logger: logger, level: slog.LevelError})
+	return nil
+}
+
+// slogWriter adapts the log package's output to a slog logger.
+type slogWriter struct {
+	logger *slog.Logger
+	level  slog.Level
+}
+
+func (w slogWriter) Write(p []byte) (int, error) {
+	w.logger.Log(context.Background(), w.level, string(bytes.TrimRight(p, "\n")))
+	return len(p), nil
+}
+
+// debugf logs maintenance detail at debug level; it is shown with -verbose.
+func debugf(format string, args ...interface{}) {
+	slog.Debug(fmt.Sprintf(format, args...))
+}
+
+// infof logs progress at info level; it is hidden by -quiet.
+func infof(format string, args ...interface{}) {
+	slog.Info(fmt.Sprintf(format, args...))
+}
+
+// warnf logs a recoverable problem at warn level.
+func warnf(format string, args ...interface{}) {
+	slog.Warn(fmt.Sprintf(format, args...))
+}
+
+// summaryf prints a line of the run summary to stdout unless -silent is set.
+func summaryf(format string, args ...interface{}) {
+	if silent {
+		return
+	}
+	fmt.Printf(format, args...)
+}
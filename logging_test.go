@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSetupLoggingLevels(t *testing.T) {
+	tests := []struct {
+		cfg       Config
+		wantInfo  bool
+		wantDebug bool
+	}{
+		{Config{}, true, false},
+		{Config{Verbose: true}, true, true},
+		{Config{Quiet: true}, false, false},
+		{Config{Silent: true}, false, false},
+		{Config{Quiet: true, LogLevel: "debug"}, true, true},
+	}
+	for _, tt := range tests {
+		restoreLogging(t)
+		out := captureOutput(t, &os.Stderr, func() {
+			if err := setupLogging(&tt.cfg); err != nil {
+				t.Fatal(err)
+			}
+			debugf("debug line")
+			infof("info line")
+			warnf("warn line")
+		})
+		if got := strings.Contains(out, "info line"); got != tt.wantInfo {
+			t.Errorf("%+v: info logged %v, want %v", tt.cfg, got, tt.wantInfo)
+		}
+		if got := strings.Contains(out, "debug line"); got != tt.wantDebug {
+			t.Errorf("%+v: debug logged %v, want %v", tt.cfg, got, tt.wantDebug)
+		}
+		if !strings.Contains(out, "warn line") {
+			t.Errorf("%+v: warning was not logged", tt.cfg)
+		}
+	}
+}
+
+func TestSetupLoggingJSONRoutesLogPackage(t *testing.T) {
+	restoreLogging(t)
+	out := captureOutput(t, &os.Stderr, func() {
+		if err := setupLogging(&Config{LogFormat: "json"}); err != nil {
+			t.Fatal(err)
+		}
+		log.Printf("startup failed")
+	})
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &record); err != nil {
+		t.Fatalf("log output %q is not one JSON record: %v", out, err)
+	}
+	if record["level"] != "ERROR" || record["msg"] != "startup failed" {
+		t.Errorf("record = %v, want the log package message at ERROR", record)
+	}
+
+	for _, cfg := range []Config{{LogFormat: "xml"}, {LogLevel: "loud"}} {
+		if err := setupLogging(&cfg); err == nil {
+			t.Errorf("setupLogging(%+v) accepted an invalid setting", cfg)
+		}
+	}
+}
+
+func TestSilentDropsSummary(t *testing.T) {
+	restoreLogging(t)
+	for _, wantSilent := range []bool{false, true} {
+		silent = wantSilent
+		out := captureOutput(t, &os.Stdout, func() { summaryf("Synced %d products\n", 3) })
+		if got := out == ""; got != wantSilent {
+			t.Errorf("silent = %v: summary %q", wantSilent, out)
+		}
+	}
+}
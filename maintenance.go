@@ -0,0 +1,57 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+)
+
+// shouldVacuum reports whether the end-of-run maintenance step is due, either
+// because -vacuum was given or because the run deleted at least
+// VacuumThreshold products.
+func shouldVacuum(cfg *Config, stats *SyncStats) bool {
+	if cfg.Vacuum {
+		return true
+	}
+	return cfg.VacuumThreshold > 0 && stats != nil && stats.Deleted >= int64(cfg.VacuumThreshold)
+}
+
+// vacuumDB truncates the WAL and rebuilds the database file, then reports how
+// much disk space was reclaimed from the database file at path. It only proceeds when the WAL checkpoint
+// completes, i.e. no other connection or process is reading or writing.
+func vacuumDB(db *sql.DB, path string) error {
+	before := dbDiskUsage(path)
+
+	var busy, logFrames, checkpointed int
+	err := db.QueryRow(`PRAGMA wal_checkpoint(TRUNCATE)`).Scan(&busy, &logFrames, &checkpointed)
+	if err != nil {
+		return fmt.Errorf("failed to checkpoint WAL: %v", err)
+	}
+	if busy != 0 {
+		warnf("Skipping VACUUM: the database is in use by another connection")
+		return nil
+	}
+
+	if _, err := db.Exec(`VACUUM`); err != nil {
+		return fmt.Errorf("failed to vacuum database: %v", err)
+	}
+	// VACUUM writes the rebuilt pages through the WAL; fold them back in.
+	if err := db.QueryRow(`PRAGMA wal_checkpoint(TRUNCATE)`).Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return fmt.Errorf("failed to checkpoint WAL: %v", err)
+	}
+
+	after := dbDiskUsage(path)
+	summaryf("Database maintenance reclaimed %d bytes (%d -> %d)\n", before-after, before, after)
+	return nil
+}
+
+// dbDiskUsage is the combined size of the database file at path and its WAL.
+func dbDiskUsage(path string) int64 {
+	var total int64
+	for _, file := range []string{path, path + "-wal"} {
+		if info, err := os.Stat(file); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShouldVacuum(t *testing.T) {
+	tests := []struct {
+		cfg     Config
+		deleted int64
+		want    bool
+	}{
+		{Config{Vacuum: true}, 0, true},
+		{Config{VacuumThreshold: 10}, 10, true},
+		{Config{VacuumThreshold: 10}, 9, false},
+		{Config{}, 1000, false},
+	}
+	for _, tt := range tests {
+		if got := shouldVacuum(&tt.cfg, &SyncStats{Deleted: tt.deleted}); got != tt.want {
+			t.Errorf("shouldVacuum(%+v, %d deleted) = %v, want %v", tt.cfg, tt.deleted, got, tt.want)
+		}
+	}
+	if shouldVacuum(&Config{VacuumThreshold: 1}, nil) {
+		t.Error("shouldVacuum() without stats = true")
+	}
+}
+
+func TestVacuumDBReclaimsDeletedRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.db")
+	db, err := initializeDB(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		`CREATE TABLE products (unique_code TEXT PRIMARY KEY, description TEXT)`,
+		`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 2000)
+			INSERT INTO products SELECT 'sku-' || i, hex(randomblob(512)) FROM n`,
+		`DELETE FROM products`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := dbDiskUsage(path)
+
+	out := captureOutput(t, &os.Stdout, func() {
+		if err := vacuumDB(db, path); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if after := dbDiskUsage(path); after*4 > before {
+		t.Errorf("database and WAL use %d bytes after VACUUM, %d before; want most of it reclaimed", after, before)
+	}
+	if !strings.Contains(out, "Database maintenance reclaimed") {
+		t.Errorf("summary = %q, want the reclaimed bytes reported", out)
+	}
+}
+
+func TestVacuumDBSkipsDatabaseInUse(t *testing.T) {
+	restoreLogging(t)
+	path := filepath.Join(t.TempDir(), "products.db")
+	db, err := initializeDB(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE products (unique_code TEXT PRIMARY KEY); INSERT INTO products VALUES ('sku-1')`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process reading the database keeps the WAL from being truncated.
+	reader, err := initializeDB(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	tx, err := reader.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	var n int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM products`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO products VALUES ('sku-2')`); err != nil {
+		t.Fatal(err)
+	}
+
+	out := captureOutput(t, &os.Stderr, func() {
+		if err := setupLogging(&Config{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := vacuumDB(db, path); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if !strings.Contains(out, "Skipping VACUUM") {
+		t.Errorf("log = %q, want VACUUM skipped while the database is in use", out)
+	}
+}
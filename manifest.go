@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// manifestEntry describes one uploaded document.
+type manifestEntry struct {
+	ID          string    `json:"id"`
+	Price       Money     `json:"price"`
+	Brand       string    `json:"brand"`
+	Category    string    `json:"category"`
+	DocumentID  string    `json:"document_id"`
+	ContentHash string    `json:"content_hash"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+}
+
+// manifestWriter appends manifest entries as JSON lines. Each entry is a
+// single write to an O_APPEND file, so concurrent runs never interleave lines.
+// A nil *manifestWriter discards entries.
+type manifestWriter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// manifest is the process-wide manifest, opened in main.
+var manifest *manifestWriter
+
+// openManifest opens path for appending; an empty path disables the manifest.
+func openManifest(path string) (*manifestWriter, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest %s: %v", path, err)
+	}
+	return &manifestWriter{file: file}, nil
+}
+
+// Write appends entry to the manifest.
+func (m *manifestWriter) Write(entry manifestEntry) error {
+	if m == nil {
+		return nil
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest entry for %s: %v", entry.ID, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err = m.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the manifest file.
+func (m *manifestWriter) Close() error {
+	if m == nil {
+		return nil
+	}
+	return m.file.Close()
+}
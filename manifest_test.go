@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// readManifest decodes every line of the manifest at path.
+func readManifest(t *testing.T, path string) []manifestEntry {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var entries []manifestEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry manifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("malformed manifest line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestManifestAppendsWholeLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.jsonl")
+	for run := 0; run < 2; run++ {
+		m, err := openManifest(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if err := m.Write(manifestEntry{ID: fmt.Sprintf("sku-%d-%d", run, i), Price: 1999}); err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		if err := m.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if entries := readManifest(t, path); len(entries) != 100 {
+		t.Errorf("manifest has %d entries after two runs, want 100", len(entries))
+	}
+}
+
+func TestManifestDisabled(t *testing.T) {
+	m, err := openManifest("")
+	if err != nil || m != nil {
+		t.Fatalf("openManifest(\"\") = %v, %v; want a nil writer", m, err)
+	}
+	if err := m.Write(manifestEntry{ID: "sku-1"}); err != nil {
+		t.Errorf("nil writer: %v", err)
+	}
+}
+
+func TestWorkerWritesManifestEntry(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	useSink(t, &FakeSink{})
+	path := filepath.Join(t.TempDir(), "manifest.jsonl")
+	m, err := openManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(previous *manifestWriter) { manifest = previous }(manifest)
+	manifest = m
+
+	item := Item{ID: "sku-1", Title: "Product", Price: 1999, Brand: "Acme", ProductType: "Kettles"}
+	if err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), item); err != nil {
+		t.Fatal(err)
+	}
+	m.Close()
+	entries := readManifest(t, path)
+	if len(entries) != 1 {
+		t.Fatalf("manifest entries = %v, want one", entries)
+	}
+	entry := entries[0]
+	if entry.ID != "sku-1" || entry.Price != 1999 || entry.Brand != "Acme" || entry.DocumentID == "" || entry.ContentHash == "" {
+		t.Errorf("manifest entry = %+v, want sku-1 with its price, brand, document ID and content hash", entry)
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metric names shared by every metrics backend.
+const (
+	metricUploads           = "uploads"
+	metricUploadFailures    = "upload_failures"
+	metricUploadDuration    = "upload_duration"
+	metricDeletes           = "deletes"
+	metricDeleteFailures    = "delete_failures"
+	metricDeleteDuration    = "delete_duration"
+	metricScrapeFailures    = "scrape_failures"
+	metricScrapeDuration    = "scrape_duration"
+	metricScrapeSkipped     = "scrape_skipped"
+	metricScrapeJSONLD      = "scrape_jsonld"
+	metricScrapeRetries     = "scrape_retries"
+	metricAPIOutages        = "api_outages"
+	metricAPIOffline        = "api_offline"
+	metricAPIOutageDuration = "api_outage_duration"
+	metricItemsProcessed    = "items_processed"
+	metricItemFailures      = "item_failures"
+	metricLastRunItems      = "last_run_items"
+	metricLastSuccess       = "last_success_timestamp"
+	metricHTTPRetries       = "http_retries"
+	statsdDefaultPrefix     = "mbsync."
+	statsdMaxPacketLength   = 1432
+	prometheusNamespace     = "mbsync"
+	defaultMetricsAddr      = ":9090"
+)
+
+// Metrics is the instrumentation sink the sync pipeline reports to.
+// Tags are "key:value" pairs; backends without tag support flatten or drop them.
+type Metrics interface {
+	IncCounter(name string, tags ...string)
+	ObserveDuration(name string, d time.Duration, tags ...string)
+	SetGauge(name string, value float64, tags ...string)
+}
+
+// metrics is the process-wide metrics sink; it is a no-op unless a backend is configured in main.
+var metrics Metrics = noopMetrics{}
+
+// noopMetrics discards everything.
+type noopMetrics struct{}
+
+func (noopMetrics) IncCounter(string, ...string)                     {}
+func (noopMetrics) ObserveDuration(string, time.Duration, ...string) {}
+func (noopMetrics) SetGauge(string, float64, ...string)              {}
+
+// newMetrics builds the backend selected by cfg. The returned close function
+// releases any sockets or listeners held by the backend.
+func newMetrics(cfg *Config) (Metrics, func() error, error) {
+	backend := cfg.MetricsBackend
+	if backend == "" && cfg.StatsDAddr != "" && cfg.MetricsAddr != "" {
+		return nil, nil, fmt.Errorf("-statsd-addr and -metrics-addr select different metrics backends; choose one with -metrics-backend")
+	}
+	if backend == "" && cfg.StatsDAddr != "" {
+		backend = "statsd"
+	}
+	if backend == "" && cfg.MetricsAddr != "" {
+		backend = "prometheus"
+	}
+
+	switch backend {
+	case "", "none":
+		return noopMetrics{}, func() error { return nil }, nil
+	case "statsd":
+		if cfg.StatsDAddr == "" {
+			return nil, nil, fmt.Errorf("metrics backend statsd requires -statsd-addr")
+		}
+		statsd, err := newStatsDMetrics(cfg.StatsDAddr)
+		if err != nil {
+			return nil, nil, err
+		}
+		return statsd, statsd.Close, nil
+	case "prometheus":
+		addr := cfg.MetricsAddr
+		if addr == "" {
+			addr = defaultMetricsAddr
+		}
+		prom := newPrometheusMetrics()
+		prom.primeCounters()
+		server, err := prom.Serve(addr)
+		if err != nil {
+			return nil, nil, err
+		}
+		return prom, server.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown metrics backend %q", backend)
+	}
+}
+
+// statsdMetrics emits counters and timers to a StatsD (or DogStatsD) agent over UDP.
+type statsdMetrics struct {
+	conn   net.Conn
+	prefix string
+}
+
+// newStatsDMetrics connects a StatsD client to addr (host:port).
+func newStatsDMetrics(addr string) (*statsdMetrics, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to statsd at %s: %v", addr, err)
+	}
+	return &statsdMetrics{conn: conn, prefix: statsdDefaultPrefix}, nil
+}
+
+func (s *statsdMetrics) IncCounter(name string, tags ...string) {
+	s.send(fmt.Sprintf("%s%s:1|c%s", s.prefix, name, statsdTags(tags)))
+}
+
+func (s *statsdMetrics) ObserveDuration(name string, d time.Duration, tags ...string) {
+	s.send(fmt.Sprintf("%s%s:%d|ms%s", s.prefix, name, d.Milliseconds(), statsdTags(tags)))
+}
+
+func (s *statsdMetrics) SetGauge(name string, value float64, tags ...string) {
+	s.send(fmt.Sprintf("%s%s:%g|g%s", s.prefix, name, value, statsdTags(tags)))
+}
+
+// send writes a single packet. StatsD is fire-and-forget, so write errors are ignored.
+func (s *statsdMetrics) send(packet string) {
+	if len(packet) > statsdMaxPacketLength {
+		return
+	}
+	_, _ = s.conn.Write([]byte(packet))
+}
+
+// Close releases the UDP socket.
+func (s *statsdMetrics) Close() error {
+	return s.conn.Close()
+}
+
+// statsdTags renders tags in the DogStatsD "|#k:v,k:v" suffix form.
+func statsdTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return "|#" + strings.Join(tags, ",")
+}
+
+// prometheusMetrics registers collectors lazily, one vector per metric name,
+// using the tag keys of the first observation as the label set.
+type prometheusMetrics struct {
+	registry   *prometheus.Registry
+	mu         sync.Mutex
+	counters   map[string]*prometheus.CounterVec
+	histograms map[string]*prometheus.HistogramVec
+	gauges     map[string]*prometheus.GaugeVec
+}
+
+func newPrometheusMetrics() *prometheusMetrics {
+	return &prometheusMetrics{
+		registry:   prometheus.NewRegistry(),
+		counters:   make(map[string]*prometheus.CounterVec),
+		histograms: make(map[string]*prometheus.HistogramVec),
+		gauges:     make(map[string]*prometheus.GaugeVec),
+	}
+}
+
+// Serve exposes the registry on addr at /metrics in the background.
+func (p *prometheusMetrics) Serve(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics on %s: %v", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			warnf("Metrics server stopped: %v", err)
+		}
+	}()
+	return server, nil
+}
+
+func (p *prometheusMetrics) IncCounter(name string, tags ...string) {
+	if counter, ok := p.counter(name, tags); ok {
+		counter.Inc()
+	}
+}
+
+// counter returns the counter for name and tags, registering its vector on
+// first use.
+func (p *prometheusMetrics) counter(name string, tags []string) (prometheus.Counter, bool) {
+	keys, values := splitTags(tags)
+	p.mu.Lock()
+	vec, ok := p.counters[name]
+	if !ok {
+		vec = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      name + "_total",
+			Help:      "Count of " + strings.ReplaceAll(name, "_", " ") + ".",
+		}, keys)
+		p.registry.MustRegister(vec)
+		p.counters[name] = vec
+	}
+	p.mu.Unlock()
+
+	counter, err := vec.GetMetricWithLabelValues(values...)
+	return counter, err == nil
+}
+
+// primeCounters registers the throughput and failure counters at zero, so
+// /metrics lists them, and rate() over them works, before the first
+// increment.
+func (p *prometheusMetrics) primeCounters() {
+	for _, status := range []string{"new", "updated", "existing", "restocked"} {
+		p.counter(metricItemsProcessed, []string{"status:" + status})
+	}
+	for _, name := range []string{metricUploads, metricUploadFailures, metricDeletes, metricDeleteFailures, metricScrapeFailures, metricItemFailures} {
+		p.counter(name, nil)
+	}
+}
+
+func (p *prometheusMetrics) ObserveDuration(name string, d time.Duration, tags ...string) {
+	name = strings.TrimSuffix(name, "_duration")
+	keys, values := splitTags(tags)
+	p.mu.Lock()
+	vec, ok := p.histograms[name]
+	if !ok {
+		vec = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: prometheusNamespace,
+			Name:      name + "_duration_seconds",
+			Help:      "Duration of " + strings.ReplaceAll(name, "_", " ") + " calls.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+		}, keys)
+		p.registry.MustRegister(vec)
+		p.histograms[name] = vec
+	}
+	p.mu.Unlock()
+
+	if observer, err := vec.GetMetricWithLabelValues(values...); err == nil {
+		observer.Observe(d.Seconds())
+	}
+}
+
+func (p *prometheusMetrics) SetGauge(name string, value float64, tags ...string) {
+	keys, values := splitTags(tags)
+	p.mu.Lock()
+	vec, ok := p.gauges[name]
+	if !ok {
+		vec = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: prometheusNamespace,
+			Name:      name,
+			Help:      "Current " + strings.ReplaceAll(name, "_", " ") + ".",
+		}, keys)
+		p.registry.MustRegister(vec)
+		p.gauges[name] = vec
+	}
+	p.mu.Unlock()
+
+	if gauge, err := vec.GetMetricWithLabelValues(values...); err == nil {
+		gauge.Set(value)
+	}
+}
+
+// splitTags turns "key:value" tags into parallel label name and value slices.
+// Tags without a colon become a label named after themselves with an empty value.
+func splitTags(tags []string) ([]string, []string) {
+	keys := make([]string, 0, len(tags))
+	values := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		key, value, _ := strings.Cut(tag, ":")
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	return keys, values
+}
+
+// recordingMetrics keeps every observation in memory so tests can assert on
+// what the pipeline reported.
+type recordingMetrics struct {
+	mu        sync.Mutex
+	counters  map[string]int
+	durations map[string][]time.Duration
+	gauges    map[string]float64
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{
+		counters:  make(map[string]int),
+		durations: make(map[string][]time.Duration),
+		gauges:    make(map[string]float64),
+	}
+}
+
+func (r *recordingMetrics) IncCounter(name string, tags ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counters[recordingKey(name, tags)]++
+}
+
+func (r *recordingMetrics) ObserveDuration(name string, d time.Duration, tags ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := recordingKey(name, tags)
+	r.durations[key] = append(r.durations[key], d)
+}
+
+func (r *recordingMetrics) SetGauge(name string, value float64, tags ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gauges[recordingKey(name, tags)] = value
+}
+
+// Counter returns how many times name was incremented with exactly tags.
+func (r *recordingMetrics) Counter(name string, tags ...string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counters[recordingKey(name, tags)]
+}
+
+func recordingKey(name string, tags []string) string {
+	if len(tags) == 0 {
+		return name
+	}
+	return name + "{" + strings.Join(tags, ",") + "}"
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// useMetrics makes m the run's metrics sink for the rest of the test.
+func useMetrics(t *testing.T, m Metrics) {
+	t.Helper()
+	saved := metrics
+	t.Cleanup(func() { metrics = saved })
+	metrics = m
+}
+
+func TestNewMetricsServesPrometheusWhenAddrIsSet(t *testing.T) {
+	m, closeMetrics, err := newMetrics(&Config{MetricsAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeMetrics()
+	if _, ok := m.(*prometheusMetrics); !ok {
+		t.Errorf("-metrics-addr selected %T, want Prometheus", m)
+	}
+
+	m, closeMetrics, err = newMetrics(&Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeMetrics()
+	if _, ok := m.(noopMetrics); !ok {
+		t.Errorf("no metrics flags selected %T, want none", m)
+	}
+}
+
+func TestNewMetricsRejectsTwoBackendsWithoutChoice(t *testing.T) {
+	cfg := &Config{StatsDAddr: "127.0.0.1:8125", MetricsAddr: "127.0.0.1:0"}
+	if _, _, err := newMetrics(cfg); err == nil {
+		t.Error("newMetrics() picked a backend for both -statsd-addr and -metrics-addr")
+	}
+
+	cfg.MetricsBackend = "statsd"
+	m, closeMetrics, err := newMetrics(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeMetrics()
+	if _, ok := m.(*statsdMetrics); !ok {
+		t.Errorf("-metrics-backend statsd selected %T", m)
+	}
+}
+
+func TestStatsDSendsPackets(t *testing.T) {
+	agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+	statsd, err := newStatsDMetrics(agent.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer statsd.Close()
+
+	statsd.IncCounter(metricUploads)
+	statsd.ObserveDuration(metricUploadDuration, 1500*time.Millisecond, "status:new")
+	statsd.SetGauge(metricLastRunItems, 42, "feed:shop", "scope:all")
+	statsd.IncCounter(metricItemsProcessed, strings.Repeat("x", statsdMaxPacketLength))
+
+	buf := make([]byte, 2*statsdMaxPacketLength)
+	for _, want := range []string{
+		"mbsync.uploads:1|c",
+		"mbsync.upload_duration:1500|ms|#status:new",
+		"mbsync.last_run_items:42|g|#feed:shop,scope:all",
+	} {
+		agent.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := agent.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("no packet for %s: %v", want, err)
+		}
+		if got := string(buf[:n]); got != want {
+			t.Errorf("packet = %q, want %q", got, want)
+		}
+	}
+	// The oversized packet is dropped rather than truncated.
+	agent.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if n, _, err := agent.ReadFrom(buf); err == nil {
+		t.Errorf("agent received an oversized packet of %d bytes", n)
+	}
+}
+
+func TestPrometheusPrimesCountersAtZero(t *testing.T) {
+	prom := newPrometheusMetrics()
+	prom.primeCounters()
+	prom.IncCounter(metricUploads)
+	server := httptest.NewServer(promhttp.HandlerFor(prom.registry, promhttp.HandlerOpts{}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"mbsync_uploads_total 1",
+		"mbsync_upload_failures_total 0",
+		"mbsync_item_failures_total 0",
+		`mbsync_items_processed_total{status="restocked"} 0`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("/metrics is missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestWorkerCountsItemFailureMetric(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	recorded := newRecordingMetrics()
+	useMetrics(t, recorded)
+	useSink(t, errSink{err: errors.New("connection refused")})
+
+	if err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), Item{ID: "sku-1", Title: "Product", Price: 100}); err == nil {
+		t.Fatal("worker() = nil, want the upload failure")
+	}
+	if n := recorded.Counter(metricItemFailures); n != 1 {
+		t.Errorf("%s = %d, want 1", metricItemFailures, n)
+	}
+}
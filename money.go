@@ -0,0 +1,151 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Money is an amount in minor currency units (cents), so prices compare
+// exactly instead of through float64 rounding. The currency is not kept: a
+// feed is priced in one currency.
+type Money int64
+
+// parseMoney parses a feed price such as "19.99", "19.990" or "19.99 USD".
+// A currency code before or after the amount is ignored. Digits beyond the
+// second decimal place are rounded half away from zero.
+func parseMoney(s string) (Money, error) {
+	amount := strings.TrimSpace(s)
+	if fields := strings.Fields(amount); len(fields) == 2 {
+		if isCurrencyCode(fields[1]) {
+			amount = fields[0]
+		} else if isCurrencyCode(fields[0]) {
+			amount = fields[1]
+		}
+	}
+
+	negative := false
+	switch {
+	case strings.HasPrefix(amount, "-"):
+		negative = true
+		amount = amount[1:]
+	case strings.HasPrefix(amount, "+"):
+		amount = amount[1:]
+	}
+	whole, frac, _ := strings.Cut(amount, ".")
+	if whole == "" && frac == "" || !allDigits(whole) || !allDigits(frac) {
+		return 0, fmt.Errorf("invalid price %q", s)
+	}
+
+	cents := int64(0)
+	if whole != "" {
+		units, err := strconv.ParseInt(whole, 10, 64)
+		if err != nil || units > (1<<63-1)/100-1 {
+			return 0, fmt.Errorf("invalid price %q", s)
+		}
+		cents = units * 100
+	}
+	frac += "00"
+	cents += int64(frac[0]-'0')*10 + int64(frac[1]-'0')
+	if frac[2:] != "" && frac[2] >= '5' {
+		cents++
+	}
+	if negative {
+		cents = -cents
+	}
+	return Money(cents), nil
+}
+
+// isCurrencyCode reports whether s looks like an ISO 4217 code such as USD.
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func allDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats m with two decimal places, e.g. "19.99".
+func (m Money) String() string {
+	cents := int64(m)
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Float64 returns m in major units, for ratios such as percent changes.
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+// UnmarshalXML parses the element text with parseMoney; an empty element is
+// zero.
+func (m *Money) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var s string
+	if err := d.DecodeElement(&s, &start); err != nil {
+		return err
+	}
+	if strings.TrimSpace(s) == "" {
+		*m = 0
+		return nil
+	}
+	parsed, err := parseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// MarshalJSON encodes m as a decimal number such as 19.99.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON reads the decimal number MarshalJSON writes, so stored items
+// such as dead-letter entries keep their price.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	parsed, err := parseMoney(string(data))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value stores m in an integer cents column.
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
+
+// Scan reads an integer cents column; NULL is zero.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: "19.99", want: 1999},
+		{in: "19.990", want: 1999},
+		{in: "19.995", want: 2000},
+		{in: "19.99 USD", want: 1999},
+		{in: "EUR 5", want: 500},
+		{in: ".5", want: 50},
+		{in: "-1.25", want: -125},
+		{in: "0.1", want: 10},
+		{in: "", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "1.2.3", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseMoney(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseMoney(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyJSONRoundTrip(t *testing.T) {
+	for _, m := range []Money{0, 1999, -125} {
+		data, err := json.Marshal(Item{ID: "sku-1", Price: m})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var item Item
+		if err := json.Unmarshal(data, &item); err != nil {
+			t.Fatalf("failed to decode %s: %v", data, err)
+		}
+		if item.Price != m {
+			t.Errorf("round trip of %s = %s", m, item.Price)
+		}
+	}
+	if err := json.Unmarshal([]byte(`"19.99"`), new(Money)); err == nil || !strings.Contains(err.Error(), "invalid price") {
+		t.Errorf("decoding a JSON string: err = %v, want an invalid price", err)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// PageLoadStrategy controls how long fetchSpecification waits after navigating
+// before it reads the page. Earlier strategies are faster but may read a page
+// that is still rendering.
+type PageLoadStrategy string
+
+const (
+	PageLoadDOMContentLoaded PageLoadStrategy = "domcontentloaded"
+	PageLoadLoad             PageLoadStrategy = "load"
+	PageLoadNetworkIdle      PageLoadStrategy = "networkidle"
+	PageLoadWaitForSelector  PageLoadStrategy = "wait-for-selector"
+)
+
+// String implements flag.Value.
+func (s *PageLoadStrategy) String() string {
+	return string(*s)
+}
+
+// Set implements flag.Value.
+func (s *PageLoadStrategy) Set(value string) error {
+	switch PageLoadStrategy(value) {
+	case PageLoadDOMContentLoaded, PageLoadLoad, PageLoadNetworkIdle, PageLoadWaitForSelector:
+		*s = PageLoadStrategy(value)
+		return nil
+	}
+	return fmt.Errorf("invalid page-load strategy %q: expected %s, %s, %s or %s",
+		value, PageLoadDOMContentLoaded, PageLoadLoad, PageLoadNetworkIdle, PageLoadWaitForSelector)
+}
+
+// Page load failures, wrapped by navigateAction so fetchSpecification can
+// tell a page that did not load from one that loaded without the panel.
+var (
+	errNavigationFailed   = errors.New("navigation failed")
+	errSelectorNotVisible = errors.New("selector never became visible")
+)
+
+// navigateAction opens url and waits according to strategy, bounded by timeout.
+// selector is only used by PageLoadWaitForSelector, which waits for it with
+// chromedp.WaitVisible.
+func navigateAction(url string, strategy PageLoadStrategy, selector string, timeout time.Duration) chromedp.Action {
+	var navigate chromedp.Action
+	waitVisible := false
+	switch strategy {
+	case PageLoadLoad:
+		navigate = chromedp.Navigate(url)
+	case PageLoadDOMContentLoaded:
+		navigate = navigateUntilLifecycle(url, "DOMContentLoaded")
+	case PageLoadNetworkIdle:
+		navigate = navigateUntilLifecycle(url, "networkIdle")
+	default:
+		navigate = navigateNoWait(url)
+		waitVisible = true
+	}
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		if err := navigate.Do(ctx); err != nil {
+			return fmt.Errorf("page load (%s): %w: %v", strategy, errNavigationFailed, err)
+		}
+		if waitVisible {
+			if err := chromedp.WaitVisible(selector, chromedp.ByQuery).Do(ctx); err != nil {
+				return fmt.Errorf("page load (%s): %w: %q: %v", strategy, errSelectorNotVisible, selector, err)
+			}
+		}
+		return nil
+	})
+}
+
+// navigateNoWait starts a navigation without waiting for the load event.
+func navigateNoWait(url string) chromedp.ActionFunc {
+	return func(ctx context.Context) error {
+		_, _, errorText, _, err := page.Navigate(url).Do(ctx)
+		if err != nil {
+			return err
+		}
+		if errorText != "" {
+			return errors.New(errorText)
+		}
+		return nil
+	}
+}
+
+// navigateUntilLifecycle navigates and returns once the main frame of the new
+// document fires the named page lifecycle event.
+func navigateUntilLifecycle(url, event string) chromedp.ActionFunc {
+	return func(ctx context.Context) error {
+		listenCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		events := make(chan *page.EventLifecycleEvent, 32)
+		chromedp.ListenTarget(listenCtx, func(ev interface{}) {
+			if e, ok := ev.(*page.EventLifecycleEvent); ok && e.Name == event {
+				select {
+				case events <- e:
+				default:
+				}
+			}
+		})
+
+		if err := page.SetLifecycleEventsEnabled(true).Do(ctx); err != nil {
+			return err
+		}
+		frameID, loaderID, errorText, _, err := page.Navigate(url).Do(ctx)
+		if err != nil {
+			return err
+		}
+		if errorText != "" {
+			return errors.New(errorText)
+		}
+
+		for {
+			select {
+			case e := <-events:
+				if e.FrameID == frameID && e.LoaderID == loaderID {
+					return nil
+				}
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useScraperPool makes a one-browser pool for cfg the run's scrapers for the
+// rest of the test. It skips the test where Chrome cannot be started.
+func useScraperPool(t *testing.T, cfg *Config) {
+	t.Helper()
+	if err := browsers.probe(); err != nil {
+		t.Skipf("Chrome is not available: %v", err)
+	}
+	saved := scrapers
+	scrapers = newScraperPool(cfg, 1)
+	t.Cleanup(func() {
+		scrapers.Close()
+		scrapers = saved
+	})
+}
+
+func TestFetchWithRetryRetriesMissingSelector(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Write([]byte(`<html><body>Loading</body></html>`))
+			return
+		}
+		w.Write([]byte(`<html><body><div class="react-tabs__tab-panel">Capacity: 1.7 l</div></body></html>`))
+	}))
+	defer server.Close()
+	cfg := newTestConfig(t)
+	cfg.ScrapeTimeout, cfg.PageLoad, cfg.PageLoadTimeout, cfg.ScrapeRetries = 30*time.Second, PageLoadWaitForSelector, time.Second, 1
+	useScraperPool(t, cfg)
+
+	data, err := fetchWithRetry(context.Background(), cfg, "sku-1", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&requests) != 2 || data["specification"] == "" {
+		t.Errorf("got %v after %d requests, want the panel on the retry", data, requests)
+	}
+}
+
+func TestFetchWithRetryGivesUpOnNavigationFailure(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+	cfg := newTestConfig(t)
+	cfg.ScrapeTimeout, cfg.PageLoad, cfg.PageLoadTimeout, cfg.ScrapeRetries = 30*time.Second, PageLoadLoad, 5*time.Second, 0
+	useScraperPool(t, cfg)
+
+	if _, err := fetchWithRetry(context.Background(), cfg, "sku-1", url); !errors.Is(err, errNavigationFailed) {
+		t.Errorf("fetchWithRetry() = %v, want errNavigationFailed", err)
+	}
+}
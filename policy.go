@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ScrapePolicy decides whether a product may be uploaded when scraping only
+// partially succeeded.
+type ScrapePolicy string
+
+const (
+	ScrapeRequireBoth ScrapePolicy = "require-both" // specification and category
+	ScrapeRequireAny  ScrapePolicy = "require-any"  // specification or category
+	ScrapeRequireNone ScrapePolicy = "require-none" // upload whatever was scraped
+)
+
+// String implements flag.Value.
+func (p *ScrapePolicy) String() string {
+	return string(*p)
+}
+
+// Set implements flag.Value.
+func (p *ScrapePolicy) Set(value string) error {
+	switch ScrapePolicy(value) {
+	case ScrapeRequireBoth, ScrapeRequireAny, ScrapeRequireNone:
+		*p = ScrapePolicy(value)
+		return nil
+	}
+	return fmt.Errorf("invalid scrape policy %q: expected %s, %s or %s", value, ScrapeRequireBoth, ScrapeRequireAny, ScrapeRequireNone)
+}
+
+// check returns a reason when the scraped fields in itemDict do not satisfy the policy.
+func (p ScrapePolicy) check(itemDict map[string]string) (string, bool) {
+	hasSpec := strings.TrimSpace(itemDict["specification"]) != ""
+	hasCategory := strings.TrimSpace(itemDict["category"]) != ""
+
+	switch p {
+	case ScrapeRequireBoth:
+		if !hasSpec || !hasCategory {
+			return fmt.Sprintf("scrape incomplete (specification=%t, category=%t) under %s", hasSpec, hasCategory, p), false
+		}
+	case ScrapeRequireAny:
+		if !hasSpec && !hasCategory {
+			return fmt.Sprintf("scrape returned neither specification nor category under %s", p), false
+		}
+	}
+	return "", true
+}
+
+// ScrapeTimeoutAction is what happens to a product whose page scrape timed out.
+type ScrapeTimeoutAction string
+
+const (
+	ScrapeTimeoutUpload ScrapeTimeoutAction = "upload" // upload without the scraped fields, subject to ScrapePolicy
+	ScrapeTimeoutSkip   ScrapeTimeoutAction = "skip"   // defer the product to the next run
+)
+
+// String implements flag.Value.
+func (a *ScrapeTimeoutAction) String() string {
+	return string(*a)
+}
+
+// Set implements flag.Value.
+func (a *ScrapeTimeoutAction) Set(value string) error {
+	switch ScrapeTimeoutAction(value) {
+	case ScrapeTimeoutUpload, ScrapeTimeoutSkip:
+		*a = ScrapeTimeoutAction(value)
+		return nil
+	}
+	return fmt.Errorf("invalid scrape timeout action %q: expected %s or %s", value, ScrapeTimeoutUpload, ScrapeTimeoutSkip)
+}
+
+// skips reports whether a scrape that failed with err defers the product.
+func (a ScrapeTimeoutAction) skips(err error) bool {
+	return a == ScrapeTimeoutSkip && errors.Is(err, errScrapeTimeout)
+}
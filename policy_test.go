@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestScrapePolicyCheck(t *testing.T) {
+	both := map[string]string{"specification": "Leather", "category": "Shoes"}
+	specOnly := map[string]string{"specification": "Leather", "category": " "}
+	neither := map[string]string{}
+	tests := []struct {
+		policy ScrapePolicy
+		fields map[string]string
+		want   bool
+	}{
+		{ScrapeRequireBoth, both, true},
+		{ScrapeRequireBoth, specOnly, false},
+		{ScrapeRequireAny, specOnly, true},
+		{ScrapeRequireAny, neither, false},
+		{ScrapeRequireNone, neither, true},
+	}
+	for _, tt := range tests {
+		reason, ok := tt.policy.check(tt.fields)
+		if ok != tt.want || (reason == "") != ok {
+			t.Errorf("%s.check(%v) = %q, %v; want ok %v with a reason when refused", tt.policy, tt.fields, reason, ok, tt.want)
+		}
+	}
+}
+
+func TestScrapePolicySet(t *testing.T) {
+	var p ScrapePolicy
+	if err := p.Set("require-any"); err != nil || p != ScrapeRequireAny {
+		t.Errorf("Set(require-any) = %v, policy %q", err, p)
+	}
+	if err := p.Set("require-all"); err == nil {
+		t.Error("Set(require-all) accepted an unknown policy")
+	}
+}
+
+func TestScrapeTimeoutActionSkips(t *testing.T) {
+	timeout := fmt.Errorf("%w after 20s", errScrapeTimeout)
+	if !ScrapeTimeoutSkip.skips(timeout) {
+		t.Error("skip does not defer a timed-out scrape")
+	}
+	if ScrapeTimeoutSkip.skips(errors.New("net::ERR_NAME_NOT_RESOLVED")) {
+		t.Error("skip defers a scrape that failed for another reason")
+	}
+	if ScrapeTimeoutUpload.skips(timeout) {
+		t.Error("upload defers a timed-out scrape")
+	}
+}
+
+func TestScrapeTimeoutActionSet(t *testing.T) {
+	var a ScrapeTimeoutAction
+	if err := a.Set("skip"); err != nil || a != ScrapeTimeoutSkip {
+		t.Errorf("Set(skip) = %v, action %q", err, a)
+	}
+	if err := a.Set("retry"); err == nil {
+		t.Error("Set(retry) accepted an unknown action")
+	}
+	if a.String() != "skip" {
+		t.Errorf("String() = %q after a failed Set, want skip", a.String())
+	}
+}
+
+func TestWorkerDefersIncompleteScrape(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	sink := &FakeSink{}
+	useSink(t, sink)
+	pages := newCachedPages(t, db, cfg)
+	cfg.ScrapePolicy = ScrapeRequireBoth
+	item := Item{ID: "sku-1", Title: "Product", Price: 1000, Link: pages.link("sku-1")}
+	data := map[string]string{"specification": "Leather", "category": ""}
+	if err := specCache.Store("", item.ID, item.Link, pageValidators{ETag: `"v1"`}, data); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := &SyncStats{}
+	if err := worker(context.Background(), db, cfg, stats, newIDSet(), item); !errors.Is(err, errDeferred) {
+		t.Fatalf("worker() = %v, want errDeferred", err)
+	}
+	if calls := sink.Calls(); len(calls) != 0 {
+		t.Errorf("sink calls = %v, want the incomplete document held back", calls)
+	}
+	if stats.Deferred != 1 || !deadLetters.Has(cfg.FeedID, item.ID) {
+		t.Errorf("Deferred = %d, queued %v; want the item in the dead-letter queue", stats.Deferred, deadLetters.Has(cfg.FeedID, item.ID))
+	}
+}
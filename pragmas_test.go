@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidatePragmas(t *testing.T) {
+	valid := map[string]string{"synchronous": "normal", "Cache_Size": "-20000", "mmap_size": "268435456", "temp_store": "MEMORY"}
+	if err := validatePragmas(valid); err != nil {
+		t.Errorf("validatePragmas(%v) = %v", valid, err)
+	}
+	for _, pragmas := range []map[string]string{
+		{"journal_mode": "WAL"},
+		{"synchronous": "sometimes"},
+		{"mmap_size": "-1"},
+		{"cache_size": "big"},
+	} {
+		if err := validatePragmas(pragmas); err == nil {
+			t.Errorf("validatePragmas(%v) accepted an invalid pragma", pragmas)
+		}
+	}
+}
+
+func TestPragmaStatements(t *testing.T) {
+	got := pragmaStatements(map[string]string{"temp_store": "memory", "Synchronous": "normal"})
+	want := []string{"PRAGMA synchronous = NORMAL", "PRAGMA temp_store = MEMORY"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pragmaStatements() = %q, want %q", got, want)
+	}
+}
+
+func TestPragmasApplyToEveryConnection(t *testing.T) {
+	saved := dbPragmas
+	t.Cleanup(func() { dbPragmas = saved })
+	dbPragmas = pragmaStatements(map[string]string{"temp_store": "memory"})
+
+	db, err := sql.Open(sqliteDriverName, filepath.Join(t.TempDir(), "products.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	var conns []*sql.Conn
+	for i := 0; i < 2; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	for i, conn := range conns {
+		var value int
+		if err := conn.QueryRowContext(ctx, `PRAGMA temp_store`).Scan(&value); err != nil {
+			t.Fatal(err)
+		}
+		if value != 2 {
+			t.Errorf("connection %d: temp_store = %d, want 2 (MEMORY)", i, value)
+		}
+	}
+}
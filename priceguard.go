@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+)
+
+// priceSwingStats summarises how the feed's prices compare to the stored ones.
+type priceSwingStats struct {
+	Compared int
+	Swung    int
+}
+
+// Fraction is the share of compared products whose price swung.
+func (s priceSwingStats) Fraction() float64 {
+	if s.Compared == 0 {
+		return 0
+	}
+	return float64(s.Swung) / float64(s.Compared)
+}
+
+// priceSwingCounter compares feed items one at a time with their stored
+// prices, so a feed can be checked while it is decoded without holding it or
+// the stored prices in memory.
+type priceSwingCounter struct {
+	cfg       *Config
+	changePct float64
+	lookup    *sql.Stmt
+	args      []interface{}
+	seen      *idSet
+	stats     priceSwingStats
+}
+
+// newPriceSwingCounter prepares the stored price lookup of the products in
+// cfg's partition. Close releases it.
+func newPriceSwingCounter(db *sql.DB, cfg *Config, changePct float64) (*priceSwingCounter, error) {
+	filter, args := partitionFilter(cfg.Scope, cfg.FeedID)
+	lookup, err := db.Prepare(`SELECT price_cents FROM products WHERE unique_code = ? AND ` + filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stored prices: %v", err)
+	}
+	return &priceSwingCounter{cfg: cfg, changePct: changePct, lookup: lookup, args: args, seen: newIDSet()}, nil
+}
+
+// Add compares item with its stored price and counts it when the price
+// changed by more than changePct percent. Items out of scope, not stored yet
+// or repeated in the feed are not compared.
+func (c *priceSwingCounter) Add(item Item) error {
+	if !c.cfg.Scope.Matches(item) || c.seen.Has(item.ID) {
+		return nil
+	}
+	c.seen.Add(item.ID)
+	var old Money
+	err := c.lookup.QueryRow(append([]interface{}{item.ID}, c.args...)...).Scan(&old)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read stored prices: %v", err)
+	}
+	c.stats.Compared++
+	pct := percentChange(old, item.Price)
+	if (math.IsNaN(pct) && item.Price != 0) || math.Abs(pct) > c.changePct {
+		c.stats.Swung++
+	}
+	return nil
+}
+
+// Close releases the stored price lookup.
+func (c *priceSwingCounter) Close() error {
+	return c.lookup.Close()
+}
+
+// measurePriceSwings compares the price of every in-scope item feed yields
+// that is already in the database with its stored price and counts the ones
+// that changed by more than changePct percent.
+func measurePriceSwings(db *sql.DB, cfg *Config, feed itemFeed, changePct float64) (priceSwingStats, error) {
+	counter, err := newPriceSwingCounter(db, cfg, changePct)
+	if err != nil {
+		return priceSwingStats{}, err
+	}
+	defer counter.Close()
+	if _, err := feed(counter.Add); err != nil {
+		return priceSwingStats{}, err
+	}
+	return counter.stats, nil
+}
+
+// checkPriceSwings rejects the feed when more than cfg.PriceGuardFraction of
+// the stored products would change price by more than cfg.PriceGuardChangePct,
+// which points at a corrupt feed rather than a real repricing. cfg.Force
+// downgrades the rejection to a warning. feed is read once, before the run
+// uploads anything.
+func checkPriceSwings(db *sql.DB, cfg *Config, feed itemFeed) error {
+	if !priceGuarded(cfg) {
+		return nil
+	}
+	stats, err := measurePriceSwings(db, cfg, feed, cfg.PriceGuardChangePct)
+	if err != nil {
+		return err
+	}
+	if stats.Fraction() <= cfg.PriceGuardFraction {
+		return nil
+	}
+
+	msg := fmt.Sprintf("%d of %d stored products (%.0f%%) would change price by more than %.0f%%, above the %.0f%% limit",
+		stats.Swung, stats.Compared, stats.Fraction()*100, cfg.PriceGuardChangePct, cfg.PriceGuardFraction*100)
+	if cfg.Force {
+		warnf("%s; continuing because -force is set", msg)
+		return nil
+	}
+	return fmt.Errorf("feed looks corrupt: %s (use -force to apply it anyway)", msg)
+}
+
+// priceGuarded reports whether the price guard is on.
+func priceGuarded(cfg *Config) bool {
+	return cfg.PriceGuardChangePct > 0 && cfg.PriceGuardFraction > 0
+}
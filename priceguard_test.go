@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestProcessFeedFilePriceGuard(t *testing.T) {
+	tests := []struct {
+		name    string
+		prices  []string
+		force   bool
+		wantErr bool
+	}{
+		{name: "repriced feed rejected", prices: []string{"1.00", "1.00", "10.00"}, wantErr: true},
+		{name: "forced", prices: []string{"1.00", "1.00", "10.00"}, force: true},
+		{name: "small changes", prices: []string{"10.50", "10.00", "1.00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			cfg := newTestConfig(t)
+			cfg.PriceGuardChangePct, cfg.PriceGuardFraction, cfg.Force = 80, 0.5, tt.force
+			sink := &FakeSink{}
+			useSink(t, sink)
+			var items []string
+			for i, code := range []string{"sku-1", "sku-2", "sku-3"} {
+				storeProduct(t, db, Product{UniqueCode: code, Price: 1000, Status: "existing"})
+				items = append(items, feedItem(code, tt.prices[i]))
+			}
+			// New products and repeated items are not compared.
+			items = append(items, feedItem("sku-new", "99.00"), feedItem("sku-1", "10.00"))
+
+			_, err := processFeedFile(context.Background(), db, cfg, writeTestFeed(t, items...), "", 0)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "2 of 3 stored products") {
+					t.Fatalf("processFeedFile() = %v, want the price guard to reject 2 of 3", err)
+				}
+				if calls := sink.Calls(); len(calls) != 0 {
+					t.Errorf("sink calls = %v, want nothing uploaded before the guard", calls)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("processFeedFile() = %v", err)
+			}
+		})
+	}
+}
+
+func TestMeasurePriceSwings(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	cfg.Scope = Scope{Kind: "brand", Value: "Acme"}
+	for _, code := range []string{"sku-1", "sku-2", "sku-free"} {
+		price := Money(1000)
+		if code == "sku-free" {
+			price = 0
+		}
+		storeProduct(t, db, Product{UniqueCode: code, Price: price, Status: "existing", Scope: "brand:Acme"})
+	}
+	items := []Item{
+		{ID: "sku-1", Brand: "Acme", Price: 1100},
+		{ID: "sku-2", Brand: "Acme", Price: 3000},
+		{ID: "sku-free", Brand: "Acme", Price: 500},
+		{ID: "sku-other", Brand: "Other", Price: 1},
+		{ID: "sku-new", Brand: "Acme", Price: 1},
+	}
+
+	stats, err := measurePriceSwings(db, cfg, sliceFeed(items, nil), 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Compared != 3 || stats.Swung != 2 {
+		t.Errorf("Compared, Swung = %d, %d; want 3, 2", stats.Compared, stats.Swung)
+	}
+	if got := (priceSwingStats{}).Fraction(); got != 0 {
+		t.Errorf("Fraction() of nothing compared = %v, want 0", got)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+// priceChange is one row of the price_history audit table.
+type priceChange struct {
+	FeedID     string
+	UniqueCode string
+	OldPrice   float64
+	NewPrice   float64
+	// PctChange is the change relative to OldPrice in percent; it is NaN when
+	// OldPrice is zero.
+	PctChange float64
+	ChangedAt time.Time
+}
+
+// percentChange returns (newPrice-oldPrice)/oldPrice in percent, or NaN when
+// oldPrice is zero and the change has no meaningful ratio.
+func percentChange(oldPrice, newPrice Money) float64 {
+	if oldPrice == 0 {
+		return math.NaN()
+	}
+	return float64(newPrice-oldPrice) / float64(oldPrice) * 100
+}
+
+// recordPriceChange appends a price change of uniqueCode of feed feedID to
+// price_history.
+func recordPriceChange(db *sql.DB, feedID, uniqueCode string, oldPrice, newPrice Money) error {
+	var pct interface{}
+	if p := percentChange(oldPrice, newPrice); !math.IsNaN(p) {
+		pct = p
+	}
+	query := `INSERT INTO price_history (feed_id, unique_code, old_price, new_price, pct_change, changed_at) VALUES (?, ?, ?, ?, ?, ?)`
+	return writeDB(db, query, feedID, uniqueCode, oldPrice.Float64(), newPrice.Float64(), pct, time.Now().UTC().Format(time.RFC3339))
+}
+
+// largePriceChanges returns the price changes of feed feedID recorded since
+// since whose absolute percent change exceeds thresholdPct, largest first.
+// Changes from a zero price are always included.
+func largePriceChanges(db *sql.DB, feedID string, thresholdPct float64, since time.Time) ([]priceChange, error) {
+	rows, err := db.Query(`SELECT feed_id, unique_code, old_price, new_price, pct_change, changed_at FROM price_history
+		WHERE feed_id = ? AND changed_at >= ? AND (pct_change IS NULL OR ABS(pct_change) > ?)
+		ORDER BY pct_change IS NOT NULL, ABS(pct_change) DESC`,
+		feedID, since.UTC().Format(time.RFC3339), thresholdPct)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query price history: %v", err)
+	}
+	defer rows.Close()
+
+	var changes []priceChange
+	for rows.Next() {
+		var change priceChange
+		var pct sql.NullFloat64
+		var changedAt string
+		if err := rows.Scan(&change.FeedID, &change.UniqueCode, &change.OldPrice, &change.NewPrice, &pct, &changedAt); err != nil {
+			return nil, fmt.Errorf("failed to read price history: %v", err)
+		}
+		change.PctChange = math.NaN()
+		if pct.Valid {
+			change.PctChange = pct.Float64
+		}
+		change.ChangedAt, _ = time.Parse(time.RFC3339, changedAt)
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// reportSuspiciousPriceChanges prints the price changes of this run of feed
+// feedID that moved by more than thresholdPct, which usually points at a feed
+// error.
+func reportSuspiciousPriceChanges(db *sql.DB, feedID string, thresholdPct float64, since time.Time) error {
+	changes, err := largePriceChanges(db, feedID, thresholdPct, since)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	summaryf("%d suspicious price changes above %.0f%%:\n", len(changes), thresholdPct)
+	for _, change := range changes {
+		if math.IsNaN(change.PctChange) {
+			summaryf("  %s: %.2f -> %.2f\n", change.UniqueCode, change.OldPrice, change.NewPrice)
+			continue
+		}
+		summaryf("  %s: %.2f -> %.2f (%+.1f%%)\n", change.UniqueCode, change.OldPrice, change.NewPrice, change.PctChange)
+	}
+	return nil
+}
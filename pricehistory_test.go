@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPercentChange(t *testing.T) {
+	if got := percentChange(1000, 1250); got != 25 {
+		t.Errorf("percentChange(10.00, 12.50) = %v, want 25", got)
+	}
+	if got := percentChange(1000, 500); got != -50 {
+		t.Errorf("percentChange(10.00, 5.00) = %v, want -50", got)
+	}
+	if got := percentChange(0, 500); !math.IsNaN(got) {
+		t.Errorf("percentChange(0, 5.00) = %v, want NaN", got)
+	}
+}
+
+func TestLargePriceChanges(t *testing.T) {
+	db := newTestDB(t)
+	since := time.Now().Add(-time.Minute)
+	for _, change := range []struct {
+		code     string
+		old, new Money
+	}{
+		{"small", 1000, 1050},
+		{"double", 1000, 2000},
+		{"free", 0, 990},
+		{"tenfold", 1000, 10000},
+	} {
+		if err := recordPriceChange(db, "", change.code, change.old, change.new); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes, err := largePriceChanges(db, "", 50, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var codes []string
+	for _, change := range changes {
+		codes = append(codes, change.UniqueCode)
+	}
+	want := []string{"free", "tenfold", "double"}
+	if len(codes) != len(want) {
+		t.Fatalf("largePriceChanges() = %v, want %v", codes, want)
+	}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("largePriceChanges() = %v, want %v", codes, want)
+		}
+	}
+	if !math.IsNaN(changes[0].PctChange) || changes[1].PctChange != 900 {
+		t.Errorf("pct changes = %v, %v; want NaN and 900", changes[0].PctChange, changes[1].PctChange)
+	}
+
+	if changes, err := largePriceChanges(db, "", 50, time.Now().Add(time.Hour)); err != nil || len(changes) != 0 {
+		t.Errorf("changes after the run = %v, %v; want none", changes, err)
+	}
+}
+
+func TestWorkerRecordsPriceChange(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	useSink(t, &FakeSink{})
+	storeProduct(t, db, Product{UniqueCode: "sku-1", Price: 1000, Status: "existing"})
+
+	if err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), Item{ID: "sku-1", Title: "Product", Price: 1500}); err != nil {
+		t.Fatal(err)
+	}
+	var oldPrice, newPrice, pct float64
+	err := db.QueryRow(`SELECT old_price, new_price, pct_change FROM price_history WHERE unique_code = 'sku-1'`).Scan(&oldPrice, &newPrice, &pct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oldPrice != 10 || newPrice != 15 || pct != 50 {
+		t.Errorf("recorded %v -> %v (%v%%), want 10 -> 15 (50%%)", oldPrice, newPrice, pct)
+	}
+}
+
+func TestLargePriceChangesIsScopedByFeedID(t *testing.T) {
+	db := newTestDB(t)
+	since := time.Now().Add(-time.Minute)
+	if err := recordPriceChange(db, "shop-b", "sku-1", 1000, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	if changes, err := largePriceChanges(db, "shop-a", 50, since); err != nil || len(changes) != 0 {
+		t.Errorf("changes of shop-a = %v, %v; want none from shop-b", changes, err)
+	}
+	changes, err := largePriceChanges(db, "shop-b", 50, since)
+	if err != nil || len(changes) != 1 || changes[0].FeedID != "shop-b" {
+		t.Errorf("changes of shop-b = %v, %v; want its 99%% drop", changes, err)
+	}
+}
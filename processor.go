@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ItemProcessor is a hook for site-specific item logic, such as enriching an
+// item from an internal API or rewriting its description. Processors run in
+// processItem after scraping and before formatItem, and may modify item in
+// place. An error defers the item to the dead-letter queue.
+type ItemProcessor interface {
+	Process(ctx context.Context, item *Item) error
+}
+
+// ItemProcessorFunc adapts a plain function to ItemProcessor.
+type ItemProcessorFunc func(ctx context.Context, item *Item) error
+
+// Process implements ItemProcessor.
+func (f ItemProcessorFunc) Process(ctx context.Context, item *Item) error {
+	return f(ctx, item)
+}
+
+// itemProcessors is the chain processItem runs, in order. It is empty, and so
+// a no-op, unless main enables processors from -item-processors.
+var itemProcessors []ItemProcessor
+
+// availableItemProcessors are the processors -item-processors can enable by name.
+var availableItemProcessors = map[string]ItemProcessor{
+	"collapse-whitespace": ItemProcessorFunc(collapseWhitespace),
+}
+
+// registerItemProcessor appends p to the chain.
+func registerItemProcessor(p ItemProcessor) {
+	itemProcessors = append(itemProcessors, p)
+}
+
+// enableItemProcessors registers the comma-separated processor names in order.
+func enableItemProcessors(names string) error {
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		p, ok := availableItemProcessors[name]
+		if !ok {
+			return fmt.Errorf("unknown item processor %q", name)
+		}
+		registerItemProcessor(p)
+	}
+	return nil
+}
+
+// runItemProcessors passes item through every registered processor and stops
+// at the first error.
+func runItemProcessors(ctx context.Context, item *Item) error {
+	for i, p := range itemProcessors {
+		if err := p.Process(ctx, item); err != nil {
+			return fmt.Errorf("item processor %d failed: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// collapseWhitespace is an example processor that folds runs of whitespace in
+// the title and description into single spaces.
+func collapseWhitespace(_ context.Context, item *Item) error {
+	item.Title = strings.Join(strings.Fields(item.Title), " ")
+	item.Description = strings.Join(strings.Fields(item.Description), " ")
+	return nil
+}
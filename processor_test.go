@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// useItemProcessors makes processors the chain for the rest of the test.
+func useItemProcessors(t *testing.T, processors ...ItemProcessor) {
+	t.Helper()
+	saved := itemProcessors
+	t.Cleanup(func() { itemProcessors = saved })
+	itemProcessors = processors
+}
+
+func TestEnableItemProcessors(t *testing.T) {
+	useItemProcessors(t)
+	if err := enableItemProcessors(" collapse-whitespace ,"); err != nil {
+		t.Fatal(err)
+	}
+	if len(itemProcessors) != 1 {
+		t.Fatalf("registered %d processors, want 1", len(itemProcessors))
+	}
+	if err := enableItemProcessors("translate"); err == nil {
+		t.Error("enableItemProcessors accepted an unknown processor")
+	}
+}
+
+func TestRunItemProcessorsInOrder(t *testing.T) {
+	var order []string
+	appendTitle := func(suffix string) ItemProcessor {
+		return ItemProcessorFunc(func(_ context.Context, item *Item) error {
+			order = append(order, suffix)
+			item.Title += suffix
+			return nil
+		})
+	}
+	useItemProcessors(t, ItemProcessorFunc(collapseWhitespace), appendTitle("-a"), appendTitle("-b"))
+
+	item := Item{Title: "  Leather   bag ", Description: "A\n\tbag"}
+	if err := runItemProcessors(context.Background(), &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Title != "Leather bag-a-b" || item.Description != "A bag" {
+		t.Errorf("item = %q / %q, want the processors applied in order", item.Title, item.Description)
+	}
+
+	order = nil
+	failing := ItemProcessorFunc(func(context.Context, *Item) error { return errors.New("lookup failed") })
+	useItemProcessors(t, failing, appendTitle("-a"))
+	err := runItemProcessors(context.Background(), &item)
+	if err == nil || !strings.Contains(err.Error(), "item processor 1") || len(order) != 0 {
+		t.Errorf("runItemProcessors() = %v, ran %v; want processor 1 to stop the chain", err, order)
+	}
+}
+
+func TestWorkerDefersItemWhenProcessorFails(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	sink := &FakeSink{}
+	useSink(t, sink)
+	useItemProcessors(t, ItemProcessorFunc(func(context.Context, *Item) error { return errors.New("lookup failed") }))
+
+	item := Item{ID: "sku-1", Title: "Product", Price: 100}
+	if err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), item); !errors.Is(err, errDeferred) {
+		t.Fatalf("worker() = %v, want errDeferred", err)
+	}
+	if calls := sink.Calls(); len(calls) != 0 {
+		t.Errorf("sink calls = %v, want nothing uploaded", calls)
+	}
+	if !deadLetters.Has(cfg.FeedID, item.ID) {
+		t.Error("item was not deferred to the dead-letter queue")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// currentRunID identifies the run in product_history; runSync sets it from the
+// run marker, and it is empty in a dry run.
+var currentRunID string
+
+// historyEntry is one row of the product_history audit table. OldStatus is
+// empty, and OldPrice zero, when the product was first stored.
+type historyEntry struct {
+	FeedID     string
+	UniqueCode string
+	OldStatus  string
+	NewStatus  string
+	OldPrice   Money
+	NewPrice   Money
+	ChangedAt  time.Time
+	RunID      string
+}
+
+// migrateProductHistory creates the product_history table. Prices are stored
+// in cents, like products.price_cents. Rows recorded before feed IDs existed
+// belong to the default feed.
+func migrateProductHistory(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS product_history (
+		feed_id TEXT NOT NULL DEFAULT '',
+		unique_code TEXT NOT NULL,
+		old_status TEXT NOT NULL,
+		new_status TEXT NOT NULL,
+		old_price INTEGER NOT NULL,
+		new_price INTEGER NOT NULL,
+		changed_at TEXT NOT NULL,
+		run_id TEXT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create product_history: %v", err)
+	}
+	if err := addColumnIfMissing(db, "product_history", "feed_id", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	_, err = db.Exec(`DROP INDEX IF EXISTS product_history_unique_code`)
+	if err != nil {
+		return fmt.Errorf("failed to drop the product_history unique_code index: %v", err)
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS product_history_feed_id_unique_code ON product_history (feed_id, unique_code, changed_at)`)
+	if err != nil {
+		return fmt.Errorf("failed to index product_history: %v", err)
+	}
+	return nil
+}
+
+// recordHistory appends a row to product_history when the sync moved
+// uniqueCode of feed feedID to a new status or price. exists and stored
+// describe the row before the change.
+func recordHistory(db *sql.DB, feedID, uniqueCode string, exists bool, stored storedProduct, status string, price Money) {
+	if exists && stored.Status == status && stored.Price == price {
+		return
+	}
+	entry := historyEntry{FeedID: feedID, UniqueCode: uniqueCode, NewStatus: status, NewPrice: price, ChangedAt: time.Now().UTC(), RunID: currentRunID}
+	if exists {
+		entry.OldStatus, entry.OldPrice = stored.Status, stored.Price
+	}
+	err := writeDB(db, `INSERT INTO product_history (feed_id, unique_code, old_status, new_status, old_price, new_price, changed_at, run_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.FeedID, entry.UniqueCode, entry.OldStatus, entry.NewStatus, entry.OldPrice, entry.NewPrice,
+		entry.ChangedAt.Format(time.RFC3339Nano), entry.RunID)
+	if err != nil {
+		warnf("Failed to record history for %s: %v", uniqueCode, err)
+	}
+}
+
+// QueryHistory returns the recorded status and price changes of uniqueCode of
+// feed feedID, oldest first.
+func QueryHistory(db *sql.DB, feedID, uniqueCode string) ([]historyEntry, error) {
+	rows, err := db.Query(`SELECT feed_id, unique_code, old_status, new_status, old_price, new_price, changed_at, run_id
+		FROM product_history WHERE feed_id = ? AND unique_code = ? ORDER BY changed_at, rowid`, feedID, uniqueCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history of %s: %v", uniqueCode, err)
+	}
+	defer rows.Close()
+
+	var history []historyEntry
+	for rows.Next() {
+		var entry historyEntry
+		var changedAt string
+		err := rows.Scan(&entry.FeedID, &entry.UniqueCode, &entry.OldStatus, &entry.NewStatus, &entry.OldPrice, &entry.NewPrice, &changedAt, &entry.RunID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history of %s: %v", uniqueCode, err)
+		}
+		entry.ChangedAt, _ = time.Parse(time.RFC3339Nano, changedAt)
+		history = append(history, entry)
+	}
+	return history, rows.Err()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestWorkerRecordsProductHistory(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	useSink(t, &FakeSink{})
+	currentRunID = "run-1"
+	sync := func(price Money) {
+		t.Helper()
+		if err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), Item{ID: "sku-1", Title: "Product", Price: price}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sync(1000)
+	sync(1000)
+	sync(1000)
+	currentRunID = "run-2"
+	sync(1250)
+
+	history, err := QueryHistory(db, "", "sku-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The third sync at the same price changes nothing and is not recorded.
+	if len(history) != 3 {
+		t.Fatalf("history = %+v, want the first store, the move to existing and the price change", history)
+	}
+	first, last := history[0], history[2]
+	if first.OldStatus != "" || first.OldPrice != 0 || first.NewStatus != "new" || first.NewPrice != 1000 || first.RunID != "run-1" {
+		t.Errorf("first entry = %+v", first)
+	}
+	if history[1].OldStatus != "new" || history[1].NewStatus != "existing" {
+		t.Errorf("second entry = %+v", history[1])
+	}
+	if last.OldStatus != "existing" || last.OldPrice != 1000 || last.NewPrice != 1250 || last.RunID != "run-2" {
+		t.Errorf("last entry = %+v", last)
+	}
+	if last.ChangedAt.Before(first.ChangedAt) {
+		t.Errorf("entries out of order: %s before %s", last.ChangedAt, first.ChangedAt)
+	}
+}
+
+// historyRows returns how many product_history and price_history rows are
+// stored.
+func historyRows(t *testing.T, db *sql.DB) (products, prices int) {
+	t.Helper()
+	if err := db.QueryRow(`SELECT (SELECT COUNT(*) FROM product_history), (SELECT COUNT(*) FROM price_history)`).Scan(&products, &prices); err != nil {
+		t.Fatal(err)
+	}
+	return products, prices
+}
+
+func TestWorkerRecordsNoHistoryForUnfinishedSync(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		setup func(t *testing.T, db *sql.DB, cfg *Config)
+	}{
+		{"failed status update", func(t *testing.T, db *sql.DB, cfg *Config) {
+			useSink(t, &FakeSink{})
+			if _, err := db.Exec(`CREATE TRIGGER reject_updates BEFORE UPDATE ON products BEGIN SELECT RAISE(ABORT, 'disk I/O error'); END`); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"failed upload", func(t *testing.T, db *sql.DB, cfg *Config) {
+			useSink(t, errSink{err: errors.New("connection refused")})
+		}},
+		{"deferred upload", func(t *testing.T, db *sql.DB, cfg *Config) {
+			useSink(t, &FakeSink{})
+			cfg.MinContentLength = 100000
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			cfg := newTestConfig(t)
+			storeProduct(t, db, Product{UniqueCode: "sku-1", Price: 1000, Status: "existing", DocumentID: "doc-1"})
+			tt.setup(t, db, cfg)
+
+			err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), Item{ID: "sku-1", Title: "Product", Price: 1500})
+			if err == nil {
+				t.Fatal("worker() = nil, want the sync to be cut short")
+			}
+			if products, prices := historyRows(t, db); products != 0 || prices != 0 {
+				t.Errorf("recorded %d history and %d price change rows, want none", products, prices)
+			}
+		})
+	}
+}
+
+func TestRecordHistorySkipsUnchangedProduct(t *testing.T) {
+	db := newTestDB(t)
+	stored := storedProduct{Price: 500, Status: "existing"}
+	recordHistory(db, "", "sku-1", true, stored, "existing", 500)
+	recordHistory(db, "", "sku-1", true, stored, "deleted", 500)
+
+	history, err := QueryHistory(db, "", "sku-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].OldStatus != "existing" || history[0].NewStatus != "deleted" {
+		t.Errorf("history = %+v, want only the status change", history)
+	}
+}
+
+func TestQueryHistoryIsScopedByFeedID(t *testing.T) {
+	db := newTestDB(t)
+	recordHistory(db, "shop-a", "sku-1", false, storedProduct{}, "new", 100)
+	recordHistory(db, "shop-b", "sku-1", false, storedProduct{}, "new", 900)
+
+	for feedID, want := range map[string]Money{"shop-a": 100, "shop-b": 900} {
+		history, err := QueryHistory(db, feedID, "sku-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 1 || history[0].FeedID != feedID || history[0].NewPrice != want {
+			t.Errorf("history of %s = %+v, want only its own entry at %s", feedID, history, want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// pruneRemoteDocuments deletes remote documents that no local product accounts
+// for. A remote document is tracked when its ID is stored as a product's
+// document_id, or when its ID or name, with or without the ".txt" extension,
+// matches a product's unique code. In dry-run mode the
+// orphans are only reported; otherwise the user must confirm unless
+// cfg.AssumeYes is set.
+func pruneRemoteDocuments(ctx context.Context, db *sql.DB, cfg *Config) error {
+	codes, err := loadUniqueCodes(db)
+	if err != nil {
+		return fmt.Errorf("failed to load local products: %v", err)
+	}
+
+	documentIDs, err := loadDocumentIDs(db)
+	if err != nil {
+		return fmt.Errorf("failed to load local document IDs: %v", err)
+	}
+
+	documents, err := listDocuments(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	tracked := make(map[string]bool, len(codes)*3+len(documentIDs))
+	for _, code := range codes {
+		tracked[code] = true
+		tracked[documentFileName(code)] = true
+		tracked[documentName(documentNameTemplate, code)] = true
+	}
+	for _, id := range documentIDs {
+		tracked[id] = true
+	}
+
+	var orphans []remoteDocument
+	for _, doc := range documents {
+		if !tracked[doc.ID] && !tracked[doc.Name] {
+			orphans = append(orphans, doc)
+		}
+	}
+
+	if len(orphans) == 0 {
+		summaryf("No orphaned remote documents among %d listed\n", len(documents))
+		return nil
+	}
+
+	for _, doc := range orphans {
+		fmt.Printf("Orphaned remote document %s (%s)\n", doc.ID, doc.Name)
+	}
+	if cfg.DryRun {
+		summaryf("Dry run: would delete %d of %d remote documents\n", len(orphans), len(documents))
+		return nil
+	}
+	if !cfg.AssumeYes && !confirm(fmt.Sprintf("Delete %d orphaned remote documents?", len(orphans))) {
+		fmt.Println("Prune cancelled")
+		return nil
+	}
+
+	deleted := 0
+	for _, doc := range orphans {
+		if err := documentSink.Delete(ctx, doc.ID); err != nil {
+			warnf("Failed to delete orphaned document %s: %v", doc.ID, err)
+			continue
+		}
+		deleted++
+	}
+	summaryf("Pruned %d of %d orphaned remote documents\n", deleted, len(orphans))
+	return nil
+}
+
+// loadUniqueCodes returns the unique code of every product in the database.
+func loadUniqueCodes(db *sql.DB) ([]string, error) {
+	return loadColumn(db, `SELECT unique_code FROM products`)
+}
+
+// loadDocumentIDs returns every stored remote document ID.
+func loadDocumentIDs(db *sql.DB) ([]string, error) {
+	return loadColumn(db, `SELECT document_id FROM products WHERE document_id != ''`)
+}
+
+// loadColumn returns the single text column selected by query.
+func loadColumn(db *sql.DB, query string) ([]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// confirm asks a yes/no question on stdin and defaults to no.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
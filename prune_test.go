@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestPruneRemoteDocumentsTracksStoredIDs(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	cfg.AssumeYes = true
+	storeProduct(t, db, Product{UniqueCode: "sku-1", Status: "existing"})
+	if err := setDocumentID(db, "", "sku-1", "doc-renamed"); err != nil {
+		t.Fatal(err)
+	}
+	newListingAPI(t, cfg,
+		remoteDocument{ID: "doc-renamed", Name: "Renamed in the dashboard"},
+		remoteDocument{ID: "doc-orphan", Name: "Prod_sku-9.txt"},
+	)
+	sink := &FakeSink{}
+	useSink(t, sink)
+
+	cfg.DryRun = true
+	if err := pruneRemoteDocuments(context.Background(), db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if calls := sink.Calls(); len(calls) != 0 {
+		t.Fatalf("dry run made sink calls %+v", calls)
+	}
+
+	cfg.DryRun = false
+	if err := pruneRemoteDocuments(context.Background(), db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := []SinkCall{{Method: "Delete", DocumentID: "doc-orphan"}}
+	if calls := sink.Calls(); !reflect.DeepEqual(calls, want) {
+		t.Errorf("sink calls = %+v, want only the orphan deleted", calls)
+	}
+}
+
+func TestStoredDocumentID(t *testing.T) {
+	db := newTestDB(t)
+	storeProduct(t, db, Product{UniqueCode: "sku-1", Status: "existing"})
+	if id, err := storedDocumentID(db, "", "sku-1"); err != nil || id != "" {
+		t.Fatalf("storedDocumentID() before an upload = %q, %v; want empty", id, err)
+	}
+	if err := setDocumentID(db, "", "sku-1", "doc-1"); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := storedDocumentID(db, "", "sku-1"); err != nil || id != "doc-1" {
+		t.Errorf("storedDocumentID() = %q, %v; want doc-1", id, err)
+	}
+	if id, err := storedDocumentID(db, "", "missing"); err != nil || id != "" {
+		t.Errorf("storedDocumentID(missing) = %q, %v; want empty", id, err)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/time/rate"
+)
+
+// uploadRateLimiter paces uploads and deletes across all workers; main sets
+// its rate from -rate-limit. Callers wait for a token rather than fail.
+var uploadRateLimiter = rate.NewLimiter(rate.Inf, 1)
+
+// configureRateLimit applies -rate-limit, in requests per second; 0 leaves
+// uploads and deletes unpaced.
+func configureRateLimit(cfg *Config) error {
+	if cfg.RateLimit < 0 {
+		return fmt.Errorf("-rate-limit must not be negative, got %v", cfg.RateLimit)
+	}
+	if cfg.RateLimit > 0 {
+		uploadRateLimiter.SetLimit(rate.Limit(cfg.RateLimit))
+	}
+	return nil
+}
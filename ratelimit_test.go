@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// useRateLimit restores the upload rate limiter when the test ends.
+func useRateLimit(t *testing.T) {
+	t.Helper()
+	limit, burst := uploadRateLimiter.Limit(), uploadRateLimiter.Burst()
+	t.Cleanup(func() {
+		uploadRateLimiter.SetLimit(limit)
+		uploadRateLimiter.SetBurst(burst)
+	})
+}
+
+func TestConfigureRateLimit(t *testing.T) {
+	cfg := newTestConfig(t)
+	useRateLimit(t)
+
+	if err := configureRateLimit(cfg); err != nil || uploadRateLimiter.Limit() != rate.Inf {
+		t.Errorf("-rate-limit 0: limit %v, err %v, want unpaced", uploadRateLimiter.Limit(), err)
+	}
+	cfg.RateLimit = -1
+	if err := configureRateLimit(cfg); err == nil {
+		t.Error("negative -rate-limit accepted")
+	}
+	cfg.RateLimit = 2.5
+	if err := configureRateLimit(cfg); err != nil || uploadRateLimiter.Limit() != 2.5 {
+		t.Errorf("-rate-limit 2.5: limit %v, err %v", uploadRateLimiter.Limit(), err)
+	}
+}
+
+func TestRateLimitPacesDeletes(t *testing.T) {
+	cfg := newTestConfig(t)
+	useRateLimit(t)
+	api := newTestAPI(t, cfg)
+	cfg.RateLimit = 20
+	if err := configureRateLimit(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := deleteFile(context.Background(), cfg, "doc-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// One token is available up front; the other four arrive 50ms apart.
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("5 deletes at 20/s took %s, want at least 150ms", elapsed)
+	}
+	if n := api.count("DELETE", "/documents/doc-1"); n != 5 {
+		t.Errorf("sent %d deletes, want 5", n)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReconcileMode orders the removal of products that fell out of the feed
+// relative to the upload pass. Deletes run on their own pool, sized by
+// -delete-concurrency, but share the API circuit breaker with uploads.
+type ReconcileMode string
+
+const (
+	ReconcileOff         ReconcileMode = "off"
+	ReconcileBefore      ReconcileMode = "before"
+	ReconcileAfter       ReconcileMode = "after"
+	ReconcileInterleaved ReconcileMode = "interleaved"
+)
+
+// String implements flag.Value.
+func (m *ReconcileMode) String() string {
+	return string(*m)
+}
+
+// Set implements flag.Value.
+func (m *ReconcileMode) Set(value string) error {
+	switch ReconcileMode(value) {
+	case ReconcileOff, ReconcileBefore, ReconcileAfter, ReconcileInterleaved:
+		*m = ReconcileMode(value)
+		return nil
+	}
+	return fmt.Errorf("invalid reconcile mode %q: expected %s, %s, %s or %s",
+		value, ReconcileOff, ReconcileBefore, ReconcileAfter, ReconcileInterleaved)
+}
+
+// feedIDs returns the unique codes of the in-scope feed items.
+func feedIDs(cfg *Config, items []Item) *idSet {
+	ids := newIDSet()
+	for _, item := range items {
+		if cfg.Scope.Matches(item) {
+			ids.Add(item.ID)
+		}
+	}
+	return ids
+}
+
+// addMalformedIDs adds to ids the ID of every malformed feed item that has
+// one. Such an item is still in the feed, so its product is left as it is
+// rather than treated as removed.
+func addMalformedIDs(ids *idSet, malformed []ItemError) {
+	for _, itemErr := range malformed {
+		if itemErr.ID != "" {
+			ids.Add(itemErr.ID)
+		}
+	}
+}
+
+// staleProducts returns the unique codes stored for the run's scope and feed
+// that are not in seen.
+func staleProducts(db *sql.DB, cfg *Config, seen *idSet) ([]string, error) {
+	filter, args := partitionFilter(cfg.Scope, cfg.FeedID)
+	rows, err := db.Query(`SELECT unique_code FROM products WHERE `+filter, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stored products: %v", err)
+	}
+	defer rows.Close()
+
+	var stale []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		if !seen.Has(code) {
+			stale = append(stale, code)
+		}
+	}
+	return stale, rows.Err()
+}
+
+// markUnseenAsDeleted sets the status of every product in the run's scope and
+// feed that the run did not see to "deleted".
+func markUnseenAsDeleted(db *sql.DB, cfg *Config, seen *idSet) (int, error) {
+	unseen, err := staleProducts(db, cfg, seen)
+	if err != nil {
+		return 0, err
+	}
+	for _, code := range unseen {
+		if cfg.DryRun {
+			infof("Dry run: would mark %s as deleted", code)
+			continue
+		}
+		if err := writerFor(db).MarkDeleted(code, cfg.FeedID); err != nil {
+			return 0, fmt.Errorf("failed to mark %s as deleted: %v", code, err)
+		}
+	}
+	return len(unseen), nil
+}
+
+// reconcileProduct deletes the remote document of a product that is no longer
+// in the feed and then drops its row.
+func reconcileProduct(ctx context.Context, db *sql.DB, cfg *Config, stats *SyncStats, uniqueCode string) {
+	if cfg.DryRun {
+		infof("Dry run: would delete stale product %s", uniqueCode)
+		stats.add(&stats.Deleted)
+		return
+	}
+
+	documentID, err := storedDocumentID(db, cfg.FeedID, uniqueCode)
+	if err != nil {
+		warnf("Failed to look up the document of stale product %s: %v", uniqueCode, err)
+		stats.add(&stats.DeleteFailures)
+		return
+	}
+	if err := deleteProductDocument(ctx, uniqueCode, documentID); err != nil {
+		warnf("Failed to delete document for stale product %s: %v", uniqueCode, err)
+		stats.add(&stats.DeleteFailures)
+		return
+	}
+	if err := deleteProduct(db, cfg.FeedID, uniqueCode); err != nil {
+		warnf("Failed to remove stale product %s: %v", uniqueCode, err)
+		stats.add(&stats.DeleteFailures)
+		return
+	}
+	stats.add(&stats.Deleted)
+	publishEvent(productEvent{Type: eventProductDeleted, ID: uniqueCode, Source: cfg.Source, OccurredAt: time.Now().UTC()})
+}
+
+// reconcileDeletions deletes the remote document of every product in the
+// run's scope and feed that is marked deleted, then tombstones the row by
+// clearing its document ID. The row is kept so a restocked product is
+// recognized; it is uploaded as a new document.
+func reconcileDeletions(ctx context.Context, db *sql.DB, cfg *Config, stats *SyncStats) error {
+	filter, args := partitionFilter(cfg.Scope, cfg.FeedID)
+	rows, err := db.Query(`SELECT unique_code, document_id FROM products
+		WHERE status = 'deleted' AND document_id != '' AND `+filter, args...)
+	if err != nil {
+		return fmt.Errorf("failed to list deleted products: %v", err)
+	}
+	removed := make(map[string]string)
+	for rows.Next() {
+		var code, documentID string
+		if err := rows.Scan(&code, &documentID); err != nil {
+			rows.Close()
+			return err
+		}
+		removed[code] = documentID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	before := atomic.LoadInt64(&stats.Deleted)
+	deletes := newDeletePool(cfg.DeleteConcurrency)
+	for code, documentID := range removed {
+		code, documentID := code, documentID
+		deletes.submit(func() {
+			if err := documentSink.Delete(ctx, documentID); err != nil {
+				warnf("Failed to delete document %s of removed product %s: %v", documentID, code, err)
+				stats.add(&stats.DeleteFailures)
+				return
+			}
+			if err := setDocumentID(db, cfg.FeedID, code, ""); err != nil {
+				warnf("Failed to clear the document ID of removed product %s: %v", code, err)
+				stats.add(&stats.DeleteFailures)
+				return
+			}
+			stats.add(&stats.Deleted)
+		})
+	}
+	deletes.wait()
+	if len(removed) > 0 {
+		summaryf("Deleted the remote documents of %d of %d products removed from the feed\n",
+			atomic.LoadInt64(&stats.Deleted)-before, len(removed))
+	}
+	return nil
+}
+
+// deletePool runs reconcile deletes on workers separate from the upload pool;
+// deletes are cheap, so they can run wider than uploads.
+type deletePool struct {
+	sem   chan struct{}
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	first time.Time
+	last  time.Time
+}
+
+func newDeletePool(concurrency int) *deletePool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &deletePool{sem: make(chan struct{}, concurrency)}
+}
+
+// submit runs task once a delete worker is free.
+func (p *deletePool) submit(task func()) {
+	p.sem <- struct{}{}
+	p.mu.Lock()
+	if p.first.IsZero() {
+		p.first = time.Now()
+	}
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer func() { <-p.sem }()
+		task()
+		p.mu.Lock()
+		p.last = time.Now()
+		p.mu.Unlock()
+	}()
+}
+
+// wait blocks until every submitted delete has finished.
+func (p *deletePool) wait() {
+	p.wg.Wait()
+}
+
+// elapsed is the time from the first submitted delete to the last finished one.
+func (p *deletePool) elapsed() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.last.Sub(p.first)
+}
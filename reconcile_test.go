@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReconcileModeSet(t *testing.T) {
+	var mode ReconcileMode
+	for _, value := range []string{"off", "before", "after", "interleaved"} {
+		if err := mode.Set(value); err != nil || string(mode) != value {
+			t.Errorf("Set(%q) = %v, mode %q", value, err, mode)
+		}
+	}
+	if err := mode.Set("sometimes"); err == nil {
+		t.Error("Set accepted an unknown mode")
+	}
+}
+
+func TestStaleProducts(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	cfg.FeedID = "warehouse"
+	storeProduct(t, db, Product{UniqueCode: "sku-1", Status: "existing", FeedID: "warehouse"})
+	storeProduct(t, db, Product{UniqueCode: "gone", Status: "existing", FeedID: "warehouse"})
+	storeProduct(t, db, Product{UniqueCode: "other", Status: "existing", FeedID: "outlet"})
+
+	stale, err := staleProducts(db, cfg, feedIDs(cfg, []Item{{ID: "sku-1"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 || stale[0] != "gone" {
+		t.Errorf("staleProducts() = %v, want only gone", stale)
+	}
+}
+
+func TestReconcileModesDeleteStaleProducts(t *testing.T) {
+	for _, mode := range []ReconcileMode{ReconcileBefore, ReconcileAfter, ReconcileInterleaved} {
+		t.Run(string(mode), func(t *testing.T) {
+			db := newTestDB(t)
+			cfg := newTestConfig(t)
+			cfg.ReconcileMode = mode
+			api := newTestAPI(t, cfg)
+			storeProduct(t, db, Product{UniqueCode: "gone", Status: "existing", DocumentID: "doc-gone"})
+
+			stats, err := processXMLData(context.Background(), db, cfg, nil, nil, "", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Deleted != 1 || stats.DeleteFailures != 0 {
+				t.Errorf("Deleted, DeleteFailures = %d, %d; want 1, 0", stats.Deleted, stats.DeleteFailures)
+			}
+			if n := api.count(http.MethodDelete, "/doc-gone"); n != 1 {
+				t.Errorf("got %d deletes of the stale document, want 1", n)
+			}
+			if _, ok := loadProduct(t, db, "gone"); ok {
+				t.Error("stale product row was kept")
+			}
+		})
+	}
+}
+
+func TestReconcileKeepsRowWhenDeleteFails(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	cfg.ReconcileMode = ReconcileAfter
+	api := newTestAPI(t, cfg)
+	apiBreaker = newCircuitBreaker(1, time.Hour)
+	apiBreaker.Record(false)
+	storeProduct(t, db, Product{UniqueCode: "gone", Status: "existing", DocumentID: "doc-gone"})
+
+	stats, err := processXMLData(context.Background(), db, cfg, nil, nil, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.DeleteFailures != 1 || api.count(http.MethodDelete, "/doc-gone") != 0 {
+		t.Errorf("DeleteFailures = %d, want 1 without reaching the open breaker's API", stats.DeleteFailures)
+	}
+	if _, ok := loadProduct(t, db, "gone"); !ok {
+		t.Error("row of a product whose delete failed was dropped")
+	}
+}
+
+// slowDeleteSink is a FakeSink whose deletes each take delay, recording how
+// many are in flight at once.
+type slowDeleteSink struct {
+	FakeSink
+	delay time.Duration
+
+	mu             sync.Mutex
+	inFlight, peak int
+}
+
+func (s *slowDeleteSink) Delete(ctx context.Context, documentID string) error {
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.peak {
+		s.peak = s.inFlight
+	}
+	s.mu.Unlock()
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	s.inFlight--
+	s.mu.Unlock()
+	return s.FakeSink.Delete(ctx, documentID)
+}
+
+func TestReconcileDeletionsRunsDeleteConcurrencyWide(t *testing.T) {
+	const deletes, workers, delay = 12, 4, 50 * time.Millisecond
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	cfg.DeleteConcurrency = workers
+	sink := &slowDeleteSink{delay: delay}
+	useSink(t, sink)
+	for i := 0; i < deletes; i++ {
+		storeProduct(t, db, Product{UniqueCode: fmt.Sprintf("sku-%d", i), Status: "deleted", DocumentID: fmt.Sprintf("doc-%d", i)})
+	}
+
+	stats := &SyncStats{}
+	start := time.Now()
+	if err := reconcileDeletions(context.Background(), db, cfg, stats); err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+	if stats.Deleted != deletes {
+		t.Errorf("Deleted = %d, want %d", stats.Deleted, deletes)
+	}
+	if sink.peak != workers {
+		t.Errorf("%d deletes in flight at once, want %d", sink.peak, workers)
+	}
+	// deletes/workers round trips, with headroom for the database writes but
+	// well short of one more round.
+	if rounds := time.Duration(deletes / workers); elapsed < rounds*delay || elapsed > (rounds+1)*delay {
+		t.Errorf("%d deletes %d wide took %s, want about %s", deletes, workers, elapsed, rounds*delay)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// reprocessColumn returns the products column -reprocess-status filters on:
+// upload_status for pending, uploaded and failed, status otherwise.
+func reprocessColumn(status string) string {
+	switch status {
+	case uploadPending, uploadUploaded, uploadFailed:
+		return "upload_status"
+	}
+	return "status"
+}
+
+// productsInStatus returns the document ID of each product in the run's scope
+// and feed whose status, or upload status, is status.
+func productsInStatus(db *sql.DB, cfg *Config, status string) (map[string]string, error) {
+	filter, args := partitionFilter(cfg.Scope, cfg.FeedID)
+	rows, err := db.Query(`SELECT unique_code, document_id FROM products WHERE `+reprocessColumn(status)+` = ? AND `+filter,
+		append([]interface{}{status}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s products: %v", status, err)
+	}
+	defer rows.Close()
+
+	products := make(map[string]string)
+	for rows.Next() {
+		var code, documentID string
+		if err := rows.Scan(&code, &documentID); err != nil {
+			return nil, fmt.Errorf("failed to read %s products: %v", status, err)
+		}
+		products[code] = documentID
+	}
+	return products, rows.Err()
+}
+
+// reprocessProducts re-renders and re-uploads the products selected by
+// -reprocess-status from the feed saved by the last sync, without
+// downloading the feed again. Stored documents are updated in place, and
+// other products are left alone.
+func reprocessProducts(ctx context.Context, db *sql.DB, cfg *Config) error {
+	selected, err := productsInStatus(db, cfg, cfg.ReprocessStatus)
+	if err != nil {
+		return err
+	}
+	if len(selected) == 0 {
+		summaryf("No products with status %s to reprocess.\n", cfg.ReprocessStatus)
+		return nil
+	}
+
+	if _, err := os.Stat(cfg.OutputPath); err != nil {
+		return fmt.Errorf("no saved feed to reprocess from; run a sync first: %v", err)
+	}
+	items, malformed, err := loadFeedItems(cfg, cfg.OutputPath)
+	if err != nil {
+		return err
+	}
+	reportMalformedItems(malformed)
+
+	var reprocess []Item
+	queued := make(map[string]bool)
+	for _, item := range items {
+		if _, ok := selected[item.ID]; ok && cfg.Scope.Matches(item) {
+			reprocess = append(reprocess, item)
+			queued[item.ID] = true
+		}
+	}
+	for code := range selected {
+		if !queued[code] {
+			warnf("Product %s is not in the saved feed; skipping", code)
+		}
+	}
+
+	stats := &SyncStats{}
+	var uploaded, deferred, failed int64
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, cfg.Workers)
+	for _, item := range reprocess {
+		item := item
+		if ctx.Err() != nil {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := uploadItem(ctx, db, cfg, stats, item, nil, selected[item.ID])
+			switch {
+			case err == nil:
+				atomic.AddInt64(&uploaded, 1)
+			case errors.Is(err, errDeferred):
+				atomic.AddInt64(&deferred, 1)
+			default:
+				atomic.AddInt64(&failed, 1)
+				warnf("Reprocessing %s failed: %v", item.ID, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	summaryf("Reprocessed %d products with status %s: %d uploaded, %d deferred, %d failed\n",
+		len(reprocess), cfg.ReprocessStatus, uploaded, deferred, failed)
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReprocessColumn(t *testing.T) {
+	for status, want := range map[string]string{uploadFailed: "upload_status", uploadPending: "upload_status", "updated": "status", "deleted": "status"} {
+		if got := reprocessColumn(status); got != want {
+			t.Errorf("reprocessColumn(%s) = %s, want %s", status, got, want)
+		}
+	}
+}
+
+func TestReprocessProductsUpdatesSelectedDocuments(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	sink := &FakeSink{}
+	useSink(t, sink)
+	var documentIDs []string
+	for _, code := range []string{"sku-1", "sku-2"} {
+		id, err := sink.Upload(context.Background(), writeDocument(t, code+".txt", "old "+code))
+		if err != nil {
+			t.Fatal(err)
+		}
+		documentIDs = append(documentIDs, id)
+	}
+	storeProduct(t, db, Product{UniqueCode: "sku-1", Price: 1000, Status: "updated", DocumentID: documentIDs[0]})
+	storeProduct(t, db, Product{UniqueCode: "sku-2", Price: 500, Status: "new", DocumentID: documentIDs[1]})
+	storeProduct(t, db, Product{UniqueCode: "sku-3", Price: 700, Status: "updated"})
+	cfg.OutputPath = writeTestFeed(t, feedItem("sku-1", "10.00"), feedItem("sku-2", "5.00"))
+	cfg.ReprocessStatus = "updated"
+
+	if err := reprocessProducts(context.Background(), db, cfg); err != nil {
+		t.Fatal(err)
+	}
+	var updates []string
+	for _, call := range sink.Calls()[2:] {
+		updates = append(updates, call.Method+" "+call.DocumentID)
+	}
+	if len(updates) != 1 || updates[0] != "Update "+documentIDs[0] {
+		t.Errorf("calls = %v, want only sku-1's document updated", updates)
+	}
+	if doc := string(sink.Documents()[documentIDs[0]]); !strings.Contains(doc, "[ID] sku-1") {
+		t.Errorf("sku-1's document = %q, want it re-rendered", doc)
+	}
+}
+
+func TestReprocessProductsNeedsSavedFeed(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	useSink(t, &FakeSink{})
+	storeProduct(t, db, Product{UniqueCode: "sku-1", Price: 1000, Status: "updated"})
+	cfg.OutputPath = filepath.Join(t.TempDir(), "feed.xml")
+	cfg.ReprocessStatus = "updated"
+
+	if err := reprocessProducts(context.Background(), db, cfg); err == nil || !strings.Contains(err.Error(), "no saved feed") {
+		t.Errorf("reprocessProducts() = %v, want an error about the missing feed", err)
+	}
+	cfg.ReprocessStatus = "restocked"
+	if err := reprocessProducts(context.Background(), db, cfg); err != nil {
+		t.Errorf("reprocessProducts() with nothing selected = %v", err)
+	}
+}
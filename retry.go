@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// RetryPolicy bounds how often and for how long an operation is retried.
+// The delay before retry n (0-based) is (n+1)*BaseDelay, capped at MaxDelay.
+// Retries also stop once the cumulative wait would exceed MaxTotalWait,
+// regardless of how many attempts remain. Zero caps mean unbounded.
+type RetryPolicy struct {
+	MaxRetries   int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	MaxTotalWait time.Duration
+}
+
+// dbRetryPolicy is used by execWithRetry for SQLITE_BUSY/SQLITE_LOCKED.
+var dbRetryPolicy = RetryPolicy{
+	MaxRetries:   maxRetries,
+	BaseDelay:    100 * time.Millisecond,
+	MaxDelay:     time.Second,
+	MaxTotalWait: 5 * time.Second,
+}
+
+// delay returns the wait before retry attempt n.
+func (p RetryPolicy) delay(n int) time.Duration {
+	d := time.Duration(n+1) * p.BaseDelay
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// Do runs op until it succeeds, reports a non-retryable error, or the policy
+// is exhausted. op returns whether its error is worth retrying.
+func (p RetryPolicy) Do(op func() (retryable bool, err error)) error {
+	var (
+		err    error
+		waited time.Duration
+	)
+	for i := 0; i < p.MaxRetries; i++ {
+		var retryable bool
+		retryable, err = op()
+		if err == nil {
+			return nil
+		}
+		if !retryable {
+			return err
+		}
+		if i == p.MaxRetries-1 {
+			break
+		}
+
+		d := p.delay(i)
+		if p.MaxTotalWait > 0 {
+			remaining := p.MaxTotalWait - waited
+			if remaining <= 0 {
+				return fmt.Errorf("gave up after waiting %v over %d attempts: %w", waited, i+1, err)
+			}
+			if d > remaining {
+				d = remaining
+			}
+		}
+		time.Sleep(d)
+		waited += d
+	}
+	return fmt.Errorf("failed after %d retries: %w", p.MaxRetries, err)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: 250 * time.Millisecond}
+	for n, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 250 * time.Millisecond, 250 * time.Millisecond} {
+		if got := p.delay(n); got != want {
+			t.Errorf("delay(%d) = %v, want %v", n, got, want)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	errBusy := errors.New("database is locked")
+	tests := []struct {
+		name      string
+		policy    RetryPolicy
+		failures  int
+		retryable bool
+		wantCalls int
+		wantErr   string
+	}{
+		{name: "succeeds after retries", policy: RetryPolicy{MaxRetries: 5, BaseDelay: time.Millisecond}, failures: 2, retryable: true, wantCalls: 3},
+		{name: "not retryable", policy: RetryPolicy{MaxRetries: 5, BaseDelay: time.Millisecond}, failures: 5, wantCalls: 1, wantErr: "database is locked"},
+		{name: "attempts exhausted", policy: RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond}, failures: 5, retryable: true, wantCalls: 3, wantErr: "failed after 3 retries"},
+		{name: "total wait exhausted", policy: RetryPolicy{MaxRetries: 10, BaseDelay: 10 * time.Millisecond, MaxTotalWait: 25 * time.Millisecond}, failures: 10, retryable: true, wantCalls: 3, wantErr: "gave up after waiting 25ms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := tt.policy.Do(func() (bool, error) {
+				calls++
+				if calls <= tt.failures {
+					return tt.retryable, errBusy
+				}
+				return false, nil
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("op ran %d times, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Do() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !errors.Is(err, errBusy) {
+				t.Errorf("Do() = %v, want %q wrapping the last error", err, tt.wantErr)
+			}
+		})
+	}
+}
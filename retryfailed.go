@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// failedUploads returns the document ID of each product in the run's scope and
+// feed whose last upload failed; it is "" when no document was created.
+func failedUploads(db *sql.DB, scope Scope, feedID string) (map[string]string, error) {
+	filter, args := partitionFilter(scope, feedID)
+	rows, err := db.Query(`SELECT unique_code, document_id FROM products WHERE upload_status = ? AND `+filter,
+		append([]interface{}{uploadFailed}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query failed uploads: %v", err)
+	}
+	defer rows.Close()
+
+	codes := make(map[string]string)
+	for rows.Next() {
+		var code, documentID string
+		if err := rows.Scan(&code, &documentID); err != nil {
+			return nil, fmt.Errorf("failed to read failed uploads: %v", err)
+		}
+		codes[code] = documentID
+	}
+	return codes, rows.Err()
+}
+
+// retryFailedUploads re-uploads the feed items whose products are marked as
+// failed together with everything in the dead-letter queue. Products that are
+// not in either set are not touched. A product that still has a document,
+// e.g. after a failed in-place update, gets that document updated rather than
+// a second one created.
+func retryFailedUploads(ctx context.Context, db *sql.DB, cfg *Config, xmlPath string) error {
+	failed, err := failedUploads(db, cfg.Scope, cfg.FeedID)
+	if err != nil {
+		return err
+	}
+
+	items, malformed, err := loadFeedItems(cfg, xmlPath)
+	if err != nil {
+		return err
+	}
+	reportMalformedItems(malformed)
+
+	var retry []Item
+	queued := make(map[string]bool)
+	documentIDs := make(map[string]string)
+	for _, item := range items {
+		if documentID, ok := failed[item.ID]; ok && cfg.Scope.Matches(item) {
+			retry = append(retry, item)
+			queued[item.ID] = true
+			documentIDs[item.ID] = documentID
+		}
+	}
+	for code := range failed {
+		if !queued[code] {
+			warnf("Failed product %s is no longer in the feed; skipping", code)
+		}
+	}
+	for _, item := range deadLetters.Items(cfg.FeedID) {
+		if !queued[item.ID] && cfg.Scope.Matches(item) {
+			documentID, err := storedDocumentID(db, cfg.FeedID, item.ID)
+			if err != nil {
+				return fmt.Errorf("failed to look up the document of %s: %v", item.ID, err)
+			}
+			retry = append(retry, item)
+			queued[item.ID] = true
+			documentIDs[item.ID] = documentID
+		}
+	}
+
+	stats := &SyncStats{}
+	var recovered, deferred, stillFailing int64
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, cfg.Workers)
+	for _, item := range retry {
+		item := item
+		if ctx.Err() != nil {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := uploadItem(ctx, db, cfg, stats, item, nil, documentIDs[item.ID])
+			switch {
+			case err == nil:
+				atomic.AddInt64(&recovered, 1)
+			case errors.Is(err, errDeferred):
+				atomic.AddInt64(&deferred, 1)
+			default:
+				atomic.AddInt64(&stillFailing, 1)
+				warnf("Retry of %s failed: %v", item.ID, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	summaryf("Retried %d products: %d recovered, %d deferred, %d still failing\n",
+		len(retry), recovered, deferred, stillFailing)
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestRetryFailedUploadsUpdatesStoredDocument(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	sink := &FakeSink{}
+	useSink(t, sink)
+
+	file := writeTestFeed(t, feedItem("sku-1", "10.00"), feedItem("sku-2", "20.00"))
+	placeholder := file + ".txt"
+	if err := os.WriteFile(placeholder, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	documentID, err := sink.Upload(context.Background(), placeholder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storeProduct(t, db, Product{UniqueCode: "sku-1", Price: 1000, Status: "restocked", DocumentID: documentID})
+	storeProduct(t, db, Product{UniqueCode: "sku-2", Price: 2000, Status: "new"})
+	for _, code := range []string{"sku-1", "sku-2"} {
+		if err := setUploadStatus(db, cfg.FeedID, code, uploadFailed); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := retryFailedUploads(context.Background(), db, cfg, file); err != nil {
+		t.Fatal(err)
+	}
+
+	methods := make(map[string]string)
+	for _, call := range sink.Calls()[1:] {
+		methods[call.Method] += call.DocumentID + " "
+	}
+	if methods["Update"] != documentID+" " {
+		t.Errorf("updated %q, want only the stored document %s", methods["Update"], documentID)
+	}
+	if len(sink.Documents()) != 2 {
+		t.Errorf("dataset holds %d documents, want 2: no duplicate of %s", len(sink.Documents()), documentID)
+	}
+	for _, code := range []string{"sku-1", "sku-2"} {
+		var status string
+		if err := db.QueryRow(`SELECT upload_status FROM products WHERE unique_code = ?`, code).Scan(&status); err != nil {
+			t.Fatal(err)
+		}
+		if status != uploadUploaded {
+			t.Errorf("upload_status of %s = %q, want %q", code, status, uploadUploaded)
+		}
+	}
+}
+
+func TestWorkerRetriesDeadLetterInPlace(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	sink := &FakeSink{}
+	useSink(t, sink)
+
+	item := Item{ID: "sku-1", Title: "Product", Price: 1000}
+	if err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), item); err != nil {
+		t.Fatal(err)
+	}
+	deadLetters.Add(cfg.FeedID, item, "scrape timed out")
+	if err := worker(context.Background(), db, cfg, &SyncStats{}, newIDSet(), item); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := sink.Calls()
+	if len(calls) != 2 || calls[1].Method != "Update" {
+		t.Errorf("sink calls = %v, want the dead letter to update the stored document", calls)
+	}
+	if deadLetters.Has(cfg.FeedID, item.ID) {
+		t.Error("dead letter still queued after the retry")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// runMarkerKeyPrefix is followed by the dataset GUID, so runs against
+// different datasets may share a database.
+const runMarkerKeyPrefix = "run_in_progress:"
+
+// runMarker is stored in sync_meta while a run is in progress. Heartbeat is
+// refreshed while the run is alive; a marker whose heartbeat is older than the
+// staleness limit is left over from a crashed run and may be taken over.
+type runMarker struct {
+	RunID     string    `json:"run_id"`
+	PID       int       `json:"pid"`
+	Hostname  string    `json:"hostname"`
+	StartedAt time.Time `json:"started_at"`
+	Heartbeat int64     `json:"heartbeat"`
+}
+
+// runLock is a held run marker.
+type runLock struct {
+	db     *sql.DB
+	key    string
+	marker runMarker
+	stop   chan struct{}
+	done   sync.WaitGroup
+}
+
+// acquireRunLock records a run marker for datasetGUID, refusing when another
+// run's marker has a heartbeat newer than staleAfter. The check and the write
+// are one statement, so two runs racing for the marker cannot both win.
+func acquireRunLock(db *sql.DB, datasetGUID string, staleAfter time.Duration) (*runLock, error) {
+	hostname, _ := os.Hostname()
+	now := time.Now()
+	lock := &runLock{
+		db:     db,
+		key:    runMarkerKeyPrefix + datasetGUID,
+		marker: runMarker{RunID: newRunID(), PID: os.Getpid(), Hostname: hostname, StartedAt: now.UTC(), Heartbeat: now.Unix()},
+		stop:   make(chan struct{}),
+	}
+	value, err := json.Marshal(lock.marker)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := writerFor(db).Exec(`INSERT INTO sync_meta (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value
+		WHERE json_extract(sync_meta.value, '$.heartbeat') < ?`,
+		lock.key, string(value), now.Add(-staleAfter).Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to record run marker: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, runInProgressError(db, lock.key)
+	}
+
+	interval := staleAfter / 3
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	lock.done.Add(1)
+	go lock.heartbeat(interval)
+	return lock, nil
+}
+
+// runInProgressError describes the live run holding key.
+func runInProgressError(db *sql.DB, key string) error {
+	value, _, err := getMeta(db, key)
+	if err != nil {
+		return fmt.Errorf("another run is in progress: %v", err)
+	}
+	var other runMarker
+	if err := json.Unmarshal([]byte(value), &other); err != nil {
+		return fmt.Errorf("another run is in progress (unreadable marker %q)", value)
+	}
+	return fmt.Errorf("another run is in progress: run %s, pid %d on %s, started %s, last seen %s",
+		other.RunID, other.PID, other.Hostname, other.StartedAt.Format(time.RFC3339),
+		time.Unix(other.Heartbeat, 0).UTC().Format(time.RFC3339))
+}
+
+// heartbeat refreshes the marker until Release.
+func (l *runLock) heartbeat(interval time.Duration) {
+	defer l.done.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case now := <-ticker.C:
+			err := writeDB(l.db, `UPDATE sync_meta SET value = json_set(value, '$.heartbeat', ?)
+				WHERE key = ? AND json_extract(value, '$.run_id') = ?`, now.Unix(), l.key, l.marker.RunID)
+			if err != nil {
+				warnf("Failed to refresh run marker: %v", err)
+			}
+		}
+	}
+}
+
+// Release stops the heartbeat and removes the marker if it is still ours.
+func (l *runLock) Release() error {
+	close(l.stop)
+	l.done.Wait()
+
+	err := writeDB(l.db, `DELETE FROM sync_meta WHERE key = ? AND json_extract(value, '$.run_id') = ?`, l.key, l.marker.RunID)
+	if err != nil {
+		return fmt.Errorf("failed to clear run marker: %v", err)
+	}
+	return nil
+}
+
+// newRunID returns a random identifier for this run.
+func newRunID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquireRunLockRefusesLiveRun(t *testing.T) {
+	db := newTestDB(t)
+	first, err := acquireRunLock(db, "dataset-a", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = acquireRunLock(db, "dataset-a", time.Hour)
+	if err == nil || !strings.Contains(err.Error(), first.marker.RunID) {
+		t.Fatalf("second acquireRunLock() = %v, want an error naming run %s", err, first.marker.RunID)
+	}
+	other, err := acquireRunLock(db, "dataset-b", time.Hour)
+	if err != nil {
+		t.Fatalf("a run against another dataset was refused: %v", err)
+	}
+	other.Release()
+
+	if err := first.Release(); err != nil {
+		t.Fatal(err)
+	}
+	again, err := acquireRunLock(db, "dataset-a", time.Hour)
+	if err != nil {
+		t.Fatalf("acquireRunLock() after Release = %v", err)
+	}
+	again.Release()
+}
+
+func TestAcquireRunLockTakesOverStaleMarker(t *testing.T) {
+	db := newTestDB(t)
+	crashed := runMarker{RunID: "crashed", PID: 1, Hostname: "old-host", StartedAt: time.Now().Add(-2 * time.Hour), Heartbeat: time.Now().Add(-time.Hour).Unix()}
+	value, _ := json.Marshal(crashed)
+	if err := setMeta(db, runMarkerKeyPrefix+"dataset-a", string(value)); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := acquireRunLock(db, "dataset-a", 10*time.Minute)
+	if err != nil {
+		t.Fatalf("stale marker was not taken over: %v", err)
+	}
+	defer lock.Release()
+	if stored, _, _ := getMeta(db, runMarkerKeyPrefix+"dataset-a"); !strings.Contains(stored, lock.marker.RunID) {
+		t.Errorf("marker = %s, want this run's", stored)
+	}
+}
+
+func TestRunLockHeartbeat(t *testing.T) {
+	db := newTestDB(t)
+	lock, err := acquireRunLock(db, "dataset-a", 30*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := lock.marker.Heartbeat
+	// The marker stays live past the staleness limit while the heartbeat runs.
+	time.Sleep(1100 * time.Millisecond)
+	if _, err := acquireRunLock(db, "dataset-a", 2*time.Second); err == nil {
+		t.Error("a second run took over a marker with a live heartbeat")
+	}
+	var marker runMarker
+	stored, _, _ := getMeta(db, runMarkerKeyPrefix+"dataset-a")
+	if err := json.Unmarshal([]byte(stored), &marker); err != nil {
+		t.Fatal(err)
+	}
+	if marker.Heartbeat <= started {
+		t.Errorf("heartbeat %d was not refreshed past %d", marker.Heartbeat, started)
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := getMeta(db, runMarkerKeyPrefix+"dataset-a"); ok {
+		t.Error("Release left the marker behind")
+	}
+}
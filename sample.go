@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// sampling reports whether -sample-rate selects a subset of the feed.
+func sampling(cfg *Config) bool {
+	return cfg.SampleRate > 0
+}
+
+// configureSampling validates -sample-rate and makes a sampled run
+// non-destructive: products outside the sample are not missing from the feed,
+// so reconcile, mark-deleted, remote deletes and checkpoints are turned off. Without
+// -sample-seed a time-based seed is chosen and logged so the run can be
+// repeated.
+func configureSampling(cfg *Config) error {
+	if cfg.SampleRate < 0 || cfg.SampleRate > 1 {
+		return fmt.Errorf("-sample-rate must be between 0 and 1, got %v", cfg.SampleRate)
+	}
+	if !sampling(cfg) {
+		return nil
+	}
+	if cfg.SampleSeed == 0 {
+		cfg.SampleSeed = time.Now().UnixNano()
+	}
+	cfg.ReconcileMode = ReconcileOff
+	cfg.PruneRemote = false
+	cfg.DeleteRemoved = false
+	cfg.CheckpointEvery = 0
+	cfg.Resume = false
+	return nil
+}
+
+// sampleItems keeps each item with probability rate, preserving feed order.
+// The same seed selects the same items from the same feed.
+func sampleItems(items []Item, rate float64, seed int64) []Item {
+	rng := rand.New(rand.NewSource(seed))
+	sampled := make([]Item, 0, int(float64(len(items))*rate)+1)
+	for _, item := range items {
+		if rng.Float64() < rate {
+			sampled = append(sampled, item)
+		}
+	}
+	return sampled
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestConfigureSampling(t *testing.T) {
+	cfg := &Config{SampleRate: 0.1, ReconcileMode: ReconcileAfter, PruneRemote: true, DeleteRemoved: true, CheckpointEvery: 100, Resume: true}
+	if err := configureSampling(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ReconcileMode != ReconcileOff || cfg.PruneRemote || cfg.DeleteRemoved || cfg.CheckpointEvery != 0 || cfg.Resume {
+		t.Errorf("sampled config = %+v, want every destructive step off", cfg)
+	}
+	if cfg.SampleSeed == 0 {
+		t.Error("no seed was chosen")
+	}
+	for _, rate := range []float64{-0.1, 1.5} {
+		if err := configureSampling(&Config{SampleRate: rate}); err == nil {
+			t.Errorf("configureSampling accepted rate %v", rate)
+		}
+	}
+}
+
+func TestSampleItemsIsRepeatable(t *testing.T) {
+	var items []Item
+	for i := 0; i < 1000; i++ {
+		items = append(items, Item{ID: fmt.Sprintf("sku-%d", i)})
+	}
+	first := sampleItems(items, 0.2, 42)
+	if n := len(first); n < 150 || n > 250 {
+		t.Errorf("sampled %d of 1000 items at rate 0.2", n)
+	}
+	if again := sampleItems(items, 0.2, 42); !reflect.DeepEqual(first, again) {
+		t.Error("the same seed selected different items")
+	}
+	for i := 1; i < len(first); i++ {
+		var prev, cur int
+		fmt.Sscanf(first[i-1].ID, "sku-%d", &prev)
+		fmt.Sscanf(first[i].ID, "sku-%d", &cur)
+		if cur <= prev {
+			t.Fatalf("sample is out of feed order at %s", first[i].ID)
+		}
+	}
+}
+
+func TestSampledRunDoesNotMarkProductsDeleted(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	cfg.SampleRate, cfg.SampleSeed = 0.5, 1
+	if err := configureSampling(cfg); err != nil {
+		t.Fatal(err)
+	}
+	useSink(t, &FakeSink{})
+	storeProduct(t, db, Product{UniqueCode: "sku-old", Status: "existing"})
+	items := []Item{{ID: "sku-1", Title: "Product", Price: 100}, {ID: "sku-2", Title: "Product", Price: 100}}
+
+	stats, err := processXMLData(context.Background(), db, cfg, items, nil, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.MarkedDeleted != 0 {
+		t.Errorf("MarkedDeleted = %d, want none in a sampled run", stats.MarkedDeleted)
+	}
+	if stored, _ := loadProduct(t, db, "sku-old"); stored.Status == "deleted" {
+		t.Error("a product outside the sample was marked deleted")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Scope restricts a run to one partition of the feed so that mark-deleted and
+// reconcile leave products belonging to other partitions untouched.
+// The zero Scope matches every item.
+type Scope struct {
+	Kind  string // brand, category or prefix
+	Value string
+}
+
+// parseScope parses "kind:value", e.g. "brand:Acme" or "prefix:SKU-".
+func parseScope(s string) (Scope, error) {
+	if s == "" {
+		return Scope{}, nil
+	}
+	kind, value, ok := strings.Cut(s, ":")
+	if !ok || value == "" {
+		return Scope{}, fmt.Errorf("invalid scope %q: expected kind:value", s)
+	}
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	switch kind {
+	case "brand", "category", "prefix":
+	default:
+		return Scope{}, fmt.Errorf("invalid scope kind %q: expected brand, category or prefix", kind)
+	}
+	return Scope{Kind: kind, Value: value}, nil
+}
+
+// String returns the canonical "kind:value" form stored with each product.
+func (s Scope) String() string {
+	if s.Kind == "" {
+		return ""
+	}
+	return s.Kind + ":" + s.Value
+}
+
+// Set implements flag.Value.
+func (s *Scope) Set(value string) error {
+	parsed, err := parseScope(value)
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
+
+// IsZero reports whether the scope covers the whole feed.
+func (s Scope) IsZero() bool {
+	return s.Kind == ""
+}
+
+// Matches reports whether item belongs to the scope. Brand and category
+// comparisons are case-insensitive; prefix applies to the item ID.
+func (s Scope) Matches(item Item) bool {
+	switch s.Kind {
+	case "":
+		return true
+	case "brand":
+		return strings.EqualFold(strings.TrimSpace(item.Brand), s.Value)
+	case "category":
+		return strings.EqualFold(strings.TrimSpace(item.ProductType), s.Value)
+	case "prefix":
+		return strings.HasPrefix(item.ID, s.Value)
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Scope
+		wantErr bool
+	}{
+		{in: "", want: Scope{}},
+		{in: "brand:Acme", want: Scope{Kind: "brand", Value: "Acme"}},
+		{in: " Category:Kettles", want: Scope{Kind: "category", Value: "Kettles"}},
+		{in: "prefix:SKU-", want: Scope{Kind: "prefix", Value: "SKU-"}},
+		{in: "brand", wantErr: true},
+		{in: "brand:", wantErr: true},
+		{in: "color:red", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseScope(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseScope(%q) = %+v, %v; want %+v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestScopeMatches(t *testing.T) {
+	item := Item{ID: "SKU-1", Brand: " acme ", ProductType: "Kettles"}
+	tests := []struct {
+		scope Scope
+		want  bool
+	}{
+		{Scope{}, true},
+		{Scope{Kind: "brand", Value: "Acme"}, true},
+		{Scope{Kind: "brand", Value: "Other"}, false},
+		{Scope{Kind: "category", Value: "kettles"}, true},
+		{Scope{Kind: "prefix", Value: "SKU-"}, true},
+		{Scope{Kind: "prefix", Value: "sku-"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.scope.Matches(item); got != tt.want {
+			t.Errorf("%q.Matches() = %v, want %v", tt.scope.String(), got, tt.want)
+		}
+	}
+}
+
+func TestMarkUnseenAsDeletedStaysInScope(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	cfg.Scope = Scope{Kind: "brand", Value: "Acme"}
+	storeProduct(t, db, Product{UniqueCode: "acme-1", Status: "existing", Scope: "brand:Acme"})
+	storeProduct(t, db, Product{UniqueCode: "acme-2", Status: "existing", Scope: "brand:Acme"})
+	storeProduct(t, db, Product{UniqueCode: "other-1", Status: "existing", Scope: "brand:Other"})
+	seen := newIDSet()
+	seen.Add("acme-1")
+
+	marked, err := markUnseenAsDeleted(db, cfg, seen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marked != 1 {
+		t.Errorf("marked %d products, want 1", marked)
+	}
+	for code, want := range map[string]string{"acme-1": "existing", "acme-2": "deleted", "other-1": "existing"} {
+		if stored, _ := loadProduct(t, db, code); stored.Status != want {
+			t.Errorf("status of %s = %q, want %q", code, stored.Status, want)
+		}
+	}
+}
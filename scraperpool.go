@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/chromedp/chromedp"
+)
+
+// errScrapeTimeout is returned, wrapped, when a scrape runs out of
+// -scrape-timeout, so renderItem can apply -on-scrape-timeout.
+var errScrapeTimeout = errors.New("scrape timed out")
+
+// ScraperPool keeps up to size Chrome instances running for the life of the
+// process and scrapes each product page in a fresh tab on one of them, so
+// Chrome is not started and stopped for every item. Browsers are started on
+// first use and restarted if they die.
+type ScraperPool struct {
+	cfg   *Config
+	size  int
+	slots chan *pooledBrowser
+}
+
+// pooledBrowser is one slot of the pool; ctx is nil until the browser starts.
+type pooledBrowser struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// scrapers is the pool fetchSpecification scrapes with; main sizes it to
+// -scrape-concurrency, or the worker count without it.
+var scrapers *ScraperPool
+
+// scrapePoolSize is the number of browsers for cfg: -scrape-concurrency, or
+// the worker count without it.
+func scrapePoolSize(cfg *Config) int {
+	if cfg.ScrapeConcurrency > 0 {
+		return cfg.ScrapeConcurrency
+	}
+	return cfg.Workers
+}
+
+// newScraperPool returns a pool of size browsers configured by cfg.
+func newScraperPool(cfg *Config, size int) *ScraperPool {
+	if size < 1 {
+		size = 1
+	}
+	p := &ScraperPool{cfg: cfg, size: size, slots: make(chan *pooledBrowser, size)}
+	for i := 0; i < size; i++ {
+		p.slots <- &pooledBrowser{}
+	}
+	return p
+}
+
+// Fetch scrapes every configured field of the product page at url, keyed by
+// field name, in a new tab that is closed when Fetch returns, on timeout, or
+// when ctx is cancelled. A scrape that runs past cfg.ScrapeTimeout fails with
+// errScrapeTimeout. productID names the debug screenshot of an empty scrape.
+func (p *ScraperPool) Fetch(ctx context.Context, productID, url string) (map[string]string, error) {
+	var b *pooledBrowser
+	select {
+	case b = <-p.slots:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { p.slots <- b }()
+
+	if b.ctx == nil || b.ctx.Err() != nil {
+		browserCtx, cancel, err := browsers.newBrowserContext()
+		if err != nil {
+			return nil, err
+		}
+		b.ctx, b.cancel = browserCtx, cancel
+	}
+
+	tabCtx, closeTab := chromedp.NewContext(b.ctx)
+	defer closeTab()
+	stop := context.AfterFunc(ctx, closeTab)
+	defer stop()
+
+	scrapeCtx, cancel := context.WithTimeout(tabCtx, p.cfg.ScrapeTimeout)
+	defer cancel()
+
+	data := make(map[string]string, len(scrapeSelectors))
+	err := chromedp.Run(scrapeCtx,
+		navigateAction(url, p.cfg.PageLoad, allSelectors(scrapeSelectors), p.cfg.PageLoadTimeout),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			// A field none of whose selectors match is left empty.
+			for _, field := range scrapedFields(scrapeSelectors) {
+				text, err := scrapeField(ctx, field, scrapeSelectors[field])
+				if err != nil {
+					return err
+				}
+				data[field] = text
+			}
+			return nil
+		}),
+	)
+	if p.cfg.ScrapeDebugDir != "" && (strings.TrimSpace(data["specification"]) == "" || strings.TrimSpace(data["category"]) == "") {
+		captureDebugScreenshot(tabCtx, p.cfg, productID)
+	}
+	if err != nil && ctx.Err() == nil && scrapeCtx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%w after %s", errScrapeTimeout, p.cfg.ScrapeTimeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch specification: %w", err)
+	}
+	return data, nil
+}
+
+// Close stops every browser in the pool, waiting for scrapes in progress.
+func (p *ScraperPool) Close() {
+	for i := 0; i < p.size; i++ {
+		b := <-p.slots
+		if b.cancel != nil {
+			b.cancel()
+		}
+	}
+}
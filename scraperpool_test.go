@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newProductPageServer serves a product page with the panels the default
+// selectors read.
+func newProductPageServer(b *testing.B) *httptest.Server {
+	b.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body>
+			<ol><li class="breadcrumb-item">Home</li><li class="breadcrumb-item">Kettles</li></ol>
+			<div class="react-tabs__tab-panel">Capacity: 1.7 l</div>
+		</body></html>`))
+	}))
+	b.Cleanup(server.Close)
+	return server
+}
+
+// BenchmarkScraperPool compares scraping on a pooled browser, which is
+// started once, with starting a browser for every item as fetchSpecification
+// used to. It is skipped where Chrome cannot be started.
+func BenchmarkScraperPool(b *testing.B) {
+	if err := browsers.probe(); err != nil {
+		b.Skipf("Chrome is not available: %v", err)
+	}
+	server := newProductPageServer(b)
+	cfg := newTestConfig(b)
+	cfg.ScrapeTimeout, cfg.PageLoad, cfg.PageLoadTimeout = 30*time.Second, PageLoadLoad, 10*time.Second
+	ctx := context.Background()
+
+	b.Run("pooled", func(b *testing.B) {
+		pool := newScraperPool(cfg, 1)
+		defer pool.Close()
+		for i := 0; i < b.N; i++ {
+			if _, err := pool.Fetch(ctx, "sku-1", server.URL); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("per-item", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			pool := newScraperPool(cfg, 1)
+			_, err := pool.Fetch(ctx, "sku-1", server.URL)
+			pool.Close()
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestScraperPoolFetchTimesOut(t *testing.T) {
+	if err := browsers.probe(); err != nil {
+		t.Skipf("Chrome is not available: %v", err)
+	}
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	cfg := newTestConfig(t)
+	cfg.ScrapeTimeout, cfg.PageLoad, cfg.PageLoadTimeout = 200*time.Millisecond, PageLoadLoad, 10*time.Second
+
+	pool := newScraperPool(cfg, 1)
+	defer pool.Close()
+	_, err := pool.Fetch(context.Background(), "sku-1", server.URL)
+	if !errors.Is(err, errScrapeTimeout) {
+		t.Errorf("Fetch() = %v, want errScrapeTimeout", err)
+	}
+}
+
+func TestScrapePoolSize(t *testing.T) {
+	for _, tt := range []struct{ workers, concurrency, want int }{{8, 0, 8}, {8, 2, 2}, {2, 8, 8}} {
+		cfg := &Config{Workers: tt.workers, ScrapeConcurrency: tt.concurrency}
+		if got := scrapePoolSize(cfg); got != tt.want {
+			t.Errorf("-workers %d -scrape-concurrency %d: size %d, want %d", tt.workers, tt.concurrency, got, tt.want)
+		}
+	}
+}
+
+func TestScraperPoolFetchWaitsForFreeBrowser(t *testing.T) {
+	pool := newScraperPool(newTestConfig(t), 1)
+	if cap(pool.slots) != 1 {
+		t.Fatalf("pool has %d slots, want 1", cap(pool.slots))
+	}
+	// Hold the only browser, as a scrape in progress would.
+	b := <-pool.slots
+	defer func() { pool.slots <- b }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Fetch(ctx, "sku-1", "http://shop.invalid/sku-1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Fetch() = %v, want to wait for the busy browser until the deadline", err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	screenshotQuality = 80
+	screenshotTimeout = 10 * time.Second
+)
+
+// screenshotsTaken counts debug screenshots written this run against
+// cfg.ScrapeDebugMax; runSync resets it.
+var screenshotsTaken int64
+
+// resetScreenshots restarts the screenshot count, for the next run in
+// -interval mode.
+func resetScreenshots() {
+	atomic.StoreInt64(&screenshotsTaken, 0)
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// captureDebugScreenshot saves a full-page screenshot of the page currently
+// loaded in tabCtx to cfg.ScrapeDebugDir, named by product ID. It is a no-op
+// once cfg.ScrapeDebugMax screenshots have been written this run.
+// tabCtx must not be the (possibly expired) scrape timeout context.
+func captureDebugScreenshot(tabCtx context.Context, cfg *Config, productID string) {
+	if atomic.AddInt64(&screenshotsTaken, 1) > int64(cfg.ScrapeDebugMax) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(tabCtx, screenshotTimeout)
+	defer cancel()
+
+	var buf []byte
+	if err := chromedp.Run(ctx, chromedp.FullScreenshot(&buf, screenshotQuality)); err != nil {
+		warnf("Failed to capture debug screenshot for %s: %v", productID, err)
+		return
+	}
+
+	if err := ensureGeneratedDir(cfg.ScrapeDebugDir, cfg.FileMode); err != nil {
+		warnf("Failed to create scrape debug directory %s: %v", cfg.ScrapeDebugDir, err)
+		return
+	}
+	path := filepath.Join(cfg.ScrapeDebugDir, unsafeFileChars.ReplaceAllString(productID, "_")+".jpg")
+	if err := writeGeneratedFile(path, buf, cfg.FileMode); err != nil {
+		warnf("Failed to write debug screenshot %s: %v", path, err)
+		return
+	}
+	infof("Saved debug screenshot for %s to %s", productID, path)
+}
@@ -0,0 +1,37 @@
+package main
+
+import "sync"
+
+// idSet is a set of unique codes that is safe for concurrent use. Workers
+// record every feed item they handle so reconcile can diff the database
+// against what this run actually saw.
+type idSet struct {
+	mu  sync.Mutex
+	ids map[string]struct{}
+}
+
+func newIDSet() *idSet {
+	return &idSet{ids: make(map[string]struct{})}
+}
+
+// Add records id.
+func (s *idSet) Add(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids[id] = struct{}{}
+}
+
+// Has reports whether id was recorded.
+func (s *idSet) Has(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.ids[id]
+	return ok
+}
+
+// Len returns the number of recorded IDs.
+func (s *idSet) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.ids)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestIDSetConcurrentAdd(t *testing.T) {
+	seen := newIDSet()
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				seen.Add(fmt.Sprintf("sku-%d", i))
+			}
+		}()
+	}
+	wg.Wait()
+	if seen.Len() != 100 {
+		t.Errorf("Len() = %d, want 100", seen.Len())
+	}
+	if !seen.Has("sku-99") || seen.Has("sku-100") {
+		t.Error("Has() does not match the added IDs")
+	}
+}
+
+func TestProcessFeedFileMarksOnlyUnseenProductsDeleted(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	useSink(t, &FakeSink{})
+	storeProduct(t, db, Product{UniqueCode: "sku-1", Status: "existing"})
+	storeProduct(t, db, Product{UniqueCode: "sku-old", Status: "existing"})
+	feed := writeTestFeed(t, feedItem("sku-1", "10.00"), feedItem("sku-2", "20.00"))
+
+	stats, err := processFeedFile(context.Background(), db, cfg, feed, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.MarkedDeleted != 1 {
+		t.Errorf("MarkedDeleted = %d, want 1", stats.MarkedDeleted)
+	}
+	for code, want := range map[string]bool{"sku-1": false, "sku-2": false, "sku-old": true} {
+		stored, ok := loadProduct(t, db, code)
+		if !ok {
+			t.Fatalf("%s is not stored", code)
+		}
+		if deleted := stored.Status == "deleted"; deleted != want {
+			t.Errorf("%s: status %q, want deleted %v", code, stored.Status, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/chromedp/chromedp"
+)
+
+// Scraped fields and their default selectors.
+var defaultSelectors = map[string][]string{
+	"specification": {specificationSelector},
+	"category":      {categorySelector},
+}
+
+// ScrapeRules names the selectors that read a storefront's product pages, so
+// feeds from different sites can be scraped by configuration alone. Each
+// selector is tried before the fallbacks configured for its field under
+// "selectors"; empty selectors keep the defaults. Extra maps additional field
+// names to selectors; they are written into the document like the built-in
+// fields.
+type ScrapeRules struct {
+	SpecificationSelector string            `json:"specification"`
+	CategorySelector      string            `json:"category"`
+	Extra                 map[string]string `json:"extra"`
+}
+
+// scrapeSelectors are the selectors fetchSpecification tries per field, in
+// order; main resolves them from the config file's "scrape_rules" and
+// "selectors" over defaultSelectors.
+var scrapeSelectors = defaultSelectors
+
+// resolveSelectors validates the configured rules and fallback selectors and
+// merges them over the defaults. Fallbacks may only be given for built-in
+// fields and fields named in rules.
+func resolveSelectors(rules ScrapeRules, configured map[string][]string) (map[string][]string, error) {
+	resolved := make(map[string][]string, len(defaultSelectors)+len(rules.Extra))
+	for field, selectors := range defaultSelectors {
+		resolved[field] = selectors
+	}
+	for field, selector := range rules.Extra {
+		if _, ok := defaultSelectors[field]; ok {
+			return nil, fmt.Errorf("extra field %q: use the %s rule instead", field, field)
+		}
+		if !validFieldName(field) {
+			return nil, fmt.Errorf("extra field %q: names may only contain letters, digits, _ and -", field)
+		}
+		if strings.TrimSpace(selector) == "" {
+			return nil, fmt.Errorf("extra field %s: empty selector", field)
+		}
+		resolved[field] = []string{selector}
+	}
+	for field, selectors := range configured {
+		if _, ok := resolved[field]; !ok {
+			return nil, fmt.Errorf("unknown scraped field %q: expected specification, category or a scrape_rules extra field", field)
+		}
+		if len(selectors) == 0 {
+			return nil, fmt.Errorf("field %s: at least one selector is required", field)
+		}
+		for _, selector := range selectors {
+			if strings.TrimSpace(selector) == "" {
+				return nil, fmt.Errorf("field %s: empty selector", field)
+			}
+		}
+		if _, extra := rules.Extra[field]; extra {
+			resolved[field] = append(resolved[field], selectors...)
+		} else {
+			resolved[field] = selectors
+		}
+	}
+	for field, selector := range map[string]string{"specification": rules.SpecificationSelector, "category": rules.CategorySelector} {
+		if strings.TrimSpace(selector) != "" {
+			resolved[field] = append([]string{selector}, resolved[field]...)
+		}
+	}
+	return resolved, nil
+}
+
+// validFieldName reports whether name can be used as a document field.
+func validFieldName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// scrapedFields lists the configured fields in a stable order.
+func scrapedFields(selectors map[string][]string) []string {
+	fields := make([]string, 0, len(selectors))
+	for field := range selectors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// allSelectors matches an element for any field's selectors.
+func allSelectors(selectors map[string][]string) string {
+	var all []string
+	for _, field := range scrapedFields(selectors) {
+		all = append(all, selectors[field]...)
+	}
+	return anySelector(all)
+}
+
+// anySelector matches an element for any of selectors.
+func anySelector(selectors []string) string {
+	return strings.Join(selectors, ", ")
+}
+
+// scrapeField reads the text of the first of selectors that yields non-empty
+// text on the current page, and "" when none does.
+func scrapeField(ctx context.Context, field string, selectors []string) (string, error) {
+	for i, selector := range selectors {
+		quoted, err := json.Marshal(selector)
+		if err != nil {
+			return "", err
+		}
+		var text string
+		script := fmt.Sprintf(`(() => { const el = document.querySelector(%s); return el ? el.innerText : ""; })()`, quoted)
+		if err := chromedp.Evaluate(script, &text).Do(ctx); err != nil {
+			return "", fmt.Errorf("failed to read %s with selector %q: %v", field, selector, err)
+		}
+		if strings.TrimSpace(text) != "" {
+			debugf("Field %s matched selector %d (%q)", field, i+1, selector)
+			return text, nil
+		}
+	}
+	debugf("Field %s matched none of %d selectors", field, len(selectors))
+	return "", nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chromedp/chromedp"
+)
+
+func TestResolveSelectors(t *testing.T) {
+	rules := ScrapeRules{
+		SpecificationSelector: ".spec",
+		Extra:                 map[string]string{"warranty": ".warranty"},
+	}
+	configured := map[string][]string{
+		"category": {"nav .crumb"},
+		"warranty": {"#warranty"},
+	}
+	resolved, err := resolveSelectors(rules, configured)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"specification": {".spec", specificationSelector},
+		"category":      {"nav .crumb"},
+		"warranty":      {".warranty", "#warranty"},
+	}
+	if !reflect.DeepEqual(resolved, want) {
+		t.Errorf("resolveSelectors() = %v, want %v", resolved, want)
+	}
+	if got := allSelectors(resolved); got != "nav .crumb, .spec, "+specificationSelector+", .warranty, #warranty" {
+		t.Errorf("allSelectors() = %q", got)
+	}
+}
+
+func TestResolveSelectorsRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		rules      ScrapeRules
+		configured map[string][]string
+		want       string
+	}{
+		{"built-in extra", ScrapeRules{Extra: map[string]string{"category": ".c"}}, nil, "use the category rule"},
+		{"bad name", ScrapeRules{Extra: map[string]string{"a b": ".c"}}, nil, "names may only contain"},
+		{"empty extra", ScrapeRules{Extra: map[string]string{"warranty": " "}}, nil, "empty selector"},
+		{"unknown field", ScrapeRules{}, map[string][]string{"colour": {".c"}}, "unknown scraped field"},
+		{"no fallbacks", ScrapeRules{}, map[string][]string{"category": {}}, "at least one selector"},
+		{"empty fallback", ScrapeRules{}, map[string][]string{"category": {""}}, "empty selector"},
+	}
+	for _, tt := range tests {
+		_, err := resolveSelectors(tt.rules, tt.configured)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: resolveSelectors() = %v, want an error mentioning %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// TestScrapeFieldFallsBack reads a page on which only the second selector
+// matches. It is skipped where Chrome cannot be started.
+func TestScrapeFieldFallsBack(t *testing.T) {
+	if err := browsers.probe(); err != nil {
+		t.Skipf("Chrome is not available: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><div class="old"></div><div class="new">Capacity: 1.7 l</div></body></html>`))
+	}))
+	defer server.Close()
+	ctx, cancel, err := browsers.newBrowserContext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	if err := chromedp.Run(ctx, chromedp.Navigate(server.URL)); err != nil {
+		t.Fatal(err)
+	}
+
+	var text string
+	err = chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		text, err = scrapeField(ctx, "specification", []string{".missing", ".old", ".new"})
+		return err
+	}))
+	if err != nil || text != "Capacity: 1.7 l" {
+		t.Errorf("scrapeField() = %q, %v; want the fallback's text", text, err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNewRequestSigner(t *testing.T) {
+	if signer, err := newRequestSigner("hmac-sha256", ""); err != nil || signer != nil {
+		t.Errorf("newRequestSigner without a key = %v, %v; want signing disabled", signer, err)
+	}
+	if _, err := newRequestSigner("rsa", "secret"); err == nil {
+		t.Error("newRequestSigner accepted an unsupported algorithm")
+	}
+}
+
+func TestAPIRequestsAreSigned(t *testing.T) {
+	newTestConfig(t)
+	saved := apiSigner
+	t.Cleanup(func() { apiSigner = saved })
+	now := time.Unix(1700000000, 0)
+	apiSigner = &hmacSHA256Signer{key: []byte("secret"), now: func() time.Time { return now }}
+
+	var signature, timestamp string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature, timestamp = r.Header.Get(signatureHeader), r.Header.Get(signatureTimestampHeader)
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/datasets/d/documents?page=1", bytes.NewReader([]byte(`{"name":"sku-1"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := apiDo(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if string(body) != `{"name":"sku-1"}` {
+		t.Errorf("server received body %q; signing consumed it", body)
+	}
+	if timestamp != strconv.FormatInt(now.Unix(), 10) {
+		t.Errorf("timestamp header = %q, want %d", timestamp, now.Unix())
+	}
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("POST\n/v1/datasets/d/documents?page=1\n" + `{"name":"sku-1"}` + "\n" + timestamp))
+	if want := hex.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Errorf("signature = %q, want %q", signature, want)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// DocumentSink is where generated product documents go. The pipeline only
+// talks to documentSink, so another destination, or a fake, can stand in for
+// the dataset API.
+type DocumentSink interface {
+	// Upload stores the file at filePath as a new document and returns its ID.
+	Upload(ctx context.Context, filePath string) (string, error)
+	// Update replaces the content of document documentID with the file at
+	// filePath and returns the document's ID.
+	Update(ctx context.Context, documentID, filePath string) (string, error)
+	// Delete removes document documentID.
+	Delete(ctx context.Context, documentID string) error
+}
+
+// documentSink is the run's sink; main sets it to a MyBuddySink.
+var documentSink DocumentSink
+
+// MyBuddySink sends documents to the run's my-buddy.ai dataset target. Each
+// call is one request: create_by_file and update_by_file take a single file,
+// so it does not implement batchUploader and batchUpload sends a batch's
+// files concurrently instead. Requests reuse the shared transport's
+// keep-alive connections.
+type MyBuddySink struct {
+	cfg *Config
+}
+
+// Upload implements DocumentSink.
+func (s MyBuddySink) Upload(ctx context.Context, filePath string) (string, error) {
+	return uploadFile(ctx, s.cfg, filePath)
+}
+
+// Update implements DocumentSink.
+func (s MyBuddySink) Update(ctx context.Context, documentID, filePath string) (string, error) {
+	return updateFile(ctx, s.cfg, documentID, filePath)
+}
+
+// Delete implements DocumentSink.
+func (s MyBuddySink) Delete(ctx context.Context, documentID string) error {
+	return deleteFile(ctx, s.cfg, documentID)
+}
+
+// SinkCall is one call recorded by FakeSink.
+type SinkCall struct {
+	Method     string
+	DocumentID string
+	FilePath   string
+}
+
+// FakeSink keeps documents in memory and records every call, so the pipeline
+// can run without a network. Its zero value is ready to use.
+type FakeSink struct {
+	mu        sync.Mutex
+	documents map[string][]byte
+	calls     []SinkCall
+	nextID    int
+}
+
+// Upload implements DocumentSink.
+func (s *FakeSink) Upload(ctx context.Context, filePath string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	documentID := fmt.Sprintf("fake-%d", s.nextID)
+	s.calls = append(s.calls, SinkCall{Method: "Upload", DocumentID: documentID, FilePath: filePath})
+	return documentID, s.store(documentID, filePath)
+}
+
+// Update implements DocumentSink.
+func (s *FakeSink) Update(ctx context.Context, documentID, filePath string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, SinkCall{Method: "Update", DocumentID: documentID, FilePath: filePath})
+	if _, ok := s.documents[documentID]; !ok {
+		return "", fmt.Errorf("document %s not found", documentID)
+	}
+	return documentID, s.store(documentID, filePath)
+}
+
+// Delete implements DocumentSink.
+func (s *FakeSink) Delete(ctx context.Context, documentID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, SinkCall{Method: "Delete", DocumentID: documentID})
+	delete(s.documents, documentID)
+	return nil
+}
+
+// store saves the content of filePath as document documentID; s.mu is held.
+func (s *FakeSink) store(documentID, filePath string) error {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	if s.documents == nil {
+		s.documents = make(map[string][]byte)
+	}
+	s.documents[documentID] = content
+	return nil
+}
+
+// Calls returns the calls recorded so far, in order.
+func (s *FakeSink) Calls() []SinkCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SinkCall(nil), s.calls...)
+}
+
+// Documents returns the content of every stored document by ID.
+func (s *FakeSink) Documents() map[string][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	documents := make(map[string][]byte, len(s.documents))
+	for id, content := range s.documents {
+		documents[id] = content
+	}
+	return documents
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeDocument writes content to a document file called name.
+func writeDocument(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFakeSinkStoresDocuments(t *testing.T) {
+	ctx := context.Background()
+	sink := &FakeSink{}
+	first, second := writeDocument(t, "a.txt", "first"), writeDocument(t, "b.txt", "second")
+
+	id, err := sink.Upload(ctx, first)
+	if err != nil || id != "fake-1" {
+		t.Fatalf("Upload() = %q, %v", id, err)
+	}
+	if id, err := sink.Update(ctx, "fake-1", second); err != nil || id != "fake-1" {
+		t.Fatalf("Update() = %q, %v", id, err)
+	}
+	if got := sink.Documents(); string(got["fake-1"]) != "second" {
+		t.Errorf("documents = %q, want the updated content", got)
+	}
+	if _, err := sink.Update(ctx, "fake-9", second); err == nil {
+		t.Error("Update of an unknown document succeeded")
+	}
+	if err := sink.Delete(ctx, "fake-1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := sink.Documents(); len(got) != 0 {
+		t.Errorf("documents after Delete = %q", got)
+	}
+
+	want := []SinkCall{
+		{Method: "Upload", DocumentID: "fake-1", FilePath: first},
+		{Method: "Update", DocumentID: "fake-1", FilePath: second},
+		{Method: "Update", DocumentID: "fake-9", FilePath: second},
+		{Method: "Delete", DocumentID: "fake-1"},
+	}
+	if got := sink.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestFakeSinkUploadOfMissingFileFails(t *testing.T) {
+	sink := &FakeSink{}
+	if _, err := sink.Upload(context.Background(), filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("Upload of a missing file succeeded")
+	}
+}
+
+func TestMyBuddySinkCallsAPI(t *testing.T) {
+	cfg := newTestConfig(t)
+	api := newTestAPI(t, cfg)
+	sink := MyBuddySink{cfg: cfg}
+	ctx := context.Background()
+
+	id, err := sink.Upload(ctx, writeDocument(t, "a.txt", "first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Delete(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if api.count("POST", "/create_by_file") != 1 || api.count("DELETE", "/documents/"+id) != 1 {
+		t.Error("MyBuddySink did not send one upload and one delete")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SortOrder orders feed items before they are dispatched to the workers, so
+// priority products are handled first. The whole feed is already held in
+// memory by loadFeedItems, so sorting costs no extra buffering. The zero value
+// keeps feed order.
+type SortOrder struct {
+	Key  string
+	Desc bool
+}
+
+// itemSortKeys compare two items on one key.
+var itemSortKeys = map[string]func(a, b Item) int{
+	"price":     func(a, b Item) int { return compareMoney(a.Price, b.Price) },
+	"inventory": func(a, b Item) int { return a.Inventory - b.Inventory },
+	"brand":     func(a, b Item) int { return strings.Compare(strings.ToLower(a.Brand), strings.ToLower(b.Brand)) },
+	"id":        func(a, b Item) int { return strings.Compare(a.ID, b.ID) },
+}
+
+// String implements flag.Value.
+func (o *SortOrder) String() string {
+	if o.Key == "" {
+		return ""
+	}
+	if o.Desc {
+		return o.Key + ":desc"
+	}
+	return o.Key + ":asc"
+}
+
+// Set implements flag.Value. The value is key[:asc|desc].
+func (o *SortOrder) Set(value string) error {
+	key, direction, _ := strings.Cut(value, ":")
+	if _, ok := itemSortKeys[key]; !ok {
+		return fmt.Errorf("invalid sort key %q: expected price, inventory, brand or id", key)
+	}
+	switch direction {
+	case "", "asc":
+		o.Desc = false
+	case "desc":
+		o.Desc = true
+	default:
+		return fmt.Errorf("invalid sort direction %q: expected asc or desc", direction)
+	}
+	o.Key = key
+	return nil
+}
+
+// sortItems sorts items in place. The sort is stable, so items with equal
+// keys keep feed order and a resumed run sees the same order again.
+func sortItems(items []Item, order SortOrder) {
+	compare, ok := itemSortKeys[order.Key]
+	if !ok {
+		return
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if order.Desc {
+			return compare(items[j], items[i]) < 0
+		}
+		return compare(items[i], items[j]) < 0
+	})
+}
+
+func compareMoney(a, b Money) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
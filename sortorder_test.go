@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortOrderSet(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    SortOrder
+		wantErr bool
+	}{
+		{in: "price", want: SortOrder{Key: "price"}},
+		{in: "inventory:desc", want: SortOrder{Key: "inventory", Desc: true}},
+		{in: "brand:asc", want: SortOrder{Key: "brand"}},
+		{in: "rating", wantErr: true},
+		{in: "id:down", wantErr: true},
+	}
+	for _, tt := range tests {
+		var got SortOrder
+		err := got.Set(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Set(%q) = %+v, %v; want %+v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+	order := SortOrder{Key: "price", Desc: true}
+	if got := order.String(); got != "price:desc" {
+		t.Errorf("String() = %q, want price:desc", got)
+	}
+}
+
+func TestSortItemsIsStable(t *testing.T) {
+	items := []Item{
+		{ID: "a", Price: 500, Brand: "beta"},
+		{ID: "b", Price: 100, Brand: "Alpha"},
+		{ID: "c", Price: 500, Brand: "alpha"},
+		{ID: "d", Price: 900, Brand: "Gamma"},
+	}
+	ids := func(items []Item) []string {
+		var ids []string
+		for _, item := range items {
+			ids = append(ids, item.ID)
+		}
+		return ids
+	}
+	tests := []struct {
+		order SortOrder
+		want  []string
+	}{
+		{SortOrder{}, []string{"a", "b", "c", "d"}},
+		{SortOrder{Key: "price"}, []string{"b", "a", "c", "d"}},
+		{SortOrder{Key: "price", Desc: true}, []string{"d", "a", "c", "b"}},
+		{SortOrder{Key: "brand"}, []string{"b", "c", "a", "d"}},
+	}
+	for _, tt := range tests {
+		sorted := append([]Item(nil), items...)
+		sortItems(sorted, tt.order)
+		if got := ids(sorted); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sortItems(%s) = %v, want %v", tt.order.String(), got, tt.want)
+		}
+	}
+}
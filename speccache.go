@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const headTimeout = 10 * time.Second
+
+// pageValidators are the HTTP cache validators of a product page.
+type pageValidators struct {
+	ETag         string
+	LastModified string
+}
+
+// IsZero reports whether the server sent no validators, in which case the
+// page must always be scraped.
+func (v pageValidators) IsZero() bool {
+	return v.ETag == "" && v.LastModified == ""
+}
+
+// headClient is used for the cheap HEAD probe before a scrape.
+var headClient = &http.Client{Transport: httpTransport, Timeout: headTimeout}
+
+// fetchPageValidators issues a HEAD request for url and returns its ETag and
+// Last-Modified headers. Cancelling ctx aborts the request.
+func fetchPageValidators(ctx context.Context, url string) (pageValidators, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+	if err != nil {
+		return pageValidators{}, err
+	}
+	resp, err := headClient.Do(req)
+	if err != nil {
+		return pageValidators{}, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return pageValidators{}, fmt.Errorf("HEAD %s: %s", url, resp.Status)
+	}
+	return pageValidators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}, nil
+}
+
+// specCacheStore keeps the last scrape result of every product together with
+// the validators of the page it came from. Like products, entries are keyed by
+// feed ID and unique code, so feeds sharing a database may reuse codes.
+type specCacheStore struct {
+	db *sql.DB
+}
+
+// specCache is the process-wide scrape cache; it is nil, and scrapes always
+// run, until main opens it.
+var specCache *specCacheStore
+
+// openSpecCache creates the spec_cache table if needed. A table from before
+// entries were keyed by feed ID is dropped: SQLite cannot change its primary
+// key, and losing it only costs one scrape per product.
+func openSpecCache(db *sql.DB) (*specCacheStore, error) {
+	scoped, err := hasColumn(db, "spec_cache", "feed_id")
+	if err != nil {
+		return nil, err
+	}
+	if !scoped {
+		if err := writeDB(db, `DROP TABLE IF EXISTS spec_cache`); err != nil {
+			return nil, fmt.Errorf("failed to drop the unscoped spec_cache: %v", err)
+		}
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS spec_cache (
+		feed_id TEXT NOT NULL,
+		unique_code TEXT NOT NULL,
+		url TEXT NOT NULL,
+		etag TEXT NOT NULL,
+		last_modified TEXT NOT NULL,
+		specification TEXT NOT NULL,
+		category TEXT NOT NULL,
+		fetched_at TEXT NOT NULL,
+		PRIMARY KEY (feed_id, unique_code)
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spec_cache: %v", err)
+	}
+	// Fields other than specification and category, as a JSON object.
+	if err := addColumnIfMissing(db, "spec_cache", "extra", "TEXT NOT NULL DEFAULT '{}'"); err != nil {
+		return nil, err
+	}
+	return &specCacheStore{db: db}, nil
+}
+
+// Lookup returns the cached scrape for productID of feed feedID when it was taken
+// from url and the page still has validators v. It is nil-safe.
+func (c *specCacheStore) Lookup(feedID, productID, url string, v pageValidators) (map[string]string, bool) {
+	if c == nil || v.IsZero() {
+		return nil, false
+	}
+	var cachedURL, etag, lastModified, specification, category, extra string
+	err := c.db.QueryRow(`SELECT url, etag, last_modified, specification, category, extra FROM spec_cache WHERE feed_id = ? AND unique_code = ?`, feedID, productID).
+		Scan(&cachedURL, &etag, &lastModified, &specification, &category, &extra)
+	if err != nil {
+		return nil, false
+	}
+	if cachedURL != url || etag != v.ETag || lastModified != v.LastModified {
+		return nil, false
+	}
+	data := make(map[string]string)
+	if err := json.Unmarshal([]byte(extra), &data); err != nil {
+		return nil, false
+	}
+	data["specification"] = specification
+	data["category"] = category
+	// A field configured since the scrape was cached forces a new scrape.
+	for field := range scrapeSelectors {
+		if _, ok := data[field]; !ok {
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// Store records a scrape of url for productID of feed feedID. It is nil-safe and
+// does nothing when the page had no validators.
+func (c *specCacheStore) Store(feedID, productID, url string, v pageValidators, data map[string]string) error {
+	if c == nil || v.IsZero() {
+		return nil
+	}
+	extra := make(map[string]string)
+	for field, value := range data {
+		if field != "specification" && field != "category" {
+			extra[field] = value
+		}
+	}
+	encoded, err := json.Marshal(extra)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO spec_cache (feed_id, unique_code, url, etag, last_modified, specification, category, extra, fetched_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(feed_id, unique_code) DO UPDATE SET url = excluded.url, etag = excluded.etag,
+			last_modified = excluded.last_modified, specification = excluded.specification,
+			category = excluded.category, extra = excluded.extra, fetched_at = excluded.fetched_at`
+	return writeDB(c.db, query, feedID, productID, url, v.ETag, v.LastModified,
+		data["specification"], data["category"], string(encoded), time.Now().UTC().Format(time.RFC3339))
+}
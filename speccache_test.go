@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFetchPageValidators(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodHead {
+			t.Errorf("probe used %s, want HEAD", r.Method)
+		}
+		w.Header().Set("ETag", `"v2"`)
+		w.Header().Set("Last-Modified", "Mon, 12 Oct 2026 08:00:00 GMT")
+	}))
+	defer server.Close()
+
+	v, err := fetchPageValidators(context.Background(), server.URL+"/sku-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.ETag != `"v2"` || v.LastModified != "Mon, 12 Oct 2026 08:00:00 GMT" {
+		t.Errorf("validators = %+v", v)
+	}
+	if _, err := fetchPageValidators(context.Background(), server.URL+"/gone"); err == nil {
+		t.Error("fetchPageValidators accepted a 404")
+	}
+}
+
+func TestSpecCacheLookup(t *testing.T) {
+	db := newTestDB(t)
+	cache, err := openSpecCache(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := pageValidators{ETag: `"v1"`}
+	data := map[string]string{"specification": "Leather", "category": "Bags"}
+	if err := cache.Store("", "sku-1", "https://shop.example/sku-1", v, data); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := cache.Lookup("", "sku-1", "https://shop.example/sku-1", v)
+	if !ok || got["specification"] != "Leather" || got["category"] != "Bags" {
+		t.Errorf("Lookup() = %v, %v; want the cached scrape", got, ok)
+	}
+	misses := []struct {
+		name string
+		url  string
+		v    pageValidators
+	}{
+		{"changed page", "https://shop.example/sku-1", pageValidators{ETag: `"v2"`}},
+		{"moved page", "https://shop.example/p/sku-1", v},
+		{"no validators", "https://shop.example/sku-1", pageValidators{}},
+	}
+	for _, miss := range misses {
+		if _, ok := cache.Lookup("", "sku-1", miss.url, miss.v); ok {
+			t.Errorf("%s: Lookup() hit the cache", miss.name)
+		}
+	}
+
+	var none *specCacheStore
+	if err := none.Store("", "sku-1", "u", v, data); err != nil {
+		t.Errorf("Store on a nil cache = %v", err)
+	}
+	if _, ok := none.Lookup("", "sku-1", "u", v); ok {
+		t.Error("Lookup on a nil cache hit")
+	}
+}
+
+func TestSpecCacheIsKeyedByFeedID(t *testing.T) {
+	db := newTestDB(t)
+	cache, err := openSpecCache(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := pageValidators{ETag: `"v1"`}
+	for feedID, spec := range map[string]string{"": "Leather", "outlet": "Canvas"} {
+		if err := cache.Store(feedID, "sku-1", "https://shop.example/sku-1", v, map[string]string{"specification": spec}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for feedID, want := range map[string]string{"": "Leather", "outlet": "Canvas"} {
+		if got, ok := cache.Lookup(feedID, "sku-1", "https://shop.example/sku-1", v); !ok || got["specification"] != want {
+			t.Errorf("Lookup(%q) = %v, %v; want %s", feedID, got, ok, want)
+		}
+	}
+	if _, ok := cache.Lookup("other", "sku-1", "https://shop.example/sku-1", v); ok {
+		t.Error("Lookup hit another feed's entry")
+	}
+}
+
+func TestOpenSpecCacheDropsUnscopedTable(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec(`DROP TABLE IF EXISTS spec_cache`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE spec_cache (unique_code TEXT PRIMARY KEY, url TEXT NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO spec_cache VALUES ('sku-1', 'https://shop.example/sku-1')`); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := openSpecCache(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Store("", "sku-1", "https://shop.example/sku-1", pageValidators{ETag: `"v1"`}, map[string]string{}); err != nil {
+		t.Errorf("Store() on the recreated table = %v", err)
+	}
+}
+
+func TestWorkerSkipsScrapeOfUnchangedPage(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	sink := &FakeSink{}
+	useSink(t, sink)
+	pages := newCachedPages(t, db, cfg)
+	pages.scraped(t, "sku-1", "Cached leather")
+
+	stats := &SyncStats{}
+	item := Item{ID: "sku-1", Title: "Product", Price: 100, Link: pages.link("sku-1")}
+	if err := worker(context.Background(), db, cfg, stats, newIDSet(), item); err != nil {
+		t.Fatal(err)
+	}
+	if pages.probeCount() != 1 || stats.ScrapeFailures != 0 {
+		t.Errorf("probes, scrape failures = %d, %d; want one probe and no scrape", pages.probeCount(), stats.ScrapeFailures)
+	}
+	documents := sink.Documents()
+	if len(documents) != 1 {
+		t.Fatalf("stored %d documents, want 1", len(documents))
+	}
+	for _, content := range documents {
+		if !strings.Contains(string(content), "Cached leather") {
+			t.Errorf("document %q lacks the cached specification", content)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SyncStats counts what a sync run did. Fields are updated atomically by workers.
+type SyncStats struct {
+	Seen       int64
+	New        int64
+	Updated    int64
+	Existing   int64
+	Restocked  int64
+	Deferred   int64
+	Reuploaded int64
+	Capped     int64
+	Migrated   int64
+	// Resumed counts products skipped because the interrupted run being
+	// resumed had already synced them.
+	Resumed int64
+	// NotModified counts products skipped because their -since timestamp is
+	// not after the stored watermark.
+	NotModified int64
+
+	Deleted        int64
+	DeleteFailures int64
+	MarkedDeleted  int64
+
+	// ScrapeFailures counts product pages that could not be scraped; the
+	// item is still uploaded unless the scrape policy defers it.
+	// UploadFailures counts failed upload requests and Failed the items that
+	// did not sync for any reason.
+	ScrapeFailures int64
+	UploadFailures int64
+	Failed         int64
+
+	// Duration is the wall-clock time of the feed pass and reconcile.
+	Duration time.Duration
+
+	// Malformed lists the feed items skipped because they failed to parse or
+	// validate.
+	Malformed []ItemError
+
+	// Failures lists the items that failed to sync, in completion order.
+	mu       sync.Mutex
+	Failures []ItemError
+}
+
+func (s *SyncStats) add(counter *int64) {
+	atomic.AddInt64(counter, 1)
+}
+
+// addFailure records an item that failed to sync.
+func (s *SyncStats) addFailure(failure ItemError) {
+	s.mu.Lock()
+	s.Failures = append(s.Failures, failure)
+	s.mu.Unlock()
+}
+
+// failureErrors joins the recorded failures into one error, or returns nil
+// when there are none.
+func (s *SyncStats) failureErrors() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	errs := make([]error, len(s.Failures))
+	for i := range s.Failures {
+		errs[i] = &s.Failures[i]
+	}
+	return errors.Join(errs...)
+}
+
+// printSummary prints the run's counters as the run summary.
+func (s *SyncStats) printSummary() {
+	summaryf("Synced %d products in %s:\n", s.Seen, s.Duration.Round(time.Millisecond))
+	rows := []struct {
+		label string
+		count int64
+	}{
+		{"new", s.New},
+		{"updated", s.Updated},
+		{"restocked", s.Restocked},
+		{"unchanged", s.Existing},
+		{"resumed", s.Resumed},
+		{"not modified", s.NotModified},
+		{"deferred", s.Deferred},
+		{"deleted", s.Deleted},
+		{"marked deleted", s.MarkedDeleted},
+		{"malformed", int64(len(s.Malformed))},
+		{"scrape failures", s.ScrapeFailures},
+		{"upload failures", s.UploadFailures},
+		{"delete failures", s.DeleteFailures},
+		{"failed", s.Failed},
+	}
+	for _, row := range rows {
+		summaryf("  %-16s %d\n", row.label+":", row.count)
+	}
+}
+
+// errTooManyFailures is returned by the worker pool once -max-failures items
+// have failed, which cancels the rest of the run.
+var errTooManyFailures = errors.New("too many failed items")
+
+// failureLimit counts failed items against -max-failures.
+type failureLimit struct {
+	max   int64
+	count int64
+}
+
+func newFailureLimit(max int) *failureLimit {
+	return &failureLimit{max: int64(max)}
+}
+
+// record counts one failure and returns errTooManyFailures when it reaches
+// the limit. A zero limit never trips.
+func (l *failureLimit) record() error {
+	if n := atomic.AddInt64(&l.count, 1); l.max > 0 && n >= l.max {
+		return fmt.Errorf("%w: %d items failed", errTooManyFailures, n)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrintSummary(t *testing.T) {
+	restoreLogging(t)
+	silent = false
+	stats := &SyncStats{Seen: 5, New: 2, Existing: 1, ScrapeFailures: 1, UploadFailures: 1, Failed: 2,
+		Duration: 1234567 * time.Microsecond, Malformed: []ItemError{{Index: 3, Reason: "missing id"}}}
+
+	out := captureOutput(t, &os.Stdout, stats.printSummary)
+	for _, want := range []string{"Synced 5 products in 1.235s", "new:", "malformed:       1", "scrape failures: 1", "upload failures: 1", "failed:          2"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("summary is missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestFailureErrors(t *testing.T) {
+	stats := &SyncStats{}
+	if err := stats.failureErrors(); err != nil {
+		t.Errorf("failureErrors() = %v, want nil without failures", err)
+	}
+	stats.addFailure(ItemError{Index: 0, ID: "sku-1", Reason: "upload failed"})
+	stats.addFailure(ItemError{Index: 4, ID: "sku-5", Reason: "scrape timed out"})
+	err := stats.failureErrors()
+	if err == nil || !strings.Contains(err.Error(), "item 0 (sku-1): upload failed") || !strings.Contains(err.Error(), "item 4 (sku-5)") {
+		t.Errorf("failureErrors() = %v, want both failures", err)
+	}
+}
+
+func TestFailureLimit(t *testing.T) {
+	unlimited := newFailureLimit(0)
+	for i := 0; i < 100; i++ {
+		if err := unlimited.record(); err != nil {
+			t.Fatalf("a zero limit tripped: %v", err)
+		}
+	}
+	limit := newFailureLimit(2)
+	if err := limit.record(); err != nil {
+		t.Fatal(err)
+	}
+	if err := limit.record(); !errors.Is(err, errTooManyFailures) {
+		t.Errorf("second failure = %v, want errTooManyFailures", err)
+	}
+}
+
+func TestProcessFeedFileRecordsFailedItems(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	useSink(t, errSink{err: errors.New("dataset unavailable")})
+	feed := writeTestFeed(t, feedItem("sku-1", "10.00"), feedItem("sku-2", "20.00"))
+
+	stats, err := processFeedFile(context.Background(), db, cfg, feed, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Failed != 2 || stats.UploadFailures != 2 || len(stats.Failures) != 2 {
+		t.Errorf("Failed, UploadFailures, Failures = %d, %d, %v; want 2 of each", stats.Failed, stats.UploadFailures, stats.Failures)
+	}
+	if stats.Duration <= 0 {
+		t.Error("Duration was not recorded")
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// syncRun records which products a full-feed run has finished, scraped and
+// uploaded, in sync_run_items, so a run that dies partway can be resumed
+// without scraping those products again. The resume checkpoint only skips a
+// finished prefix of the feed; this covers the items the workers finished
+// out of order after it.
+type syncRun struct {
+	db *sql.DB
+	id string
+
+	mu   sync.Mutex
+	done map[string]bool
+}
+
+// activeRun is the run being tracked; runSync sets it, and it is nil when the
+// run is not tracked (dry runs, sampling, retries and the changes feed).
+var activeRun *syncRun
+
+// migrateSyncRuns creates the run tracking tables.
+func migrateSyncRuns(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS sync_runs (
+		run_id TEXT PRIMARY KEY,
+		status TEXT NOT NULL,
+		started_at TEXT NOT NULL,
+		finished_at TEXT
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create sync_runs: %v", err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS sync_run_items (
+		run_id TEXT NOT NULL,
+		unique_code TEXT NOT NULL,
+		completed_at TEXT NOT NULL,
+		PRIMARY KEY (run_id, unique_code)
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create sync_run_items: %v", err)
+	}
+	return nil
+}
+
+// startSyncRun returns the run to track. An incomplete run left by an
+// interrupted sync is resumed with -resume, discarded with -new-run, and
+// otherwise resumed only if the user agrees at a terminal.
+func startSyncRun(db *sql.DB, cfg *Config) (*syncRun, error) {
+	var id, startedAt string
+	err := db.QueryRow(`SELECT run_id, started_at FROM sync_runs WHERE status = 'running'
+		ORDER BY started_at DESC LIMIT 1`).Scan(&id, &startedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to look up incomplete runs: %v", err)
+	}
+
+	if err == nil {
+		var finished int
+		err := db.QueryRow(`SELECT COUNT(*) FROM sync_run_items WHERE run_id = ?`, id).Scan(&finished)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read run %s: %v", id, err)
+		}
+		question := fmt.Sprintf("Run %s started at %s was interrupted after %d products. Resume it?", id, startedAt, finished)
+		resume := cfg.Resume
+		if !resume && !cfg.NewRun {
+			if stdinIsTerminal() {
+				resume = confirm(question)
+			} else {
+				infof("Run %s started at %s was interrupted after %d products; starting a new run (use -resume to continue it)", id, startedAt, finished)
+			}
+		}
+		if resume {
+			return resumeSyncRun(db, id, startedAt)
+		}
+		err = writeDB(db, `UPDATE sync_runs SET status = 'abandoned', finished_at = ? WHERE run_id = ?`,
+			time.Now().UTC().Format(time.RFC3339), id)
+		if err == nil {
+			err = writeDB(db, `DELETE FROM sync_run_items WHERE run_id = ?`, id)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to abandon run %s: %v", id, err)
+		}
+	}
+
+	run := &syncRun{db: db, id: newRunID(), done: make(map[string]bool)}
+	err = writeDB(db, `INSERT INTO sync_runs (run_id, status, started_at) VALUES (?, 'running', ?)`,
+		run.id, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record run: %v", err)
+	}
+	return run, nil
+}
+
+// resumeSyncRun loads the products run id already finished.
+func resumeSyncRun(db *sql.DB, id, startedAt string) (*syncRun, error) {
+	rows, err := db.Query(`SELECT unique_code FROM sync_run_items WHERE run_id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run %s: %v", id, err)
+	}
+	defer rows.Close()
+
+	run := &syncRun{db: db, id: id, done: make(map[string]bool)}
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, fmt.Errorf("failed to read run %s: %v", id, err)
+		}
+		run.done[code] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read run %s: %v", id, err)
+	}
+	infof("Resuming run %s started at %s: skipping %d products it already synced", id, startedAt, len(run.done))
+	return run, nil
+}
+
+// completed reports whether uniqueCode was finished earlier in the run.
+func (r *syncRun) completed(uniqueCode string) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.done[uniqueCode]
+}
+
+// markDone records that uniqueCode has been scraped and uploaded.
+func (r *syncRun) markDone(uniqueCode string) {
+	if r == nil {
+		return
+	}
+	err := writeDB(r.db, `INSERT OR IGNORE INTO sync_run_items (run_id, unique_code, completed_at) VALUES (?, ?, ?)`,
+		r.id, uniqueCode, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		warnf("Failed to record %s as synced in run %s: %v", uniqueCode, r.id, err)
+		return
+	}
+	r.mu.Lock()
+	r.done[uniqueCode] = true
+	r.mu.Unlock()
+}
+
+// finish marks the run complete once the whole feed has been processed; its
+// per-product rows are no longer needed.
+func (r *syncRun) finish() {
+	if r == nil {
+		return
+	}
+	err := writeDB(r.db, `UPDATE sync_runs SET status = 'completed', finished_at = ? WHERE run_id = ?`,
+		time.Now().UTC().Format(time.RFC3339), r.id)
+	if err == nil {
+		err = writeDB(r.db, `DELETE FROM sync_run_items WHERE run_id = ?`, r.id)
+	}
+	if err != nil {
+		warnf("Failed to mark run %s complete: %v", r.id, err)
+	}
+}
+
+// stdinIsTerminal reports whether standard input is interactive, so a cron
+// job or daemon is never left waiting on a prompt.
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
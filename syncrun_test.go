@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+// runStatus returns the recorded status of run id.
+func runStatus(t *testing.T, db *sql.DB, id string) string {
+	t.Helper()
+	var status string
+	if err := db.QueryRow(`SELECT status FROM sync_runs WHERE run_id = ?`, id).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestStartSyncRunResumesInterruptedRun(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	interrupted, err := startSyncRun(db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interrupted.markDone("sku-1")
+
+	cfg.Resume = true
+	run, err := startSyncRun(db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.id != interrupted.id || !run.completed("sku-1") || run.completed("sku-2") {
+		t.Errorf("resumed run %s with %v, want %s with sku-1 done", run.id, run.done, interrupted.id)
+	}
+
+	run.finish()
+	if status := runStatus(t, db, run.id); status != "completed" {
+		t.Errorf("status = %q, want completed", status)
+	}
+	cfg.Resume = false
+	next, err := startSyncRun(db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.id == run.id || len(next.done) != 0 {
+		t.Errorf("started %s with %v after a finished run, want a fresh run", next.id, next.done)
+	}
+}
+
+func TestStartSyncRunAbandonsInterruptedRun(t *testing.T) {
+	for _, newRun := range []bool{true, false} {
+		if !newRun && stdinIsTerminal() {
+			// startSyncRun would prompt and wait for an answer.
+			continue
+		}
+		db := newTestDB(t)
+		cfg := newTestConfig(t)
+		interrupted, err := startSyncRun(db, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		interrupted.markDone("sku-1")
+
+		// Without -new-run and no terminal to prompt at, a new run starts too.
+		cfg.NewRun = newRun
+		run, err := startSyncRun(db, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.id == interrupted.id || run.completed("sku-1") {
+			t.Errorf("-new-run %v: resumed the interrupted run", newRun)
+		}
+		if status := runStatus(t, db, interrupted.id); status != "abandoned" {
+			t.Errorf("-new-run %v: interrupted run is %q, want abandoned", newRun, status)
+		}
+		var items int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM sync_run_items`).Scan(&items); err != nil || items != 0 {
+			t.Errorf("-new-run %v: %d run items left, %v", newRun, items, err)
+		}
+	}
+}
+
+func TestProcessFeedFileSkipsProductsTheRunFinished(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	sink := &FakeSink{}
+	useSink(t, sink)
+	run, err := startSyncRun(db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run.markDone("sku-1")
+	activeRun = run
+	feed := writeTestFeed(t, feedItem("sku-1", "10.00"), feedItem("sku-2", "20.00"))
+
+	stats, err := processFeedFile(context.Background(), db, cfg, feed, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Resumed != 1 || stats.New != 1 || len(sink.Calls()) != 1 {
+		t.Errorf("Resumed, New, uploads = %d, %d, %d; want 1, 1, 1", stats.Resumed, stats.New, len(sink.Calls()))
+	}
+	if !run.completed("sku-2") {
+		t.Error("the uploaded product was not marked done")
+	}
+}
+
+func TestNilSyncRunIsUntracked(t *testing.T) {
+	var run *syncRun
+	run.markDone("sku-1")
+	run.finish()
+	if run.completed("sku-1") {
+		t.Error("an untracked run reported a product as done")
+	}
+}
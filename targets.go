@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Indexing techniques accepted by the dataset API.
+const (
+	IndexingHighQuality = "high_quality"
+	IndexingEconomy     = "economy"
+)
+
+// IndexingConfig is the indexing/processing payload sent with every upload.
+type IndexingConfig struct {
+	IndexingTechnique string      `json:"indexing_technique"`
+	ProcessRule       ProcessRule `json:"process_rule"`
+}
+
+// ProcessRule mirrors the API's process_rule object.
+type ProcessRule struct {
+	Rules ProcessRules `json:"rules"`
+	Mode  string       `json:"mode"`
+}
+
+// ProcessRules holds pre-processing and segmentation rules.
+type ProcessRules struct {
+	PreProcessingRules []PreProcessingRule `json:"pre_processing_rules"`
+	Segmentation       Segmentation        `json:"segmentation"`
+}
+
+// PreProcessingRule toggles one of the API's built-in clean-up rules.
+type PreProcessingRule struct {
+	ID      string `json:"id"`
+	Enabled bool   `json:"enabled"`
+}
+
+// Segmentation controls how the API chunks an uploaded document.
+type Segmentation struct {
+	Separator string `json:"separator"`
+	MaxTokens int    `json:"max_tokens"`
+}
+
+// DatasetTarget is a remote dataset documents can be uploaded to, with its
+// own indexing settings (e.g. high_quality for prod, economy for staging).
+type DatasetTarget struct {
+	Name        string          `json:"name"`
+	DatasetGUID string          `json:"dataset_guid"`
+	Indexing    *IndexingConfig `json:"indexing,omitempty"`
+}
+
+// defaultIndexingConfig is the payload used when a target does not set its own.
+func defaultIndexingConfig() IndexingConfig {
+	return IndexingConfig{
+		IndexingTechnique: IndexingHighQuality,
+		ProcessRule: ProcessRule{
+			Mode: "custom",
+			Rules: ProcessRules{
+				PreProcessingRules: []PreProcessingRule{
+					{ID: "remove_extra_spaces", Enabled: true},
+					{ID: "remove_urls_emails", Enabled: false},
+				},
+				Segmentation: Segmentation{Separator: "###", MaxTokens: 1000},
+			},
+		},
+	}
+}
+
+// defaultTarget is the dataset used when no targets are configured.
+func defaultTarget(datasetGUID string) DatasetTarget {
+	return DatasetTarget{Name: "default", DatasetGUID: datasetGUID}
+}
+
+// indexing returns the target's indexing config, or the default one.
+func (t *DatasetTarget) indexing() IndexingConfig {
+	if t.Indexing != nil {
+		return *t.Indexing
+	}
+	return defaultIndexingConfig()
+}
+
+// uploadData is the "data" form field sent with an upload.
+type uploadData struct {
+	IndexingConfig
+	DocMetadata map[string]string `json:"doc_metadata,omitempty"`
+}
+
+// uploadPayload renders the "data" form field for uploads to this target,
+// tagging the document with its source feed when source is set.
+func (t *DatasetTarget) uploadPayload(source string) (string, error) {
+	data := uploadData{IndexingConfig: t.indexing()}
+	if source != "" {
+		data.DocMetadata = map[string]string{"source": source}
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode upload payload for target %s: %v", t.Name, err)
+	}
+	return string(payload), nil
+}
+
+// Validate checks the target's identity and indexing settings.
+func (t *DatasetTarget) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("dataset target has no name")
+	}
+	if t.DatasetGUID == "" {
+		return fmt.Errorf("dataset target %s: dataset_guid is required", t.Name)
+	}
+
+	indexing := t.indexing()
+	switch indexing.IndexingTechnique {
+	case IndexingHighQuality, IndexingEconomy:
+	default:
+		return fmt.Errorf("dataset target %s: indexing_technique must be %s or %s, got %q",
+			t.Name, IndexingHighQuality, IndexingEconomy, indexing.IndexingTechnique)
+	}
+	switch indexing.ProcessRule.Mode {
+	case "automatic", "custom":
+	default:
+		return fmt.Errorf("dataset target %s: process_rule.mode must be automatic or custom, got %q", t.Name, indexing.ProcessRule.Mode)
+	}
+	if indexing.ProcessRule.Mode == "custom" {
+		segmentation := indexing.ProcessRule.Rules.Segmentation
+		if segmentation.Separator == "" {
+			return fmt.Errorf("dataset target %s: segmentation.separator is required in custom mode", t.Name)
+		}
+		if segmentation.MaxTokens <= 0 {
+			return fmt.Errorf("dataset target %s: segmentation.max_tokens must be positive", t.Name)
+		}
+	}
+	return nil
+}
+
+// resolveTarget validates every configured target and returns the one named
+// name, or the first when name is empty. Without configured targets a default
+// target for datasetGUID is used.
+func resolveTarget(targets []DatasetTarget, name, datasetGUID string) (*DatasetTarget, error) {
+	if len(targets) == 0 {
+		targets = []DatasetTarget{defaultTarget(datasetGUID)}
+	}
+
+	seen := make(map[string]bool, len(targets))
+	for i := range targets {
+		if err := targets[i].Validate(); err != nil {
+			return nil, err
+		}
+		if seen[targets[i].Name] {
+			return nil, fmt.Errorf("dataset target %s is defined twice", targets[i].Name)
+		}
+		seen[targets[i].Name] = true
+	}
+
+	if name == "" {
+		return &targets[0], nil
+	}
+	for i := range targets {
+		if targets[i].Name == name {
+			return &targets[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown dataset target %q", name)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestResolveTarget(t *testing.T) {
+	economy := IndexingConfig{
+		IndexingTechnique: IndexingEconomy,
+		ProcessRule:       ProcessRule{Mode: "automatic"},
+	}
+	targets := []DatasetTarget{
+		{Name: "prod", DatasetGUID: "prod-guid"},
+		{Name: "staging", DatasetGUID: "staging-guid", Indexing: &economy},
+	}
+
+	target, err := resolveTarget(targets, "", "")
+	if err != nil || target.Name != "prod" {
+		t.Fatalf("resolveTarget(default) = %+v, %v; want prod", target, err)
+	}
+	target, err = resolveTarget(targets, "staging", "")
+	if err != nil || target.indexing().IndexingTechnique != IndexingEconomy {
+		t.Fatalf("resolveTarget(staging) = %+v, %v; want economy indexing", target, err)
+	}
+	if _, err := resolveTarget(targets, "missing", ""); err == nil {
+		t.Error("resolveTarget accepted an unknown target")
+	}
+	target, err = resolveTarget(nil, "", "legacy-guid")
+	if err != nil || target.DatasetGUID != "legacy-guid" || target.indexing().IndexingTechnique != IndexingHighQuality {
+		t.Errorf("resolveTarget without targets = %+v, %v; want a high_quality default for legacy-guid", target, err)
+	}
+}
+
+func TestDatasetTargetValidate(t *testing.T) {
+	custom := func(separator string, maxTokens int) *IndexingConfig {
+		config := defaultIndexingConfig()
+		config.ProcessRule.Rules.Segmentation = Segmentation{Separator: separator, MaxTokens: maxTokens}
+		return &config
+	}
+	tests := []struct {
+		name   string
+		target DatasetTarget
+		want   string
+	}{
+		{"valid", DatasetTarget{Name: "a", DatasetGUID: "g"}, ""},
+		{"no name", DatasetTarget{DatasetGUID: "g"}, "no name"},
+		{"no guid", DatasetTarget{Name: "a"}, "dataset_guid"},
+		{"technique", DatasetTarget{Name: "a", DatasetGUID: "g", Indexing: &IndexingConfig{IndexingTechnique: "fast", ProcessRule: ProcessRule{Mode: "automatic"}}}, "indexing_technique"},
+		{"mode", DatasetTarget{Name: "a", DatasetGUID: "g", Indexing: &IndexingConfig{IndexingTechnique: IndexingEconomy}}, "process_rule.mode"},
+		{"separator", DatasetTarget{Name: "a", DatasetGUID: "g", Indexing: custom("", 100)}, "separator"},
+		{"max tokens", DatasetTarget{Name: "a", DatasetGUID: "g", Indexing: custom("###", 0)}, "max_tokens"},
+	}
+	for _, tt := range tests {
+		err := tt.target.Validate()
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want one mentioning %q", tt.name, err, tt.want)
+		}
+	}
+
+	duplicated := []DatasetTarget{{Name: "a", DatasetGUID: "g"}, {Name: "a", DatasetGUID: "h"}}
+	if _, err := resolveTarget(duplicated, "", ""); err == nil {
+		t.Error("resolveTarget accepted a target defined twice")
+	}
+}
+
+func TestUploadPayloadUsesTargetIndexing(t *testing.T) {
+	economy := IndexingConfig{IndexingTechnique: IndexingEconomy, ProcessRule: ProcessRule{Mode: "automatic"}}
+	target := DatasetTarget{Name: "staging", DatasetGUID: "g", Indexing: &economy}
+	payload, err := target.uploadPayload("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data uploadData
+	if err := json.Unmarshal([]byte(payload), &data); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+	if data.IndexingTechnique != IndexingEconomy || data.ProcessRule.Mode != "automatic" {
+		t.Errorf("payload indexing = %+v, want the target's economy config", data.IndexingConfig)
+	}
+}
+
+func TestUploadPayloadTagsSource(t *testing.T) {
+	target := defaultTarget("g")
+	for _, source := range []string{"", "warehouse"} {
+		payload, err := target.uploadPayload(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var data uploadData
+		if err := json.Unmarshal([]byte(payload), &data); err != nil {
+			t.Fatalf("payload is not JSON: %v", err)
+		}
+		if got := data.DocMetadata["source"]; got != source {
+			t.Errorf("uploadPayload(%q) tagged source %q", source, got)
+		}
+		if source == "" && strings.Contains(payload, "doc_metadata") {
+			t.Errorf("uploadPayload without a source = %s, want no doc_metadata", payload)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// tempDir receives intermediate files such as feed downloads while they are
+// being written; main sets it from -temp-dir. Empty means os.TempDir, which
+// honors TMPDIR.
+var tempDir string
+
+// tempDirOrDefault is the directory writeViaTemp creates files in.
+func tempDirOrDefault() string {
+	if tempDir != "" {
+		return tempDir
+	}
+	return os.TempDir()
+}
+
+// writeViaTemp streams r into a temporary file in tempDir and moves it to
+// path once it is complete, so a failed write never leaves a truncated file
+// at path. The temporary file is removed on every error path.
+func writeViaTemp(path string, r io.Reader) (err error) {
+	tmp, err := os.CreateTemp(tempDir, "mbsync-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer func() {
+		tmp.Close()
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return moveFile(tmp.Name(), path)
+}
+
+// moveFile renames src to dst. When they are on different filesystems, as a
+// temp volume and the working directory often are, src is copied to
+// <dst>.tmp next to dst and renamed from there, so dst is always either the
+// old file or the complete new one.
+func moveFile(src, dst string) (err error) {
+	err = os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	staged := dst + ".tmp"
+	out, err := os.Create(staged)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		out.Close()
+		if err != nil {
+			os.Remove(staged)
+		}
+	}()
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(staged, dst); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
+
+// lengthCheckedReader fails at EOF when fewer or more than want bytes were
+// read, so a download cut short is never saved as a complete feed. A
+// negative want, an unknown Content-Length, is not checked.
+type lengthCheckedReader struct {
+	r    io.Reader
+	want int64
+	got  int64
+}
+
+func (l *lengthCheckedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.got += int64(n)
+	if err == io.EOF && l.want >= 0 && l.got != l.want {
+		return n, fmt.Errorf("read %d bytes, expected %d from Content-Length", l.got, l.want)
+	}
+	return n, err
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useTempDir makes dir the staging directory for the rest of the test.
+func useTempDir(t *testing.T, dir string) {
+	t.Helper()
+	saved := tempDir
+	t.Cleanup(func() { tempDir = saved })
+	tempDir = dir
+}
+
+func TestWriteViaTempStagesInTempDir(t *testing.T) {
+	staging := t.TempDir()
+	useTempDir(t, staging)
+	path := filepath.Join(t.TempDir(), "feed.xml")
+
+	if err := writeViaTemp(path, strings.NewReader("<rss/>")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "<rss/>" {
+		t.Errorf("file = %q, want <rss/>", got)
+	}
+	if leftovers, _ := os.ReadDir(staging); len(leftovers) != 0 {
+		t.Errorf("staging directory still holds %d files", len(leftovers))
+	}
+}
+
+func TestWriteViaTempKeepsOldFileOnFailure(t *testing.T) {
+	staging := t.TempDir()
+	useTempDir(t, staging)
+	path := filepath.Join(t.TempDir(), "feed.xml")
+	if err := os.WriteFile(path, []byte("previous feed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	broken := io.MultiReader(strings.NewReader("<rss>"), errReader{errors.New("connection reset")})
+	if err := writeViaTemp(path, broken); err == nil {
+		t.Fatal("writeViaTemp() = nil, want the read error")
+	}
+	if got, _ := os.ReadFile(path); string(got) != "previous feed" {
+		t.Errorf("file = %q, want the previous feed untouched", got)
+	}
+	if leftovers, _ := os.ReadDir(staging); len(leftovers) != 0 {
+		t.Errorf("failed write left %d files in the staging directory", len(leftovers))
+	}
+}
+
+// errReader fails every read with err.
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestLengthCheckedReader(t *testing.T) {
+	for _, tt := range []struct {
+		want    int64
+		wantErr bool
+	}{{6, false}, {-1, false}, {10, true}, {3, true}} {
+		_, err := io.ReadAll(&lengthCheckedReader{r: strings.NewReader("<rss/>"), want: tt.want})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("want %d bytes: err = %v, want error %v", tt.want, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDownloadXMLRejectsTruncatedFeed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1000")
+		w.Write([]byte("<rss><channel>"))
+		// Hijacking drops the connection with the body cut short.
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer server.Close()
+	useTempDir(t, t.TempDir())
+	path := filepath.Join(t.TempDir(), "feed.xml")
+	if err := os.WriteFile(path, []byte("previous feed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := downloadXML(context.Background(), server.URL, FeedAuth{Mode: FeedAuthNone}, path, pageValidators{}); err == nil {
+		t.Fatal("downloadXML() = nil, want the truncated download to fail")
+	}
+	if got, _ := os.ReadFile(path); string(got) != "previous feed" {
+		t.Errorf("file = %q, want the previous feed untouched", got)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("staged copy left next to the feed: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// TokenProvider supplies the bearer token for dataset API requests.
+type TokenProvider interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// apiTokens authorizes every dataset API request; main installs the
+// configured provider.
+var apiTokens TokenProvider = staticToken("")
+
+// staticToken is a fixed bearer token.
+type staticToken string
+
+func (t staticToken) Token(context.Context) (string, error) {
+	return string(t), nil
+}
+
+// oauthTokenProvider fetches tokens with the OAuth2 client-credentials grant.
+// Tokens are cached and refreshed shortly before they expire.
+type oauthTokenProvider struct {
+	source oauth2.TokenSource
+}
+
+func (p *oauthTokenProvider) Token(context.Context) (string, error) {
+	token, err := p.source.Token()
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain OAuth2 token: %v", err)
+	}
+	return token.AccessToken, nil
+}
+
+// newTokenProvider returns an OAuth2 client-credentials provider when a token
+// endpoint is configured and the static cfg.AuthToken otherwise.
+func newTokenProvider(cfg *Config) (TokenProvider, error) {
+	if cfg.OAuthTokenURL == "" {
+		if cfg.AuthToken == "" {
+			return nil, fmt.Errorf("no API token: set %s or configure OAuth2 with -oauth-token-url", envAuthToken)
+		}
+		return staticToken(cfg.AuthToken), nil
+	}
+	if cfg.OAuthClientID == "" || cfg.OAuthClientSecret == "" {
+		return nil, fmt.Errorf("OAuth2 token endpoint is set but client ID or secret is missing")
+	}
+
+	credentials := clientcredentials.Config{
+		ClientID:     cfg.OAuthClientID,
+		ClientSecret: cfg.OAuthClientSecret,
+		TokenURL:     cfg.OAuthTokenURL,
+	}
+	if cfg.OAuthScopes != "" {
+		credentials.Scopes = strings.Split(cfg.OAuthScopes, ",")
+	}
+	// The token source outlives any single request, so it gets its own context.
+	return &oauthTokenProvider{source: credentials.TokenSource(context.Background())}, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestNewTokenProviderStatic(t *testing.T) {
+	if _, err := newTokenProvider(&Config{}); err == nil {
+		t.Error("newTokenProvider accepted a config without credentials")
+	}
+	provider, err := newTokenProvider(&Config{AuthToken: "static"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, err := provider.Token(context.Background()); err != nil || token != "static" {
+		t.Errorf("Token() = %q, %v; want static", token, err)
+	}
+	if _, err := newTokenProvider(&Config{OAuthTokenURL: "http://auth.invalid/token", OAuthClientID: "id"}); err == nil {
+		t.Error("newTokenProvider accepted OAuth2 without a client secret")
+	}
+}
+
+func TestOAuthTokenProviderCachesToken(t *testing.T) {
+	var issued int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("scope") != "read write" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		n := atomic.AddInt32(&issued, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":3600}`, n)
+	}))
+	defer server.Close()
+
+	provider, err := newTokenProvider(&Config{
+		OAuthTokenURL:     server.URL,
+		OAuthClientID:     "id",
+		OAuthClientSecret: "secret",
+		OAuthScopes:       "read,write",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if token, err := provider.Token(context.Background()); err != nil || token != "token-1" {
+			t.Fatalf("Token() = %q, %v; want token-1", token, err)
+		}
+	}
+	if n := atomic.LoadInt32(&issued); n != 1 {
+		t.Errorf("token endpoint called %d times, want 1", n)
+	}
+}
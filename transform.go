@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Transform operations supported in TransformRule.Op.
+const (
+	TransformTrimPrefix = "trim-prefix"
+	TransformTrimSuffix = "trim-suffix"
+	TransformTrim       = "trim"
+	TransformReplace    = "replace"
+	TransformUpper      = "upper"
+	TransformLower      = "lower"
+	TransformDefault    = "default"
+)
+
+// TransformRule is one declarative field rewrite applied to every feed item
+// before it is formatted, e.g. {"field":"brand","op":"upper"} or
+// {"field":"image_link","op":"trim-prefix","arg":"http://old-cdn"}.
+// replace substitutes every Arg with With; default sets Arg when the field is empty.
+type TransformRule struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Arg   string `json:"arg,omitempty"`
+	With  string `json:"with,omitempty"`
+}
+
+// Validate checks that the rule names a field and a known operation with the arguments it needs.
+func (r TransformRule) Validate() error {
+	if r.Field == "" {
+		return fmt.Errorf("transform rule %+v: field is required", r)
+	}
+	if r.Field == "id" {
+		return fmt.Errorf("transform rule %+v: the id field cannot be transformed", r)
+	}
+	switch r.Op {
+	case TransformTrim, TransformUpper, TransformLower:
+	case TransformTrimPrefix, TransformTrimSuffix, TransformReplace, TransformDefault:
+		if r.Arg == "" {
+			return fmt.Errorf("transform rule %+v: %s requires arg", r, r.Op)
+		}
+	default:
+		return fmt.Errorf("transform rule %+v: unknown op %q", r, r.Op)
+	}
+	return nil
+}
+
+// apply returns value rewritten by the rule.
+func (r TransformRule) apply(value string) string {
+	switch r.Op {
+	case TransformTrimPrefix:
+		return strings.TrimPrefix(value, r.Arg)
+	case TransformTrimSuffix:
+		return strings.TrimSuffix(value, r.Arg)
+	case TransformTrim:
+		return strings.TrimSpace(value)
+	case TransformReplace:
+		return strings.ReplaceAll(value, r.Arg, r.With)
+	case TransformUpper:
+		return strings.ToUpper(value)
+	case TransformLower:
+		return strings.ToLower(value)
+	case TransformDefault:
+		if strings.TrimSpace(value) == "" {
+			return r.Arg
+		}
+	}
+	return value
+}
+
+// validateTransforms checks every rule, reporting the first invalid one by position.
+func validateTransforms(rules []TransformRule) error {
+	for i, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("transforms[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// normalizeItems applies rules, in order, to every item in place.
+func normalizeItems(items []Item, rules []TransformRule) {
+	if len(rules) == 0 {
+		return
+	}
+	for i := range items {
+		normalizeItem(&items[i], rules)
+	}
+}
+
+// normalizeItem applies rules, in order, to item in place.
+func normalizeItem(item *Item, rules []TransformRule) {
+	for _, rule := range rules {
+		setItemField(item, rule.Field, rule.apply(itemField(*item, rule.Field)))
+	}
+}
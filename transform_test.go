@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestTransformRuleValidate(t *testing.T) {
+	tests := []struct {
+		rule    TransformRule
+		wantErr bool
+	}{
+		{TransformRule{Field: "brand", Op: TransformUpper}, false},
+		{TransformRule{Field: "image_link", Op: TransformTrimPrefix, Arg: "http://old-cdn"}, false},
+		{TransformRule{Op: TransformUpper}, true},
+		{TransformRule{Field: "id", Op: TransformLower}, true},
+		{TransformRule{Field: "brand", Op: TransformReplace}, true},
+		{TransformRule{Field: "brand", Op: "reverse"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.rule.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%+v.Validate() = %v, want error %v", tt.rule, err, tt.wantErr)
+		}
+	}
+	if err := validateTransforms([]TransformRule{{Field: "brand", Op: TransformTrim}, {Field: "brand"}}); err == nil {
+		t.Error("validateTransforms accepted an invalid rule")
+	}
+}
+
+func TestNormalizeItemAppliesRulesInOrder(t *testing.T) {
+	item := Item{
+		ID:        "sku-1",
+		Brand:     "  acme ",
+		ImageLink: "http://old-cdn/img/1.jpg",
+		Extra:     []xmlField{{XMLName: xml.Name{Local: "material"}, Value: "leather-ish"}},
+	}
+	normalizeItem(&item, []TransformRule{
+		{Field: "brand", Op: TransformTrim},
+		{Field: "brand", Op: TransformUpper},
+		{Field: "image_link", Op: TransformTrimPrefix, Arg: "http://old-cdn"},
+		{Field: "image_link", Op: TransformReplace, Arg: "/img/", With: "/images/"},
+		{Field: "material", Op: TransformTrimSuffix, Arg: "-ish"},
+		{Field: "condition", Op: TransformDefault, Arg: "new"},
+		{Field: "season", Op: TransformDefault, Arg: "all"},
+	})
+
+	if item.Brand != "ACME" {
+		t.Errorf("Brand = %q, want ACME", item.Brand)
+	}
+	if item.ImageLink != "/images/1.jpg" {
+		t.Errorf("ImageLink = %q, want /images/1.jpg", item.ImageLink)
+	}
+	if got := itemField(item, "material"); got != "leather" {
+		t.Errorf("material = %q, want leather", got)
+	}
+	if item.Condition != "new" {
+		t.Errorf("Condition = %q, want the default", item.Condition)
+	}
+	if got := itemField(item, "season"); got != "all" {
+		t.Errorf("season = %q, want a new extra field", got)
+	}
+	if item.ID != "sku-1" {
+		t.Errorf("ID = %q, want it unchanged", item.ID)
+	}
+}
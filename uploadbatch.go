@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// uploadResult is the outcome of one file of a batchUpload.
+type uploadResult struct {
+	FilePath   string
+	DocumentID string
+	Err        error
+}
+
+// batchUploader is implemented by sinks that can create several documents in
+// one request.
+type batchUploader interface {
+	// UploadBatch stores each of files as a new document and returns one
+	// result per file, in order. An error means the request as a whole
+	// failed and no result is meaningful.
+	UploadBatch(ctx context.Context, files []string) ([]uploadResult, error)
+}
+
+// batchUpload uploads files through sink as new documents in groups of
+// batchSize and returns one result per file, in the order of files, so a
+// partly failed batch reports which files made it. A sink that implements
+// batchUploader gets one request per batch; a batch it cannot take falls
+// back to single-file uploads, as do other sinks. The single-file uploads of
+// a batch run concurrently and a batch finishes before the next starts, so at
+// most batchSize requests are in flight. A batchSize below one uploads one
+// file at a time.
+func batchUpload(ctx context.Context, sink DocumentSink, files []string, batchSize int) []uploadResult {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	results := make([]uploadResult, 0, len(files))
+	for start := 0; start < len(files); start += batchSize {
+		end := start + batchSize
+		if end > len(files) {
+			end = len(files)
+		}
+		results = append(results, uploadBatch(ctx, sink, files[start:end])...)
+	}
+	return results
+}
+
+// uploadBatch uploads one batch for batchUpload.
+func uploadBatch(ctx context.Context, sink DocumentSink, files []string) []uploadResult {
+	if batcher, ok := sink.(batchUploader); ok && len(files) > 1 {
+		results, err := batcher.UploadBatch(ctx, files)
+		if err == nil && len(results) == len(files) {
+			return results
+		}
+		if err == nil {
+			warnf("Batch upload of %d files returned %d results; uploading them one by one", len(files), len(results))
+		} else {
+			warnf("Batch upload of %d files failed: %v; uploading them one by one", len(files), err)
+		}
+	}
+
+	results := make([]uploadResult, len(files))
+	var wg sync.WaitGroup
+	for i, filePath := range files {
+		i, filePath := i, filePath
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			documentID, err := sink.Upload(ctx, filePath)
+			results[i] = uploadResult{FilePath: filePath, DocumentID: documentID, Err: err}
+		}()
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// batchSink is a FakeSink that also takes batches. Files whose name contains
+// failName fail, in a batch or alone, and a batch containing rejectName is
+// refused as a whole.
+type batchSink struct {
+	FakeSink
+	failName, rejectName string
+
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (s *batchSink) Upload(ctx context.Context, filePath string) (string, error) {
+	if s.failName != "" && strings.Contains(filePath, s.failName) {
+		return "", errors.New("422 Unprocessable Entity")
+	}
+	return s.FakeSink.Upload(ctx, filePath)
+}
+
+func (s *batchSink) UploadBatch(ctx context.Context, files []string) ([]uploadResult, error) {
+	s.mu.Lock()
+	s.batches = append(s.batches, files)
+	s.mu.Unlock()
+	for _, filePath := range files {
+		if s.rejectName != "" && strings.Contains(filePath, s.rejectName) {
+			return nil, errors.New("413 Request Entity Too Large")
+		}
+	}
+	results := make([]uploadResult, len(files))
+	for i, filePath := range files {
+		documentID, err := s.Upload(ctx, filePath)
+		results[i] = uploadResult{FilePath: filePath, DocumentID: documentID, Err: err}
+	}
+	return results, nil
+}
+
+// writeDocuments writes n document files and returns their paths.
+func writeDocuments(t *testing.T, n int) []string {
+	t.Helper()
+	dir := t.TempDir()
+	files := make([]string, n)
+	for i := range files {
+		files[i] = filepath.Join(dir, fmt.Sprintf("Prod_sku-%d.txt", i+1))
+		if err := os.WriteFile(files[i], []byte(fmt.Sprintf("[TITLE] Product %d", i+1)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+func TestBatchUpload(t *testing.T) {
+	tests := []struct {
+		name                 string
+		files, batchSize     int
+		failName, rejectName string
+		wantBatches          []int
+		wantFailed           []int
+	}{
+		{name: "full batches", files: 4, batchSize: 2, wantBatches: []int{2, 2}},
+		{name: "partial last batch", files: 5, batchSize: 2, wantBatches: []int{2, 2}},
+		{name: "partly failed batch", files: 3, batchSize: 3, failName: "sku-2.", wantBatches: []int{3}, wantFailed: []int{1}},
+		{name: "failed batch falls back to single uploads", files: 4, batchSize: 2, rejectName: "sku-3.", wantBatches: []int{2, 2}},
+		{name: "single-file path", files: 2, batchSize: 0, failName: "sku-1.", wantFailed: []int{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &batchSink{failName: tt.failName, rejectName: tt.rejectName}
+			files := writeDocuments(t, tt.files)
+
+			results := batchUpload(context.Background(), sink, files, tt.batchSize)
+			if len(results) != len(files) {
+				t.Fatalf("got %d results for %d files", len(results), len(files))
+			}
+			failed := map[int]bool{}
+			for _, i := range tt.wantFailed {
+				failed[i] = true
+			}
+			for i, result := range results {
+				if result.FilePath != files[i] {
+					t.Errorf("result %d is for %s, want %s", i, result.FilePath, files[i])
+				}
+				if gotFailed := result.Err != nil; gotFailed != failed[i] {
+					t.Errorf("result %d error = %v, want failed %v", i, result.Err, failed[i])
+				}
+				if result.Err == nil && result.DocumentID == "" {
+					t.Errorf("result %d has no document ID", i)
+				}
+			}
+			var sizes []int
+			for _, batch := range sink.batches {
+				sizes = append(sizes, len(batch))
+			}
+			if fmt.Sprint(sizes) != fmt.Sprint(tt.wantBatches) {
+				t.Errorf("batch requests of sizes %v, want %v", sizes, tt.wantBatches)
+			}
+			if want := len(files) - len(tt.wantFailed); len(sink.Documents()) != want {
+				t.Errorf("stored %d documents, want %d", len(sink.Documents()), want)
+			}
+		})
+	}
+}
+
+func TestBatchUploadWithoutBatchSupport(t *testing.T) {
+	sink := &FakeSink{}
+	files := writeDocuments(t, 3)
+
+	results := batchUpload(context.Background(), sink, files, 2)
+	for i, result := range results {
+		if result.Err != nil || result.DocumentID == "" {
+			t.Errorf("result %d = %+v, want an uploaded document", i, result)
+		}
+	}
+	if calls := sink.Calls(); len(calls) != 3 {
+		t.Errorf("sink calls = %v, want one upload per file", calls)
+	}
+}
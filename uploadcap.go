@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// uploadLimiter caps the number of uploads a single run may perform so a
+// runaway feed cannot exhaust the API quota. A max of 0 disables the cap.
+type uploadLimiter struct {
+	max  int64
+	used int64
+}
+
+// uploadCap is the process-wide limiter; main sets its max from -max-uploads.
+var uploadCap = &uploadLimiter{}
+
+// formatMigrations throttles how many outdated documents a run re-uploads after
+// a document format version bump; main sets its max from -format-migrate-max.
+var formatMigrations = &uploadLimiter{}
+
+// errUploadCapReached is returned by processItem when the upload was skipped
+// because the run already performed -max-uploads uploads.
+var errUploadCapReached = errors.New("upload cap reached")
+
+// reserve claims one upload slot and reports whether one was available.
+func (l *uploadLimiter) reserve() bool {
+	if l.max <= 0 {
+		return true
+	}
+	if atomic.AddInt64(&l.used, 1) > l.max {
+		atomic.AddInt64(&l.used, -1)
+		return false
+	}
+	return true
+}
+
+// reached reports whether every slot has been claimed.
+func (l *uploadLimiter) reached() bool {
+	return l.max > 0 && atomic.LoadInt64(&l.used) >= l.max
+}
+
+// reset releases every claimed slot, for the next run in -interval mode.
+func (l *uploadLimiter) reset() {
+	atomic.StoreInt64(&l.used, 0)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUploadLimiter(t *testing.T) {
+	limiter := &uploadLimiter{max: 2}
+	if !limiter.reserve() || !limiter.reserve() {
+		t.Fatal("reserve() refused a slot under the cap")
+	}
+	if limiter.reserve() {
+		t.Error("reserve() granted a slot over the cap")
+	}
+	if !limiter.reached() {
+		t.Error("reached() = false with every slot claimed")
+	}
+	limiter.reset()
+	if limiter.reached() || !limiter.reserve() {
+		t.Error("reset() did not release the slots")
+	}
+
+	unlimited := &uploadLimiter{}
+	for i := 0; i < 10; i++ {
+		if !unlimited.reserve() {
+			t.Fatal("a limiter without a max refused a slot")
+		}
+	}
+}
+
+func TestProcessFeedFileStopsAtUploadCap(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	cfg.Workers = 1
+	sink := &FakeSink{}
+	useSink(t, sink)
+	storeProduct(t, db, Product{UniqueCode: "sku-3", Status: "existing", DocumentID: "doc-3"})
+	uploadCap.max = 1
+	feed := writeTestFeed(t, feedItem("sku-1", "10.00"), feedItem("sku-2", "20.00"), feedItem("sku-3", "30.00"))
+
+	stats, err := processFeedFile(context.Background(), db, cfg, feed, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := sink.Calls(); len(calls) != 1 {
+		t.Errorf("sink calls = %v, want one upload", calls)
+	}
+	if stats.MarkedDeleted != 0 {
+		t.Errorf("MarkedDeleted = %d; items past the cap were treated as removed", stats.MarkedDeleted)
+	}
+	if stored, ok := loadProduct(t, db, "sku-3"); !ok || stored.Status == "deleted" {
+		t.Errorf("sku-3 = %+v, %v; want it kept", stored, ok)
+	}
+}
+
+func TestWorkerMigratesOutdatedDocumentsUpToTheCap(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	cfg.Workers = 1
+	sink := &FakeSink{}
+	useSink(t, sink)
+	feed := writeTestFeed(t, feedItem("sku-1", "10.00"), feedItem("sku-2", "20.00"))
+	if _, err := processFeedFile(context.Background(), db, cfg, feed, "", 0); err != nil {
+		t.Fatal(err)
+	}
+	uploaded := map[string]string{}
+	for _, code := range []string{"sku-1", "sku-2"} {
+		stored, _ := loadProduct(t, db, code)
+		uploaded[code] = stored.DocumentID
+	}
+
+	cfg.FormatVersion = documentFormatVersion + 1
+	formatMigrations.max = 1
+	stats, err := processFeedFile(context.Background(), db, cfg, feed, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Migrated != 1 || stats.Existing != 2 {
+		t.Errorf("Migrated, Existing = %d, %d; want one of two unchanged products migrated", stats.Migrated, stats.Existing)
+	}
+	updates := sink.Calls()[len(uploaded):]
+	if len(updates) != 1 || updates[0].Method != "Update" {
+		t.Fatalf("sink calls after the version bump = %+v, want one update", updates)
+	}
+	migrated := 0
+	for code, documentID := range uploaded {
+		stored, _ := loadProduct(t, db, code)
+		if stored.DocumentID != documentID {
+			t.Errorf("%s document = %s, want %s kept", code, stored.DocumentID, documentID)
+		}
+		if stored.FormatVersion == cfg.FormatVersion {
+			migrated++
+			if updates[0].DocumentID != documentID {
+				t.Errorf("updated %s, want %s of the migrated %s", updates[0].DocumentID, documentID, code)
+			}
+		}
+	}
+	if migrated != 1 {
+		t.Errorf("%d products at format version %d, want 1", migrated, cfg.FormatVersion)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Values of products.upload_status.
+const (
+	uploadPending  = "pending"
+	uploadUploaded = "uploaded"
+	uploadFailed   = "failed"
+)
+
+// setUploadStatus records the upload state of a product of feed feedID with retry logic.
+func setUploadStatus(db *sql.DB, feedID, uniqueCode, status string) error {
+	query := `UPDATE products SET upload_status = ? WHERE feed_id = ? AND unique_code = ?`
+	return writeDB(db, query, status, feedID, uniqueCode)
+}
+
+// setFormatVersion stamps a product of feed feedID with the document format version it was
+// last uploaded with.
+func setFormatVersion(db *sql.DB, feedID, uniqueCode string, version int) error {
+	query := `UPDATE products SET format_version = ? WHERE feed_id = ? AND unique_code = ?`
+	return writeDB(db, query, version, feedID, uniqueCode)
+}
+
+// setContentHash records the hash of the document last uploaded for a product
+// of feed feedID.
+func setContentHash(db *sql.DB, feedID, uniqueCode, hash string) error {
+	return writeDB(db, `UPDATE products SET content_hash = ? WHERE feed_id = ? AND unique_code = ?`, hash, feedID, uniqueCode)
+}
+
+// setImagePath records the local copy of the image of a product of feed feedID.
+func setImagePath(db *sql.DB, feedID, uniqueCode, path string) error {
+	return writeDB(db, `UPDATE products SET image_path = ? WHERE feed_id = ? AND unique_code = ?`, path, feedID, uniqueCode)
+}
+
+// setIndexingStatus records the indexing state of the document of a product
+// of feed feedID.
+func setIndexingStatus(db *sql.DB, feedID, uniqueCode, status string) error {
+	return writeDB(db, `UPDATE products SET indexing_status = ? WHERE feed_id = ? AND unique_code = ?`, status, feedID, uniqueCode)
+}
+
+// uploadItem runs processItem for item, or for rendered when it is not nil,
+// updating documentID in place when it is set, and tracks the outcome in upload_status: pending while in flight or
+// deferred, uploaded on success and failed once the upload gave up. The ID of
+// the uploaded document is stored in document_id, the path of its
+// downloaded image in image_path and, with -wait-indexing, its indexing state
+// in indexing_status; a document the API failed to index counts as failed.
+func uploadItem(ctx context.Context, db *sql.DB, cfg *Config, stats *SyncStats, item Item, rendered *renderedDocument, documentID string) error {
+	if err := setUploadStatus(db, cfg.FeedID, item.ID, uploadPending); err != nil {
+		return fmt.Errorf("failed to mark %s as pending: %v", item.ID, err)
+	}
+
+	uploaded, err := processItem(ctx, cfg, stats, item, rendered, documentID)
+	if err == nil && uploaded.DocumentID != "" {
+		if idErr := setDocumentID(db, cfg.FeedID, item.ID, uploaded.DocumentID); idErr != nil {
+			warnf("Failed to record document ID for %s: %v", item.ID, idErr)
+		}
+	}
+	// A document that fails to index keeps its ID but not its content hash,
+	// so the next run replaces it.
+	if err == nil {
+		err = waitForIndexing(ctx, db, cfg, item.ID, uploaded.DocumentID)
+	}
+	status := uploadUploaded
+	switch {
+	case errors.Is(err, errDeferred), errors.Is(err, errUploadCapReached):
+		status = uploadPending
+	case err != nil:
+		status = uploadFailed
+	}
+
+	if err == nil {
+		if versionErr := setFormatVersion(db, cfg.FeedID, item.ID, cfg.FormatVersion); versionErr != nil {
+			warnf("Failed to record format version for %s: %v", item.ID, versionErr)
+		}
+	}
+	if err == nil && uploaded.ContentHash != "" {
+		if hashErr := setContentHash(db, cfg.FeedID, item.ID, uploaded.ContentHash); hashErr != nil {
+			warnf("Failed to record content hash for %s: %v", item.ID, hashErr)
+		}
+	}
+	if err == nil && uploaded.ImagePath != "" {
+		if imageErr := setImagePath(db, cfg.FeedID, item.ID, uploaded.ImagePath); imageErr != nil {
+			warnf("Failed to record image path for %s: %v", item.ID, imageErr)
+		}
+	}
+	if statusErr := setUploadStatus(db, cfg.FeedID, item.ID, status); statusErr != nil {
+		warnf("Failed to record upload status %s for %s: %v", status, item.ID, statusErr)
+	}
+	return err
+}
+
+// printUploadStats prints the number of products per status and upload_status.
+func printUploadStats(db *sql.DB) error {
+	rows, err := db.Query(`SELECT status, upload_status, COUNT(*) FROM products GROUP BY status, upload_status ORDER BY status, upload_status`)
+	if err != nil {
+		return fmt.Errorf("failed to query product statistics: %v", err)
+	}
+	defer rows.Close()
+
+	fmt.Printf("%-10s %-10s %s\n", "STATUS", "UPLOAD", "COUNT")
+	for rows.Next() {
+		var status, uploadStatus string
+		var count int
+		if err := rows.Scan(&status, &uploadStatus, &count); err != nil {
+			return fmt.Errorf("failed to read product statistics: %v", err)
+		}
+		fmt.Printf("%-10s %-10s %d\n", status, uploadStatus, count)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestUploadItemTracksUploadStatus(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	useSink(t, &FakeSink{})
+	storeProduct(t, db, Product{UniqueCode: "sku-1", Status: "new"})
+	storeProduct(t, db, Product{UniqueCode: "sku-2", Status: "new"})
+
+	if err := uploadItem(context.Background(), db, cfg, &SyncStats{}, Item{ID: "sku-1", Title: "Product", Price: 100}, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if status := storedUploadStatus(t, db, "sku-1"); status != uploadUploaded {
+		t.Errorf("upload_status after an upload = %q, want %q", status, uploadUploaded)
+	}
+
+	cfg.MinContentLength = 100000
+	if err := uploadItem(context.Background(), db, cfg, &SyncStats{}, Item{ID: "sku-2", Title: "Product", Price: 100}, nil, ""); err == nil {
+		t.Fatal("uploadItem() = nil, want the item deferred")
+	}
+	if status := storedUploadStatus(t, db, "sku-2"); status != uploadPending {
+		t.Errorf("upload_status of a deferred item = %q, want %q", status, uploadPending)
+	}
+}
+
+func TestPrintUploadStats(t *testing.T) {
+	db := newTestDB(t)
+	storeProduct(t, db, Product{UniqueCode: "sku-1", Status: "existing"})
+	storeProduct(t, db, Product{UniqueCode: "sku-2", Status: "existing"})
+	if err := setUploadStatus(db, "", "sku-2", uploadFailed); err != nil {
+		t.Fatal(err)
+	}
+
+	var err error
+	out := captureOutput(t, &os.Stdout, func() { err = printUploadStats(db) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"existing   failed     1", "existing   pending    1"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("stats output %q is missing %q", out, line)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+// Variant is one feed item folded into a product group.
+type Variant struct {
+	ID           string       `json:"id"`
+	Size         string       `json:"size,omitempty"`
+	Color        string       `json:"color,omitempty"`
+	Price        Money        `json:"price"`
+	Availability Availability `json:"availability,omitempty"`
+}
+
+// groupVariants folds items sharing the same groupField value into one item
+// per group. The group item takes the group ID as its unique code, the lowest
+// variant price as Price and the highest as PriceMax, and lists every variant.
+// Items without a group value and single-item groups are returned unchanged.
+// Feed order is preserved by first appearance.
+func groupVariants(items []Item, groupField string) []Item {
+	groups := make(map[string][]Item)
+	var order []string
+	var grouped []Item
+
+	for _, item := range items {
+		groupID := itemField(item, groupField)
+		if groupID == "" {
+			order = append(order, "")
+			grouped = append(grouped, item)
+			continue
+		}
+		if _, seen := groups[groupID]; !seen {
+			order = append(order, groupID)
+			grouped = append(grouped, Item{})
+		}
+		groups[groupID] = append(groups[groupID], item)
+	}
+
+	for i, groupID := range order {
+		if groupID == "" {
+			continue
+		}
+		members := groups[groupID]
+		if len(members) == 1 {
+			grouped[i] = members[0]
+			continue
+		}
+		grouped[i] = mergeVariants(groupID, members)
+	}
+	return grouped
+}
+
+// mergeVariants builds the group item for members.
+func mergeVariants(groupID string, members []Item) Item {
+	merged := members[0]
+	merged.ID = groupID
+	merged.Price = members[0].Price
+	merged.PriceMax = members[0].Price
+	merged.Inventory = 0
+	merged.Variants = make([]Variant, 0, len(members))
+
+	for _, member := range members {
+		if member.Price < merged.Price {
+			merged.Price = member.Price
+		}
+		if member.Price > merged.PriceMax {
+			merged.PriceMax = member.Price
+		}
+		if member.Availability == AvailabilityInStock {
+			merged.Availability = member.Availability
+		}
+		merged.Inventory += member.Inventory
+		merged.Variants = append(merged.Variants, Variant{
+			ID:           member.ID,
+			Size:         member.Size,
+			Color:        member.Color,
+			Price:        member.Price,
+			Availability: member.Availability,
+		})
+	}
+	return merged
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGroupVariants(t *testing.T) {
+	items := []Item{
+		{ID: "shirt-s", ItemGroupID: "shirt", Title: "Shirt", Size: "S", Color: "blue", Price: 1500, Inventory: 2, Availability: AvailabilityOutOfStock},
+		{ID: "mug", Title: "Mug", Price: 500},
+		{ID: "shirt-m", ItemGroupID: "shirt", Title: "Shirt", Size: "M", Color: "blue", Price: 1200, Inventory: 3, Availability: AvailabilityInStock},
+		{ID: "hat-1", ItemGroupID: "hat", Title: "Hat", Price: 900},
+		{ID: "shirt-l", ItemGroupID: "shirt", Title: "Shirt", Size: "L", Price: 1800},
+	}
+
+	grouped := groupVariants(items, "item_group_id")
+	var ids []string
+	for _, item := range grouped {
+		ids = append(ids, item.ID)
+	}
+	if want := []string{"shirt", "mug", "hat-1"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("grouped IDs = %v, want %v in order of first appearance", ids, want)
+	}
+
+	shirt := grouped[0]
+	if shirt.Price != 1200 || shirt.PriceMax != 1800 || shirt.Inventory != 5 || shirt.Availability != AvailabilityInStock {
+		t.Errorf("shirt price %s-%s, inventory %d, availability %q; want 12.00-18.00, 5, in_stock",
+			shirt.Price, shirt.PriceMax, shirt.Inventory, shirt.Availability)
+	}
+	wantVariants := []Variant{
+		{ID: "shirt-s", Size: "S", Color: "blue", Price: 1500, Availability: AvailabilityOutOfStock},
+		{ID: "shirt-m", Size: "M", Color: "blue", Price: 1200, Availability: AvailabilityInStock},
+		{ID: "shirt-l", Size: "L", Price: 1800},
+	}
+	if !reflect.DeepEqual(shirt.Variants, wantVariants) {
+		t.Errorf("variants = %+v, want %+v", shirt.Variants, wantVariants)
+	}
+	if grouped[1].Variants != nil || grouped[2].Variants != nil {
+		t.Error("an ungrouped or single-item group gained variants")
+	}
+}
+
+func TestVariantsRenderInDocument(t *testing.T) {
+	grouped := groupVariants([]Item{
+		{ID: "shirt-s", ItemGroupID: "shirt", Title: "Shirt", Size: "S", Price: 1500},
+		{ID: "shirt-m", ItemGroupID: "shirt", Title: "Shirt", Size: "M", Color: "red", Price: 1200, Availability: AvailabilityInStock},
+	}, "item_group_id")
+
+	var doc strings.Builder
+	if err := documentTemplate.Execute(&doc, newDocumentData(grouped[0], nil)); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"[PRICE RANGE] 12.00 - 15.00\n", "- shirt-s: size S, 15.00\n", "- shirt-m: size M, color red, 12.00, in_stock\n"} {
+		if !strings.Contains(doc.String(), want) {
+			t.Errorf("document lacks %q:\n%s", want, doc.String())
+		}
+	}
+}
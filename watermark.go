@@ -0,0 +1,135 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const itemWatermarkMetaKey = "item_watermark"
+
+// itemTimeLayouts are the accepted formats of a feed item's update time.
+var itemTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// itemWatermark implements -since: items whose update time is not after the
+// stored watermark are skipped without being scraped. Items without a
+// parseable time are always synced and compared by price and content hash as
+// usual. The watermark only moves past items that synced, so a failed item is
+// retried on the next run.
+type itemWatermark struct {
+	field string
+	since time.Time
+
+	mu           sync.Mutex
+	newest       time.Time
+	oldestFailed time.Time
+	stamped      int
+}
+
+// feedWatermark is the watermark of the current run; runSync sets it, and it
+// is nil without -since.
+var feedWatermark *itemWatermark
+
+// loadWatermark returns the watermark for cfg.SinceField. With -full every
+// item is synced, but the watermark still advances.
+func loadWatermark(db *sql.DB, cfg *Config) (*itemWatermark, error) {
+	if cfg.SinceField == "" {
+		return nil, nil
+	}
+	w := &itemWatermark{field: cfg.SinceField}
+	value, ok, err := getMeta(db, feedMetaKey(itemWatermarkMetaKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the item watermark: %v", err)
+	}
+	if ok && !cfg.Full {
+		w.since, err = time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid item watermark %q: %v", value, err)
+		}
+		infof("Skipping items whose %s is not after %s", w.field, value)
+	}
+	return w, nil
+}
+
+// itemTime parses the feed element field of item as an update time.
+func itemTime(item Item, field string) (time.Time, bool) {
+	value := strings.TrimSpace(itemField(item, field))
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range itemTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	debugf("Item %s has an unparseable %s %q; syncing it", item.ID, field, value)
+	return time.Time{}, false
+}
+
+// unmodified records item's update time and reports whether it is not after
+// the watermark, so the item can be skipped.
+func (w *itemWatermark) unmodified(item Item) bool {
+	if w == nil {
+		return false
+	}
+	t, ok := itemTime(item, w.field)
+	if !ok {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stamped++
+	if t.After(w.newest) {
+		w.newest = t
+	}
+	return !w.since.IsZero() && !t.After(w.since)
+}
+
+// failed records that item did not sync, holding the watermark below it.
+func (w *itemWatermark) failed(item Item) {
+	if w == nil {
+		return
+	}
+	t, ok := itemTime(item, w.field)
+	if !ok {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.oldestFailed.IsZero() || t.Before(w.oldestFailed) {
+		w.oldestFailed = t
+	}
+}
+
+// next returns the watermark to store after the run: the newest update time
+// seen, held just below the oldest failed item. ok is false when it would not
+// move forward.
+func (w *itemWatermark) next() (time.Time, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	mark := w.newest
+	if !w.oldestFailed.IsZero() && !mark.Before(w.oldestFailed) {
+		mark = w.oldestFailed.Add(-time.Nanosecond)
+	}
+	return mark, mark.After(w.since)
+}
+
+// save stores the advanced watermark once the whole feed has been processed.
+func (w *itemWatermark) save(db *sql.DB) {
+	if w == nil {
+		return
+	}
+	if w.stamped == 0 {
+		infof("No feed item has a parseable %s; every item was compared by price and content", w.field)
+		return
+	}
+	mark, ok := w.next()
+	if !ok {
+		return
+	}
+	if err := setMeta(db, feedMetaKey(itemWatermarkMetaKey), mark.UTC().Format(time.RFC3339Nano)); err != nil {
+		warnf("Failed to save the item watermark: %v", err)
+	}
+}
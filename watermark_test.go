@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+// stampedItem returns a feed item whose updated element is at.
+func stampedItem(id, at string) Item {
+	return Item{ID: id, Extra: []xmlField{{XMLName: xml.Name{Local: "updated"}, Value: at}}}
+}
+
+func TestItemTime(t *testing.T) {
+	want := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+	for _, value := range []string{"2026-03-01T12:30:00Z", "2026-03-01T12:30:00", " 2026-03-01 12:30:00 "} {
+		if got, ok := itemTime(stampedItem("sku-1", value), "updated"); !ok || !got.Equal(want) {
+			t.Errorf("itemTime(%q) = %s, %v; want %s", value, got, ok, want)
+		}
+	}
+	for _, value := range []string{"", "yesterday"} {
+		if _, ok := itemTime(stampedItem("sku-1", value), "updated"); ok {
+			t.Errorf("itemTime(%q) parsed", value)
+		}
+	}
+}
+
+func TestItemWatermarkAdvancesBelowFailures(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	cfg.SinceField = "updated"
+	w, err := loadWatermark(db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range []Item{stampedItem("sku-1", "2026-03-01"), stampedItem("sku-2", "2026-03-03"), stampedItem("sku-3", "2026-03-05")} {
+		if w.unmodified(item) {
+			t.Errorf("%s skipped without a stored watermark", item.ID)
+		}
+	}
+	w.failed(stampedItem("sku-2", "2026-03-03"))
+	w.save(db)
+
+	w, err = loadWatermark(db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond); !w.since.Equal(want) {
+		t.Errorf("stored watermark %s, want just before the failed item at %s", w.since, want)
+	}
+	if !w.unmodified(stampedItem("sku-1", "2026-03-01")) || w.unmodified(stampedItem("sku-2", "2026-03-03")) {
+		t.Error("watermark skipped the wrong items")
+	}
+	if w.unmodified(Item{ID: "sku-4"}) {
+		t.Error("an item without an update time was skipped")
+	}
+
+	cfg.Full = true
+	if w, err = loadWatermark(db, cfg); err != nil || !w.since.IsZero() {
+		t.Errorf("-full loaded watermark %v, %v; want none", w, err)
+	}
+	cfg.SinceField = ""
+	if w, err = loadWatermark(db, cfg); err != nil || w != nil {
+		t.Errorf("without -since loaded %v, %v; want nil", w, err)
+	}
+}
+
+func TestProcessFeedFileSkipsUnmodifiedItems(t *testing.T) {
+	db := newTestDB(t)
+	cfg := newTestConfig(t)
+	sink := &FakeSink{}
+	useSink(t, sink)
+	cfg.SinceField = "updated"
+	if err := setMeta(db, feedMetaKey(itemWatermarkMetaKey), "2026-03-02T00:00:00Z"); err != nil {
+		t.Fatal(err)
+	}
+	w, err := loadWatermark(db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feedWatermark = w
+	feed := writeTestFeed(t,
+		`<item><id>sku-1</id><title>Old</title><price>1.00</price><updated>2026-03-01</updated></item>`,
+		`<item><id>sku-2</id><title>New</title><price>2.00</price><updated>2026-03-04</updated></item>`)
+
+	stats, err := processFeedFile(context.Background(), db, cfg, feed, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.NotModified != 1 || stats.New != 1 || len(sink.Calls()) != 1 {
+		t.Errorf("NotModified, New, uploads = %d, %d, %d; want 1, 1, 1", stats.NotModified, stats.New, len(sink.Calls()))
+	}
+}